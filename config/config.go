@@ -23,12 +23,16 @@ type Config struct {
 	// OAuth配置
 	ClientID     string
 	ClientSecret string
+	// 环境变量配置的SSO客户端允许的回调地址，管理后台未注册同名客户端时使用
+	SSORedirectURIs []string
 
 	// JWT配置
 	JWTSecret string
 
 	// Token过期时间（小时）
 	AccessTokenExpireHours int
+	// 刷新令牌过期时间（天），刷新令牌在有效期内未使用则设备需重新登录
+	RefreshTokenExpireDays int
 	// 设备码过期时间（分钟）
 	DeviceCodeExpireMinutes int
 
@@ -69,6 +73,12 @@ type Config struct {
 	LinuxDoClientID     string
 	LinuxDoClientSecret string
 	LinuxDoBaseURL      string
+
+	// GitHub / Google OAuth配置，未配置时不显示对应登录方式
+	GitHubClientID     string
+	GitHubClientSecret string
+	GoogleClientID     string
+	GoogleClientSecret string
 	
 	// 前端域名配置
 	FrontendURL         string
@@ -77,6 +87,16 @@ type Config struct {
 	InstallCommand string
 	DocsURL        string
 	ClaudeURL      string
+
+	// 支付配置
+	PaymentMockEnabled  bool   // 是否启用本地模拟支付渠道（仅用于测试）
+	PaymentMockSecret   string // 模拟支付回调签名密钥
+	StripeSecretKey     string
+	StripeWebhookSecret string
+
+	// 通行密钥（WebAuthn）配置，为空时使用前端域名
+	WebAuthnRPID    string
+	WebAuthnOrigins []string
 }
 
 var AppConfig *Config
@@ -99,11 +119,14 @@ func LoadConfig() {
 		DBName:     getEnv("DB_NAME", ""),
 
 		// OAuth配置
-		ClientID:     getEnv("OAUTH_CLIENT_ID", ""),
-		ClientSecret: getEnv("OAUTH_CLIENT_SECRET", ""),
+		ClientID:        getEnv("OAUTH_CLIENT_ID", ""),
+		ClientSecret:    getEnv("OAUTH_CLIENT_SECRET", ""),
+		SSORedirectURIs: getEnvAsSlice("OAUTH_REDIRECT_URIS", []string{}),
 
 		// JWT配置
-		JWTSecret: getEnv("JWT_SECRET_KEY", ""),
+		JWTSecret:              getEnv("JWT_SECRET_KEY", ""),
+		AccessTokenExpireHours: getEnvAsInt("ACCESS_TOKEN_EXPIRE_HOURS", 2),
+		RefreshTokenExpireDays: getEnvAsInt("REFRESH_TOKEN_EXPIRE_DAYS", 30),
 
 		// New API配置
 		NewAPIEndpoint: getEnv("NEW_API_ENDPOINT", ""),
@@ -142,6 +165,12 @@ func LoadConfig() {
 		LinuxDoClientID:     getEnv("LINUX_DO_CLIENT_ID", ""),
 		LinuxDoClientSecret: getEnv("LINUX_DO_CLIENT_SECRET", ""),
 		LinuxDoBaseURL:      getEnv("LINUX_DO_BASE_URL", "https://connect.linux.do"),
+
+		// GitHub / Google OAuth配置
+		GitHubClientID:     getEnv("GITHUB_CLIENT_ID", ""),
+		GitHubClientSecret: getEnv("GITHUB_CLIENT_SECRET", ""),
+		GoogleClientID:     getEnv("GOOGLE_CLIENT_ID", ""),
+		GoogleClientSecret: getEnv("GOOGLE_CLIENT_SECRET", ""),
 		
 		// 前端域名配置
 		FrontendURL:         getEnv("FRONTEND_URL", "https://www.duckcode.top"),
@@ -150,6 +179,16 @@ func LoadConfig() {
 		InstallCommand: getEnv("INSTALL_COMMAND", "npm install -g http://111.180.197.234:7778/install --registry=https://registry.npmmirror.com"),
 		DocsURL:        getEnv("DOCS_URL", "https://github.com/anthropics/claude-code"),
 		ClaudeURL:      getEnv("CLAUDE_URL", "https://api.anthropic.com"),
+
+		// 支付配置
+		PaymentMockEnabled:  getEnvAsBool("PAYMENT_MOCK_ENABLED", false),
+		PaymentMockSecret:   getEnv("PAYMENT_MOCK_SECRET", ""),
+		StripeSecretKey:     getEnv("STRIPE_SECRET_KEY", ""),
+		StripeWebhookSecret: getEnv("STRIPE_WEBHOOK_SECRET", ""),
+
+		// 通行密钥（WebAuthn）配置
+		WebAuthnRPID:    getEnv("WEBAUTHN_RP_ID", ""),
+		WebAuthnOrigins: getEnvAsSlice("WEBAUTHN_ORIGINS", []string{}),
 	}
 }
 
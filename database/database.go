@@ -86,6 +86,27 @@ func Migrate() error {
 		&models.OAuthAccount{},
 		&models.FrozenPointsRecord{}, // 新增积分冻结记录表
 		&models.ConversationLog{},
+		&models.Organization{},
+		&models.OrganizationWallet{},
+		&models.OrganizationMember{},
+		&models.OrganizationInvitation{},
+		&models.OrganizationCreditRecord{},
+		&models.OrganizationMemberDailyUsage{},
+		&models.PointTransfer{},
+		&models.PaymentOrder{},
+		&models.PaymentWebhookEvent{},
+		&models.PromoCode{},
+		&models.PromoRedemption{},
+		&models.ReferralCode{},
+		&models.Referral{},
+		&models.JobRun{},
+		&models.WalletExpiryRecord{},
+		&models.SubscriptionPlanVersion{},
+		&models.RiskEvent{},
+		&models.UserTwoFactor{},
+		&models.TwoFactorRecoveryCode{},
+		&models.Passkey{},
+		&models.OAuthClient{},
 	)
 
 	if err != nil {
@@ -104,6 +125,12 @@ func Migrate() error {
 	// 确保新架构表的索引
 	ensureNewArchitectureIndexes()
 
+	// 补全历史激活码的兑换次数
+	backfillActivationCodeRedemptionCount()
+
+	// 为历史订阅计划生成初始版本
+	backfillSubscriptionPlanVersions()
+
 	// 标记初始化完成
 	markInitializationComplete()
 
@@ -184,6 +211,151 @@ func initDefaultConfigs() {
 			ConfigValue: "highest",
 			Description: "多个订阅时的签到积分策略（highest=最高，lowest=最低）",
 		},
+		{
+			ConfigKey:   "daily_checkin_streak_bonus",
+			ConfigValue: `{"7": 2, "30": 3}`,
+			Description: "连续签到奖励倍率，JSON格式：{\"连续天数\": 倍率}，连续签到达到该天数后按最高一档倍率发放",
+		},
+		{
+			ConfigKey:   "daily_checkin_makeup_enabled",
+			ConfigValue: "false",
+			Description: "是否允许使用积分补签",
+		},
+		{
+			ConfigKey:   "daily_checkin_makeup_cost",
+			ConfigValue: "100",
+			Description: "每次补签消耗的积分",
+		},
+		{
+			ConfigKey:   "daily_checkin_makeup_max_days",
+			ConfigValue: "7",
+			Description: "最多可补签多少天以内的漏签",
+		},
+		{
+			ConfigKey:   "daily_checkin_makeup_monthly_limit",
+			ConfigValue: "3",
+			Description: "每月最多补签次数，0表示不限制",
+		},
+		{
+			ConfigKey:   "activation_code_prefix",
+			ConfigValue: "",
+			Description: "生成激活码的默认前缀，只能包含大写字母和数字，为空表示不加前缀",
+		},
+		{
+			ConfigKey:   "activation_code_length",
+			ConfigValue: "16",
+			Description: "生成激活码的随机部分长度（8-32），末尾另加一位校验字符",
+		},
+		{
+			ConfigKey:   "brute_force_enabled",
+			ConfigValue: "true",
+			Description: "是否启用登录和激活码兑换的防暴力破解",
+		},
+		{
+			ConfigKey:   "brute_force_ip_max_failures",
+			ConfigValue: "20",
+			Description: "同一IP在统计窗口内允许的失败次数，超过后锁定，0表示不限制",
+		},
+		{
+			ConfigKey:   "brute_force_account_max_failures",
+			ConfigValue: "5",
+			Description: "同一账户在统计窗口内允许的失败次数，超过后锁定，0表示不限制",
+		},
+		{
+			ConfigKey:   "brute_force_code_group_max_failures",
+			ConfigValue: "10",
+			Description: "同一激活码分组（前缀加第一组随机字符）在统计窗口内允许的兑换失败次数，超过后该分组内不存在的激活码直接拒绝，0表示不限制",
+		},
+		{
+			ConfigKey:   "brute_force_check_email_max_requests",
+			ConfigValue: "30",
+			Description: "同一IP在统计窗口内允许的邮箱注册检查次数，0表示不限制",
+		},
+		{
+			ConfigKey:   "brute_force_window_seconds",
+			ConfigValue: "900",
+			Description: "失败次数统计窗口（秒）",
+		},
+		{
+			ConfigKey:   "brute_force_lockout_base_seconds",
+			ConfigValue: "60",
+			Description: "首次锁定时长（秒），之后每次锁定时长翻倍",
+		},
+		{
+			ConfigKey:   "brute_force_lockout_max_seconds",
+			ConfigValue: "86400",
+			Description: "最长锁定时长（秒）",
+		},
+		{
+			ConfigKey:   "risk_engine_enabled",
+			ConfigValue: "true",
+			Description: "是否启用账户共享和倒卖风控扫描",
+		},
+		{
+			ConfigKey:   "risk_scan_window_hours",
+			ConfigValue: "24",
+			Description: "风控信号统计窗口（小时）",
+		},
+		{
+			ConfigKey:   "risk_max_distinct_ips",
+			ConfigValue: "10",
+			Description: "统计窗口内同一账户允许的不同IP数量（登录设备和API请求），超过后产生风控事件，0表示不检测",
+		},
+		{
+			ConfigKey:   "risk_max_distinct_locations",
+			ConfigValue: "3",
+			Description: "统计窗口内同一账户允许的不同登录地区数量，超过后产生风控事件，0表示不检测",
+		},
+		{
+			ConfigKey:   "risk_max_devices_per_day",
+			ConfigValue: "5",
+			Description: "同一账户每天允许新增的登录设备数量，超过后产生风控事件，0表示不检测",
+		},
+		{
+			ConfigKey:   "risk_max_concurrent_ips",
+			ConfigValue: "3",
+			Description: "同一账户允许同时发起请求的不同IP数量，超过后产生风控事件，0表示不检测",
+		},
+		{
+			ConfigKey:   "risk_fresh_account_hours",
+			ConfigValue: "48",
+			Description: "注册后多少小时内兑换激活码的账户视为新账户",
+		},
+		{
+			ConfigKey:   "risk_batch_fresh_account_threshold",
+			ConfigValue: "10",
+			Description: "统计窗口内同一批次激活码被新账户兑换的次数达到该值时，兑换账户产生风控事件，0表示不检测",
+		},
+		{
+			ConfigKey:   "risk_auto_logout_score",
+			ConfigValue: "0",
+			Description: "账户风险分达到该值时自动下线全部登录设备，0表示不自动处置",
+		},
+		{
+			ConfigKey:   "risk_auto_disable_score",
+			ConfigValue: "0",
+			Description: "账户风险分达到该值时自动临时禁用账户，0表示不自动处置",
+		},
+		{
+			ConfigKey:   "risk_auto_disable_hours",
+			ConfigValue: "24",
+			Description: "自动临时禁用账户的时长（小时）",
+		},
+		{
+			ConfigKey:   "two_factor_required_for_admins",
+			ConfigValue: "false",
+			Description: "是否要求管理员账户启用两步验证，开启后未启用两步验证的管理员无法访问管理接口",
+		},
+		{
+			ConfigKey:   "legacy_access_tokens_allowed",
+			ConfigValue: "true",
+			Description: "是否继续接受升级前签发的无过期时间访问令牌，旧设备全部重新登录后可关闭",
+		},
+		{
+			ConfigKey:   "password_reset_token_expire_minutes",
+			ConfigValue: "30",
+			Description: "找回密码邮件中重置链接的有效期（分钟），链接只能使用一次",
+		},
 		{
 			ConfigKey:   "registration_plan_mapping",
 			ConfigValue: `{"default": -1, "linux_do": -1, "github": -1, "google": -1}`,
@@ -199,6 +371,136 @@ func initDefaultConfigs() {
 			ConfigValue: `{}`,
 			Description: "模型倍率映射，JSON格式：{\"模型名\": 倍率}，在现有计费基础上乘以对应倍率，空对象表示不应用额外倍率",
 		},
+		{
+			ConfigKey:   "organization_invitation_expire_hours",
+			ConfigValue: "72",
+			Description: "组织邀请链接有效期（小时）",
+		},
+		{
+			ConfigKey:   "organization_max_members",
+			ConfigValue: "50",
+			Description: "每个组织最大成员数量（含所有者）",
+		},
+		{
+			ConfigKey:   "point_transfer_enabled",
+			ConfigValue: "true",
+			Description: "是否允许用户之间转账积分",
+		},
+		{
+			ConfigKey:   "point_transfer_min_points",
+			ConfigValue: "100",
+			Description: "单笔转账最少积分",
+		},
+		{
+			ConfigKey:   "point_transfer_max_points",
+			ConfigValue: "100000",
+			Description: "单笔转账最多积分，0表示不限制",
+		},
+		{
+			ConfigKey:   "point_transfer_daily_limit",
+			ConfigValue: "200000",
+			Description: "每个用户每日累计转出积分上限，0表示不限制",
+		},
+		{
+			ConfigKey:   "point_transfer_verify_threshold",
+			ConfigValue: "10000",
+			Description: "单笔转账达到该积分数量时需要邮箱验证码确认，0表示不需要验证",
+		},
+		{
+			ConfigKey:   "payment_order_expire_minutes",
+			ConfigValue: "30",
+			Description: "支付订单未支付过期时间（分钟）",
+		},
+		{
+			ConfigKey:   "subscription_grace_period_days",
+			ConfigValue: "3",
+			Description: "周期订阅续费失败后的宽限期（天），宽限期内保留权益并可继续支付续费订单",
+		},
+		{
+			ConfigKey:   "subscription_renewal_max_attempts",
+			ConfigValue: "3",
+			Description: "周期订阅宽限期内自动扣款的最大尝试次数",
+		},
+		{
+			ConfigKey:   "referral_enabled",
+			ConfigValue: "true",
+			Description: "是否启用邀请奖励",
+		},
+		{
+			ConfigKey:   "referral_referrer_points",
+			ConfigValue: "1000",
+			Description: "被邀请人首次兑换付费激活码后邀请人获得的积分",
+		},
+		{
+			ConfigKey:   "referral_referee_points",
+			ConfigValue: "500",
+			Description: "被邀请人首次兑换付费激活码后额外获得的积分",
+		},
+		{
+			ConfigKey:   "referral_reward_validity_days",
+			ConfigValue: "30",
+			Description: "邀请奖励积分有效期（天）",
+		},
+		{
+			ConfigKey:   "referral_disposable_email_domains",
+			ConfigValue: "mailinator.com,guerrillamail.com,10minutemail.com,temp-mail.org,yopmail.com,trashmail.com,sharklasers.com,getnada.com,maildrop.cc,dispostable.com",
+			Description: "一次性邮箱域名（逗号分隔），使用这些邮箱注册的邀请不发放奖励",
+		},
+		{
+			ConfigKey:   "wallet_grace_period_days",
+			ConfigValue: "0",
+			Description: "钱包到期后的宽限期（天），宽限期内可查看但不能使用积分，重新兑换后恢复，0表示到期直接过期",
+		},
+		{
+			ConfigKey:   "wallet_expiry_notify_enabled",
+			ConfigValue: "true",
+			Description: "钱包进入宽限期或过期时是否发送邮件通知用户",
+		},
+		{
+			ConfigKey:   "job_schedule_auto_refill",
+			ConfigValue: "0 */4 * * *",
+			Description: "定时任务【自动补给】的cron表达式（分 时 日 月 周），填 off 表示停用",
+		},
+		{
+			ConfigKey:   "job_schedule_payment_order_expiry",
+			ConfigValue: "*/5 * * * *",
+			Description: "定时任务【支付订单过期检查】的cron表达式（分 时 日 月 周），填 off 表示停用",
+		},
+		{
+			ConfigKey:   "job_schedule_subscription_renewal",
+			ConfigValue: "*/10 * * * *",
+			Description: "定时任务【周期订阅续费】的cron表达式（分 时 日 月 周），填 off 表示停用",
+		},
+		{
+			ConfigKey:   "job_schedule_wallet_expiry",
+			ConfigValue: "*/15 * * * *",
+			Description: "定时任务【钱包过期扫描】的cron表达式（分 时 日 月 周），填 off 表示停用",
+		},
+		{
+			ConfigKey:   "job_schedule_device_code_cleanup",
+			ConfigValue: "*/30 * * * *",
+			Description: "定时任务【过期设备码清理】的cron表达式（分 时 日 月 周），填 off 表示停用",
+		},
+		{
+			ConfigKey:   "job_schedule_device_cleanup",
+			ConfigValue: "0 3 * * *",
+			Description: "定时任务【过期登录设备清理】的cron表达式（分 时 日 月 周），填 off 表示停用",
+		},
+		{
+			ConfigKey:   "job_schedule_activation_code_expiry",
+			ConfigValue: "5 * * * *",
+			Description: "定时任务【激活码过期检查】的cron表达式（分 时 日 月 周），填 off 表示停用",
+		},
+		{
+			ConfigKey:   "job_schedule_job_run_cleanup",
+			ConfigValue: "30 3 * * *",
+			Description: "定时任务【定时任务执行记录清理】的cron表达式（分 时 日 月 周），填 off 表示停用",
+		},
+		{
+			ConfigKey:   "job_schedule_risk_scan",
+			ConfigValue: "*/30 * * * *",
+			Description: "定时任务【账户风控扫描】的cron表达式（分 时 日 月 周），填 off 表示停用",
+		},
 	}
 
 	for _, cfg := range defaultConfigs {
@@ -266,6 +568,61 @@ func ensureDailyPointsUsageIndexes() {
 	}
 }
 
+// backfillActivationCodeRedemptionCount 支持多次兑换前已使用的激活码没有兑换次数，按已兑换一次补全
+func backfillActivationCodeRedemptionCount() {
+	result := DB.Exec(`UPDATE activation_codes SET redemption_count = 1 WHERE status = 'used' AND redemption_count = 0`)
+	if result.Error != nil {
+		log.Printf("补全激活码兑换次数失败: %v", result.Error)
+		return
+	}
+	if result.RowsAffected > 0 {
+		log.Printf("✅ 已补全 %d 个激活码的兑换次数", result.RowsAffected)
+	}
+}
+
+// backfillSubscriptionPlanVersions 为没有版本的订阅计划生成初始版本，并将尚未用完的激活码关联到该版本
+func backfillSubscriptionPlanVersions() {
+	result := DB.Exec(`INSERT INTO subscription_plan_versions
+		(subscription_plan_id, version, title, description, point_amount, price, currency, validity_days,
+		degradation_guaranteed, daily_checkin_points, daily_checkin_points_max, daily_max_points,
+		auto_refill_enabled, auto_refill_threshold, auto_refill_amount, is_recurring, rollover_cap, features,
+		change_note, created_at)
+		SELECT id, 1, title, description, point_amount, price, currency, validity_days,
+		degradation_guaranteed, daily_checkin_points, daily_checkin_points_max, daily_max_points,
+		auto_refill_enabled, auto_refill_threshold, auto_refill_amount, is_recurring, rollover_cap, features,
+		'初始版本', NOW()
+		FROM subscription_plans p
+		WHERE p.current_version_id IS NULL
+		AND NOT EXISTS (SELECT 1 FROM subscription_plan_versions v WHERE v.subscription_plan_id = p.id)`)
+	if result.Error != nil {
+		log.Printf("生成订阅计划初始版本失败: %v", result.Error)
+		return
+	}
+	if result.RowsAffected > 0 {
+		log.Printf("✅ 已为 %d 个订阅计划生成初始版本", result.RowsAffected)
+	}
+
+	if err := DB.Exec(`UPDATE subscription_plans p
+		JOIN subscription_plan_versions v ON v.subscription_plan_id = p.id AND v.version = 1
+		SET p.current_version = 1, p.current_version_id = v.id
+		WHERE p.current_version_id IS NULL`).Error; err != nil {
+		log.Printf("更新订阅计划当前版本失败: %v", err)
+		return
+	}
+
+	result = DB.Exec(`UPDATE activation_codes c
+		JOIN subscription_plans p ON p.id = c.subscription_plan_id
+		SET c.plan_version_id = p.current_version_id
+		WHERE c.plan_version_id IS NULL AND c.status <> 'used' AND p.current_version_id IS NOT NULL`)
+	if result.Error != nil {
+		log.Printf("关联激活码订阅计划版本失败: %v", result.Error)
+		return
+	}
+	if result.RowsAffected > 0 {
+		log.Printf("✅ 已将 %d 个激活码关联到订阅计划版本", result.RowsAffected)
+	}
+}
+
 // ensureNewArchitectureIndexes 确保新架构表的索引
 func ensureNewArchitectureIndexes() {
 	// 先检查索引是否存在
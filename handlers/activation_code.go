@@ -0,0 +1,211 @@
+package handlers
+
+import (
+	"encoding/csv"
+	"fmt"
+	"log"
+	"net/http"
+	"strconv"
+
+	"claude/utils"
+
+	"github.com/gin-gonic/gin"
+)
+
+// ===== 激活码批次管理相关接口 =====
+
+// HandleAdminGetActivationCodeBatches 获取激活码批次列表及各批次兑换进度
+func HandleAdminGetActivationCodeBatches(c *gin.Context) {
+	pagination := getPagination(c)
+	offset := (pagination.Page - 1) * pagination.PageSize
+
+	batches, total, err := utils.GetActivationCodeBatches(c.Query("batch_number"), c.Query("channel"), pagination.PageSize, offset)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, PaginatedResponse{
+		Data:       batches,
+		Total:      total,
+		Page:       pagination.Page,
+		PageSize:   pagination.PageSize,
+		TotalPages: int((total + int64(pagination.PageSize) - 1) / int64(pagination.PageSize)),
+	})
+}
+
+// HandleAdminGetActivationCodeBatchStats 获取批次兑换统计：兑换率、每日兑换趋势和兑换用户积分消耗
+func HandleAdminGetActivationCodeBatchStats(c *gin.Context) {
+	stats, err := utils.GetActivationCodeBatchStats(c.Param("batch"))
+	if err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, stats)
+}
+
+// HandleAdminExportActivationCodeBatch 导出批次激活码
+// 支持 format=csv（默认，包含状态和兑换信息）、txt（每行一个激活码）
+// status 可选，只导出指定状态的激活码，例如 status=unused 导出尚未用完的激活码
+func HandleAdminExportActivationCodeBatch(c *gin.Context) {
+	batchNumber := c.Param("batch")
+	format := c.DefaultQuery("format", "csv")
+	if format != "csv" && format != "txt" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "不支持的导出格式"})
+		return
+	}
+
+	codes, err := utils.GetActivationCodeBatchCodes(batchNumber)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	if len(codes) == 0 {
+		c.JSON(http.StatusNotFound, gin.H{"error": "批次不存在"})
+		return
+	}
+	status := c.Query("status")
+
+	filename := fmt.Sprintf("activation-codes-%s.%s", batchNumber, format)
+	if format == "txt" {
+		setStatementDownloadHeaders(c, "text/plain; charset=utf-8", filename)
+		for _, code := range codes {
+			if status != "" && code.Status != status {
+				continue
+			}
+			fmt.Fprintln(c.Writer, code.Code)
+		}
+		return
+	}
+
+	setStatementDownloadHeaders(c, "text/csv; charset=utf-8", filename)
+	writer := csv.NewWriter(c.Writer)
+	writer.Write([]string{"code", "batch_number", "channel", "subscription_plan_id", "status", "redemption_count", "max_redemptions", "expires_at", "used_by_user_id", "used_at", "created_at"})
+	for _, code := range codes {
+		if status != "" && code.Status != status {
+			continue
+		}
+		expiresAt, usedBy, usedAt := "", "", ""
+		if code.ExpiresAt != nil {
+			expiresAt = code.ExpiresAt.Format("2006-01-02 15:04:05")
+		}
+		if code.UsedByUserID != nil {
+			usedBy = strconv.FormatUint(uint64(*code.UsedByUserID), 10)
+		}
+		if code.UsedAt != nil {
+			usedAt = code.UsedAt.Format("2006-01-02 15:04:05")
+		}
+		writer.Write([]string{
+			code.Code,
+			code.BatchNumber,
+			code.Channel,
+			strconv.FormatUint(uint64(code.SubscriptionPlanID), 10),
+			code.Status,
+			strconv.Itoa(code.RedemptionCount),
+			strconv.Itoa(code.MaxRedemptions),
+			expiresAt,
+			usedBy,
+			usedAt,
+			code.CreatedAt.Format("2006-01-02 15:04:05"),
+		})
+	}
+	writer.Flush()
+	if err := writer.Error(); err != nil {
+		log.Printf("导出激活码批次失败: batch=%s, error=%v", batchNumber, err)
+	}
+}
+
+// HandleAdminDisableActivationCodeBatch 停用批次中所有尚未用完的激活码
+func HandleAdminDisableActivationCodeBatch(c *gin.Context) {
+	setActivationCodeBatchDisabled(c, true)
+}
+
+// HandleAdminEnableActivationCodeBatch 重新启用批次中被停用的激活码
+func HandleAdminEnableActivationCodeBatch(c *gin.Context) {
+	setActivationCodeBatchDisabled(c, false)
+}
+
+// setActivationCodeBatchDisabled 停用或启用批次
+func setActivationCodeBatchDisabled(c *gin.Context, disabled bool) {
+	adminUserID := c.GetUint("userID")
+	batchNumber := c.Param("batch")
+
+	if _, err := utils.GetActivationCodeBatchSummary(batchNumber); err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+		return
+	}
+
+	affected, err := utils.SetActivationCodeBatchDisabled(batchNumber, disabled)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	action := "启用"
+	if disabled {
+		action = "停用"
+	}
+	log.Printf("管理员%s激活码批次: admin_id=%d, batch=%s, affected=%d", action, adminUserID, batchNumber, affected)
+
+	c.JSON(http.StatusOK, gin.H{
+		"success":  true,
+		"message":  fmt.Sprintf("已%s %d 个激活码", action, affected),
+		"affected": affected,
+	})
+}
+
+// ActivationCodeBatchBanRequest 批次封禁请求
+type ActivationCodeBatchBanRequest struct {
+	Reason        string `json:"reason" binding:"required"`
+	DisableUnused *bool  `json:"disable_unused"` // 是否同时停用批次中未用完的激活码，默认停用
+}
+
+// HandleAdminPreviewActivationCodeBatchBan 预览批次封禁：按用户列出将被冻结的积分，不做任何修改
+func HandleAdminPreviewActivationCodeBatchBan(c *gin.Context) {
+	report, err := utils.BanActivationCodeBatch(c.Param("batch"), "", c.GetUint("userID"), true, true)
+	if err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, report)
+}
+
+// HandleAdminBanActivationCodeBatch 封禁整个泄露的激活码批次，冻结所有兑换用户的剩余积分
+func HandleAdminBanActivationCodeBatch(c *gin.Context) {
+	adminUserID := c.GetUint("userID")
+	batchNumber := c.Param("batch")
+
+	var req ActivationCodeBatchBanRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "参数错误: " + err.Error()})
+		return
+	}
+	disableUnused := req.DisableUnused == nil || *req.DisableUnused
+
+	report, err := utils.BanActivationCodeBatch(batchNumber, req.Reason, adminUserID, false, disableUnused)
+	if err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+		return
+	}
+
+	log.Printf("管理员封禁激活码批次: admin_id=%d, batch=%s, users=%d, codes=%d, frozen_points=%d, failed=%d",
+		adminUserID, batchNumber, report.AffectedUsers, report.AffectedCodes, report.TotalPoints, report.FailedUsers)
+
+	c.JSON(http.StatusOK, report)
+}
+
+// HandleAdminUnbanActivationCodeBatch 解禁整个批次，恢复所有仍处于冻结状态的积分
+// dry_run=true 时只返回将恢复的积分
+func HandleAdminUnbanActivationCodeBatch(c *gin.Context) {
+	dryRun := c.Query("dry_run") == "true"
+
+	report, err := utils.UnbanActivationCodeBatch(c.Param("batch"), c.GetUint("userID"), dryRun)
+	if err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, report)
+}
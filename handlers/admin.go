@@ -3,9 +3,9 @@ package handlers
 import (
 	"encoding/json"
 	"fmt"
-	"math/rand"
 	"net/http"
 	"strconv"
+	"strings"
 	"time"
 
 	"claude/database"
@@ -13,6 +13,8 @@ import (
 	"claude/utils"
 
 	"github.com/gin-gonic/gin"
+	"github.com/gin-gonic/gin/binding"
+	"gorm.io/gorm"
 )
 
 // Pagination 分页参数
@@ -110,7 +112,9 @@ func HandleAdminUpdateUser(c *gin.Context) {
 		updates["is_admin"] = *updateData.IsAdmin
 	}
 	if updateData.IsDisabled != nil {
+		// 管理员手动设置的状态会覆盖风控临时禁用
 		updates["is_disabled"] = *updateData.IsDisabled
+		updates["disabled_until"] = nil
 	}
 	if updateData.DegradationGuaranteed != nil {
 		updates["degradation_guaranteed"] = *updateData.DegradationGuaranteed
@@ -193,6 +197,16 @@ func HandleAdminGetActivationCodes(c *gin.Context) {
 	if code := c.Query("code"); code != "" {
 		query = query.Where("code LIKE ?", "%"+code+"%")
 	}
+	if channel := c.Query("channel"); channel != "" {
+		query = query.Where("channel = ?", channel)
+	}
+	if multiUse := c.Query("multi_use"); multiUse != "" {
+		if multiUse == "true" {
+			query = query.Where("max_redemptions > 1")
+		} else {
+			query = query.Where("max_redemptions <= 1")
+		}
+	}
 	if username := c.Query("username"); username != "" {
 		// 通过用户名搜索，需要join users表
 		query = query.Joins("LEFT JOIN users ON activation_codes.used_by_user_id = users.id").
@@ -256,9 +270,17 @@ func HandleAdminGetActivationCodes(c *gin.Context) {
 // HandleAdminCreateActivationCodes 批量创建激活码
 func HandleAdminCreateActivationCodes(c *gin.Context) {
 	var request struct {
-		Count              int    `json:"count" binding:"required,min=1,max=1000"`
-		SubscriptionPlanID uint   `json:"subscription_plan_id" binding:"required"`
-		BatchNumber        string `json:"batch_number"`
+		Count               int        `json:"count" binding:"required,min=1,max=1000"`
+		SubscriptionPlanID  uint       `json:"subscription_plan_id" binding:"required"`
+		BatchNumber         string     `json:"batch_number"`
+		ExpiresAt           *time.Time `json:"expires_at"`                                   // 未使用时的过期时间，为空表示永不过期
+		MaxRedemptions      int        `json:"max_redemptions" binding:"omitempty,min=1"`    // 每个激活码最大兑换次数，默认1
+		AllowRepeat         bool       `json:"allow_repeat"`                                 // 是否允许同一用户重复兑换
+		NewUserDays         int        `json:"new_user_days" binding:"omitempty,min=0"`      // 仅限注册N天内的新用户兑换
+		AllowedEmailDomains []string   `json:"allowed_email_domains"`                        // 限定的邮箱域名
+		Channel             string     `json:"channel" binding:"max=64"`                     // 渠道/分销商标识
+		Prefix              *string    `json:"prefix"`                                       // 激活码前缀，为空时使用系统配置
+		CodeLength          int        `json:"code_length" binding:"omitempty,min=8,max=32"` // 随机部分长度，为0时使用系统配置
 	}
 
 	if err := c.ShouldBindJSON(&request); err != nil {
@@ -273,6 +295,38 @@ func HandleAdminCreateActivationCodes(c *gin.Context) {
 		return
 	}
 
+	if request.ExpiresAt != nil && !request.ExpiresAt.After(time.Now()) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "过期时间必须晚于当前时间"})
+		return
+	}
+	if request.MaxRedemptions == 0 {
+		request.MaxRedemptions = 1
+	}
+	emailDomains := strings.Join(utils.NormalizeEmailDomains(request.AllowedEmailDomains), ",")
+	if len(emailDomains) > 500 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "限定邮箱域名过多"})
+		return
+	}
+
+	// 激活码格式：请求中未指定时使用系统配置
+	format := utils.GetActivationCodeFormat()
+	if request.Prefix != nil {
+		format.Prefix = strings.ToUpper(strings.TrimSpace(*request.Prefix))
+	}
+	if request.CodeLength > 0 {
+		format.Length = request.CodeLength
+	}
+	if err := utils.ValidateActivationCodePrefix(format.Prefix); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	generated, err := utils.GenerateActivationCodes(format, request.Count)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
 	// 生成批次号
 	if request.BatchNumber == "" {
 		request.BatchNumber = "BATCH-" + strconv.FormatInt(time.Now().Unix(), 10)
@@ -281,10 +335,17 @@ func HandleAdminCreateActivationCodes(c *gin.Context) {
 	codes := make([]models.ActivationCode, request.Count)
 	for i := 0; i < request.Count; i++ {
 		code := models.ActivationCode{
-			Code:               generateActivationCode(),
-			SubscriptionPlanID: request.SubscriptionPlanID,
-			Status:             "unused",
-			BatchNumber:        request.BatchNumber,
+			Code:                generated[i],
+			SubscriptionPlanID:  request.SubscriptionPlanID,
+			PlanVersionID:       plan.CurrentVersionID,
+			Status:              "unused",
+			BatchNumber:         request.BatchNumber,
+			ExpiresAt:           request.ExpiresAt,
+			MaxRedemptions:      request.MaxRedemptions,
+			AllowRepeat:         request.AllowRepeat,
+			NewUserDays:         request.NewUserDays,
+			AllowedEmailDomains: emailDomains,
+			Channel:             strings.TrimSpace(request.Channel),
 		}
 
 		codes[i] = code
@@ -303,17 +364,6 @@ func HandleAdminCreateActivationCodes(c *gin.Context) {
 	})
 }
 
-// generateActivationCode 生成激活码
-func generateActivationCode() string {
-	const charset = "ABCDEFGHIJKLMNOPQRSTUVWXYZ0123456789"
-	b := make([]byte, 16)
-	for i := range b {
-		b[i] = charset[rand.Intn(len(charset))]
-	}
-	// 格式化为 XXXX-XXXX-XXXX-XXXX
-	return string(b[0:4]) + "-" + string(b[4:8]) + "-" + string(b[8:12]) + "-" + string(b[12:16])
-}
-
 // HandleAdminDeleteActivationCode 删除激活码
 func HandleAdminDeleteActivationCode(c *gin.Context) {
 	codeID := c.Param("id")
@@ -482,18 +532,23 @@ func HandleAdminGetSubscriptionPlans(c *gin.Context) {
 func HandleAdminCreateSubscriptionPlan(c *gin.Context) {
 	// 定义请求结构体，排除ID和时间字段
 	var request struct {
-		Title                 string  `json:"title" binding:"required"`
-		Description           string  `json:"description"`
-		PointAmount           int64   `json:"point_amount" binding:"required,min=0"`
-		Price                 float64 `json:"price" binding:"required,min=0"`
-		Currency              string  `json:"currency"`
-		ValidityDays          int     `json:"validity_days" binding:"required,min=1"`
-		DegradationGuaranteed int     `json:"degradation_guaranteed"`
-		DailyCheckinPoints    int64   `json:"daily_checkin_points"`
-		DailyCheckinPointsMax int64   `json:"daily_checkin_points_max"`
-		DailyMaxPoints        int64   `json:"daily_max_points"` // 新增每日最大使用积分数量
-		Features              string  `json:"features"`
-		Active                *bool   `json:"active"`
+		Title                 string     `json:"title" binding:"required"`
+		Description           string     `json:"description"`
+		PointAmount           int64      `json:"point_amount" binding:"required,min=0"`
+		Price                 float64    `json:"price" binding:"required,min=0"`
+		Currency              string     `json:"currency"`
+		ValidityDays          int        `json:"validity_days" binding:"required,min=1"`
+		DegradationGuaranteed int        `json:"degradation_guaranteed"`
+		DailyCheckinPoints    int64      `json:"daily_checkin_points"`
+		DailyCheckinPointsMax int64      `json:"daily_checkin_points_max"`
+		DailyMaxPoints        int64      `json:"daily_max_points"` // 新增每日最大使用积分数量
+		IsRecurring           bool       `json:"is_recurring"`     // 周期订阅，周期长度为 validity_days
+		RolloverCap           int64      `json:"rollover_cap" binding:"min=-1"`
+		Features              string     `json:"features"`
+		Active                *bool      `json:"active"`
+		AvailableFrom         *time.Time `json:"available_from"`  // 上架时间
+		AvailableUntil        *time.Time `json:"available_until"` // 下架时间
+		InventoryCap          int64      `json:"inventory_cap" binding:"min=0"`
 	}
 
 	if err := c.ShouldBindJSON(&request); err != nil {
@@ -513,6 +568,12 @@ func HandleAdminCreateSubscriptionPlan(c *gin.Context) {
 		return
 	}
 
+	// 验证上下架时间
+	if request.AvailableFrom != nil && request.AvailableUntil != nil && !request.AvailableUntil.After(*request.AvailableFrom) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "下架时间必须晚于上架时间"})
+		return
+	}
+
 	// 创建订阅计划模型
 	plan := models.SubscriptionPlan{
 		Title:                 request.Title,
@@ -525,7 +586,12 @@ func HandleAdminCreateSubscriptionPlan(c *gin.Context) {
 		DailyCheckinPoints:    request.DailyCheckinPoints,
 		DailyCheckinPointsMax: request.DailyCheckinPointsMax,
 		DailyMaxPoints:        request.DailyMaxPoints,
+		IsRecurring:           request.IsRecurring,
+		RolloverCap:           request.RolloverCap,
 		Features:              request.Features,
+		AvailableFrom:         request.AvailableFrom,
+		AvailableUntil:        request.AvailableUntil,
+		InventoryCap:          request.InventoryCap,
 	}
 
 	// 设置默认值
@@ -546,7 +612,21 @@ func HandleAdminCreateSubscriptionPlan(c *gin.Context) {
 		plan.DailyCheckinPointsMax = plan.DailyCheckinPoints
 	}
 
-	if err := database.DB.Create(&plan).Error; err != nil {
+	// 创建计划的同时生成第一个版本
+	adminUserID := c.GetUint("userID")
+	err := database.DB.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Create(&plan).Error; err != nil {
+			return err
+		}
+		version, _, err := utils.CreatePlanVersionTx(tx, plan.ID, "初始版本", &adminUserID)
+		if err != nil {
+			return err
+		}
+		plan.CurrentVersion = version.Version
+		plan.CurrentVersionID = &version.ID
+		return nil
+	})
+	if err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
 		return
 	}
@@ -555,27 +635,55 @@ func HandleAdminCreateSubscriptionPlan(c *gin.Context) {
 }
 
 // HandleAdminUpdateSubscriptionPlan 更新订阅计划
+// 权益相关字段发生变化时生成新版本，已生成的激活码和已有订单仍按原版本发放
 func HandleAdminUpdateSubscriptionPlan(c *gin.Context) {
-	planID := c.Param("id")
-	var updateData models.SubscriptionPlan
+	planID, err := strconv.ParseUint(c.Param("id"), 10, 32)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "无效的订阅计划ID"})
+		return
+	}
 
-	if err := c.ShouldBindJSON(&updateData); err != nil {
+	var updateData models.SubscriptionPlan
+	if err := c.ShouldBindBodyWith(&updateData, binding.JSON); err != nil {
 		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
 		return
 	}
+	var meta struct {
+		ChangeNote string `json:"change_note"` // 版本修改说明
+	}
+	c.ShouldBindBodyWith(&meta, binding.JSON)
 
-	result := database.DB.Model(&models.SubscriptionPlan{}).Where("id = ?", planID).Updates(updateData)
-	if result.Error != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": result.Error.Error()})
+	// 版本号和已发放数量由系统维护，不允许直接修改
+	updateData.CurrentVersion = 0
+	updateData.CurrentVersionID = nil
+	updateData.InventoryUsed = 0
+
+	var plan models.SubscriptionPlan
+	if err := database.DB.Where("id = ?", planID).First(&plan).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Subscription plan not found"})
 		return
 	}
 
-	if result.RowsAffected == 0 {
-		c.JSON(http.StatusNotFound, gin.H{"error": "Subscription plan not found"})
+	adminUserID := c.GetUint("userID")
+	var version *models.SubscriptionPlanVersion
+	var created bool
+	err = database.DB.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Model(&models.SubscriptionPlan{}).Where("id = ?", planID).Updates(updateData).Error; err != nil {
+			return err
+		}
+		version, created, err = utils.CreatePlanVersionTx(tx, uint(planID), meta.ChangeNote, &adminUserID)
+		return err
+	})
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
 		return
 	}
 
-	c.JSON(http.StatusOK, gin.H{"message": "Subscription plan updated successfully"})
+	c.JSON(http.StatusOK, gin.H{
+		"message":     "Subscription plan updated successfully",
+		"version":     version.Version,
+		"new_version": created,
+	})
 }
 
 // HandleAdminDeleteSubscriptionPlan 删除订阅计划
@@ -735,8 +843,11 @@ func HandleAdminToggleUserStatus(c *gin.Context) {
 		return
 	}
 
-	// 更新用户状态
-	result := database.DB.Model(&user).Update("is_disabled", requestData.IsDisabled)
+	// 更新用户状态，管理员手动设置的状态会覆盖风控临时禁用
+	result := database.DB.Model(&user).Updates(map[string]interface{}{
+		"is_disabled":    requestData.IsDisabled,
+		"disabled_until": nil,
+	})
 	if result.Error != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": result.Error.Error()})
 		return
@@ -937,6 +1048,7 @@ func HandleAdminGiftSubscription(c *gin.Context) {
 		FromAdminID:        &admin.ID,
 		ToUserID:           uint(uid),
 		SubscriptionPlanID: requestData.SubscriptionPlanID,
+		PlanVersionID:      plan.CurrentVersionID,
 		PointsAmount:       pointsAmount,
 		ValidityDays:       validityDays,
 		DailyMaxPoints:     dailyMaxPoints,
@@ -1139,6 +1251,24 @@ func HandleAdminDashboard(c *gin.Context) {
 		Select("source_type, COUNT(*) as count, SUM(points_amount) as points").
 		Scan(&sourceStats)
 
+	// 获取钱包状态分布（由钱包过期扫描任务维护）
+	type WalletStatusStats struct {
+		Status string `json:"status"`
+		Count  int64  `json:"count"`
+	}
+
+	var walletStatusStats []WalletStatusStats
+	database.DB.Model(&models.UserWallet{}).
+		Group("status").
+		Select("status, COUNT(*) as count").
+		Scan(&walletStatusStats)
+
+	// 获取今日过期钱包数
+	var todayExpiredWallets int64
+	database.DB.Model(&models.WalletExpiryRecord{}).
+		Where("event = ? AND DATE(created_at) = ?", "expired", today).
+		Count(&todayExpiredWallets)
+
 	// 构建响应数据
 	dashboardData := gin.H{
 		"overview": gin.H{
@@ -1149,6 +1279,7 @@ func HandleAdminDashboard(c *gin.Context) {
 			"user_growth_rate":          userGrowthRate,
 			"today_points_used":         todayPointsUsed,
 			"points_growth_rate":        pointsGrowthRate,
+			"today_expired_wallets":     todayExpiredWallets,
 		},
 		"points_stats": pointsStats,
 		"trends": gin.H{
@@ -1158,12 +1289,43 @@ func HandleAdminDashboard(c *gin.Context) {
 		"distributions": gin.H{
 			"subscription_plans": planStats,
 			"points_sources":     sourceStats,
+			"wallet_statuses":    walletStatusStats,
 		},
 		"generated_at": now.Format(time.RFC3339),
 	}
 
 	c.JSON(http.StatusOK, dashboardData)
 }
+
+// HandleAdminGetWalletExpiryRecords 获取钱包过期记录
+func HandleAdminGetWalletExpiryRecords(c *gin.Context) {
+	pagination := getPagination(c)
+	var records []models.WalletExpiryRecord
+	var total int64
+
+	query := database.DB.Model(&models.WalletExpiryRecord{})
+	if userID := c.Query("user_id"); userID != "" {
+		query = query.Where("user_id = ?", userID)
+	}
+	if event := c.Query("event"); event != "" {
+		query = query.Where("event = ?", event)
+	}
+
+	query.Count(&total)
+
+	offset := (pagination.Page - 1) * pagination.PageSize
+	query.Preload("User").Order("created_at DESC").
+		Offset(offset).Limit(pagination.PageSize).Find(&records)
+
+	c.JSON(http.StatusOK, PaginatedResponse{
+		Data:       records,
+		Total:      total,
+		Page:       pagination.Page,
+		PageSize:   pagination.PageSize,
+		TotalPages: int((total + int64(pagination.PageSize) - 1) / int64(pagination.PageSize)),
+	})
+}
+
 // ===== 激活码封禁管理相关接口 =====
 
 // HandleBanActivationCode 封禁激活码
@@ -1780,3 +1942,241 @@ func GetConversationLogStats(c *gin.Context) {
 
 	c.JSON(http.StatusOK, statsResponse)
 }
+
+// ===== 组织管理相关接口 =====
+
+// HandleAdminGetOrganizations 获取组织列表
+func HandleAdminGetOrganizations(c *gin.Context) {
+	pagination := getPagination(c)
+	var organizations []models.Organization
+	var total int64
+
+	query := database.DB.Model(&models.Organization{})
+
+	if search := c.Query("search"); search != "" {
+		query = query.Where("name LIKE ?", "%"+search+"%")
+	}
+	if status := c.Query("status"); status != "" {
+		query = query.Where("status = ?", status)
+	}
+
+	query.Count(&total)
+
+	offset := (pagination.Page - 1) * pagination.PageSize
+	query.Preload("Owner").Order("created_at DESC").Offset(offset).Limit(pagination.PageSize).Find(&organizations)
+
+	result := make([]gin.H, 0, len(organizations))
+	for _, organization := range organizations {
+		var memberCount int64
+		database.DB.Model(&models.OrganizationMember{}).Where("organization_id = ?", organization.ID).Count(&memberCount)
+
+		var wallet models.OrganizationWallet
+		database.DB.Where("organization_id = ?", organization.ID).First(&wallet)
+
+		result = append(result, gin.H{
+			"organization": organization,
+			"member_count": memberCount,
+			"wallet":       wallet,
+		})
+	}
+
+	c.JSON(http.StatusOK, PaginatedResponse{
+		Data:       result,
+		Total:      total,
+		Page:       pagination.Page,
+		PageSize:   pagination.PageSize,
+		TotalPages: int((total + int64(pagination.PageSize) - 1) / int64(pagination.PageSize)),
+	})
+}
+
+// HandleAdminToggleOrganizationStatus 启用/禁用组织
+func HandleAdminToggleOrganizationStatus(c *gin.Context) {
+	organizationID := c.Param("id")
+
+	var requestData struct {
+		Status string `json:"status" binding:"required,oneof=active disabled"`
+	}
+	if err := c.ShouldBindJSON(&requestData); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "请求参数无效: " + err.Error()})
+		return
+	}
+
+	result := database.DB.Model(&models.Organization{}).Where("id = ?", organizationID).Update("status", requestData.Status)
+	if result.Error != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": result.Error.Error()})
+		return
+	}
+	if result.RowsAffected == 0 {
+		c.JSON(http.StatusNotFound, gin.H{"error": "组织不存在"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "组织状态已更新"})
+}
+
+// HandleAdminGiftOrganization 管理员为组织钱包充值积分
+func HandleAdminGiftOrganization(c *gin.Context) {
+	organizationID, err := strconv.ParseUint(c.Param("id"), 10, 32)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "无效的组织ID"})
+		return
+	}
+
+	adminID := c.GetUint("userID")
+
+	var requestData struct {
+		Points       int64  `json:"points" binding:"required,min=1"`
+		ValidityDays int    `json:"validity_days" binding:"required,min=1"`
+		Reason       string `json:"reason"`
+	}
+	if err := c.ShouldBindJSON(&requestData); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "请求参数无效: " + err.Error()})
+		return
+	}
+
+	var organization models.Organization
+	if err := database.DB.Where("id = ?", organizationID).First(&organization).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "组织不存在"})
+		return
+	}
+
+	if err := utils.AdminGiftToOrganization(adminID, organization.ID, requestData.Points, requestData.ValidityDays, requestData.Reason); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "充值失败: " + err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"message": fmt.Sprintf("已为组织 %s 充值 %d 积分，有效期 %d 天", organization.Name, requestData.Points, requestData.ValidityDays),
+	})
+}
+
+// HandleAdminGetOrganizationUsage 获取组织按成员的用量统计
+func HandleAdminGetOrganizationUsage(c *gin.Context) {
+	organizationID, err := strconv.ParseUint(c.Param("id"), 10, 32)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "无效的组织ID"})
+		return
+	}
+
+	dateFrom, dateTo := getOrganizationUsageDateRange(c)
+	usage, err := utils.GetOrganizationUsageBreakdown(uint(organizationID), dateFrom, dateTo)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	var credits []models.OrganizationCreditRecord
+	database.DB.Preload("Operator").Where("organization_id = ?", organizationID).Order("created_at DESC").Limit(50).Find(&credits)
+
+	c.JSON(http.StatusOK, gin.H{
+		"members": usage,
+		"credits": credits,
+		"date_range": gin.H{
+			"from": dateFrom,
+			"to":   dateTo,
+		},
+	})
+}
+
+// ===== 退款与积分调整相关接口 =====
+
+// HandleAdminRefundTransaction 退还指定API事务消耗的积分（支持部分退款）
+func HandleAdminRefundTransaction(c *gin.Context) {
+	transactionID, err := strconv.ParseUint(c.Param("id"), 10, 32)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "无效的事务ID"})
+		return
+	}
+
+	adminID := c.GetUint("userID")
+
+	var requestData struct {
+		Points int64  `json:"points"` // 可选：按token阈值折算的部分退款积分，不传或为0时退还全部剩余用量
+		Reason string `json:"reason" binding:"required"`
+	}
+	if err := c.ShouldBindJSON(&requestData); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "请求参数无效: " + err.Error()})
+		return
+	}
+
+	refunded, refundedTokens, err := utils.RefundAPITransaction(adminID, uint(transactionID), requestData.Points, requestData.Reason)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"message":         fmt.Sprintf("已退还 %d 加权token，其中 %d 积分退回钱包", refundedTokens, refunded),
+		"refunded_points": refunded,
+		"refunded_tokens": refundedTokens,
+	})
+}
+
+// HandleAdminAdjustUserPoints 手动调整用户钱包积分（正数增加，负数扣减）
+func HandleAdminAdjustUserPoints(c *gin.Context) {
+	userID, err := strconv.ParseUint(c.Param("id"), 10, 32)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "无效的用户ID"})
+		return
+	}
+
+	adminID := c.GetUint("userID")
+
+	var requestData struct {
+		Points       int64  `json:"points" binding:"required"`
+		ValidityDays int    `json:"validity_days"` // 可选：增加积分时延长钱包有效期的天数
+		Reason       string `json:"reason" binding:"required"`
+	}
+	if err := c.ShouldBindJSON(&requestData); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "请求参数无效: " + err.Error()})
+		return
+	}
+
+	var targetUser models.User
+	if err := database.DB.Where("id = ?", userID).First(&targetUser).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "目标用户不存在"})
+		return
+	}
+
+	record, err := utils.AdjustWalletPoints(adminID, targetUser.ID, requestData.Points, requestData.ValidityDays, requestData.Reason)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"message": fmt.Sprintf("已为用户 %s 调整 %+d 积分", targetUser.Username, requestData.Points),
+		"record":  record,
+	})
+}
+
+// HandleAdminGetAdjustments 获取退款和手动调整记录
+func HandleAdminGetAdjustments(c *gin.Context) {
+	pagination := getPagination(c)
+	var records []models.RedemptionRecord
+	var total int64
+
+	query := database.DB.Model(&models.RedemptionRecord{}).
+		Where("source_type IN ?", []string{"refund", "admin_adjustment"})
+
+	if userID := c.Query("user_id"); userID != "" {
+		query = query.Where("user_id = ?", userID)
+	}
+	if sourceType := c.Query("source_type"); sourceType != "" {
+		query = query.Where("source_type = ?", sourceType)
+	}
+
+	query.Count(&total)
+
+	offset := (pagination.Page - 1) * pagination.PageSize
+	query.Preload("User").Preload("AdminUser").Order("created_at DESC").
+		Offset(offset).Limit(pagination.PageSize).Find(&records)
+
+	c.JSON(http.StatusOK, PaginatedResponse{
+		Data:       records,
+		Total:      total,
+		Page:       pagination.Page,
+		PageSize:   pagination.PageSize,
+		TotalPages: int((total + int64(pagination.PageSize) - 1) / int64(pagination.PageSize)),
+	})
+}
@@ -19,9 +19,10 @@ import (
 
 // 注册登录相关请求结构
 type RegisterRequest struct {
-	Username string `json:"username" binding:"required,min=5,max=20"`
-	Email    string `json:"email" binding:"required,email"`
-	Password string `json:"password" binding:"required,min=6"`
+	Username     string `json:"username" binding:"required,min=5,max=20"`
+	Email        string `json:"email" binding:"required,email"`
+	Password     string `json:"password" binding:"required,min=6"`
+	ReferralCode string `json:"referral_code" binding:"max=32"` // 邀请码（可选）
 }
 
 type LoginRequest struct {
@@ -31,10 +32,14 @@ type LoginRequest struct {
 
 // AuthResponse 注册登录相关响应结构
 type AuthResponse struct {
-	Success bool      `json:"success"`
-	Message string    `json:"message"`
-	Token   string    `json:"token,omitempty"`
-	User    *UserData `json:"user,omitempty"`
+	Success           bool      `json:"success"`
+	Message           string    `json:"message"`
+	Token             string    `json:"token,omitempty"`
+	User              *UserData `json:"user,omitempty"`
+	TwoFactorRequired bool      `json:"two_factor_required,omitempty"` // 需要使用 ChallengeToken 完成两步验证
+	ChallengeToken    string    `json:"challenge_token,omitempty"`
+	RefreshToken      string    `json:"refresh_token,omitempty"` // 访问令牌过期后用于换取新令牌
+	ExpiresIn         int       `json:"expires_in,omitempty"`    // 访问令牌有效期（秒）
 }
 
 type UserData struct {
@@ -135,10 +140,15 @@ func HandleRegister(c *gin.Context) {
 		// 套餐赠送失败不影响注册，继续处理
 	}
 
+	// 记录邀请关系
+	recordReferral(c, user.ID, req.ReferralCode, "email")
+
 	c.JSON(http.StatusOK, AuthResponse{
-		Success: true,
-		Message: "注册成功",
-		Token:   token,
+		Success:      true,
+		Message:      "注册成功",
+		Token:        token,
+		RefreshToken: device.RefreshToken,
+		ExpiresIn:    utils.AccessTokenExpiresIn(),
 		User: &UserData{
 			ID:       user.ID,
 			Username: user.Username,
@@ -158,10 +168,21 @@ func HandleLogin(c *gin.Context) {
 		return
 	}
 
+	// 按IP和账户统计失败次数，防止暴力破解密码
+	guard := utils.NewBruteForceGuard(utils.BruteForceScopeLogin, c.ClientIP(), req.Email, "")
+	if err := guard.Check(); err != nil {
+		c.JSON(http.StatusTooManyRequests, AuthResponse{
+			Success: false,
+			Message: err.Error(),
+		})
+		return
+	}
+
 	// 查找用户
 	var user models.User
 	err := database.DB.Where("email = ?", req.Email).First(&user).Error
 	if err != nil {
+		guard.Fail()
 		c.JSON(http.StatusUnauthorized, AuthResponse{
 			Success: false,
 			Message: "邮箱或密码错误",
@@ -171,6 +192,7 @@ func HandleLogin(c *gin.Context) {
 
 	// 验证密码
 	if user.Password == nil {
+		guard.Fail()
 		c.JSON(http.StatusUnauthorized, AuthResponse{
 			Success: false,
 			Message: "该账户未设置密码，请使用邮箱验证码登录",
@@ -180,12 +202,19 @@ func HandleLogin(c *gin.Context) {
 	
 	err = bcrypt.CompareHashAndPassword([]byte(*user.Password), []byte(req.Password))
 	if err != nil {
+		guard.Fail()
 		c.JSON(http.StatusUnauthorized, AuthResponse{
 			Success: false,
 			Message: "邮箱或密码错误",
 		})
 		return
 	}
+	guard.Succeed()
+
+	// 已启用两步验证时先返回登录挑战
+	if respondTwoFactorChallenge(c, &user, "password") {
+		return
+	}
 
 	// 生成访问令牌
 	token, err := utils.GenerateAccessToken(user.ID, user.Email)
@@ -217,9 +246,11 @@ func HandleLogin(c *gin.Context) {
 	log.Printf("用户登录成功: user_id=%d, device_id=%s, ip=%s", user.ID, device.ID, device.IP)
 
 	c.JSON(http.StatusOK, AuthResponse{
-		Success: true,
-		Message: "登录成功",
-		Token:   token,
+		Success:      true,
+		Message:      "登录成功",
+		Token:        token,
+		RefreshToken: device.RefreshToken,
+		ExpiresIn:    utils.AccessTokenExpiresIn(),
 		User: &UserData{
 			ID:       user.ID,
 			Username: user.Username,
@@ -285,8 +316,10 @@ type CheckUsernameRequest struct {
 }
 
 type SendVerificationCodeForSettingsRequest struct {
-	Type        string `json:"type" binding:"required"`        // change_username, change_password
+	Type        string `json:"type" binding:"required"`        // change_username, change_password, transfer_points
 	NewUsername string `json:"new_username,omitempty"`         // 修改用户名时需要
+	Recipient   string `json:"recipient,omitempty"`            // 积分转账时需要，验证码只能用于该收款人
+	Points      int64  `json:"points,omitempty"`               // 积分转账时需要，验证码只能用于该金额
 }
 
 type ChangeUsernameRequest struct {
@@ -373,6 +406,7 @@ func HandleSendVerificationCodeForSettings(c *gin.Context) {
 	}
 
 	// 验证请求类型和参数
+	transferTarget := ""
 	switch req.Type {
 	case "change_username":
 		if req.NewUsername == "" {
@@ -396,6 +430,18 @@ func HandleSendVerificationCodeForSettings(c *gin.Context) {
 		}
 	case "change_password":
 		// 修改密码不需要额外验证
+	case "transfer_points":
+		// 验证码绑定收款人和金额，确认转账时一并校验
+		if req.Points <= 0 {
+			c.JSON(http.StatusBadRequest, ErrorResponse{Error: "转账积分必须大于0"})
+			return
+		}
+		toUser, err := findTransferRecipient(req.Recipient)
+		if err != nil {
+			c.JSON(http.StatusNotFound, ErrorResponse{Error: "收款用户不存在"})
+			return
+		}
+		transferTarget = transferVerificationTarget(toUser.ID, req.Points)
 	default:
 		c.JSON(http.StatusBadRequest, ErrorResponse{Error: "不支持的验证码类型"})
 		return
@@ -405,7 +451,11 @@ func HandleSendVerificationCodeForSettings(c *gin.Context) {
 	code := utils.GenerateVerificationCode()
 
 	// 存储验证码到Redis，有效期5分钟
-	err = redisClientForAuth.Set(context.Background(), redisKey, code, 5*time.Minute).Err()
+	storedValue := code
+	if transferTarget != "" {
+		storedValue = code + ":" + transferTarget
+	}
+	err = redisClientForAuth.Set(context.Background(), redisKey, storedValue, 5*time.Minute).Err()
 	if err != nil {
 		log.Printf("存储验证码失败: %v", err)
 		c.JSON(http.StatusInternalServerError, ErrorResponse{Error: "验证码生成失败"})
@@ -419,6 +469,8 @@ func HandleSendVerificationCodeForSettings(c *gin.Context) {
 		emailType = "change_username"
 	case "change_password":
 		emailType = "change_password"
+	case "transfer_points":
+		emailType = "transfer_points"
 	}
 
 	err = utils.SendSettingsVerificationEmail(user.Email, code, emailType)
@@ -25,10 +25,11 @@ type SendVerificationCodeRequest struct {
 }
 
 type RegisterWithCodeRequest struct {
-	Username string  `json:"username" binding:"required,min=5,max=20"`
-	Email    string  `json:"email" binding:"required,email"`
-	Password *string `json:"password,omitempty"` // 密码现在是可选的
-	Code     string  `json:"code" binding:"required,len=6"`
+	Username     string  `json:"username" binding:"required,min=5,max=20"`
+	Email        string  `json:"email" binding:"required,email"`
+	Password     *string `json:"password,omitempty"` // 密码现在是可选的
+	Code         string  `json:"code" binding:"required,len=6"`
+	ReferralCode string  `json:"referral_code" binding:"max=32"` // 邀请码（可选）
 }
 
 type LoginWithCodeRequest struct {
@@ -39,9 +40,10 @@ type LoginWithCodeRequest struct {
 
 // 新增：邮箱验证码一键登录/注册请求
 type EmailOnlyAuthRequest struct {
-	Email    string `json:"email" binding:"required,email"`
-	Code     string `json:"code" binding:"required,len=6"`
-	Username string `json:"username,omitempty"` // 可选，仅在注册时需要
+	Email        string `json:"email" binding:"required,email"`
+	Code         string `json:"code" binding:"required,len=6"`
+	Username     string `json:"username,omitempty"`                       // 可选，仅在注册时需要
+	ReferralCode string `json:"referral_code,omitempty" binding:"max=32"` // 邀请码（可选），仅在注册时使用
 }
 
 // 邮箱检查请求结构体
@@ -246,16 +248,38 @@ func HandleRegisterWithCode(c *gin.Context) {
 		return
 	}
 
+	// 注册设备到Redis
+	deviceManager := utils.NewDeviceManager(database.TokenRedisClient, database.UserRedisClient, database.DeviceRedisClient)
+	device, err := deviceManager.RegisterDevice(
+		user.ID,
+		token,
+		c.ClientIP(),
+		c.GetHeader("User-Agent"),
+		"web",
+	)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, AuthResponse{
+			Success: false,
+			Message: "设备注册失败",
+		})
+		return
+	}
+
 	// 处理新用户注册套餐赠送
 	if err := utils.ProcessRegistrationPlanGift(user.ID, "default"); err != nil {
 		log.Printf("新用户套餐赠送失败: user_id=%d, error=%v", user.ID, err)
 		// 套餐赠送失败不影响注册，继续处理
 	}
 
+	// 记录邀请关系
+	recordReferral(c, user.ID, req.ReferralCode, "email")
+
 	c.JSON(http.StatusOK, AuthResponse{
-		Success: true,
-		Message: "注册成功",
-		Token:   token,
+		Success:      true,
+		Message:      "注册成功",
+		Token:        token,
+		RefreshToken: device.RefreshToken,
+		ExpiresIn:    utils.AccessTokenExpiresIn(),
 		User: &UserData{
 			ID:       user.ID,
 			Username: user.Username,
@@ -278,28 +302,47 @@ func HandleLoginWithCode(c *gin.Context) {
 	// 查找用户（支持用户名或邮箱）
 	var user models.User
 	err := database.DB.Where("email = ? OR username = ?", req.EmailOrUsername, req.EmailOrUsername).First(&user).Error
+
+	// 按IP和账户统计失败次数，用户名和邮箱登录共用账户计数
+	account := req.EmailOrUsername
+	if err == nil {
+		account = user.Email
+	}
+	guard := utils.NewBruteForceGuard(utils.BruteForceScopeLogin, c.ClientIP(), account, "")
+	if lockErr := guard.Check(); lockErr != nil {
+		c.JSON(http.StatusTooManyRequests, AuthResponse{
+			Success: false,
+			Message: lockErr.Error(),
+		})
+		return
+	}
+
+	// 用户不存在和密码错误返回相同提示，避免枚举账户
 	if err != nil {
+		guard.Fail()
 		c.JSON(http.StatusUnauthorized, AuthResponse{
 			Success: false,
-			Message: "用户不存在",
+			Message: "账户或密码错误",
 		})
 		return
 	}
 
 	// 验证密码
 	if user.Password == nil {
+		guard.Fail()
 		c.JSON(http.StatusUnauthorized, AuthResponse{
 			Success: false,
-			Message: "该账户未设置密码，无法使用密码验证",
+			Message: "账户或密码错误",
 		})
 		return
 	}
 
 	err = bcrypt.CompareHashAndPassword([]byte(*user.Password), []byte(req.Password))
 	if err != nil {
+		guard.Fail()
 		c.JSON(http.StatusUnauthorized, AuthResponse{
 			Success: false,
-			Message: "密码错误",
+			Message: "账户或密码错误",
 		})
 		return
 	}
@@ -309,6 +352,7 @@ func HandleLoginWithCode(c *gin.Context) {
 	verificationKey := fmt.Sprintf("email_verification:%s:login", user.Email)
 	storedCode, err := redisClientForAuth.Get(ctx, verificationKey).Result()
 	if err != nil || storedCode != req.Code {
+		guard.Fail()
 		c.JSON(http.StatusBadRequest, AuthResponse{
 			Success: false,
 			Message: "验证码错误或已过期",
@@ -318,6 +362,12 @@ func HandleLoginWithCode(c *gin.Context) {
 
 	// 删除已使用的验证码
 	redisClientForAuth.Del(ctx, verificationKey)
+	guard.Succeed()
+
+	// 已启用两步验证时先返回登录挑战
+	if respondTwoFactorChallenge(c, &user, "password_code") {
+		return
+	}
 
 	// 生成访问令牌
 	token, err := utils.GenerateAccessToken(user.ID, user.Email)
@@ -329,10 +379,29 @@ func HandleLoginWithCode(c *gin.Context) {
 		return
 	}
 
+	// 注册设备到Redis
+	deviceManager := utils.NewDeviceManager(database.TokenRedisClient, database.UserRedisClient, database.DeviceRedisClient)
+	device, err := deviceManager.RegisterDevice(
+		user.ID,
+		token,
+		c.ClientIP(),
+		c.GetHeader("User-Agent"),
+		"web",
+	)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, AuthResponse{
+			Success: false,
+			Message: "设备注册失败",
+		})
+		return
+	}
+
 	c.JSON(http.StatusOK, AuthResponse{
-		Success: true,
-		Message: "登录成功",
-		Token:   token,
+		Success:      true,
+		Message:      "登录成功",
+		Token:        token,
+		RefreshToken: device.RefreshToken,
+		ExpiresIn:    utils.AccessTokenExpiresIn(),
 		User: &UserData{
 			ID:       user.ID,
 			Username: user.Username,
@@ -458,6 +527,14 @@ func HandleEmailOnlyAuth(c *gin.Context) {
 			log.Printf("新用户套餐赠送失败: user_id=%d, error=%v", user.ID, err)
 			// 套餐赠送失败不影响注册，继续处理
 		}
+
+		// 记录邀请关系
+		recordReferral(c, user.ID, req.ReferralCode, "email_code")
+	}
+
+	// 已启用两步验证的用户登录时先返回登录挑战
+	if isLogin && respondTwoFactorChallenge(c, &user, "email_code") {
+		return
 	}
 
 	// 生成访问令牌
@@ -492,9 +569,11 @@ func HandleEmailOnlyAuth(c *gin.Context) {
 		user.ID, device.ID, device.IP)
 
 	c.JSON(http.StatusOK, AuthResponse{
-		Success: true,
-		Message: map[bool]string{true: "登录成功", false: "注册成功"}[isLogin],
-		Token:   token,
+		Success:      true,
+		Message:      map[bool]string{true: "登录成功", false: "注册成功"}[isLogin],
+		Token:        token,
+		RefreshToken: device.RefreshToken,
+		ExpiresIn:    utils.AccessTokenExpiresIn(),
 		User: &UserData{
 			ID:       user.ID,
 			Username: user.Username,
@@ -524,6 +603,17 @@ func HandleCheckEmail(c *gin.Context) {
 		return
 	}
 
+	// 每次检查都计入次数，每个IP在统计窗口内的检查次数有限，防止批量枚举已注册邮箱
+	guard := utils.NewBruteForceGuard(utils.BruteForceScopeCheckEmail, c.ClientIP(), "", "")
+	if err := guard.Check(); err != nil {
+		c.JSON(http.StatusTooManyRequests, CheckEmailResponse{
+			Success: false,
+			Message: err.Error(),
+		})
+		return
+	}
+	guard.Fail()
+
 	// 查询用户是否存在
 	var existingUser models.User
 	userExists := database.DB.Where("email = ?", req.Email).First(&existingUser).Error == nil
@@ -0,0 +1,47 @@
+package handlers
+
+import (
+	"log"
+	"net/http"
+
+	"claude/utils"
+
+	"github.com/gin-gonic/gin"
+)
+
+// ===== 防暴力破解管理相关接口 =====
+
+// HandleAdminGetBruteForceLocks 获取当前被锁定的IP、账户和激活码分组，可按 scope 筛选
+func HandleAdminGetBruteForceLocks(c *gin.Context) {
+	locks, err := utils.GetBruteForceLocks(c.Query("scope"))
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"data":     locks,
+		"settings": utils.GetBruteForceSettings(),
+	})
+}
+
+// HandleAdminUnlockBruteForceSubject 手动解除锁定
+func HandleAdminUnlockBruteForceSubject(c *gin.Context) {
+	var req utils.BruteForceSubject
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "参数错误: " + err.Error()})
+		return
+	}
+
+	if err := utils.UnlockBruteForceSubject(req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	log.Printf("管理员解除锁定: admin_id=%d, scope=%s, kind=%s, value=%s", c.GetUint("userID"), req.Scope, req.Kind, req.Value)
+
+	c.JSON(http.StatusOK, gin.H{
+		"success": true,
+		"message": "已解除锁定",
+	})
+}
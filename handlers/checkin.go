@@ -0,0 +1,91 @@
+package handlers
+
+import (
+	"net/http"
+	"time"
+
+	"claude/utils"
+
+	"github.com/gin-gonic/gin"
+)
+
+// CheckinMakeupRequest 补签请求
+type CheckinMakeupRequest struct {
+	Date string `json:"date" binding:"required"` // 补签日期 YYYY-MM-DD
+}
+
+// HandleGetCheckinCalendar 获取指定月份的签到日历，默认当月
+func HandleGetCheckinCalendar(c *gin.Context) {
+	userID := c.GetUint("userID")
+	month := c.DefaultQuery("month", time.Now().Format("2006-01"))
+
+	calendar, err := utils.GetCheckinCalendar(userID, month)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, calendar)
+}
+
+// HandleCheckinMakeup 消耗积分补签漏签的日期
+func HandleCheckinMakeup(c *gin.Context) {
+	userID := c.GetUint("userID")
+
+	var req CheckinMakeupRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "参数错误: " + err.Error()})
+		return
+	}
+
+	checkin, err := utils.MakeupCheckin(userID, req.Date)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"success":    true,
+		"message":    "补签成功",
+		"date":       checkin.CheckinDate,
+		"cost":       checkin.MakeupCost,
+		"streakDays": checkin.StreakDays,
+	})
+}
+
+// ===== 签到统计相关接口 =====
+
+// HandleAdminGetCheckinStats 签到参与情况统计，默认最近30天
+func HandleAdminGetCheckinStats(c *gin.Context) {
+	today := time.Now().Format("2006-01-02")
+	end, err := time.ParseInLocation("2006-01-02", c.DefaultQuery("date_to", today), time.Local)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "date_to 格式错误，应为 YYYY-MM-DD"})
+		return
+	}
+	end = end.AddDate(0, 0, 1)
+
+	start := end.AddDate(0, 0, -30)
+	if dateFrom := c.Query("date_from"); dateFrom != "" {
+		if start, err = time.ParseInLocation("2006-01-02", dateFrom, time.Local); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "date_from 格式错误，应为 YYYY-MM-DD"})
+			return
+		}
+	}
+	if !start.Before(end) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "date_from 不能晚于 date_to"})
+		return
+	}
+
+	stats, err := utils.GetCheckinStats(start, end)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "获取签到统计失败"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"streak_tiers": utils.GetCheckinStreakTiers(),
+		"makeup":       utils.GetCheckinMakeupSettings(),
+		"stats":        stats,
+	})
+}
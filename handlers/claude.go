@@ -147,8 +147,31 @@ func HandleClaudeProxy(c *gin.Context) {
 		}
 	}
 
+	// 加入有效组织的成员使用组织钱包计费
+	organizationID := utils.GetBillingOrganizationID(userID)
+
 	// 如果不是免费模型，则需要检查积分
-	if !isFreeModel {
+	if !isFreeModel && organizationID != nil {
+		// 检查组织钱包是否有效
+		if !utils.IsOrganizationWalletActive(*organizationID) {
+			c.JSON(http.StatusPaymentRequired, gin.H{
+				"error": "组织积分余额不足或已过期，请联系组织管理员充值",
+				"code":  "INSUFFICIENT_ORGANIZATION_CREDITS",
+			})
+			return
+		}
+
+		// 检查成员每日额度
+		if member, err := utils.GetOrganizationMember(*organizationID, userID); err == nil {
+			if err := utils.CheckOrganizationMemberDailyLimit(member, 0); err != nil {
+				c.JSON(http.StatusTooManyRequests, gin.H{
+					"error": err.Error(),
+					"code":  "ORGANIZATION_MEMBER_DAILY_LIMIT",
+				})
+				return
+			}
+		}
+	} else if !isFreeModel {
 		// 检查用户钱包是否有效和可用积分
 		if !utils.IsWalletActive(userID) {
 			available, _, _, err := utils.GetWalletBalance(userID)
@@ -232,15 +255,15 @@ func HandleClaudeProxy(c *gin.Context) {
 
 	// 如果是非流式响应，直接处理
 	if !isStream {
-		handleNonStreamResponse(c, resp, userID, user.Username, model, startTime, configMap, isFreeModel, requestData)
+		handleNonStreamResponse(c, resp, userID, user.Username, model, startTime, configMap, isFreeModel, organizationID, requestData)
 	} else {
 		// 流式响应处理
-		handleStreamResponse(c, resp, userID, user.Username, model, startTime, configMap, isFreeModel, requestData)
+		handleStreamResponse(c, resp, userID, user.Username, model, startTime, configMap, isFreeModel, organizationID, requestData)
 	}
 }
 
 // 处理非流式响应
-func handleNonStreamResponse(c *gin.Context, resp *http.Response, userID uint, username, model string, startTime time.Time, configMap map[string]string, isFreeModel bool, requestData map[string]interface{}) {
+func handleNonStreamResponse(c *gin.Context, resp *http.Response, userID uint, username, model string, startTime time.Time, configMap map[string]string, isFreeModel bool, organizationID *uint, requestData map[string]interface{}) {
 	// 读取响应体
 	responseBody, err := io.ReadAll(resp.Body)
 	if err != nil {
@@ -287,18 +310,19 @@ func handleNonStreamResponse(c *gin.Context, resp *http.Response, userID uint, u
 			if isError, exists := responseCheck["is_error"]; exists && isError == true {
 				// 如果检测到 is_error，记录失败请求但不扣费
 				apiTransaction := models.APITransaction{
-					UserID:      userID,
-					RequestID:   fmt.Sprintf("req_%d_%d", userID, time.Now().UnixNano()),
-					Model:       model,
-					RequestType: "api",
-					IP:          c.ClientIP(),
-					UID:         fmt.Sprintf("%d", userID),
-					Username:    username,
-					Status:      "claude_error",
-					Error:       "Claude API returned is_error: true",
-					Duration:    int(time.Since(startTime).Milliseconds()),
-					ServiceTier: "standard",
-					CreatedAt:   time.Now(),
+					UserID:         userID,
+					OrganizationID: organizationID,
+					RequestID:      fmt.Sprintf("req_%d_%d", userID, time.Now().UnixNano()),
+					Model:          model,
+					RequestType:    "api",
+					IP:             c.ClientIP(),
+					UID:            fmt.Sprintf("%d", userID),
+					Username:       username,
+					Status:         "claude_error",
+					Error:          "Claude API returned is_error: true",
+					Duration:       int(time.Since(startTime).Milliseconds()),
+					ServiceTier:    "standard",
+					CreatedAt:      time.Now(),
 				}
 				database.DB.Create(&apiTransaction)
 				return
@@ -315,7 +339,7 @@ func handleNonStreamResponse(c *gin.Context, resp *http.Response, userID uint, u
 				claudeResp.Usage.CacheReadInputTokens,
 				claudeResp.Usage.ServiceTier,
 				"api", // 非流式请求
-				c.ClientIP(), startTime, configMap, isFreeModel)
+				c.ClientIP(), startTime, configMap, isFreeModel, organizationID)
 
 			// 记录完整的对话日志
 			recordConversationLog(userID, username, c.ClientIP(), requestData, &claudeResp, nil, "api", isFreeModel, startTime)
@@ -323,18 +347,19 @@ func handleNonStreamResponse(c *gin.Context, resp *http.Response, userID uint, u
 	} else {
 		// 记录失败的请求但不扣费
 		apiTransaction := models.APITransaction{
-			UserID:      userID,
-			RequestID:   fmt.Sprintf("req_%d_%d", userID, time.Now().UnixNano()),
-			Model:       model,
-			RequestType: "api",
-			IP:          c.ClientIP(),
-			UID:         fmt.Sprintf("%d", userID),
-			Username:    username,
-			Status:      "failed",
-			Error:       fmt.Sprintf("HTTP %d: %s", resp.StatusCode, string(responseBody)),
-			Duration:    int(time.Since(startTime).Milliseconds()),
-			ServiceTier: "standard",
-			CreatedAt:   time.Now(),
+			UserID:         userID,
+			OrganizationID: organizationID,
+			RequestID:      fmt.Sprintf("req_%d_%d", userID, time.Now().UnixNano()),
+			Model:          model,
+			RequestType:    "api",
+			IP:             c.ClientIP(),
+			UID:            fmt.Sprintf("%d", userID),
+			Username:       username,
+			Status:         "failed",
+			Error:          fmt.Sprintf("HTTP %d: %s", resp.StatusCode, string(responseBody)),
+			Duration:       int(time.Since(startTime).Milliseconds()),
+			ServiceTier:    "standard",
+			CreatedAt:      time.Now(),
 		}
 		database.DB.Create(&apiTransaction)
 
@@ -344,7 +369,7 @@ func handleNonStreamResponse(c *gin.Context, resp *http.Response, userID uint, u
 }
 
 // 处理流式响应
-func handleStreamResponse(c *gin.Context, resp *http.Response, userID uint, username, model string, startTime time.Time, configMap map[string]string, isFreeModel bool, requestData map[string]interface{}) {
+func handleStreamResponse(c *gin.Context, resp *http.Response, userID uint, username, model string, startTime time.Time, configMap map[string]string, isFreeModel bool, organizationID *uint, requestData map[string]interface{}) {
 	// 特殊处理429状态码
 	if resp.StatusCode == http.StatusTooManyRequests {
 		c.Header("Content-Type", "text/event-stream")
@@ -454,7 +479,7 @@ func handleStreamResponse(c *gin.Context, resp *http.Response, userID uint, user
 			0, 0, // 流式响应暂时没有缓存信息
 			"standard", // 默认服务等级
 			"stream",   // 流式请求
-			c.ClientIP(), startTime, configMap, isFreeModel)
+			c.ClientIP(), startTime, configMap, isFreeModel, organizationID)
 
 		// 记录成功的流式对话日志
 		recordConversationLog(userID, username, c.ClientIP(), requestData, finalClaudeResp, nil, "stream", isFreeModel, startTime)
@@ -469,21 +494,22 @@ func handleStreamResponse(c *gin.Context, resp *http.Response, userID uint, user
 		}
 		
 		apiTransaction := models.APITransaction{
-			UserID:       userID,
-			MessageID:    messageID,
-			RequestID:    messageID,
-			Model:        model,
-			RequestType:  "stream",
-			InputTokens:  totalInputTokens,
-			OutputTokens: totalOutputTokens,
-			IP:           c.ClientIP(),
-			UID:          fmt.Sprintf("%d", userID),
-			Username:     username,
-			Status:       status,
-			Error:        errorMsg,
-			Duration:     int(time.Since(startTime).Milliseconds()),
-			ServiceTier:  "standard",
-			CreatedAt:    time.Now(),
+			UserID:         userID,
+			OrganizationID: organizationID,
+			MessageID:      messageID,
+			RequestID:      messageID,
+			Model:          model,
+			RequestType:    "stream",
+			InputTokens:    totalInputTokens,
+			OutputTokens:   totalOutputTokens,
+			IP:             c.ClientIP(),
+			UID:            fmt.Sprintf("%d", userID),
+			Username:       username,
+			Status:         status,
+			Error:          errorMsg,
+			Duration:       int(time.Since(startTime).Milliseconds()),
+			ServiceTier:    "standard",
+			CreatedAt:      time.Now(),
 		}
 		if streamError != nil {
 			apiTransaction.Error = streamError.Error()
@@ -496,7 +522,7 @@ func handleStreamResponse(c *gin.Context, resp *http.Response, userID uint, user
 }
 
 // 记录使用情况
-func recordUsage(userID uint, username string, model string, messageID string, inputTokens int, outputTokens int, cacheCreationTokens int, cacheReadTokens int, serviceTier string, requestType string, ip string, startTime time.Time, configMap map[string]string, isFreeModel bool) {
+func recordUsage(userID uint, username string, model string, messageID string, inputTokens int, outputTokens int, cacheCreationTokens int, cacheReadTokens int, serviceTier string, requestType string, ip string, startTime time.Time, configMap map[string]string, isFreeModel bool, organizationID *uint) {
 	// 如果是免费模型，只增加使用次数，不扣积分，不记录API事务
 	if isFreeModel {
 		// 开始数据库事务
@@ -572,8 +598,14 @@ func recordUsage(userID uint, username string, model string, messageID string, i
 	// 应用模型倍率到总加权token
 	finalWeightedTokens := totalWeightedTokens * modelMultiplier
 
-	// 使用新的累计token计费逻辑
-	err := utils.AccumulateTokensAndDeduct(userID, int64(finalWeightedTokens))
+	// 使用新的累计token计费逻辑，组织成员从组织钱包扣费
+	var err error
+	var pointsUsed int64
+	if organizationID != nil {
+		pointsUsed, err = utils.AccumulateOrganizationTokensAndDeduct(*organizationID, userID, int64(finalWeightedTokens))
+	} else {
+		pointsUsed, err = utils.AccumulateTokensAndDeduct(userID, int64(finalWeightedTokens))
+	}
 
 	// 开始数据库事务
 	tx := database.DB.Begin()
@@ -582,6 +614,7 @@ func recordUsage(userID uint, username string, model string, messageID string, i
 		// 如果扣费失败，仍然记录API调用，但标记为失败
 		apiTransaction := models.APITransaction{
 			UserID:                   userID,
+			OrganizationID:           organizationID,
 			MessageID:                messageID,
 			RequestID:                messageID,
 			Model:                    model,
@@ -611,6 +644,7 @@ func recordUsage(userID uint, username string, model string, messageID string, i
 	// 创建成功的API事务记录
 	apiTransaction := models.APITransaction{
 		UserID:                   userID,
+		OrganizationID:           organizationID,
 		MessageID:                messageID,
 		RequestID:                messageID, // 使用messageID作为requestID
 		Model:                    model,
@@ -623,7 +657,8 @@ func recordUsage(userID uint, username string, model string, messageID string, i
 		OutputMultiplier:         outputMultiplier,
 		CacheMultiplier:          cacheMultiplier,
 		ModelMultiplier:          modelMultiplier,
-		PointsUsed:               0, // 累计token计费模式下，这里记录为0，实际扣费由AccumulateTokensAndDeduct处理
+		PointsUsed:               pointsUsed, // 累计token计费模式下，记录本次请求触发的实际扣费，未达到阈值时为0
+		WeightedTokens:           int64(finalWeightedTokens),
 		IP:                       ip,
 		UID:                      fmt.Sprintf("%d", userID),
 		Username:                 username,
@@ -68,6 +68,8 @@ type CreditUsageData struct {
 	CacheCreationTokens int             `json:"cache_creation_tokens,omitempty"`
 	CacheReadTokens     int             `json:"cache_read_tokens,omitempty"`
 	TotalCacheTokens    int             `json:"total_cache_tokens,omitempty"`
+	RefundedPoints      int64           `json:"refunded_points,omitempty"` // 管理员已退还的积分
+	RefundedTokens      int64           `json:"refunded_tokens,omitempty"` // 管理员已退还的加权token
 	BillingDetails      *BillingDetails `json:"billing_details,omitempty"`
 }
 
@@ -370,6 +372,8 @@ func HandleGetCreditUsageHistory(c *gin.Context) {
 			CacheCreationTokens: int(transaction.CacheCreationInputTokens),
 			CacheReadTokens:     int(transaction.CacheReadInputTokens),
 			TotalCacheTokens:    totalCacheTokens,
+			RefundedPoints:      transaction.RefundedPoints,
+			RefundedTokens:      transaction.RefundedTokens,
 			BillingDetails:      billingDetails,
 		})
 	}
@@ -476,3 +480,37 @@ func HandleGetDailyUsage(c *gin.Context) {
 func floatPtr(f float64) *float64 {
 	return &f
 }
+
+// HandleGetCreditAnalytics 获取用户API用量分析（按时间分桶和模型统计）
+func HandleGetCreditAnalytics(c *gin.Context) {
+	userID, err := getUserIDFromToken(c)
+	if err != nil {
+		c.JSON(http.StatusUnauthorized, ErrorResponse{Error: err.Error()})
+		return
+	}
+
+	// 默认统计最近7天
+	now := time.Now()
+	dateFrom := c.DefaultQuery("date_from", now.AddDate(0, 0, -6).Format("2006-01-02"))
+	dateTo := c.DefaultQuery("date_to", now.Format("2006-01-02"))
+	granularity := c.DefaultQuery("granularity", "day")
+
+	from, err := time.ParseInLocation("2006-01-02", dateFrom, time.Local)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, ErrorResponse{Error: "date_from 格式错误，应为 YYYY-MM-DD"})
+		return
+	}
+	toDay, err := time.ParseInLocation("2006-01-02", dateTo, time.Local)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, ErrorResponse{Error: "date_to 格式错误，应为 YYYY-MM-DD"})
+		return
+	}
+
+	analytics, err := utils.GetUserUsageAnalytics(userID, from, toDay.AddDate(0, 0, 1), granularity, c.Query("model"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, ErrorResponse{Error: err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, analytics)
+}
@@ -0,0 +1,100 @@
+package handlers
+
+import (
+	"errors"
+	"log"
+	"net/http"
+
+	"claude/database"
+	"claude/models"
+	"claude/utils"
+
+	"github.com/gin-gonic/gin"
+)
+
+// UpdateJobScheduleRequest 更新定时任务cron表达式请求
+type UpdateJobScheduleRequest struct {
+	Schedule string `json:"schedule" binding:"required"` // 5段式cron表达式，off 表示停用
+}
+
+// ===== 定时任务管理相关接口 =====
+
+// HandleAdminGetJobs 获取定时任务列表及最近一次执行情况
+func HandleAdminGetJobs(c *gin.Context) {
+	c.JSON(http.StatusOK, gin.H{
+		"data": utils.GetScheduledJobStatuses(),
+	})
+}
+
+// HandleAdminRunJob 手动触发定时任务，任务在后台执行
+func HandleAdminRunJob(c *gin.Context) {
+	adminUserID := c.GetUint("userID")
+	name := c.Param("name")
+
+	run, err := utils.TriggerScheduledJob(name, adminUserID)
+	if err != nil {
+		status := http.StatusBadRequest
+		if errors.Is(err, utils.ErrJobRunning) {
+			status = http.StatusConflict
+		}
+		c.JSON(status, gin.H{"error": err.Error()})
+		return
+	}
+
+	log.Printf("管理员手动触发定时任务: admin_id=%d, job=%s, run_id=%d", adminUserID, name, run.ID)
+
+	c.JSON(http.StatusAccepted, gin.H{
+		"success": true,
+		"data":    run,
+	})
+}
+
+// HandleAdminUpdateJobSchedule 更新定时任务的cron表达式
+func HandleAdminUpdateJobSchedule(c *gin.Context) {
+	var req UpdateJobScheduleRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "参数错误: " + err.Error()})
+		return
+	}
+
+	if err := utils.UpdateJobSchedule(c.Param("name"), req.Schedule); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"success": true,
+		"message": "定时任务计划已更新",
+	})
+}
+
+// HandleAdminGetJobRuns 获取定时任务执行记录
+func HandleAdminGetJobRuns(c *gin.Context) {
+	pagination := getPagination(c)
+	var runs []models.JobRun
+	var total int64
+
+	query := database.DB.Model(&models.JobRun{})
+	if name := c.Query("job_name"); name != "" {
+		query = query.Where("job_name = ?", name)
+	}
+	if status := c.Query("status"); status != "" {
+		query = query.Where("status = ?", status)
+	}
+	if trigger := c.Query("trigger_type"); trigger != "" {
+		query = query.Where("trigger_type = ?", trigger)
+	}
+
+	query.Count(&total)
+
+	offset := (pagination.Page - 1) * pagination.PageSize
+	query.Order("started_at DESC").Offset(offset).Limit(pagination.PageSize).Find(&runs)
+
+	c.JSON(http.StatusOK, PaginatedResponse{
+		Data:       runs,
+		Total:      total,
+		Page:       pagination.Page,
+		PageSize:   pagination.PageSize,
+		TotalPages: int((total + int64(pagination.PageSize) - 1) / int64(pagination.PageSize)),
+	})
+}
@@ -0,0 +1,573 @@
+package handlers
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"net/url"
+
+	"claude/config"
+	"claude/database"
+	"claude/models"
+	"claude/utils"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+)
+
+// OAuthAccountResponse 已绑定的第三方账号，不返回第三方令牌
+type OAuthAccountResponse struct {
+	Provider       string `json:"provider"`
+	DisplayName    string `json:"display_name"`
+	Username       string `json:"username"`
+	Name           string `json:"name"`
+	Email          string `json:"email"`
+	AvatarTemplate string `json:"avatar_template"`
+	CreatedAt      string `json:"created_at"`
+}
+
+// 完成OAuth注册请求结构
+type CompleteOAuthRegistrationRequest struct {
+	TempToken    string `json:"temp_token" binding:"required"`
+	Username     string `json:"username" binding:"required"`
+	Email        string `json:"email" binding:"required,email"`
+	ReferralCode string `json:"referral_code" binding:"max=32"` // 邀请码（可选）
+}
+
+// getOAuthRedirectURI 获取回调地址，使用当前Host拼接提供商登记的回调路径
+func getOAuthRedirectURI(c *gin.Context, provider utils.OAuthProvider) string {
+	scheme := "https"
+	if c.Request.TLS == nil {
+		scheme = "http"
+	}
+	return fmt.Sprintf("%s://%s%s", scheme, c.Request.Host, provider.CallbackPath())
+}
+
+// setOAuthStateCookie 将 state 摘要写入 HttpOnly Cookie，回调时校验发起授权和完成回调的是同一个浏览器
+func setOAuthStateCookie(c *gin.Context, state string) {
+	c.SetSameSite(http.SameSiteLaxMode)
+	c.SetCookie(utils.OAuthStateCookieName, utils.OAuthStateHash(state), utils.OAuthStateCookieMaxAge, "/", "", c.Request.TLS != nil, true)
+}
+
+// clearOAuthStateCookie 回调后清除 state Cookie
+func clearOAuthStateCookie(c *gin.Context) {
+	c.SetSameSite(http.SameSiteLaxMode)
+	c.SetCookie(utils.OAuthStateCookieName, "", -1, "/", "", c.Request.TLS != nil, true)
+}
+
+// oauthProviderDisplayName 获取提供商展示名称，未知提供商返回标识本身
+func oauthProviderDisplayName(name string) string {
+	for _, provider := range utils.ListOAuthProviders() {
+		if provider.Name() == name {
+			return provider.DisplayName()
+		}
+	}
+	return name
+}
+
+// HandleGetOAuthProviders 获取第三方登录方式及其配置状态
+func HandleGetOAuthProviders(c *gin.Context) {
+	providers := []gin.H{}
+	for _, provider := range utils.ListOAuthProviders() {
+		providers = append(providers, gin.H{
+			"name":         provider.Name(),
+			"display_name": provider.DisplayName(),
+			"available":    provider.Configured(),
+		})
+	}
+	c.JSON(http.StatusOK, gin.H{
+		"success":   true,
+		"providers": providers,
+	})
+}
+
+// HandleOAuthAuthorize 生成第三方登录授权URL，provider 通过查询参数指定
+func HandleOAuthAuthorize(c *gin.Context) {
+	handleOAuthAuthorize(c, c.Query("provider"))
+}
+
+func handleOAuthAuthorize(c *gin.Context, providerName string) {
+	provider, err := utils.GetOAuthProvider(providerName)
+	if err != nil {
+		c.JSON(http.StatusServiceUnavailable, gin.H{
+			"success": false,
+			"message": err.Error(),
+		})
+		return
+	}
+
+	// state 和 PKCE 校验值存入Redis，回调时校验
+	authURL, state, err := utils.BeginOAuth(provider, utils.OAuthModeLogin, 0, getOAuthRedirectURI(c, provider))
+	if err != nil {
+		log.Printf("生成%s授权地址失败: %v", provider.DisplayName(), err)
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"success": false,
+			"message": "生成授权地址失败",
+		})
+		return
+	}
+	setOAuthStateCookie(c, state)
+
+	c.JSON(http.StatusOK, gin.H{
+		"success":  true,
+		"auth_url": authURL,
+		"state":    state,
+	})
+}
+
+// HandleGitHubCallback GitHub OAuth回调
+func HandleGitHubCallback(c *gin.Context) {
+	handleOAuthCallback(c, "github")
+}
+
+// HandleGoogleCallback Google OAuth回调
+func HandleGoogleCallback(c *gin.Context) {
+	handleOAuthCallback(c, "google")
+}
+
+// redirectOAuthLinkResult 绑定流程结束后重定向回账户设置页
+func redirectOAuthLinkResult(c *gin.Context, providerName string, linkErr error) {
+	redirectURL := fmt.Sprintf("%s/settings?oauth_link=success&provider=%s",
+		config.AppConfig.FrontendURL, url.QueryEscape(providerName))
+	if linkErr != nil {
+		redirectURL = fmt.Sprintf("%s/settings?oauth_link=error&provider=%s&message=%s",
+			config.AppConfig.FrontendURL, url.QueryEscape(providerName), url.QueryEscape(linkErr.Error()))
+	}
+	c.Redirect(http.StatusTemporaryRedirect, redirectURL)
+}
+
+// handleOAuthCallback 处理OAuth2回调：校验state，使用PKCE换取令牌，获取资料后登录、引导注册或绑定
+func handleOAuthCallback(c *gin.Context, providerName string) {
+	provider, err := utils.GetOAuthProvider(providerName)
+	if err != nil {
+		c.JSON(http.StatusServiceUnavailable, AuthResponse{
+			Success: false,
+			Message: err.Error(),
+		})
+		return
+	}
+
+	// state 必须与发起授权的浏览器 Cookie 一致，防止攻击者诱导受害者完成攻击者发起的授权
+	stateCookie, _ := c.Cookie(utils.OAuthStateCookieName)
+	clearOAuthStateCookie(c)
+	if !utils.VerifyOAuthStateHash(c.Query("state"), stateCookie) {
+		log.Printf("%s OAuth state与浏览器Cookie不一致", provider.DisplayName())
+		c.JSON(http.StatusBadRequest, AuthResponse{
+			Success: false,
+			Message: utils.ErrOAuthStateInvalid.Error(),
+		})
+		return
+	}
+
+	// 校验state，state只能使用一次
+	oauthState, err := utils.ConsumeOAuthState(provider.Name(), c.Query("state"))
+	if err != nil {
+		log.Printf("%s OAuth state校验失败: %v", provider.DisplayName(), err)
+		c.JSON(http.StatusBadRequest, AuthResponse{
+			Success: false,
+			Message: utils.ErrOAuthStateInvalid.Error(),
+		})
+		return
+	}
+	isLink := oauthState.Mode == utils.OAuthModeLink
+
+	// 检查是否有错误
+	if errorParam := c.Query("error"); errorParam != "" {
+		errorDescription := c.Query("error_description")
+		log.Printf("%s OAuth错误: %s - %s", provider.DisplayName(), errorParam, errorDescription)
+		if isLink {
+			redirectOAuthLinkResult(c, provider.Name(), errors.New("授权失败："+errorDescription))
+			return
+		}
+		c.JSON(http.StatusBadRequest, AuthResponse{
+			Success: false,
+			Message: "授权失败：" + errorDescription,
+		})
+		return
+	}
+
+	// 检查必要参数
+	code := c.Query("code")
+	if code == "" {
+		c.JSON(http.StatusBadRequest, AuthResponse{
+			Success: false,
+			Message: "缺少授权码",
+		})
+		return
+	}
+
+	// 使用授权码和PKCE校验值获取访问令牌
+	tokenResp, err := provider.ExchangeCode(code, oauthState.CodeVerifier, oauthState.RedirectURI)
+	if err != nil {
+		log.Printf("%s获取访问令牌失败: %v", provider.DisplayName(), err)
+		if isLink {
+			redirectOAuthLinkResult(c, provider.Name(), errors.New("获取访问令牌失败"))
+			return
+		}
+		c.JSON(http.StatusInternalServerError, AuthResponse{
+			Success: false,
+			Message: "获取访问令牌失败",
+		})
+		return
+	}
+
+	// 使用访问令牌获取用户信息
+	profile, err := provider.FetchProfile(tokenResp)
+	if err != nil {
+		log.Printf("%s获取用户信息失败: %v", provider.DisplayName(), err)
+		if isLink {
+			redirectOAuthLinkResult(c, provider.Name(), errors.New("获取用户信息失败"))
+			return
+		}
+		c.JSON(http.StatusInternalServerError, AuthResponse{
+			Success: false,
+			Message: "获取用户信息失败",
+		})
+		return
+	}
+
+	// 绑定模式：关联到发起绑定的用户
+	if isLink {
+		err := utils.LinkOAuthAccount(oauthState.UserID, provider.Name(), profile, tokenResp)
+		if err != nil {
+			log.Printf("绑定%s账号失败: user_id=%d, error=%v", provider.DisplayName(), oauthState.UserID, err)
+		} else {
+			log.Printf("绑定%s账号成功: user_id=%d, provider_uid=%s", provider.DisplayName(), oauthState.UserID, profile.ProviderUID)
+		}
+		redirectOAuthLinkResult(c, provider.Name(), err)
+		return
+	}
+
+	// 首先尝试通过provider_uid查找已绑定的OAuth账号
+	account, err := utils.FindOAuthAccount(provider.Name(), profile.ProviderUID)
+	if err != nil {
+		// 没有找到已绑定的OAuth账号，引导用户完成注册
+		// 注意：为了安全起见，不自动匹配现有用户，避免账号劫持风险
+		tempToken, err := utils.StoreTemporaryOAuthUser(provider.Name(), profile, tokenResp)
+		if err != nil {
+			log.Printf("存储临时用户信息失败: %v", err)
+			c.JSON(http.StatusInternalServerError, AuthResponse{
+				Success: false,
+				Message: "登录处理失败",
+			})
+			return
+		}
+		redirectURL := fmt.Sprintf("%s/register/oauth-complete?temp_token=%s&provider=%s",
+			config.AppConfig.FrontendURL,
+			url.QueryEscape(tempToken),
+			url.QueryEscape(provider.Name()),
+		)
+		c.Redirect(http.StatusTemporaryRedirect, redirectURL)
+		return
+	}
+
+	// 找到已绑定的OAuth账号，更新信息并登录
+	if err := utils.UpdateOAuthAccount(account, profile, tokenResp); err != nil {
+		log.Printf("更新OAuth账号失败: %v", err)
+	}
+
+	var user models.User
+	if err := database.DB.Where("id = ?", account.UserID).First(&user).Error; err != nil {
+		log.Printf("查找关联用户失败: %v", err)
+		c.JSON(http.StatusInternalServerError, AuthResponse{
+			Success: false,
+			Message: "登录处理失败",
+		})
+		return
+	}
+
+	// 已启用两步验证时重定向到前端输入两步验证码，不签发令牌
+	if utils.IsTwoFactorEnabled(user.ID) {
+		challengeToken, err := utils.CreateTwoFactorChallenge(user.ID, provider.Name())
+		if err != nil {
+			log.Printf("创建两步验证挑战失败: user_id=%d, error=%v", user.ID, err)
+			c.JSON(http.StatusInternalServerError, AuthResponse{
+				Success: false,
+				Message: "登录处理失败",
+			})
+			return
+		}
+		redirectURL := fmt.Sprintf("%s/login/2fa?challenge_token=%s",
+			config.AppConfig.FrontendURL,
+			url.QueryEscape(challengeToken),
+		)
+		c.Redirect(http.StatusTemporaryRedirect, redirectURL)
+		return
+	}
+
+	// 生成访问令牌
+	token, err := utils.GenerateAccessToken(user.ID, user.Email)
+	if err != nil {
+		log.Printf("生成访问令牌失败: %v", err)
+		c.JSON(http.StatusInternalServerError, AuthResponse{
+			Success: false,
+			Message: "登录处理失败",
+		})
+		return
+	}
+
+	// 注册设备到Redis
+	deviceManager := utils.NewDeviceManager(database.TokenRedisClient, database.UserRedisClient, database.DeviceRedisClient)
+	device, err := deviceManager.RegisterDevice(
+		user.ID,
+		token,
+		c.ClientIP(),
+		c.GetHeader("User-Agent"),
+		"web",
+	)
+	refreshToken := ""
+	if err != nil {
+		log.Printf("设备注册失败: user_id=%d, error=%v", user.ID, err)
+		// 设备注册失败不影响登录，继续处理
+	} else {
+		refreshToken = device.RefreshToken
+		log.Printf("%s用户登录成功: user_id=%d, device_id=%s, ip=%s",
+			provider.DisplayName(), user.ID, device.ID, device.IP)
+	}
+
+	// 成功后重定向到前端，携带token信息
+	redirectURL := fmt.Sprintf("%s/?auth=success&token=%s&refresh_token=%s&expires_in=%d&message=%s",
+		config.AppConfig.FrontendURL,
+		url.QueryEscape(token),
+		url.QueryEscape(refreshToken),
+		utils.AccessTokenExpiresIn(),
+		url.QueryEscape("登录成功"),
+	)
+	c.Redirect(http.StatusTemporaryRedirect, redirectURL)
+}
+
+// HandleGetTemporaryOAuthUser 获取首次登录时暂存的第三方用户信息，用于预填注册表单
+func HandleGetTemporaryOAuthUser(c *gin.Context) {
+	handleGetTemporaryOAuthUser(c, "")
+}
+
+func handleGetTemporaryOAuthUser(c *gin.Context, providerName string) {
+	tempToken := c.Query("temp_token")
+	if tempToken == "" {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"success": false,
+			"message": "缺少临时令牌",
+		})
+		return
+	}
+
+	tempUser, err := utils.GetTemporaryOAuthUser(providerName, tempToken)
+	if err != nil {
+		c.JSON(http.StatusNotFound, gin.H{
+			"success": false,
+			"message": err.Error(),
+		})
+		return
+	}
+
+	// 第三方令牌只在服务端使用，不返回给前端
+	c.JSON(http.StatusOK, gin.H{
+		"success": true,
+		"data": gin.H{
+			"provider":   tempUser.Provider,
+			"user_info":  tempUser.UserInfo,
+			"created_at": tempUser.CreatedAt,
+		},
+	})
+}
+
+// HandleCompleteOAuthRegistration 首次使用第三方账号登录时完成注册
+func HandleCompleteOAuthRegistration(c *gin.Context) {
+	handleCompleteOAuthRegistration(c, "")
+}
+
+func handleCompleteOAuthRegistration(c *gin.Context, providerName string) {
+	var req CompleteOAuthRegistrationRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"success": false,
+			"message": "请求参数错误: " + err.Error(),
+		})
+		return
+	}
+
+	tempUser, err := utils.GetTemporaryOAuthUser(providerName, req.TempToken)
+	if err != nil {
+		c.JSON(http.StatusNotFound, gin.H{
+			"success": false,
+			"message": err.Error(),
+		})
+		return
+	}
+	providerName = tempUser.Provider
+
+	// 暂存期间该第三方账号可能已在其他请求中完成注册
+	if _, err := utils.FindOAuthAccount(providerName, tempUser.UserInfo.ProviderUID); err == nil {
+		c.JSON(http.StatusConflict, gin.H{
+			"success": false,
+			"message": "该第三方账号已注册，请直接登录",
+		})
+		return
+	}
+
+	// 检查用户名是否已存在
+	var existingUser models.User
+	err = database.DB.Where("username = ?", req.Username).First(&existingUser).Error
+	if err == nil {
+		c.JSON(http.StatusConflict, gin.H{
+			"success": false,
+			"message": "用户名已被使用，请选择其他用户名",
+		})
+		return
+	}
+
+	// 检查邮箱是否已存在
+	err = database.DB.Where("email = ?", req.Email).First(&existingUser).Error
+	if err == nil {
+		c.JSON(http.StatusConflict, gin.H{
+			"success": false,
+			"message": "邮箱已被使用，请选择其他邮箱",
+		})
+		return
+	}
+
+	// 创建新用户和OAuth账号绑定
+	user := models.User{
+		Username:              req.Username,
+		Email:                 req.Email,
+		Password:              nil, // 第三方登录的用户没有密码
+		DegradationGuaranteed: config.AppConfig.DefaultDegradationGuaranteed,
+		DegradationSource:     "system",
+		DegradationLocked:     false,
+		DegradationCounter:    0,
+	}
+	err = database.DB.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Create(&user).Error; err != nil {
+			return err
+		}
+		return utils.CreateOAuthAccount(tx, &user, providerName, tempUser.UserInfo, tempUser.TokenResp)
+	})
+	if err != nil {
+		log.Printf("创建用户失败: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"success": false,
+			"message": "创建用户失败",
+		})
+		return
+	}
+
+	// 生成访问令牌
+	token, err := utils.GenerateAccessToken(user.ID, user.Email)
+	if err != nil {
+		log.Printf("生成访问令牌失败: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"success": false,
+			"message": "生成访问令牌失败",
+		})
+		return
+	}
+
+	// 注册设备到Redis
+	deviceManager := utils.NewDeviceManager(database.TokenRedisClient, database.UserRedisClient, database.DeviceRedisClient)
+	device, err := deviceManager.RegisterDevice(
+		user.ID,
+		token,
+		c.ClientIP(),
+		c.GetHeader("User-Agent"),
+		"web",
+	)
+	refreshToken := ""
+	if err != nil {
+		log.Printf("设备注册失败: user_id=%d, error=%v", user.ID, err)
+		// 设备注册失败不影响注册，继续处理
+	} else {
+		refreshToken = device.RefreshToken
+		log.Printf("%s用户注册成功: user_id=%d, device_id=%s, ip=%s",
+			oauthProviderDisplayName(providerName), user.ID, device.ID, device.IP)
+	}
+
+	// 处理新用户注册套餐赠送
+	if err := utils.ProcessRegistrationPlanGift(user.ID, providerName); err != nil {
+		log.Printf("%s新用户套餐赠送失败: user_id=%d, error=%v", oauthProviderDisplayName(providerName), user.ID, err)
+		// 套餐赠送失败不影响注册，继续处理
+	}
+
+	// 记录邀请关系
+	recordReferral(c, user.ID, req.ReferralCode, providerName)
+
+	// 删除临时用户信息
+	utils.DeleteTemporaryOAuthUser(req.TempToken)
+
+	c.JSON(http.StatusOK, gin.H{
+		"success":       true,
+		"message":       "注册成功",
+		"token":         token,
+		"refresh_token": refreshToken,
+		"expires_in":    utils.AccessTokenExpiresIn(),
+		"user":          user,
+	})
+}
+
+// HandleGetOAuthAccounts 获取当前用户已绑定的第三方账号
+func HandleGetOAuthAccounts(c *gin.Context) {
+	userID := c.GetUint("userID")
+
+	accounts, err := utils.GetUserOAuthAccounts(userID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	result := make([]OAuthAccountResponse, 0, len(accounts))
+	for _, account := range accounts {
+		result = append(result, OAuthAccountResponse{
+			Provider:       account.Provider,
+			DisplayName:    oauthProviderDisplayName(account.Provider),
+			Username:       account.Username,
+			Name:           account.Name,
+			Email:          account.Email,
+			AvatarTemplate: account.AvatarTemplate,
+			CreatedAt:      account.CreatedAt.Format("2006-01-02 15:04:05"),
+		})
+	}
+
+	c.JSON(http.StatusOK, gin.H{"accounts": result})
+}
+
+// HandleOAuthLinkBegin 已登录用户发起绑定第三方账号，返回授权URL
+func HandleOAuthLinkBegin(c *gin.Context) {
+	userID := c.GetUint("userID")
+
+	provider, err := utils.GetOAuthProvider(c.Param("provider"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	authURL, state, err := utils.BeginOAuth(provider, utils.OAuthModeLink, userID, getOAuthRedirectURI(c, provider))
+	if err != nil {
+		log.Printf("生成%s绑定地址失败: user_id=%d, error=%v", provider.DisplayName(), userID, err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "生成授权地址失败"})
+		return
+	}
+	setOAuthStateCookie(c, state)
+
+	c.JSON(http.StatusOK, gin.H{
+		"auth_url": authURL,
+		"state":    state,
+	})
+}
+
+// HandleUnlinkOAuthAccount 解绑第三方账号
+func HandleUnlinkOAuthAccount(c *gin.Context) {
+	userID := c.GetUint("userID")
+	providerName := c.Param("provider")
+
+	if err := utils.UnlinkOAuthAccount(userID, providerName); err != nil {
+		status := http.StatusBadRequest
+		if errors.Is(err, utils.ErrOAuthAccountNotFound) {
+			status = http.StatusNotFound
+		}
+		c.JSON(status, gin.H{"error": err.Error()})
+		return
+	}
+
+	log.Printf("解绑第三方账号: user_id=%d, provider=%s", userID, providerName)
+	c.JSON(http.StatusOK, gin.H{"message": "解绑成功"})
+}
@@ -0,0 +1,162 @@
+package handlers
+
+import (
+	"io"
+	"log"
+	"net/http"
+	"strconv"
+
+	"claude/models"
+	"claude/utils"
+
+	"github.com/gin-gonic/gin"
+)
+
+// RotateOAuthClientSecretRequest 轮换客户端密钥请求
+type RotateOAuthClientSecretRequest struct {
+	GraceHours int `json:"grace_hours"` // 旧密钥继续有效的小时数，0表示立即失效
+}
+
+// oauthClientResponse 客户端信息，回调地址和权限范围以数组返回
+type oauthClientResponse struct {
+	models.OAuthClient
+	RedirectURIs []string `json:"redirect_uris"`
+	Scopes       []string `json:"scopes"`
+}
+
+func newOAuthClientResponse(client *models.OAuthClient) oauthClientResponse {
+	return oauthClientResponse{
+		OAuthClient:  *client,
+		RedirectURIs: utils.OAuthClientRedirectURIs(client),
+		Scopes:       utils.OAuthClientScopes(client),
+	}
+}
+
+// parseOAuthClientID 解析路径中的客户端ID
+func parseOAuthClientID(c *gin.Context) (uint, bool) {
+	id, err := strconv.ParseUint(c.Param("id"), 10, 32)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "无效的客户端ID"})
+		return 0, false
+	}
+	return uint(id), true
+}
+
+// HandleAdminGetOAuthClients 获取SSO客户端列表
+func HandleAdminGetOAuthClients(c *gin.Context) {
+	clients, err := utils.ListOAuthClients()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	data := make([]oauthClientResponse, 0, len(clients))
+	for i := range clients {
+		data = append(data, newOAuthClientResponse(&clients[i]))
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"success": true,
+		"data":    data,
+	})
+}
+
+// HandleAdminCreateOAuthClient 注册SSO客户端，密钥明文只在创建时返回一次
+func HandleAdminCreateOAuthClient(c *gin.Context) {
+	adminUserID := c.GetUint("userID")
+
+	var req utils.OAuthClientInput
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "参数错误: " + err.Error()})
+		return
+	}
+
+	client, secret, err := utils.CreateOAuthClient(&req, adminUserID)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusCreated, gin.H{
+		"success":       true,
+		"data":          newOAuthClientResponse(client),
+		"client_secret": secret,
+		"message":       "客户端密钥只显示一次，请妥善保存",
+	})
+}
+
+// HandleAdminUpdateOAuthClient 更新SSO客户端，停用后该客户端的所有设备立即下线
+func HandleAdminUpdateOAuthClient(c *gin.Context) {
+	id, ok := parseOAuthClientID(c)
+	if !ok {
+		return
+	}
+
+	var req utils.OAuthClientInput
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "参数错误: " + err.Error()})
+		return
+	}
+
+	client, err := utils.UpdateOAuthClient(id, &req)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	log.Printf("管理员更新SSO客户端: admin_id=%d, client_id=%s", c.GetUint("userID"), client.ClientID)
+
+	c.JSON(http.StatusOK, gin.H{
+		"success": true,
+		"data":    newOAuthClientResponse(client),
+	})
+}
+
+// HandleAdminRotateOAuthClientSecret 轮换SSO客户端密钥
+func HandleAdminRotateOAuthClientSecret(c *gin.Context) {
+	id, ok := parseOAuthClientID(c)
+	if !ok {
+		return
+	}
+
+	var req RotateOAuthClientSecretRequest
+	if err := c.ShouldBindJSON(&req); err != nil && err != io.EOF {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "参数错误: " + err.Error()})
+		return
+	}
+
+	client, secret, err := utils.RotateOAuthClientSecret(id, req.GraceHours)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	log.Printf("管理员轮换SSO客户端密钥: admin_id=%d, client_id=%s", c.GetUint("userID"), client.ClientID)
+
+	c.JSON(http.StatusOK, gin.H{
+		"success":       true,
+		"data":          newOAuthClientResponse(client),
+		"client_secret": secret,
+		"message":       "新密钥只显示一次，请妥善保存",
+	})
+}
+
+// HandleAdminDeleteOAuthClient 删除SSO客户端，该客户端的所有设备立即下线
+func HandleAdminDeleteOAuthClient(c *gin.Context) {
+	id, ok := parseOAuthClientID(c)
+	if !ok {
+		return
+	}
+
+	if err := utils.DeleteOAuthClient(id); err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+		return
+	}
+
+	log.Printf("管理员删除SSO客户端: admin_id=%d, id=%d", c.GetUint("userID"), id)
+
+	c.JSON(http.StatusOK, gin.H{
+		"success": true,
+		"message": "客户端已删除",
+	})
+}
@@ -0,0 +1,491 @@
+package handlers
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"claude/config"
+	"claude/database"
+	"claude/models"
+	"claude/utils"
+
+	"github.com/gin-gonic/gin"
+)
+
+// requireOrganizationRole 校验当前用户是否为指定组织成员且拥有所需角色
+func requireOrganizationRole(c *gin.Context, roles ...string) (*models.OrganizationMember, bool) {
+	userID := c.GetUint("userID")
+
+	organizationID, err := strconv.ParseUint(c.Param("id"), 10, 32)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "无效的组织ID"})
+		return nil, false
+	}
+
+	member, err := utils.GetOrganizationMember(uint(organizationID), userID)
+	if err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "组织不存在或您不是该组织成员"})
+		return nil, false
+	}
+
+	if len(roles) > 0 {
+		allowed := false
+		for _, role := range roles {
+			if member.Role == role {
+				allowed = true
+				break
+			}
+		}
+		if !allowed {
+			c.JSON(http.StatusForbidden, gin.H{"error": "您在该组织中没有执行此操作的权限"})
+			return nil, false
+		}
+	}
+
+	return member, true
+}
+
+// getOrganizationUsageDateRange 获取用量统计的日期范围，默认最近30天
+func getOrganizationUsageDateRange(c *gin.Context) (string, string) {
+	dateFrom := c.DefaultQuery("date_from", time.Now().AddDate(0, 0, -29).Format("2006-01-02"))
+	dateTo := c.DefaultQuery("date_to", time.Now().Format("2006-01-02"))
+	return dateFrom, dateTo
+}
+
+// HandleCreateOrganization 创建组织
+func HandleCreateOrganization(c *gin.Context) {
+	userID := c.GetUint("userID")
+
+	var request struct {
+		Name string `json:"name" binding:"required,max=100"`
+	}
+	if err := c.ShouldBindJSON(&request); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	name := strings.TrimSpace(request.Name)
+	if name == "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "组织名称不能为空"})
+		return
+	}
+
+	organization, err := utils.CreateOrganization(userID, name)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusCreated, gin.H{
+		"message":      "组织创建成功",
+		"organization": organization,
+	})
+}
+
+// HandleGetCurrentOrganization 获取当前用户所属组织信息
+func HandleGetCurrentOrganization(c *gin.Context) {
+	userID := c.GetUint("userID")
+
+	member, err := utils.GetUserOrganizationMember(userID)
+	if err != nil {
+		c.JSON(http.StatusOK, gin.H{
+			"organization": nil,
+		})
+		return
+	}
+
+	wallet, err := utils.GetOrCreateOrganizationWallet(member.OrganizationID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "获取组织钱包失败"})
+		return
+	}
+
+	var memberCount int64
+	database.DB.Model(&models.OrganizationMember{}).Where("organization_id = ?", member.OrganizationID).Count(&memberCount)
+
+	c.JSON(http.StatusOK, gin.H{
+		"organization": member.Organization,
+		"role":         member.Role,
+		"member_count": memberCount,
+		"my_quota": gin.H{
+			"daily_max_points":  member.DailyMaxPoints,
+			"today_points_used": utils.GetOrganizationMemberTodayUsage(member.OrganizationID, userID),
+		},
+		"wallet": gin.H{
+			"total_points":      wallet.TotalPoints,
+			"available_points":  wallet.AvailablePoints,
+			"used_points":       wallet.UsedPoints,
+			"wallet_expires_at": wallet.WalletExpiresAt,
+			"status":            wallet.Status,
+		},
+	})
+}
+
+// HandleGetOrganizationMembers 获取组织成员列表
+func HandleGetOrganizationMembers(c *gin.Context) {
+	member, ok := requireOrganizationRole(c)
+	if !ok {
+		return
+	}
+
+	var members []models.OrganizationMember
+	if err := database.DB.Preload("User").Where("organization_id = ?", member.OrganizationID).
+		Order("created_at ASC").Find(&members).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "获取组织成员失败"})
+		return
+	}
+
+	result := make([]gin.H, 0, len(members))
+	for _, m := range members {
+		result = append(result, gin.H{
+			"user_id":           m.UserID,
+			"username":          m.User.Username,
+			"email":             m.User.Email,
+			"role":              m.Role,
+			"daily_max_points":  m.DailyMaxPoints,
+			"today_points_used": utils.GetOrganizationMemberTodayUsage(m.OrganizationID, m.UserID),
+			"joined_at":         m.CreatedAt,
+		})
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"members": result,
+		"total":   len(result),
+	})
+}
+
+// HandleUpdateOrganizationMember 更新成员角色或每日额度
+func HandleUpdateOrganizationMember(c *gin.Context) {
+	operator, ok := requireOrganizationRole(c, "owner", "admin")
+	if !ok {
+		return
+	}
+
+	targetUserID, err := strconv.ParseUint(c.Param("user_id"), 10, 32)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "无效的用户ID"})
+		return
+	}
+
+	var request struct {
+		Role           *string `json:"role"`
+		DailyMaxPoints *int64  `json:"daily_max_points"`
+	}
+	if err := c.ShouldBindJSON(&request); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	// 只有所有者可以调整角色；管理员只能管理普通成员的额度
+	if request.Role != nil && operator.Role != "owner" {
+		c.JSON(http.StatusForbidden, gin.H{"error": "只有组织所有者可以修改成员角色"})
+		return
+	}
+	if operator.Role == "admin" {
+		target, err := utils.GetOrganizationMember(operator.OrganizationID, uint(targetUserID))
+		if err != nil {
+			c.JSON(http.StatusNotFound, gin.H{"error": "组织成员不存在"})
+			return
+		}
+		if target.Role != "member" {
+			c.JSON(http.StatusForbidden, gin.H{"error": "管理员只能管理普通成员"})
+			return
+		}
+	}
+
+	if err := utils.UpdateOrganizationMember(operator.OrganizationID, uint(targetUserID), request.Role, request.DailyMaxPoints); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "组织成员已更新"})
+}
+
+// HandleRemoveOrganizationMember 移除组织成员（成员也可以通过此接口退出组织）
+func HandleRemoveOrganizationMember(c *gin.Context) {
+	operator, ok := requireOrganizationRole(c)
+	if !ok {
+		return
+	}
+
+	targetUserID, err := strconv.ParseUint(c.Param("user_id"), 10, 32)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "无效的用户ID"})
+		return
+	}
+
+	if uint(targetUserID) != operator.UserID {
+		target, err := utils.GetOrganizationMember(operator.OrganizationID, uint(targetUserID))
+		if err != nil {
+			c.JSON(http.StatusNotFound, gin.H{"error": "组织成员不存在"})
+			return
+		}
+
+		switch operator.Role {
+		case "owner":
+		case "admin":
+			if target.Role != "member" {
+				c.JSON(http.StatusForbidden, gin.H{"error": "管理员只能移除普通成员"})
+				return
+			}
+		default:
+			c.JSON(http.StatusForbidden, gin.H{"error": "您在该组织中没有执行此操作的权限"})
+			return
+		}
+	}
+
+	if err := utils.RemoveOrganizationMember(operator.OrganizationID, uint(targetUserID)); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "组织成员已移除"})
+}
+
+// HandleCreateOrganizationInvitation 发送组织邀请
+func HandleCreateOrganizationInvitation(c *gin.Context) {
+	operator, ok := requireOrganizationRole(c, "owner", "admin")
+	if !ok {
+		return
+	}
+
+	var request struct {
+		Email string `json:"email" binding:"required,email"`
+		Role  string `json:"role"`
+	}
+	if err := c.ShouldBindJSON(&request); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	if request.Role == "" {
+		request.Role = "member"
+	}
+	if request.Role == "admin" && operator.Role != "owner" {
+		c.JSON(http.StatusForbidden, gin.H{"error": "只有组织所有者可以邀请管理员"})
+		return
+	}
+
+	invitation, token, err := utils.CreateOrganizationInvitation(operator.OrganizationID, operator.UserID, request.Email, request.Role)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	var inviter models.User
+	database.DB.Where("id = ?", operator.UserID).First(&inviter)
+
+	inviteURL := fmt.Sprintf("%s/organization/invite?token=%s", config.AppConfig.FrontendURL, url.QueryEscape(token))
+	if err := utils.SendOrganizationInvitationEmail(invitation.Email, operator.Organization.Name, inviter.Username, inviteURL, invitation.ExpiresAt); err != nil {
+		log.Printf("发送组织邀请邮件失败: org_id=%d, email=%s, error=%v", operator.OrganizationID, invitation.Email, err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "邀请已创建，但邮件发送失败，请稍后重新邀请"})
+		return
+	}
+
+	c.JSON(http.StatusCreated, gin.H{
+		"message":    "邀请已发送",
+		"invitation": invitation,
+	})
+}
+
+// HandleGetOrganizationInvitations 获取组织邀请列表
+func HandleGetOrganizationInvitations(c *gin.Context) {
+	operator, ok := requireOrganizationRole(c, "owner", "admin")
+	if !ok {
+		return
+	}
+
+	query := database.DB.Preload("InvitedBy").Where("organization_id = ?", operator.OrganizationID)
+	if status := c.Query("status"); status != "" {
+		query = query.Where("status = ?", status)
+	}
+
+	var invitations []models.OrganizationInvitation
+	if err := query.Order("created_at DESC").Limit(200).Find(&invitations).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "获取邀请列表失败"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"invitations": invitations,
+		"total":       len(invitations),
+	})
+}
+
+// HandleRevokeOrganizationInvitation 撤销组织邀请
+func HandleRevokeOrganizationInvitation(c *gin.Context) {
+	operator, ok := requireOrganizationRole(c, "owner", "admin")
+	if !ok {
+		return
+	}
+
+	result := database.DB.Model(&models.OrganizationInvitation{}).
+		Where("id = ? AND organization_id = ? AND status = ?", c.Param("invitation_id"), operator.OrganizationID, "pending").
+		Update("status", "revoked")
+	if result.Error != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": result.Error.Error()})
+		return
+	}
+
+	if result.RowsAffected == 0 {
+		c.JSON(http.StatusNotFound, gin.H{"error": "邀请不存在或已处理"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "邀请已撤销"})
+}
+
+// HandleAcceptOrganizationInvitation 接受组织邀请
+func HandleAcceptOrganizationInvitation(c *gin.Context) {
+	userID := c.GetUint("userID")
+
+	var request struct {
+		Token string `json:"token" binding:"required"`
+	}
+	if err := c.ShouldBindJSON(&request); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	member, err := utils.AcceptOrganizationInvitation(userID, request.Token)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"message":         "已成功加入组织",
+		"organization_id": member.OrganizationID,
+		"role":            member.Role,
+	})
+}
+
+// HandleRedeemCouponToOrganization 兑换激活码到组织钱包
+func HandleRedeemCouponToOrganization(c *gin.Context) {
+	operator, ok := requireOrganizationRole(c, "owner", "admin")
+	if !ok {
+		return
+	}
+
+	var req RedeemCouponRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request format"})
+		return
+	}
+
+	// 激活码统一按大写查询，与校验位检查使用同一规范化结果
+	req.CouponCode = utils.NormalizeActivationCode(req.CouponCode)
+
+	guard := utils.NewBruteForceGuard(utils.BruteForceScopeCoupon, c.ClientIP(), strconv.FormatUint(uint64(operator.UserID), 10), utils.ActivationCodeGuessGroup(req.CouponCode))
+	if err := guard.Check(); err != nil {
+		c.JSON(http.StatusTooManyRequests, gin.H{
+			"success": false,
+			"message": err.Error(),
+		})
+		return
+	}
+
+	if err := utils.CheckActivationCodeFormat(req.CouponCode); err != nil {
+		guard.Fail()
+		c.JSON(http.StatusOK, gin.H{
+			"success": false,
+			"message": err.Error(),
+		})
+		return
+	}
+
+	var activationCode models.ActivationCode
+	err := database.DB.Preload("Plan").Where("code = ? AND status = ?", req.CouponCode, "unused").First(&activationCode).Error
+	if err != nil {
+		guard.Fail()
+		// 激活码分组失败次数过多时，分组内不存在的激活码直接返回锁定提示
+		if lockErr := guard.CheckCodeGroup(); lockErr != nil {
+			c.JSON(http.StatusTooManyRequests, gin.H{
+				"success": false,
+				"message": lockErr.Error(),
+			})
+			return
+		}
+		c.JSON(http.StatusOK, gin.H{
+			"success": false,
+			"message": "无效的激活码或已被使用。",
+		})
+		return
+	}
+	guard.Succeed()
+
+	plan, err := utils.ResolvePlanVersion(database.DB, &activationCode.Plan, activationCode.PlanVersionID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	activationCode.Plan = *plan
+	if err := utils.CheckPlanAvailability(plan); err != nil {
+		c.JSON(http.StatusOK, gin.H{
+			"success": false,
+			"message": err.Error(),
+		})
+		return
+	}
+
+	var user models.User
+	if err := database.DB.Where("id = ?", operator.UserID).First(&user).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "获取用户信息失败"})
+		return
+	}
+	if err := utils.CheckActivationCodeEligibility(database.DB, &activationCode, &user); err != nil {
+		c.JSON(http.StatusOK, gin.H{
+			"success": false,
+			"message": err.Error(),
+		})
+		return
+	}
+
+	if err := utils.RedeemActivationCodeToOrganization(operator.OrganizationID, operator.UserID, &activationCode); err != nil {
+		status := http.StatusInternalServerError
+		if errors.Is(err, utils.ErrActivationCodeClaimed) || errors.Is(err, utils.ErrPlanSoldOut) {
+			status = http.StatusConflict
+		}
+		c.JSON(status, gin.H{
+			"success": false,
+			"message": fmt.Sprintf("激活码兑换失败: %s", err.Error()),
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"success": true,
+		"message": fmt.Sprintf("激活码兑换成功！组织钱包已充值 %d 积分，有效期 %d 天。",
+			activationCode.Plan.PointAmount,
+			activationCode.Plan.ValidityDays),
+	})
+}
+
+// HandleGetOrganizationUsage 获取组织按成员的用量统计
+func HandleGetOrganizationUsage(c *gin.Context) {
+	operator, ok := requireOrganizationRole(c, "owner", "admin")
+	if !ok {
+		return
+	}
+
+	dateFrom, dateTo := getOrganizationUsageDateRange(c)
+	usage, err := utils.GetOrganizationUsageBreakdown(operator.OrganizationID, dateFrom, dateTo)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"members": usage,
+		"date_range": gin.H{
+			"from": dateFrom,
+			"to":   dateTo,
+		},
+	})
+}
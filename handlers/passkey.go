@@ -0,0 +1,197 @@
+package handlers
+
+import (
+	"log"
+	"net/http"
+	"strconv"
+
+	"claude/database"
+	"claude/models"
+	"claude/utils"
+
+	"github.com/gin-gonic/gin"
+)
+
+// PasskeyRegisterFinishRequest 完成通行密钥注册请求
+type PasskeyRegisterFinishRequest struct {
+	Name       string                  `json:"name"`
+	Credential utils.PasskeyCredential `json:"credential" binding:"required"`
+}
+
+// PasskeyLoginFinishRequest 完成通行密钥登录请求
+type PasskeyLoginFinishRequest struct {
+	SessionID  string                  `json:"session_id" binding:"required"`
+	Credential utils.PasskeyCredential `json:"credential" binding:"required"`
+}
+
+// HandlePasskeyRegisterBegin 获取注册通行密钥的选项，前端传给 navigator.credentials.create()
+func HandlePasskeyRegisterBegin(c *gin.Context) {
+	var user models.User
+	if err := database.DB.Where("id = ?", c.GetUint("userID")).First(&user).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "用户不存在"})
+		return
+	}
+
+	options, err := utils.BeginPasskeyRegistration(&user)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"options": options})
+}
+
+// HandlePasskeyRegisterFinish 校验并保存新注册的通行密钥
+func HandlePasskeyRegisterFinish(c *gin.Context) {
+	var req PasskeyRegisterFinishRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "参数错误: " + err.Error()})
+		return
+	}
+
+	var user models.User
+	if err := database.DB.Where("id = ?", c.GetUint("userID")).First(&user).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "用户不存在"})
+		return
+	}
+
+	passkey, err := utils.FinishPasskeyRegistration(&user, req.Name, &req.Credential)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	log.Printf("用户注册通行密钥: user_id=%d, passkey_id=%d, aaguid=%s", user.ID, passkey.ID, passkey.AAGUID)
+
+	c.JSON(http.StatusOK, gin.H{
+		"success": true,
+		"message": "通行密钥注册成功",
+		"data":    passkey,
+	})
+}
+
+// HandleGetPasskeys 获取当前用户的通行密钥列表
+func HandleGetPasskeys(c *gin.Context) {
+	passkeys, err := utils.GetUserPasskeys(c.GetUint("userID"))
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"data": passkeys})
+}
+
+// HandleDeletePasskey 删除当前用户的通行密钥
+func HandleDeletePasskey(c *gin.Context) {
+	passkeyID, err := strconv.ParseUint(c.Param("id"), 10, 32)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "无效的通行密钥ID"})
+		return
+	}
+
+	userID := c.GetUint("userID")
+	if err := utils.DeletePasskey(userID, uint(passkeyID)); err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+		return
+	}
+
+	log.Printf("用户删除通行密钥: user_id=%d, passkey_id=%d", userID, passkeyID)
+
+	c.JSON(http.StatusOK, gin.H{
+		"success": true,
+		"message": "通行密钥已删除",
+	})
+}
+
+// HandlePasskeyLoginBegin 获取通行密钥登录选项，前端传给 navigator.credentials.get()
+func HandlePasskeyLoginBegin(c *gin.Context) {
+	sessionID, options, err := utils.BeginPasskeyLogin()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"session_id": sessionID,
+		"options":    options,
+	})
+}
+
+// HandlePasskeyLoginFinish 校验通行密钥签名并登录
+func HandlePasskeyLoginFinish(c *gin.Context) {
+	var req PasskeyLoginFinishRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, AuthResponse{
+			Success: false,
+			Message: "请求格式错误：" + err.Error(),
+		})
+		return
+	}
+
+	guard := utils.NewBruteForceGuard(utils.BruteForceScopeLogin, c.ClientIP(), "", "")
+	if err := guard.Check(); err != nil {
+		c.JSON(http.StatusTooManyRequests, AuthResponse{
+			Success: false,
+			Message: err.Error(),
+		})
+		return
+	}
+
+	user, userVerified, err := utils.FinishPasskeyLogin(req.SessionID, &req.Credential)
+	if err != nil {
+		guard.Fail()
+		c.JSON(http.StatusUnauthorized, AuthResponse{
+			Success: false,
+			Message: err.Error(),
+		})
+		return
+	}
+
+	// 认证器未验证用户身份（生物识别或PIN）时只相当于持有设备，已启用两步验证的用户仍需输入两步验证码
+	if !userVerified && respondTwoFactorChallenge(c, user, "passkey") {
+		return
+	}
+
+	// 生成访问令牌
+	token, err := utils.GenerateAccessToken(user.ID, user.Email)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, AuthResponse{
+			Success: false,
+			Message: "生成访问令牌失败",
+		})
+		return
+	}
+
+	// 注册设备到Redis
+	deviceManager := utils.NewDeviceManager(database.TokenRedisClient, database.UserRedisClient, database.DeviceRedisClient)
+	device, err := deviceManager.RegisterDevice(
+		user.ID,
+		token,
+		c.ClientIP(),
+		c.GetHeader("User-Agent"),
+		"web",
+	)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, AuthResponse{
+			Success: false,
+			Message: "设备注册失败",
+		})
+		return
+	}
+
+	log.Printf("用户通行密钥登录成功: user_id=%d, device_id=%s, ip=%s", user.ID, device.ID, device.IP)
+
+	c.JSON(http.StatusOK, AuthResponse{
+		Success:      true,
+		Message:      "登录成功",
+		Token:        token,
+		RefreshToken: device.RefreshToken,
+		ExpiresIn:    utils.AccessTokenExpiresIn(),
+		User: &UserData{
+			ID:       user.ID,
+			Username: user.Username,
+			Email:    user.Email,
+			IsAdmin:  user.IsAdmin,
+		},
+	})
+}
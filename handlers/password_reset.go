@@ -0,0 +1,117 @@
+package handlers
+
+import (
+	"errors"
+	"log"
+	"net/http"
+	"strings"
+
+	"claude/utils"
+
+	"github.com/gin-gonic/gin"
+	"golang.org/x/crypto/bcrypt"
+)
+
+// ForgotPasswordRequest 找回密码请求
+type ForgotPasswordRequest struct {
+	Email string `json:"email" binding:"required,email"`
+}
+
+// ResetPasswordRequest 重置密码请求
+type ResetPasswordRequest struct {
+	Token       string `json:"token" binding:"required"`
+	NewPassword string `json:"new_password" binding:"required,min=6"`
+}
+
+// 无论邮箱是否注册都返回相同提示，避免枚举已注册邮箱
+const forgotPasswordMessage = "如果该邮箱已注册，我们已向其发送重置密码邮件，请查收"
+
+// HandleForgotPassword 发送找回密码邮件
+func HandleForgotPassword(c *gin.Context) {
+	var req ForgotPasswordRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"success": false,
+			"message": "请求格式错误：" + err.Error(),
+		})
+		return
+	}
+
+	// 每次请求都计入次数，限制同一IP和同一邮箱在统计窗口内的请求数
+	guard := utils.NewBruteForceGuard(utils.BruteForceScopePasswordReset, c.ClientIP(), strings.ToLower(req.Email), "")
+	if err := guard.Check(); err != nil {
+		c.JSON(http.StatusTooManyRequests, gin.H{
+			"success": false,
+			"message": err.Error(),
+		})
+		return
+	}
+	guard.Fail()
+
+	if err := utils.RequestPasswordReset(req.Email); err != nil {
+		log.Printf("处理找回密码请求失败: error=%v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"success": false,
+			"message": "发送失败，请稍后再试",
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"success": true,
+		"message": forgotPasswordMessage,
+	})
+}
+
+// HandleResetPassword 通过邮件中的重置链接设置新密码
+func HandleResetPassword(c *gin.Context) {
+	var req ResetPasswordRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"success": false,
+			"message": "请求格式错误：" + err.Error(),
+		})
+		return
+	}
+
+	guard := utils.NewBruteForceGuard(utils.BruteForceScopePasswordReset, c.ClientIP(), "", "")
+	if err := guard.Check(); err != nil {
+		c.JSON(http.StatusTooManyRequests, gin.H{
+			"success": false,
+			"message": err.Error(),
+		})
+		return
+	}
+
+	// 加密新密码
+	hashedPassword, err := bcrypt.GenerateFromPassword([]byte(req.NewPassword), bcrypt.DefaultCost)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"success": false,
+			"message": "密码加密失败",
+		})
+		return
+	}
+
+	if _, err := utils.CompletePasswordReset(req.Token, string(hashedPassword), c.ClientIP()); err != nil {
+		if errors.Is(err, utils.ErrPasswordResetTokenInvalid) {
+			guard.Fail()
+			c.JSON(http.StatusBadRequest, gin.H{
+				"success": false,
+				"message": err.Error(),
+			})
+			return
+		}
+		log.Printf("重置密码失败: error=%v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"success": false,
+			"message": "重置密码失败",
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"success": true,
+		"message": "密码已重置，所有设备已下线，请使用新密码登录",
+	})
+}
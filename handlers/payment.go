@@ -0,0 +1,256 @@
+package handlers
+
+import (
+	"errors"
+	"io"
+	"log"
+	"net/http"
+	"strconv"
+	"time"
+
+	"claude/database"
+	"claude/models"
+	"claude/utils"
+
+	"github.com/gin-gonic/gin"
+)
+
+// 支付回调请求体最大长度
+const maxPaymentWebhookBodySize = 1 << 20
+
+// CreatePaymentOrderRequest 创建支付订单请求
+type CreatePaymentOrderRequest struct {
+	PlanID   uint   `json:"plan_id" binding:"required"`
+	Provider string `json:"provider" binding:"required"`
+}
+
+// RefundPaymentOrderRequest 管理员退款请求
+type RefundPaymentOrderRequest struct {
+	Reason string `json:"reason" binding:"max=500"`
+}
+
+// HandleGetPaymentProviders 获取已启用的支付方式
+func HandleGetPaymentProviders(c *gin.Context) {
+	c.JSON(http.StatusOK, gin.H{
+		"providers": utils.GetPaymentProviderNames(),
+	})
+}
+
+// HandleCreatePaymentOrder 创建支付订单，返回支付跳转地址
+func HandleCreatePaymentOrder(c *gin.Context) {
+	userID := c.GetUint("userID")
+
+	var req CreatePaymentOrderRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "参数错误: " + err.Error()})
+		return
+	}
+
+	order, err := utils.CreatePaymentOrder(userID, req.PlanID, req.Provider)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	log.Printf("创建支付订单: user_id=%d, order_no=%s, plan_id=%d, provider=%s, amount=%.2f %s",
+		userID, order.OrderNo, order.SubscriptionPlanID, order.Provider, order.Amount, order.Currency)
+
+	c.JSON(http.StatusOK, gin.H{
+		"success": true,
+		"data":    order,
+	})
+}
+
+// HandleGetPaymentOrders 获取当前用户的支付订单
+func HandleGetPaymentOrders(c *gin.Context) {
+	userID := c.GetUint("userID")
+	pagination := getPagination(c)
+	var orders []models.PaymentOrder
+	var total int64
+
+	query := database.DB.Model(&models.PaymentOrder{}).Where("user_id = ?", userID)
+	if status := c.Query("status"); status != "" {
+		query = query.Where("status = ?", status)
+	}
+
+	query.Count(&total)
+
+	offset := (pagination.Page - 1) * pagination.PageSize
+	query.Preload("Plan").Order("created_at DESC").
+		Offset(offset).Limit(pagination.PageSize).Find(&orders)
+
+	c.JSON(http.StatusOK, PaginatedResponse{
+		Data:       orders,
+		Total:      total,
+		Page:       pagination.Page,
+		PageSize:   pagination.PageSize,
+		TotalPages: int((total + int64(pagination.PageSize) - 1) / int64(pagination.PageSize)),
+	})
+}
+
+// HandleGetPaymentOrder 获取当前用户的单个支付订单（用于支付结果页轮询）
+func HandleGetPaymentOrder(c *gin.Context) {
+	userID := c.GetUint("userID")
+
+	var order models.PaymentOrder
+	if err := database.DB.Preload("Plan").
+		Where("order_no = ? AND user_id = ?", c.Param("order_no"), userID).
+		First(&order).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "订单不存在"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"data": order})
+}
+
+// HandleCancelPaymentOrder 取消未支付的订单
+func HandleCancelPaymentOrder(c *gin.Context) {
+	userID := c.GetUint("userID")
+
+	if err := utils.CancelPaymentOrder(userID, c.Param("order_no")); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"success": true,
+		"message": "订单已取消",
+	})
+}
+
+// HandlePaymentWebhook 支付渠道回调，签名由各渠道适配器校验
+func HandlePaymentWebhook(c *gin.Context) {
+	providerName := c.Param("provider")
+	provider, ok := utils.GetPaymentProvider(providerName)
+	if !ok {
+		c.JSON(http.StatusNotFound, gin.H{"error": "支付渠道不存在"})
+		return
+	}
+
+	body, err := io.ReadAll(io.LimitReader(c.Request.Body, maxPaymentWebhookBodySize))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "读取请求体失败"})
+		return
+	}
+
+	event, err := provider.ParseWebhook(c.Request.Header, body)
+	if err != nil {
+		log.Printf("支付回调校验失败: provider=%s, ip=%s, error=%v", providerName, c.ClientIP(), err)
+		if errors.Is(err, utils.ErrPaymentSignature) {
+			c.JSON(http.StatusUnauthorized, gin.H{"error": err.Error()})
+		} else {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		}
+		return
+	}
+
+	// 处理失败时返回非2xx，由渠道重试
+	if err := utils.ProcessPaymentEvent(providerName, event, body); err != nil {
+		log.Printf("❌ 处理支付回调失败: provider=%s, event_id=%s, order_no=%s, error=%v",
+			providerName, event.EventID, event.OrderNo, err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "处理回调失败"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"received": true})
+}
+
+// HandleMockPay 模拟支付完成（仅在启用模拟支付渠道时可用）
+func HandleMockPay(c *gin.Context) {
+	userID := c.GetUint("userID")
+
+	provider, ok := utils.GetPaymentProvider("mock")
+	if !ok {
+		c.JSON(http.StatusNotFound, gin.H{"error": "模拟支付未启用"})
+		return
+	}
+	mockProvider := provider.(*utils.MockPaymentProvider)
+
+	var order models.PaymentOrder
+	if err := database.DB.Where("order_no = ? AND user_id = ? AND provider = ?", c.Param("order_no"), userID, "mock").
+		First(&order).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "订单不存在"})
+		return
+	}
+	if order.Status != "pending" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "订单状态为 " + order.Status + "，无法支付"})
+		return
+	}
+	if time.Now().After(order.ExpiresAt) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "订单已过期"})
+		return
+	}
+
+	if err := mockProvider.CompletePayment(&order); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "模拟支付失败: " + err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"success": true,
+		"message": "模拟支付成功",
+	})
+}
+
+// ===== 支付订单管理相关接口 =====
+
+// HandleAdminGetPaymentOrders 管理员查看支付订单
+func HandleAdminGetPaymentOrders(c *gin.Context) {
+	pagination := getPagination(c)
+	var orders []models.PaymentOrder
+	var total int64
+
+	query := database.DB.Model(&models.PaymentOrder{})
+	if userIDStr := c.Query("user_id"); userIDStr != "" {
+		if id, err := strconv.ParseUint(userIDStr, 10, 32); err == nil {
+			query = query.Where("user_id = ?", id)
+		}
+	}
+	if status := c.Query("status"); status != "" {
+		query = query.Where("status = ?", status)
+	}
+	if provider := c.Query("provider"); provider != "" {
+		query = query.Where("provider = ?", provider)
+	}
+	if orderNo := c.Query("order_no"); orderNo != "" {
+		query = query.Where("order_no = ?", orderNo)
+	}
+
+	query.Count(&total)
+
+	offset := (pagination.Page - 1) * pagination.PageSize
+	query.Preload("User").Preload("Plan").Order("created_at DESC").
+		Offset(offset).Limit(pagination.PageSize).Find(&orders)
+
+	c.JSON(http.StatusOK, PaginatedResponse{
+		Data:       orders,
+		Total:      total,
+		Page:       pagination.Page,
+		PageSize:   pagination.PageSize,
+		TotalPages: int((total + int64(pagination.PageSize) - 1) / int64(pagination.PageSize)),
+	})
+}
+
+// HandleAdminRefundPaymentOrder 管理员对已支付订单发起退款
+func HandleAdminRefundPaymentOrder(c *gin.Context) {
+	adminUserID := c.GetUint("userID")
+	orderNo := c.Param("order_no")
+
+	var req RefundPaymentOrderRequest
+	if err := c.ShouldBindJSON(&req); err != nil && err != io.EOF {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "参数错误: " + err.Error()})
+		return
+	}
+
+	if err := utils.RefundPaymentOrder(orderNo, req.Reason); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	log.Printf("管理员退款支付订单: admin_id=%d, order_no=%s, reason=%s", adminUserID, orderNo, req.Reason)
+
+	c.JSON(http.StatusOK, gin.H{
+		"success": true,
+		"message": "退款成功",
+	})
+}
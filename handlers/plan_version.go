@@ -0,0 +1,109 @@
+package handlers
+
+import (
+	"net/http"
+	"strconv"
+	"time"
+
+	"claude/utils"
+
+	"github.com/gin-gonic/gin"
+)
+
+// UpdatePlanScheduleRequest 设置订阅计划上下架时间和库存请求
+type UpdatePlanScheduleRequest struct {
+	AvailableFrom  *time.Time `json:"available_from"`  // 上架时间，为空表示立即可用
+	AvailableUntil *time.Time `json:"available_until"` // 下架时间，为空表示不下架
+	InventoryCap   int64      `json:"inventory_cap"`   // 库存上限，0表示不限制
+}
+
+// ===== 订阅计划版本相关接口 =====
+
+// HandleAdminGetPlanVersions 获取订阅计划的版本历史
+func HandleAdminGetPlanVersions(c *gin.Context) {
+	planID, err := strconv.ParseUint(c.Param("id"), 10, 32)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "无效的订阅计划ID"})
+		return
+	}
+
+	versions, err := utils.GetPlanVersions(uint(planID))
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"data": versions})
+}
+
+// HandleAdminDiffPlanVersions 对比订阅计划的两个版本，默认对比当前版本与上一版本
+func HandleAdminDiffPlanVersions(c *gin.Context) {
+	planID, err := strconv.ParseUint(c.Param("id"), 10, 32)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "无效的订阅计划ID"})
+		return
+	}
+
+	versions, err := utils.GetPlanVersions(uint(planID))
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	if len(versions) == 0 {
+		c.JSON(http.StatusNotFound, gin.H{"error": "订阅计划没有版本记录"})
+		return
+	}
+
+	to := versions[0].Version
+	from := to - 1
+	if value := c.Query("to"); value != "" {
+		if to, err = strconv.Atoi(value); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "to 必须是版本号"})
+			return
+		}
+		from = to - 1
+	}
+	if value := c.Query("from"); value != "" {
+		if from, err = strconv.Atoi(value); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "from 必须是版本号"})
+			return
+		}
+	}
+	if from < 1 {
+		from = 1
+	}
+
+	diff, err := utils.DiffPlanVersions(uint(planID), from, to)
+	if err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, diff)
+}
+
+// HandleAdminUpdatePlanSchedule 设置订阅计划的上下架时间和库存上限
+func HandleAdminUpdatePlanSchedule(c *gin.Context) {
+	planID, err := strconv.ParseUint(c.Param("id"), 10, 32)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "无效的订阅计划ID"})
+		return
+	}
+
+	var req UpdatePlanScheduleRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "参数错误: " + err.Error()})
+		return
+	}
+
+	plan, err := utils.UpdatePlanSchedule(uint(planID), req.AvailableFrom, req.AvailableUntil, req.InventoryCap)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"success": true,
+		"data":    plan,
+	})
+}
@@ -0,0 +1,256 @@
+package handlers
+
+import (
+	"log"
+	"net/http"
+	"strconv"
+	"time"
+
+	"claude/database"
+	"claude/models"
+	"claude/utils"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+)
+
+// PromoCodeRequest 创建/更新优惠码请求
+type PromoCodeRequest struct {
+	Code               string     `json:"code" binding:"required,max=64"`
+	Name               string     `json:"name" binding:"required,max=191"`
+	Description        string     `json:"description"`
+	RewardType         string     `json:"reward_type" binding:"required"`
+	PointsAmount       int64      `json:"points_amount"`
+	ValidityDays       int        `json:"validity_days"`
+	Percent            int        `json:"percent"`
+	MaxUses            int        `json:"max_uses"`
+	PerUserLimit       *int       `json:"per_user_limit"` // 为空时默认每人1次，0表示不限制
+	StartsAt           *time.Time `json:"starts_at"`
+	EndsAt             *time.Time `json:"ends_at"`
+	NewUsersOnly       bool       `json:"new_users_only"`
+	SubscriptionPlanID *uint      `json:"subscription_plan_id"`
+	OAuthProvider      string     `json:"oauth_provider"`
+	Active             *bool      `json:"active"`
+}
+
+// applyTo 将请求内容写入优惠码模型
+func (req *PromoCodeRequest) applyTo(promo *models.PromoCode) {
+	promo.Code = utils.NormalizePromoCode(req.Code)
+	promo.Name = req.Name
+	promo.Description = req.Description
+	promo.RewardType = req.RewardType
+	promo.PointsAmount = req.PointsAmount
+	promo.ValidityDays = req.ValidityDays
+	promo.Percent = req.Percent
+	promo.MaxUses = req.MaxUses
+	promo.StartsAt = req.StartsAt
+	promo.EndsAt = req.EndsAt
+	promo.NewUsersOnly = req.NewUsersOnly
+	promo.SubscriptionPlanID = req.SubscriptionPlanID
+	promo.OAuthProvider = req.OAuthProvider
+	if req.PerUserLimit != nil {
+		promo.PerUserLimit = *req.PerUserLimit
+	}
+	if req.Active != nil {
+		promo.Active = *req.Active
+	}
+}
+
+// HandleGetMyPromoRedemptions 获取当前用户的优惠码使用记录（含待使用的优惠）
+func HandleGetMyPromoRedemptions(c *gin.Context) {
+	userID := c.GetUint("userID")
+
+	var redemptions []models.PromoRedemption
+	if err := database.DB.Preload("PromoCode", func(db *gorm.DB) *gorm.DB { return db.Unscoped() }).
+		Where("user_id = ?", userID).
+		Order("created_at DESC").Limit(100).Find(&redemptions).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "获取优惠码记录失败"})
+		return
+	}
+
+	result := make([]gin.H, 0, len(redemptions))
+	for _, redemption := range redemptions {
+		result = append(result, gin.H{
+			"id":             redemption.ID,
+			"code":           redemption.PromoCode.Code,
+			"name":           redemption.PromoCode.Name,
+			"summary":        utils.PromoSummary(&redemption.PromoCode),
+			"reward_type":    redemption.RewardType,
+			"status":         redemption.Status,
+			"points_amount":  redemption.PointsAmount,
+			"discount_value": redemption.DiscountValue,
+			"applied_at":     redemption.AppliedAt,
+			"created_at":     redemption.CreatedAt,
+		})
+	}
+
+	c.JSON(http.StatusOK, gin.H{"data": result})
+}
+
+// ===== 优惠码管理相关接口 =====
+
+// HandleAdminGetPromoCodes 获取优惠码列表
+func HandleAdminGetPromoCodes(c *gin.Context) {
+	pagination := getPagination(c)
+	var promos []models.PromoCode
+	var total int64
+
+	query := database.DB.Model(&models.PromoCode{})
+	if code := c.Query("code"); code != "" {
+		query = query.Where("code LIKE ?", "%"+utils.NormalizePromoCode(code)+"%")
+	}
+	if rewardType := c.Query("reward_type"); rewardType != "" {
+		query = query.Where("reward_type = ?", rewardType)
+	}
+	if active := c.Query("active"); active != "" {
+		query = query.Where("active = ?", active == "true")
+	}
+
+	query.Count(&total)
+
+	offset := (pagination.Page - 1) * pagination.PageSize
+	query.Preload("Plan").Order("created_at DESC").
+		Offset(offset).Limit(pagination.PageSize).Find(&promos)
+
+	c.JSON(http.StatusOK, PaginatedResponse{
+		Data:       promos,
+		Total:      total,
+		Page:       pagination.Page,
+		PageSize:   pagination.PageSize,
+		TotalPages: int((total + int64(pagination.PageSize) - 1) / int64(pagination.PageSize)),
+	})
+}
+
+// HandleAdminCreatePromoCode 创建优惠码
+func HandleAdminCreatePromoCode(c *gin.Context) {
+	adminUserID := c.GetUint("userID")
+
+	var req PromoCodeRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "参数错误: " + err.Error()})
+		return
+	}
+
+	promo := models.PromoCode{
+		PerUserLimit:     1,
+		Active:           true,
+		CreatedByAdminID: adminUserID,
+	}
+	req.applyTo(&promo)
+	if err := utils.ValidatePromoCode(&promo); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	// 优惠码与激活码共用兑换入口，不能重复
+	var codeCount int64
+	database.DB.Model(&models.ActivationCode{}).Where("code = ?", promo.Code).Count(&codeCount)
+	if codeCount > 0 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "该优惠码与已有激活码重复"})
+		return
+	}
+
+	if err := database.DB.Create(&promo).Error; err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "创建优惠码失败，优惠码可能已存在"})
+		return
+	}
+
+	log.Printf("管理员创建优惠码: admin_id=%d, code=%s, reward_type=%s", adminUserID, promo.Code, promo.RewardType)
+
+	c.JSON(http.StatusCreated, gin.H{
+		"success": true,
+		"data":    promo,
+	})
+}
+
+// HandleAdminUpdatePromoCode 更新优惠码（已使用次数不变）
+func HandleAdminUpdatePromoCode(c *gin.Context) {
+	id, err := strconv.ParseUint(c.Param("id"), 10, 32)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "无效的优惠码ID"})
+		return
+	}
+
+	var promo models.PromoCode
+	if err := database.DB.Where("id = ?", id).First(&promo).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "优惠码不存在"})
+		return
+	}
+
+	var req PromoCodeRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "参数错误: " + err.Error()})
+		return
+	}
+
+	req.applyTo(&promo)
+	if err := utils.ValidatePromoCode(&promo); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	// 使用Select更新所有字段，允许将布尔值和可选条件清空
+	if err := database.DB.Model(&promo).Select(
+		"code", "name", "description", "reward_type", "points_amount", "validity_days", "percent",
+		"max_uses", "per_user_limit", "starts_at", "ends_at", "new_users_only",
+		"subscription_plan_id", "oauth_provider", "active",
+	).Updates(&promo).Error; err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "更新优惠码失败: " + err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"success": true,
+		"data":    promo,
+	})
+}
+
+// HandleAdminDeletePromoCode 删除优惠码（已领取未使用的优惠不受影响）
+func HandleAdminDeletePromoCode(c *gin.Context) {
+	result := database.DB.Where("id = ?", c.Param("id")).Delete(&models.PromoCode{})
+	if result.Error != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "删除优惠码失败"})
+		return
+	}
+	if result.RowsAffected == 0 {
+		c.JSON(http.StatusNotFound, gin.H{"error": "优惠码不存在"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"success": true,
+		"message": "优惠码已删除",
+	})
+}
+
+// HandleAdminGetPromoRedemptions 获取优惠码使用记录
+func HandleAdminGetPromoRedemptions(c *gin.Context) {
+	pagination := getPagination(c)
+	var redemptions []models.PromoRedemption
+	var total int64
+
+	query := database.DB.Model(&models.PromoRedemption{})
+	if promoID := c.Query("promo_code_id"); promoID != "" {
+		query = query.Where("promo_code_id = ?", promoID)
+	}
+	if userID := c.Query("user_id"); userID != "" {
+		query = query.Where("user_id = ?", userID)
+	}
+	if status := c.Query("status"); status != "" {
+		query = query.Where("status = ?", status)
+	}
+
+	query.Count(&total)
+
+	offset := (pagination.Page - 1) * pagination.PageSize
+	query.Preload("PromoCode").Preload("User").Order("created_at DESC").
+		Offset(offset).Limit(pagination.PageSize).Find(&redemptions)
+
+	c.JSON(http.StatusOK, PaginatedResponse{
+		Data:       redemptions,
+		Total:      total,
+		Page:       pagination.Page,
+		PageSize:   pagination.PageSize,
+		TotalPages: int((total + int64(pagination.PageSize) - 1) / int64(pagination.PageSize)),
+	})
+}
@@ -0,0 +1,116 @@
+package handlers
+
+import (
+	"net/http"
+	"strconv"
+
+	"claude/database"
+	"claude/models"
+	"claude/utils"
+
+	"github.com/gin-gonic/gin"
+)
+
+// RetryRenewalRequest 重新发起续费支付请求
+type RetryRenewalRequest struct {
+	Provider string `json:"provider"` // 为空时使用订阅原有的支付渠道
+}
+
+// parseSubscriptionID 解析路径中的订阅ID
+func parseSubscriptionID(c *gin.Context) (uint, bool) {
+	id, err := strconv.ParseUint(c.Param("id"), 10, 32)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "无效的订阅ID"})
+		return 0, false
+	}
+	return uint(id), true
+}
+
+// HandleGetRecurringSubscriptions 获取当前用户的周期订阅及未支付的续费订单
+func HandleGetRecurringSubscriptions(c *gin.Context) {
+	userID := c.GetUint("userID")
+
+	subs, err := utils.GetUserRecurringSubscriptions(userID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "获取周期订阅失败"})
+		return
+	}
+
+	result := make([]gin.H, 0, len(subs))
+	for _, sub := range subs {
+		item := gin.H{
+			"subscription": sub,
+		}
+		if sub.Status == "past_due" {
+			var order models.PaymentOrder
+			if err := database.DB.Where("subscription_id = ? AND status = ?", sub.ID, "pending").
+				Order("created_at DESC").First(&order).Error; err == nil {
+				item["pending_renewal_order"] = order
+			}
+		}
+		result = append(result, item)
+	}
+
+	c.JSON(http.StatusOK, gin.H{"data": result})
+}
+
+// HandleCancelRecurringSubscription 取消周期订阅（当前周期结束后生效）
+func HandleCancelRecurringSubscription(c *gin.Context) {
+	userID := c.GetUint("userID")
+	subscriptionID, ok := parseSubscriptionID(c)
+	if !ok {
+		return
+	}
+
+	if err := utils.CancelRecurringSubscription(userID, subscriptionID); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"success": true,
+		"message": "订阅已取消，当前周期内权益不受影响",
+	})
+}
+
+// HandleResumeRecurringSubscription 撤销周期结束时取消
+func HandleResumeRecurringSubscription(c *gin.Context) {
+	userID := c.GetUint("userID")
+	subscriptionID, ok := parseSubscriptionID(c)
+	if !ok {
+		return
+	}
+
+	if err := utils.ResumeRecurringSubscription(userID, subscriptionID); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"success": true,
+		"message": "订阅已恢复自动续费",
+	})
+}
+
+// HandleRetrySubscriptionRenewal 宽限期内重新发起续费支付
+func HandleRetrySubscriptionRenewal(c *gin.Context) {
+	userID := c.GetUint("userID")
+	subscriptionID, ok := parseSubscriptionID(c)
+	if !ok {
+		return
+	}
+
+	var req RetryRenewalRequest
+	c.ShouldBindJSON(&req)
+
+	order, err := utils.RetrySubscriptionRenewal(userID, subscriptionID, req.Provider)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"success": true,
+		"data":    order,
+	})
+}
@@ -0,0 +1,197 @@
+package handlers
+
+import (
+	"log"
+	"net/http"
+	"strconv"
+	"time"
+
+	"claude/database"
+	"claude/models"
+	"claude/utils"
+
+	"github.com/gin-gonic/gin"
+)
+
+// recordReferral 注册成功后记录邀请关系，失败不影响注册
+func recordReferral(c *gin.Context, userID uint, code, source string) {
+	if code == "" {
+		return
+	}
+	deviceHash := utils.ReferralDeviceHash(c.ClientIP(), c.GetHeader("User-Agent"), c.GetHeader("X-Device-Fingerprint"))
+	if err := utils.RecordReferral(userID, code, source, c.ClientIP(), deviceHash); err != nil {
+		log.Printf("记录邀请关系失败: user_id=%d, code=%s, error=%v", userID, code, err)
+	}
+}
+
+// maskUsername 隐藏用户名中间部分，用于邀请列表展示
+func maskUsername(username string) string {
+	runes := []rune(username)
+	if len(runes) <= 2 {
+		return string(runes[:1]) + "*"
+	}
+	return string(runes[:1]) + "***" + string(runes[len(runes)-1:])
+}
+
+// HandleGetReferralDashboard 获取当前用户的邀请码、邀请链接、奖励规则和统计
+func HandleGetReferralDashboard(c *gin.Context) {
+	userID := c.GetUint("userID")
+
+	referralCode, err := utils.GetOrCreateReferralCode(userID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	stats, err := utils.GetReferralStats(userID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "获取邀请统计失败"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"code":     referralCode.Code,
+		"link":     utils.ReferralLink(referralCode.Code),
+		"settings": utils.GetReferralSettings(),
+		"stats":    stats,
+	})
+}
+
+// HandleGetMyReferrals 获取当前用户邀请的用户列表
+func HandleGetMyReferrals(c *gin.Context) {
+	userID := c.GetUint("userID")
+	pagination := getPagination(c)
+	var referrals []models.Referral
+	var total int64
+
+	query := database.DB.Model(&models.Referral{}).Where("referrer_id = ?", userID)
+	if status := c.Query("status"); status != "" {
+		query = query.Where("status = ?", status)
+	}
+
+	query.Count(&total)
+
+	offset := (pagination.Page - 1) * pagination.PageSize
+	query.Preload("Referee").Order("created_at DESC").
+		Offset(offset).Limit(pagination.PageSize).Find(&referrals)
+
+	// 不向邀请人暴露被邀请人的邮箱等信息
+	result := make([]gin.H, 0, len(referrals))
+	for _, referral := range referrals {
+		result = append(result, gin.H{
+			"id":              referral.ID,
+			"referee":         maskUsername(referral.Referee.Username),
+			"status":          referral.Status,
+			"reject_reason":   referral.RejectReason,
+			"referrer_points": referral.ReferrerPoints,
+			"converted_at":    referral.ConvertedAt,
+			"created_at":      referral.CreatedAt,
+		})
+	}
+
+	c.JSON(http.StatusOK, PaginatedResponse{
+		Data:       result,
+		Total:      total,
+		Page:       pagination.Page,
+		PageSize:   pagination.PageSize,
+		TotalPages: int((total + int64(pagination.PageSize) - 1) / int64(pagination.PageSize)),
+	})
+}
+
+// ===== 邀请管理相关接口 =====
+
+// HandleAdminGetReferrals 获取邀请关系列表
+func HandleAdminGetReferrals(c *gin.Context) {
+	pagination := getPagination(c)
+	var referrals []models.Referral
+	var total int64
+
+	query := database.DB.Model(&models.Referral{})
+	if referrerID := c.Query("referrer_id"); referrerID != "" {
+		if id, err := strconv.ParseUint(referrerID, 10, 32); err == nil {
+			query = query.Where("referrer_id = ?", id)
+		}
+	}
+	if refereeID := c.Query("referee_id"); refereeID != "" {
+		if id, err := strconv.ParseUint(refereeID, 10, 32); err == nil {
+			query = query.Where("referee_id = ?", id)
+		}
+	}
+	if status := c.Query("status"); status != "" {
+		query = query.Where("status = ?", status)
+	}
+	if source := c.Query("source"); source != "" {
+		query = query.Where("source = ?", source)
+	}
+	if ip := c.Query("register_ip"); ip != "" {
+		query = query.Where("register_ip = ?", ip)
+	}
+
+	query.Count(&total)
+
+	offset := (pagination.Page - 1) * pagination.PageSize
+	query.Preload("Referrer").Preload("Referee").Order("created_at DESC").
+		Offset(offset).Limit(pagination.PageSize).Find(&referrals)
+
+	c.JSON(http.StatusOK, PaginatedResponse{
+		Data:       referrals,
+		Total:      total,
+		Page:       pagination.Page,
+		PageSize:   pagination.PageSize,
+		TotalPages: int((total + int64(pagination.PageSize) - 1) / int64(pagination.PageSize)),
+	})
+}
+
+// HandleAdminGetReferralReport 邀请数据汇总及邀请人排行，可按注册日期筛选排行
+func HandleAdminGetReferralReport(c *gin.Context) {
+	var start, end *time.Time
+	if dateFrom := c.Query("date_from"); dateFrom != "" {
+		t, err := time.ParseInLocation("2006-01-02", dateFrom, time.Local)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "date_from 格式错误，应为 YYYY-MM-DD"})
+			return
+		}
+		start = &t
+	}
+	if dateTo := c.Query("date_to"); dateTo != "" {
+		t, err := time.ParseInLocation("2006-01-02", dateTo, time.Local)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "date_to 格式错误，应为 YYYY-MM-DD"})
+			return
+		}
+		t = t.AddDate(0, 0, 1)
+		end = &t
+	}
+
+	limit, _ := strconv.Atoi(c.DefaultQuery("limit", "20"))
+	if limit < 1 || limit > 100 {
+		limit = 20
+	}
+
+	stats, err := utils.GetReferralStats(0)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "获取邀请统计失败"})
+		return
+	}
+
+	topReferrers, err := utils.GetTopReferrers(start, end, limit)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "获取邀请排行失败"})
+		return
+	}
+
+	// 风控拒绝原因分布
+	var rejectReasons []struct {
+		Reason string `json:"reason"`
+		Count  int64  `json:"count"`
+	}
+	database.DB.Model(&models.Referral{}).Select("reject_reason AS reason, COUNT(*) AS count").
+		Where("status = ?", "rejected").Group("reject_reason").Scan(&rejectReasons)
+
+	c.JSON(http.StatusOK, gin.H{
+		"settings":       utils.GetReferralSettings(),
+		"stats":          stats,
+		"top_referrers":  topReferrers,
+		"reject_reasons": rejectReasons,
+	})
+}
@@ -0,0 +1,75 @@
+package handlers
+
+import (
+	"errors"
+	"log"
+	"net/http"
+
+	"claude/database"
+	"claude/utils"
+
+	"github.com/gin-gonic/gin"
+)
+
+// RefreshTokenRequest 刷新令牌请求
+type RefreshTokenRequest struct {
+	RefreshToken string `json:"refresh_token" binding:"required"`
+}
+
+// refreshErrorCode 刷新失败时返回给客户端的错误码，客户端据此决定是否要求重新登录
+func refreshErrorCode(err error) string {
+	switch {
+	case errors.Is(err, utils.ErrRefreshTokenReused):
+		return "REFRESH_TOKEN_REUSED"
+	case errors.Is(err, utils.ErrRefreshUserDisabled):
+		return "USER_DISABLED"
+	default:
+		return "REFRESH_TOKEN_INVALID"
+	}
+}
+
+// HandleRefreshToken 使用刷新令牌换取新的访问令牌，刷新令牌同时轮换
+func HandleRefreshToken(c *gin.Context) {
+	var req RefreshTokenRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, AuthResponse{
+			Success: false,
+			Message: "请求参数错误",
+		})
+		return
+	}
+
+	// SSO客户端的设备只能通过 /api/sso/refresh-token 携带客户端凭据刷新
+	deviceManager := utils.NewDeviceManager(database.TokenRedisClient, database.UserRedisClient, database.DeviceRedisClient)
+	user, token, device, err := deviceManager.RefreshTokens(req.RefreshToken, c.ClientIP(), "", "")
+	if err != nil {
+		if errors.Is(err, utils.ErrRefreshTokenInvalid) || errors.Is(err, utils.ErrRefreshTokenReused) || errors.Is(err, utils.ErrRefreshUserDisabled) {
+			c.JSON(http.StatusUnauthorized, gin.H{
+				"success": false,
+				"message": err.Error(),
+				"code":    refreshErrorCode(err),
+			})
+			return
+		}
+		log.Printf("刷新令牌失败: error=%v", err)
+		c.JSON(http.StatusInternalServerError, AuthResponse{
+			Success: false,
+			Message: "刷新令牌失败",
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, AuthResponse{
+		Success:      true,
+		Message:      "刷新成功",
+		Token:        token,
+		RefreshToken: device.RefreshToken,
+		ExpiresIn:    device.ExpiresIn(),
+		User: &UserData{
+			ID:       user.ID,
+			Username: user.Username,
+			Email:    user.Email,
+			IsAdmin:  user.IsAdmin,
+		},
+	})
+}
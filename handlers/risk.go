@@ -0,0 +1,109 @@
+package handlers
+
+import (
+	"log"
+	"net/http"
+	"strconv"
+
+	"claude/database"
+	"claude/models"
+	"claude/utils"
+
+	"github.com/gin-gonic/gin"
+)
+
+// ===== 风控相关接口 =====
+
+// HandleAdminGetRiskEvents 获取风控事件审核队列，默认只返回待审核事件，可按 status、signal_type、user_id 筛选
+func HandleAdminGetRiskEvents(c *gin.Context) {
+	pagination := getPagination(c)
+	var events []models.RiskEvent
+	var total int64
+
+	query := database.DB.Model(&models.RiskEvent{})
+	if status := c.DefaultQuery("status", utils.RiskEventPending); status != "all" {
+		query = query.Where("status = ?", status)
+	}
+	if signalType := c.Query("signal_type"); signalType != "" {
+		query = query.Where("signal_type = ?", signalType)
+	}
+	if userID := c.Query("user_id"); userID != "" {
+		query = query.Where("user_id = ?", userID)
+	}
+
+	if err := query.Count(&total).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "获取风控事件失败"})
+		return
+	}
+
+	offset := (pagination.Page - 1) * pagination.PageSize
+	if err := query.Preload("User").Order("score DESC, created_at DESC").Offset(offset).Limit(pagination.PageSize).Find(&events).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "获取风控事件失败"})
+		return
+	}
+
+	c.JSON(http.StatusOK, PaginatedResponse{
+		Data:       events,
+		Total:      total,
+		Page:       pagination.Page,
+		PageSize:   pagination.PageSize,
+		TotalPages: int((total + int64(pagination.PageSize) - 1) / int64(pagination.PageSize)),
+	})
+}
+
+// RiskEventReviewRequest 审核风控事件请求
+type RiskEventReviewRequest struct {
+	Status       string `json:"status" binding:"required"` // confirmed, dismissed
+	Action       string `json:"action"`                    // none, device_logout, disable
+	DisableHours int64  `json:"disable_hours"`             // 临时禁用时长（小时），为0时使用风控配置
+	Note         string `json:"note"`
+}
+
+// HandleAdminReviewRiskEvent 审核风控事件，确认时可下线用户设备或临时禁用账户
+func HandleAdminReviewRiskEvent(c *gin.Context) {
+	eventID, err := strconv.ParseUint(c.Param("id"), 10, 32)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "无效的事件ID"})
+		return
+	}
+
+	var req RiskEventReviewRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "参数错误: " + err.Error()})
+		return
+	}
+
+	adminID := c.GetUint("userID")
+	event, err := utils.ReviewRiskEvent(uint(eventID), adminID, req.Status, req.Action, req.DisableHours, req.Note)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	log.Printf("管理员审核风控事件: admin_id=%d, event_id=%d, user_id=%d, status=%s, action=%s", adminID, event.ID, event.UserID, event.Status, event.ReviewAction)
+
+	c.JSON(http.StatusOK, gin.H{
+		"success": true,
+		"data":    event,
+	})
+}
+
+// HandleAdminGetUserRisk 获取用户当前的风控信号、风险分和风控事件
+func HandleAdminGetUserRisk(c *gin.Context) {
+	userID, err := strconv.ParseUint(c.Param("id"), 10, 32)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "无效的用户ID"})
+		return
+	}
+
+	profile, err := utils.GetUserRiskProfile(uint(userID))
+	if err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"data":     profile,
+		"settings": utils.GetRiskSettings(),
+	})
+}
@@ -1,8 +1,8 @@
 package handlers
 
 import (
+	"errors"
 	"net/http"
-	"net/url"
 
 	"claude/config"
 	"claude/database"
@@ -26,20 +26,32 @@ type VerifyCodeRequest struct {
 	ClientSecret string `json:"client_secret" binding:"required"`
 }
 
+// SSORefreshTokenRequest SSO客户端刷新令牌请求结构
+type SSORefreshTokenRequest struct {
+	RefreshToken string `json:"refresh_token" binding:"required"`
+	ClientID     string `json:"client_id" binding:"required"`
+	ClientSecret string `json:"client_secret" binding:"required"`
+}
+
 // TokenVerifyResponse Token验证响应结构
 type TokenVerifyResponse struct {
 	Authenticated bool   `json:"authenticated"`
 	UserID        string `json:"userId,omitempty"`
 	Email         string `json:"email,omitempty"`
+	Scope         string `json:"scope,omitempty"`
 	Error         string `json:"error,omitempty"`
 }
 
 // CodeVerifyResponse 设备码验证响应结构
 type CodeVerifyResponse struct {
-	Token  string `json:"token,omitempty"`
-	UserID string `json:"userId,omitempty"`
-	Email  string `json:"email,omitempty"`
-	Error  string `json:"error,omitempty"`
+	Token        string `json:"token,omitempty"`
+	RefreshToken string `json:"refreshToken,omitempty"`
+	ExpiresIn    int    `json:"expiresIn,omitempty"`
+	UserID       string `json:"userId,omitempty"`
+	Email        string `json:"email,omitempty"`
+	Scope        string `json:"scope,omitempty"`
+	Error        string `json:"error,omitempty"`
+	Code         string `json:"code,omitempty"`
 }
 
 // AuthorizeRequest OAuth授权请求结构
@@ -47,12 +59,28 @@ type AuthorizeRequest struct {
 	ClientID    string `json:"client_id" binding:"required"`
 	RedirectURI string `json:"redirect_uri" binding:"required"`
 	State       string `json:"state" binding:"required"`
+	Scope       string `json:"scope"` // 空格分隔，为空时授予客户端允许的全部权限
 	DeviceFlow  bool   `json:"device_flow"`
 }
 
-// validateClient 验证客户端凭据
-func validateClient(clientID, clientSecret string) bool {
-	return clientID == config.AppConfig.ClientID && clientSecret == config.AppConfig.ClientSecret
+// ssoEmail 客户端获得email权限时才返回邮箱
+func ssoEmail(user *models.User, scope string) string {
+	if utils.HasOAuthScope(scope, "email") {
+		return user.Email
+	}
+	return ""
+}
+
+// ssoDeviceIssuedTo 令牌是否签发给该客户端：只接受SSO设备，网页登录的令牌不能被客户端验证
+// 升级前签发的SSO设备没有记录客户端，只允许环境变量配置的客户端验证
+func ssoDeviceIssuedTo(device *utils.DeviceInfo, client *models.OAuthClient) bool {
+	if device.Source != "sso" {
+		return false
+	}
+	if device.ClientID == "" {
+		return config.AppConfig.ClientID != "" && client.ClientID == config.AppConfig.ClientID
+	}
+	return device.ClientID == client.ClientID
 }
 
 // HandleAuthorize OAuth授权页面处理器
@@ -85,25 +113,35 @@ func HandleAuthorize(c *gin.Context) {
 	}
 
 	// 验证客户端ID
-	if req.ClientID != config.AppConfig.ClientID {
+	client, err := utils.GetOAuthClient(req.ClientID)
+	if err != nil {
 		c.JSON(http.StatusBadRequest, gin.H{
 			"error": "Invalid client ID",
 		})
 		return
 	}
 
-	// 验证重定向URI
-	if _, err := url.Parse(req.RedirectURI); err != nil {
+	// 验证重定向URI必须在客户端白名单中
+	if err := utils.ValidateOAuthRedirectURI(client, req.RedirectURI); err != nil {
 		c.JSON(http.StatusBadRequest, gin.H{
 			"error": "Invalid redirect URI",
 		})
 		return
 	}
 
+	// 验证请求的权限范围
+	scope, err := utils.ResolveOAuthScopes(client, req.Scope)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error": "Invalid scope",
+		})
+		return
+	}
+
 	// 根据是否是设备流程返回不同响应
 	if req.DeviceFlow {
 		// 设备码模式 - 生成设备码
-		deviceCode, err := utils.StoreDeviceCode(userID)
+		deviceCode, err := utils.StoreDeviceCode(userID, client.ClientID, scope)
 		if err != nil {
 			c.JSON(http.StatusInternalServerError, gin.H{
 				"error": "Failed to generate device code",
@@ -117,7 +155,7 @@ func HandleAuthorize(c *gin.Context) {
 		})
 	} else {
 		// 自动模式 - 生成真实的JWT token
-		token, err := utils.GenerateAccessToken(user.ID, user.Email)
+		token, err := utils.GenerateAccessTokenWithTTL(user.ID, user.Email, utils.OAuthClientAccessTokenTTL(client))
 		if err != nil {
 			c.JSON(http.StatusInternalServerError, gin.H{
 				"error": "Failed to generate access token",
@@ -127,12 +165,13 @@ func HandleAuthorize(c *gin.Context) {
 
 		// 注册SSO设备到Redis
 		deviceManager := utils.NewDeviceManager(database.TokenRedisClient, database.UserRedisClient, database.DeviceRedisClient)
-		_, err = deviceManager.RegisterDevice(
+		device, err := deviceManager.RegisterDeviceWithOptions(
 			user.ID,
 			token,
 			c.ClientIP(),
 			c.GetHeader("User-Agent"),
 			"sso",
+			utils.OAuthClientTokenOptions(client, scope),
 		)
 		if err != nil {
 			c.JSON(http.StatusInternalServerError, gin.H{
@@ -142,8 +181,11 @@ func HandleAuthorize(c *gin.Context) {
 		}
 
 		c.JSON(http.StatusOK, gin.H{
-			"token":       token,
-			"device_flow": false,
+			"token":         token,
+			"refresh_token": device.RefreshToken,
+			"expires_in":    device.ExpiresIn(),
+			"scope":         scope,
+			"device_flow":   false,
 		})
 	}
 }
@@ -160,7 +202,8 @@ func HandleVerifyToken(c *gin.Context) {
 	}
 
 	// 验证客户端凭据
-	if !validateClient(req.ClientID, req.ClientSecret) {
+	client, err := utils.AuthenticateOAuthClient(req.ClientID, req.ClientSecret)
+	if err != nil {
 		c.JSON(http.StatusUnauthorized, TokenVerifyResponse{
 			Authenticated: false,
 			Error:         "Invalid client credentials",
@@ -170,6 +213,13 @@ func HandleVerifyToken(c *gin.Context) {
 
 	// 先验证JWT格式
 	claims, err := utils.ValidateAccessToken(req.Token)
+	if errors.Is(err, utils.ErrAccessTokenExpired) {
+		c.JSON(http.StatusUnauthorized, TokenVerifyResponse{
+			Authenticated: false,
+			Error:         "Token expired",
+		})
+		return
+	}
 	if err != nil {
 		c.JSON(http.StatusUnauthorized, TokenVerifyResponse{
 			Authenticated: false,
@@ -198,6 +248,15 @@ func HandleVerifyToken(c *gin.Context) {
 		return
 	}
 
+	// 客户端只能验证自己签发的令牌
+	if !ssoDeviceIssuedTo(device, client) {
+		c.JSON(http.StatusUnauthorized, TokenVerifyResponse{
+			Authenticated: false,
+			Error:         "Token not issued to this client",
+		})
+		return
+	}
+
 	// 获取用户信息
 	var user models.User
 	if err := database.DB.Where("id = ?", device.UserID).First(&user).Error; err != nil {
@@ -212,7 +271,8 @@ func HandleVerifyToken(c *gin.Context) {
 	c.JSON(http.StatusOK, TokenVerifyResponse{
 		Authenticated: true,
 		UserID:        user.Username, // 返回用户名而不是数字ID
-		Email:         user.Email,
+		Email:         ssoEmail(&user, device.Scope),
+		Scope:         device.Scope,
 	})
 }
 
@@ -227,7 +287,8 @@ func HandleVerifyCode(c *gin.Context) {
 	}
 
 	// 验证客户端凭据
-	if !validateClient(req.ClientID, req.ClientSecret) {
+	client, err := utils.AuthenticateOAuthClient(req.ClientID, req.ClientSecret)
+	if err != nil {
 		c.JSON(http.StatusUnauthorized, CodeVerifyResponse{
 			Error: "Invalid client credentials",
 		})
@@ -235,7 +296,7 @@ func HandleVerifyCode(c *gin.Context) {
 	}
 
 	// 验证设备码
-	user, err := utils.ValidateDeviceCode(req.Code)
+	user, scope, err := utils.ValidateDeviceCode(req.Code, client.ClientID)
 	if err != nil {
 		c.JSON(http.StatusBadRequest, CodeVerifyResponse{
 			Error: err.Error(),
@@ -244,7 +305,7 @@ func HandleVerifyCode(c *gin.Context) {
 	}
 
 	// 生成访问令牌
-	token, err := utils.GenerateAccessToken(user.ID, user.Email)
+	token, err := utils.GenerateAccessTokenWithTTL(user.ID, user.Email, utils.OAuthClientAccessTokenTTL(client))
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, CodeVerifyResponse{
 			Error: "Failed to generate access token",
@@ -254,12 +315,13 @@ func HandleVerifyCode(c *gin.Context) {
 
 	// 注册SSO设备到Redis
 	deviceManager := utils.NewDeviceManager(database.TokenRedisClient, database.UserRedisClient, database.DeviceRedisClient)
-	_, err = deviceManager.RegisterDevice(
+	device, err := deviceManager.RegisterDeviceWithOptions(
 		user.ID,
 		token,
 		c.ClientIP(),
 		c.GetHeader("User-Agent"),
 		"sso",
+		utils.OAuthClientTokenOptions(client, scope),
 	)
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, CodeVerifyResponse{
@@ -270,8 +332,57 @@ func HandleVerifyCode(c *gin.Context) {
 
 	// 返回成功响应
 	c.JSON(http.StatusOK, CodeVerifyResponse{
-		Token:  token,
-		UserID: user.Username, // 返回用户名而不是数字ID
-		Email:  user.Email,
+		Token:        token,
+		RefreshToken: device.RefreshToken,
+		ExpiresIn:    device.ExpiresIn(),
+		UserID:       user.Username, // 返回用户名而不是数字ID
+		Email:        ssoEmail(user, device.Scope),
+		Scope:        device.Scope,
+	})
+}
+
+// HandleSSORefreshToken SSO客户端刷新令牌处理器，长时间运行的客户端在访问令牌过期前调用
+func HandleSSORefreshToken(c *gin.Context) {
+	var req SSORefreshTokenRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, CodeVerifyResponse{
+			Error: "Invalid request format",
+		})
+		return
+	}
+
+	// 验证客户端凭据
+	client, err := utils.AuthenticateOAuthClient(req.ClientID, req.ClientSecret)
+	if err != nil {
+		c.JSON(http.StatusUnauthorized, CodeVerifyResponse{
+			Error: "Invalid client credentials",
+		})
+		return
+	}
+
+	// 只允许刷新本客户端创建的SSO设备的令牌
+	deviceManager := utils.NewDeviceManager(database.TokenRedisClient, database.UserRedisClient, database.DeviceRedisClient)
+	user, token, device, err := deviceManager.RefreshTokens(req.RefreshToken, c.ClientIP(), "sso", client.ClientID)
+	if err != nil {
+		if errors.Is(err, utils.ErrRefreshTokenInvalid) || errors.Is(err, utils.ErrRefreshTokenReused) || errors.Is(err, utils.ErrRefreshUserDisabled) {
+			c.JSON(http.StatusUnauthorized, CodeVerifyResponse{
+				Error: "Refresh token invalid or revoked",
+				Code:  refreshErrorCode(err),
+			})
+			return
+		}
+		c.JSON(http.StatusInternalServerError, CodeVerifyResponse{
+			Error: "Failed to refresh token",
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, CodeVerifyResponse{
+		Token:        token,
+		RefreshToken: device.RefreshToken,
+		ExpiresIn:    device.ExpiresIn(),
+		UserID:       user.Username, // 返回用户名而不是数字ID
+		Email:        ssoEmail(user, device.Scope),
+		Scope:        device.Scope,
 	})
 }
@@ -0,0 +1,164 @@
+package handlers
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"strconv"
+	"time"
+
+	"claude/utils"
+
+	"github.com/gin-gonic/gin"
+)
+
+// 批量导出对账单允许的最大天数
+const maxStatementExportDays = 366
+
+// setStatementDownloadHeaders 设置对账单下载响应头
+func setStatementDownloadHeaders(c *gin.Context, contentType, filename string) {
+	c.Header("Content-Type", contentType)
+	c.Header("Content-Disposition", fmt.Sprintf("attachment; filename=%q", filename))
+	c.Header("Cache-Control", "no-cache")
+}
+
+// HandleGetStatement 获取当前用户的月度积分对账单
+// 支持 format=json（默认）、csv、jsonl、html（可打印，浏览器另存为PDF）
+func HandleGetStatement(c *gin.Context) {
+	userID := c.GetUint("userID")
+
+	month := c.DefaultQuery("month", time.Now().Format("2006-01"))
+	start, err := time.ParseInLocation("2006-01", month, time.Local)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "月份格式错误，应为 YYYY-MM"})
+		return
+	}
+	end := start.AddDate(0, 1, 0)
+
+	if start.After(time.Now()) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "不能查询未来月份的对账单"})
+		return
+	}
+
+	statement, err := utils.GenerateUserStatement(userID, start, end)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "生成对账单失败: " + err.Error()})
+		return
+	}
+
+	filename := fmt.Sprintf("statement-%s", month)
+	switch c.DefaultQuery("format", "json") {
+	case "csv":
+		setStatementDownloadHeaders(c, "text/csv; charset=utf-8", filename+".csv")
+		err = statement.WriteCSV(c.Writer)
+	case "jsonl":
+		setStatementDownloadHeaders(c, "application/x-ndjson; charset=utf-8", filename+".jsonl")
+		err = statement.WriteJSONL(c.Writer)
+	case "html":
+		c.Header("Content-Type", "text/html; charset=utf-8")
+		err = statement.WriteHTML(c.Writer)
+	case "json":
+		c.JSON(http.StatusOK, statement)
+	default:
+		c.JSON(http.StatusBadRequest, gin.H{"error": "不支持的导出格式"})
+		return
+	}
+
+	if err != nil {
+		log.Printf("输出对账单失败: user_id=%d, month=%s, error=%v", userID, month, err)
+	}
+}
+
+// HandleAdminExportStatements 批量导出指定日期范围内所有用户的对账单
+// format=csv 时每个用户一行汇总，format=jsonl 时每行为一个完整对账单
+func HandleAdminExportStatements(c *gin.Context) {
+	dateFrom := c.Query("date_from")
+	dateTo := c.Query("date_to")
+	start, err := time.ParseInLocation("2006-01-02", dateFrom, time.Local)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "date_from 格式错误，应为 YYYY-MM-DD"})
+		return
+	}
+	endDay, err := time.ParseInLocation("2006-01-02", dateTo, time.Local)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "date_to 格式错误，应为 YYYY-MM-DD"})
+		return
+	}
+	end := endDay.AddDate(0, 0, 1)
+
+	if !end.After(start) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "结束日期不能早于开始日期"})
+		return
+	}
+	if end.Sub(start) > maxStatementExportDays*24*time.Hour {
+		c.JSON(http.StatusBadRequest, gin.H{"error": fmt.Sprintf("导出范围不能超过 %d 天", maxStatementExportDays)})
+		return
+	}
+
+	format := c.DefaultQuery("format", "csv")
+	if format != "csv" && format != "jsonl" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "不支持的导出格式"})
+		return
+	}
+
+	userIDs, err := utils.GetStatementUserIDs(start, end)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "获取用户列表失败"})
+		return
+	}
+
+	filename := fmt.Sprintf("statements-%s-%s.%s", dateFrom, dateTo, format)
+	if format == "csv" {
+		setStatementDownloadHeaders(c, "text/csv; charset=utf-8", filename)
+	} else {
+		setStatementDownloadHeaders(c, "application/x-ndjson; charset=utf-8", filename)
+	}
+
+	csvWriter := csv.NewWriter(c.Writer)
+	jsonEncoder := json.NewEncoder(c.Writer)
+	if format == "csv" {
+		csvWriter.Write([]string{"user_id", "username", "email", "period_start", "period_end", "opening_balance", "total_credits", "total_debits", "closing_balance", "requests"})
+	}
+
+	for _, userID := range userIDs {
+		statement, err := utils.GenerateUserStatement(userID, start, end)
+		if err != nil {
+			log.Printf("生成用户对账单失败: user_id=%d, error=%v", userID, err)
+			continue
+		}
+
+		if format == "jsonl" {
+			if err := jsonEncoder.Encode(statement); err != nil {
+				log.Printf("导出对账单失败: %v", err)
+				return
+			}
+			continue
+		}
+
+		var requests int64
+		for _, debit := range statement.ModelDebits {
+			requests += debit.Requests
+		}
+		csvWriter.Write([]string{
+			strconv.FormatUint(uint64(statement.UserID), 10),
+			statement.Username,
+			statement.Email,
+			dateFrom,
+			dateTo,
+			strconv.FormatInt(statement.OpeningBalance, 10),
+			strconv.FormatInt(statement.TotalCredits, 10),
+			strconv.FormatInt(statement.TotalDebits, 10),
+			strconv.FormatInt(statement.ClosingBalance, 10),
+			strconv.FormatInt(requests, 10),
+		})
+	}
+
+	if format == "csv" {
+		csvWriter.Flush()
+		if err := csvWriter.Error(); err != nil {
+			log.Printf("导出对账单失败: %v", err)
+		}
+	}
+}
@@ -1,6 +1,7 @@
 package handlers
 
 import (
+	"errors"
 	"fmt"
 	"math/rand"
 	"net/http"
@@ -78,6 +79,13 @@ type RedeemCouponResponse struct {
 	// 自动补给对比
 	CurrentAutoRefill int64 `json:"currentAutoRefill,omitempty"` // 当前自动补给积分
 	NewAutoRefill     int64 `json:"newAutoRefill,omitempty"`     // 新套餐自动补给积分
+
+	// 优惠码
+	PromoBonusPoints int64               `json:"promoBonusPoints,omitempty"` // 已领取优惠码额外赠送的积分
+	Promo            *utils.PromoPreview `json:"promo,omitempty"`            // 输入的是优惠码时返回优惠内容
+
+	// 激活码兑换限制
+	Restrictions *utils.ActivationCodeRestrictions `json:"restrictions,omitempty"`
 }
 
 // 签到相关响应结构
@@ -88,16 +96,20 @@ type CheckinPointsRange struct {
 }
 
 type CheckinStatusResponse struct {
-	CanCheckin      bool               `json:"canCheckin"`      // 是否可以签到
-	TodayChecked    bool               `json:"todayChecked"`    // 今天是否已签到
-	LastCheckinDate string             `json:"lastCheckinDate"` // 最后签到日期
-	PointsRange     CheckinPointsRange `json:"pointsRange"`     // 积分范围
+	CanCheckin      bool                     `json:"canCheckin"`       // 是否可以签到
+	TodayChecked    bool                     `json:"todayChecked"`     // 今天是否已签到
+	LastCheckinDate string                   `json:"lastCheckinDate"`  // 最后签到日期
+	PointsRange     CheckinPointsRange       `json:"pointsRange"`      // 积分范围
+	Streak          *utils.CheckinStreakInfo `json:"streak,omitempty"` // 连续签到信息
 }
 
 type CheckinResponse struct {
-	Success      bool   `json:"success"`
-	Message      string `json:"message"`
-	RewardPoints int64  `json:"rewardPoints"` // 获得的奖励积分
+	Success      bool    `json:"success"`
+	Message      string  `json:"message"`
+	RewardPoints int64   `json:"rewardPoints"`         // 获得的奖励积分
+	BasePoints   int64   `json:"basePoints,omitempty"` // 连续签到加成前的基础积分
+	StreakDays   int     `json:"streakDays,omitempty"` // 连续签到天数
+	Multiplier   float64 `json:"multiplier,omitempty"` // 连续签到奖励倍率
 }
 
 // HandleGetActiveSubscription 获取用户钱包信息（替代原订阅查询）
@@ -118,8 +130,11 @@ func HandleGetActiveSubscription(c *gin.Context) {
 		return
 	}
 
-	// 更新钱包状态
+	// 更新钱包状态，并使用更新后的状态展示
 	utils.UpdateWalletStatus(userID)
+	if updated, err := utils.GetUserWallet(userID); err == nil {
+		wallet = updated
+	}
 
 	// 获取用户的有效兑换记录（用于显示历史）
 	records, err := utils.GetWalletActiveRedemptionRecords(userID)
@@ -197,6 +212,13 @@ func HandleGetActiveSubscription(c *gin.Context) {
 		detailedStatus := "已过期"
 		availablePoints := int64(0)
 
+		// 宽限期内可查看剩余积分，但不能使用，重新兑换后恢复
+		if wallet.Status == "grace" {
+			status = "grace"
+			detailedStatus = "宽限期"
+			availablePoints = wallet.AvailablePoints
+		}
+
 		// 如果是新用户（没有积分记录），显示为待激活状态
 		if wallet.TotalPoints == 0 && len(records) == 0 {
 			detailedStatus = "待激活"
@@ -348,22 +370,93 @@ func HandleRedeemCouponPreview(c *gin.Context) {
 		return
 	}
 
+	// 激活码统一按大写查询，与校验位检查使用同一规范化结果
+	req.CouponCode = utils.NormalizeActivationCode(req.CouponCode)
+
+	// 按IP、账户和激活码分组统计失败次数，防止暴力猜测激活码
+	guard := utils.NewBruteForceGuard(utils.BruteForceScopeCoupon, c.ClientIP(), strconv.FormatUint(uint64(userID), 10), utils.ActivationCodeGuessGroup(req.CouponCode))
+	if err := guard.Check(); err != nil {
+		c.JSON(http.StatusTooManyRequests, RedeemCouponResponse{
+			Success: false,
+			Message: err.Error(),
+		})
+		return
+	}
+
+	// 校验位不正确的激活码直接拒绝，不查询数据库
+	if err := utils.CheckActivationCodeFormat(req.CouponCode); err != nil {
+		guard.Fail()
+		c.JSON(http.StatusOK, RedeemCouponResponse{
+			Success: false,
+			Message: err.Error(),
+		})
+		return
+	}
+
 	// 查找激活码
 	var activationCode models.ActivationCode
 	err = database.DB.Preload("Plan").Where("code = ? AND status = ?", req.CouponCode, "unused").First(&activationCode).Error
 	if err != nil {
+		// 不是激活码时尝试按优惠码预览
+		if _, promoErr := utils.FindPromoCode(req.CouponCode); promoErr == nil {
+			guard.Succeed()
+			preview, previewErr := utils.PreviewPromoCode(userID, req.CouponCode)
+			if previewErr != nil {
+				c.JSON(http.StatusOK, RedeemCouponResponse{
+					Success: false,
+					Message: previewErr.Error(),
+				})
+				return
+			}
+			c.JSON(http.StatusOK, RedeemCouponResponse{
+				Success:   true,
+				Message:   fmt.Sprintf("预检查成功：%s。", preview.Summary),
+				NewPoints: preview.PointsAmount,
+				Promo:     preview,
+			})
+			return
+		}
+
+		guard.Fail()
+		// 激活码分组失败次数过多时，分组内不存在的激活码直接返回锁定提示
+		if lockErr := guard.CheckCodeGroup(); lockErr != nil {
+			c.JSON(http.StatusTooManyRequests, RedeemCouponResponse{
+				Success: false,
+				Message: lockErr.Error(),
+			})
+			return
+		}
 		c.JSON(http.StatusOK, RedeemCouponResponse{
 			Success: false,
 			Message: "无效的激活码或已被使用。",
 		})
 		return
 	}
+	guard.Succeed()
+
+	// 按激活码生成时的订阅计划版本展示和发放权益，并检查计划是否可兑换（启用、上下架时间、库存）
+	plan, err := utils.ResolvePlanVersion(database.DB, &activationCode.Plan, activationCode.PlanVersionID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, RedeemCouponResponse{
+			Success: false,
+			Message: err.Error(),
+		})
+		return
+	}
+	activationCode.Plan = *plan
+	if err := utils.CheckPlanAvailability(plan); err != nil {
+		c.JSON(http.StatusOK, RedeemCouponResponse{
+			Success: false,
+			Message: err.Error(),
+		})
+		return
+	}
 
-	// 检查订阅计划是否启用
-	if !activationCode.Plan.Active {
+	// 检查激活码的兑换限制
+	if err := utils.CheckActivationCodeEligibility(database.DB, &activationCode, &user); err != nil {
 		c.JSON(http.StatusOK, RedeemCouponResponse{
 			Success: false,
-			Message: "该订阅计划已停用。",
+			Message: err.Error(),
 		})
 		return
 	}
@@ -426,12 +519,17 @@ func HandleRedeemCouponPreview(c *gin.Context) {
 		newAutoRefill = activationCode.Plan.AutoRefillAmount
 	}
 
+	// 已领取的优惠码额外赠送
+	promoBonus := utils.GetPendingPromoBonus(userID, &activationCode.Plan)
+	totalPointsAfter += promoBonus
+
 	// 返回预检查结果，不执行实际兑换
 	c.JSON(http.StatusOK, RedeemCouponResponse{
 		Success: true,
 		Message: fmt.Sprintf("预检查成功：将充值 %d 积分，有效期 %d 天。",
 			activationCode.Plan.PointAmount,
 			activationCode.Plan.ValidityDays),
+		PromoBonusPoints:  promoBonus,
 		ServiceLevel:      serviceLevel,
 		Warning:           warning,
 		CurrentPoints:     currentPoints,
@@ -443,6 +541,7 @@ func HandleRedeemCouponPreview(c *gin.Context) {
 		NewCheckinMax:     newCheckinMax,
 		CurrentAutoRefill: currentAutoRefill,
 		NewAutoRefill:     newAutoRefill,
+		Restrictions:      utils.GetActivationCodeRestrictions(&activationCode),
 	})
 }
 
@@ -482,22 +581,80 @@ func HandleRedeemCoupon(c *gin.Context) {
 		return
 	}
 
+	// 激活码统一按大写查询，与校验位检查使用同一规范化结果
+	req.CouponCode = utils.NormalizeActivationCode(req.CouponCode)
+
+	// 按IP、账户和激活码分组统计失败次数，防止暴力猜测激活码
+	guard := utils.NewBruteForceGuard(utils.BruteForceScopeCoupon, c.ClientIP(), strconv.FormatUint(uint64(userID), 10), utils.ActivationCodeGuessGroup(req.CouponCode))
+	if err := guard.Check(); err != nil {
+		c.JSON(http.StatusTooManyRequests, RedeemCouponResponse{
+			Success: false,
+			Message: err.Error(),
+		})
+		return
+	}
+
+	// 校验位不正确的激活码直接拒绝，不查询数据库
+	if err := utils.CheckActivationCodeFormat(req.CouponCode); err != nil {
+		guard.Fail()
+		c.JSON(http.StatusOK, RedeemCouponResponse{
+			Success: false,
+			Message: err.Error(),
+		})
+		return
+	}
+
 	// 查找激活码
 	var activationCode models.ActivationCode
 	err = database.DB.Preload("Plan").Where("code = ? AND status = ?", req.CouponCode, "unused").First(&activationCode).Error
 	if err != nil {
+		// 不是激活码时尝试按优惠码兑换
+		if _, promoErr := utils.FindPromoCode(req.CouponCode); promoErr == nil {
+			guard.Succeed()
+			handleRedeemPromoCode(c, userID, req.CouponCode)
+			return
+		}
+
+		guard.Fail()
+		// 激活码分组失败次数过多时，分组内不存在的激活码直接返回锁定提示
+		if lockErr := guard.CheckCodeGroup(); lockErr != nil {
+			c.JSON(http.StatusTooManyRequests, RedeemCouponResponse{
+				Success: false,
+				Message: lockErr.Error(),
+			})
+			return
+		}
 		c.JSON(http.StatusOK, RedeemCouponResponse{
 			Success: false,
 			Message: "无效的激活码或已被使用。",
 		})
 		return
 	}
+	guard.Succeed()
+
+	// 按激活码生成时的订阅计划版本展示和发放权益，并检查计划是否可兑换（启用、上下架时间、库存）
+	plan, err := utils.ResolvePlanVersion(database.DB, &activationCode.Plan, activationCode.PlanVersionID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, RedeemCouponResponse{
+			Success: false,
+			Message: err.Error(),
+		})
+		return
+	}
+	activationCode.Plan = *plan
+	if err := utils.CheckPlanAvailability(plan); err != nil {
+		c.JSON(http.StatusOK, RedeemCouponResponse{
+			Success: false,
+			Message: err.Error(),
+		})
+		return
+	}
 
-	// 检查订阅计划是否启用
-	if !activationCode.Plan.Active {
+	// 检查激活码的兑换限制
+	if err := utils.CheckActivationCodeEligibility(database.DB, &activationCode, &user); err != nil {
 		c.JSON(http.StatusOK, RedeemCouponResponse{
 			Success: false,
-			Message: "该订阅计划已停用。",
+			Message: err.Error(),
 		})
 		return
 	}
@@ -519,8 +676,18 @@ func HandleRedeemCoupon(c *gin.Context) {
 		serviceLevel = "upgrade" // 新用户或过期用户默认为升级
 	}
 
+	// 已领取的优惠码额外赠送（兑换时在同一事务中发放）
+	promoBonus := utils.GetPendingPromoBonus(userID, &activationCode.Plan)
+
 	// 使用新的钱包架构兑换激活码
 	err = utils.RedeemActivationCodeToWallet(userID, &activationCode)
+	if errors.Is(err, utils.ErrActivationCodeClaimed) || errors.Is(err, utils.ErrPlanSoldOut) {
+		c.JSON(http.StatusConflict, RedeemCouponResponse{
+			Success: false,
+			Message: err.Error(),
+		})
+		return
+	}
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, RedeemCouponResponse{
 			Success: false,
@@ -537,13 +704,42 @@ func HandleRedeemCoupon(c *gin.Context) {
 		})
 	}
 
+	message := fmt.Sprintf("激活码兑换成功！已充值 %d 积分，有效期 %d 天。",
+		activationCode.Plan.PointAmount,
+		activationCode.Plan.ValidityDays)
+	if promoBonus > 0 {
+		message += fmt.Sprintf("优惠码额外赠送 %d 积分。", promoBonus)
+	}
+
 	c.JSON(http.StatusOK, RedeemCouponResponse{
-		Success: true,
-		Message: fmt.Sprintf("激活码兑换成功！已充值 %d 积分，有效期 %d 天。",
-			activationCode.Plan.PointAmount,
-			activationCode.Plan.ValidityDays),
-		ServiceLevel: serviceLevel,
-		Warning:      warning,
+		Success:          true,
+		Message:          message,
+		ServiceLevel:     serviceLevel,
+		Warning:          warning,
+		PromoBonusPoints: promoBonus,
+	})
+}
+
+// handleRedeemPromoCode 兑换优惠码
+func handleRedeemPromoCode(c *gin.Context, userID uint, code string) {
+	redemption, promo, err := utils.RedeemPromoCode(userID, code)
+	if err != nil {
+		c.JSON(http.StatusOK, RedeemCouponResponse{
+			Success: false,
+			Message: err.Error(),
+		})
+		return
+	}
+
+	message := fmt.Sprintf("优惠码领取成功！%s。", utils.PromoSummary(promo))
+	if redemption.Status == "applied" {
+		message = fmt.Sprintf("优惠码兑换成功！已充值 %d 积分，有效期 %d 天。", promo.PointsAmount, promo.ValidityDays)
+	}
+
+	c.JSON(http.StatusOK, RedeemCouponResponse{
+		Success:   true,
+		Message:   message,
+		NewPoints: redemption.PointsAmount,
 	})
 }
 
@@ -616,11 +812,15 @@ func HandleGetCheckinStatus(c *gin.Context) {
 		lastCheckinDate = wallet.LastCheckinDate
 	}
 
+	// 连续签到信息获取失败不影响签到状态展示
+	streak, _ := utils.GetCheckinStreakInfo(userID)
+
 	c.JSON(http.StatusOK, CheckinStatusResponse{
 		CanCheckin:      !todayChecked,
 		TodayChecked:    todayChecked,
 		LastCheckinDate: lastCheckinDate,
 		PointsRange:     pointsRange,
+		Streak:          streak,
 	})
 }
 
@@ -677,13 +877,24 @@ func HandleDailyCheckin(c *gin.Context) {
 	}
 
 	// 在范围内随机生成积分
-	var rewardPoints int64
+	var basePoints int64
 	if pointsRange.MinPoints == pointsRange.MaxPoints {
-		rewardPoints = pointsRange.MinPoints
+		basePoints = pointsRange.MinPoints
 	} else {
 		// 生成范围内的随机数
 		randRange := pointsRange.MaxPoints - pointsRange.MinPoints + 1
-		rewardPoints = pointsRange.MinPoints + int64(rand.Int63n(randRange))
+		basePoints = pointsRange.MinPoints + int64(rand.Int63n(randRange))
+	}
+
+	// 按连续签到天数计算奖励倍率
+	streakDays, multiplier, rewardPoints, err := utils.ApplyCheckinStreakBonus(userID, basePoints)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, CheckinResponse{
+			Success:      false,
+			Message:      "计算连续签到奖励失败",
+			RewardPoints: 0,
+		})
+		return
 	}
 
 	// 检查今天是否已经签到
@@ -704,6 +915,9 @@ func HandleDailyCheckin(c *gin.Context) {
 		UserID:      userID,
 		CheckinDate: today,
 		Points:      rewardPoints,
+		BasePoints:  basePoints,
+		StreakDays:  streakDays,
+		Multiplier:  multiplier,
 		CreatedAt:   time.Now(),
 	}
 
@@ -727,10 +941,18 @@ func HandleDailyCheckin(c *gin.Context) {
 		return
 	}
 
+	message := fmt.Sprintf("签到成功！获得 %d 积分奖励", rewardPoints)
+	if multiplier > 1 {
+		message = fmt.Sprintf("签到成功！已连续签到 %d 天，获得 %g 倍奖励共 %d 积分", streakDays, multiplier, rewardPoints)
+	}
+
 	c.JSON(http.StatusOK, CheckinResponse{
 		Success:      true,
-		Message:      fmt.Sprintf("签到成功！获得 %d 积分奖励", rewardPoints),
+		Message:      message,
 		RewardPoints: rewardPoints,
+		BasePoints:   basePoints,
+		StreakDays:   streakDays,
+		Multiplier:   multiplier,
 	})
 }
 
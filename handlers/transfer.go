@@ -0,0 +1,210 @@
+package handlers
+
+import (
+	"context"
+	"crypto/subtle"
+	"fmt"
+	"log"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"claude/database"
+	"claude/models"
+	"claude/utils"
+
+	"github.com/gin-gonic/gin"
+)
+
+// TransferPointsRequest 积分转账请求
+type TransferPointsRequest struct {
+	Recipient        string `json:"recipient" binding:"required"` // 收款人用户名或邮箱
+	Points           int64  `json:"points" binding:"required,min=1"`
+	Note             string `json:"note" binding:"max=200"`
+	VerificationCode string `json:"verification_code"` // 大额转账时需要
+}
+
+// findTransferRecipient 按用户名或邮箱查找收款人
+func findTransferRecipient(recipient string) (*models.User, error) {
+	recipient = strings.TrimSpace(recipient)
+	if recipient == "" {
+		return nil, fmt.Errorf("收款用户不存在")
+	}
+	var toUser models.User
+	if err := database.DB.Where("username = ? OR email = ?", recipient, recipient).First(&toUser).Error; err != nil {
+		return nil, err
+	}
+	return &toUser, nil
+}
+
+// transferVerificationTarget 转账验证码绑定的收款人和金额
+func transferVerificationTarget(toUserID uint, points int64) string {
+	return fmt.Sprintf("%d:%d", toUserID, points)
+}
+
+// HandleGetTransferSettings 获取积分转账配置和今日额度
+func HandleGetTransferSettings(c *gin.Context) {
+	userID := c.GetUint("userID")
+
+	settings := utils.GetPointTransferSettings()
+	transferredToday := utils.GetTodayTransferredPoints(userID)
+
+	var remainingToday int64 = -1 // -1表示不限制
+	if settings.DailyLimit > 0 {
+		remainingToday = max(settings.DailyLimit-transferredToday, 0)
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"settings":          settings,
+		"transferred_today": transferredToday,
+		"remaining_today":   remainingToday,
+	})
+}
+
+// HandleTransferPoints 向其他用户转账积分
+func HandleTransferPoints(c *gin.Context) {
+	userID := c.GetUint("userID")
+
+	var req TransferPointsRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "参数错误: " + err.Error()})
+		return
+	}
+
+	// 查找收款人（用户名或邮箱）
+	toUser, err := findTransferRecipient(req.Recipient)
+	if err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "收款用户不存在"})
+		return
+	}
+	if toUser.IsDisabled {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "收款用户已被禁用"})
+		return
+	}
+
+	// 大额转账需要邮箱验证码确认
+	verified := false
+	redisKey := fmt.Sprintf("verification_code:transfer_points:%d", userID)
+	settings := utils.GetPointTransferSettings()
+	if settings.RequiresVerification(req.Points) {
+		if req.VerificationCode == "" {
+			c.JSON(http.StatusForbidden, gin.H{
+				"error": "转账金额较大，请先获取邮箱验证码",
+				"code":  "VERIFICATION_REQUIRED",
+			})
+			return
+		}
+
+		// 验证码错误计入失败次数，防止会话被盗后穷举6位验证码
+		guard := utils.NewBruteForceGuard(utils.BruteForceScopeTransfer, c.ClientIP(), strconv.FormatUint(uint64(userID), 10), "")
+		if err := guard.Check(); err != nil {
+			c.JSON(http.StatusTooManyRequests, gin.H{"error": err.Error()})
+			return
+		}
+
+		// 验证码只能用于发送时指定的收款人和金额
+		ctx := context.Background()
+		storedValue, err := redisClientForAuth.Get(ctx, redisKey).Result()
+		expected := req.VerificationCode + ":" + transferVerificationTarget(toUser.ID, req.Points)
+		if err != nil || subtle.ConstantTimeCompare([]byte(storedValue), []byte(expected)) != 1 {
+			guard.Fail()
+			c.JSON(http.StatusBadRequest, gin.H{"error": "验证码错误、已过期或与转账信息不符"})
+			return
+		}
+
+		// 先原子地占用验证码再转账，并发请求只有一个能使用同一个验证码
+		deleted, err := redisClientForAuth.Del(ctx, redisKey).Result()
+		if err != nil || deleted == 0 {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "验证码已被使用，请重新获取"})
+			return
+		}
+		guard.Succeed()
+		verified = true
+	}
+
+	transfer, err := utils.TransferPoints(userID, toUser.ID, req.Points, strings.TrimSpace(req.Note), verified, c.ClientIP())
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	log.Printf("积分转账成功: from=%d, to=%d, points=%d, transfer_id=%d", userID, toUser.ID, req.Points, transfer.ID)
+
+	c.JSON(http.StatusOK, gin.H{
+		"success": true,
+		"message": fmt.Sprintf("已成功向 %s 转账 %d 积分", toUser.Username, req.Points),
+		"data":    transfer,
+	})
+}
+
+// HandleGetPointTransfers 获取当前用户的转账记录
+func HandleGetPointTransfers(c *gin.Context) {
+	userID := c.GetUint("userID")
+	pagination := getPagination(c)
+
+	transfers, total, err := utils.GetUserPointTransfers(userID, pagination.PageSize, (pagination.Page-1)*pagination.PageSize)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "获取转账记录失败"})
+		return
+	}
+
+	// 只返回对方的用户名，避免泄露邮箱等信息
+	result := make([]gin.H, 0, len(transfers))
+	for _, transfer := range transfers {
+		direction := "out"
+		counterparty := transfer.ToUser.Username
+		if transfer.ToUserID == userID {
+			direction = "in"
+			counterparty = transfer.FromUser.Username
+		}
+		result = append(result, gin.H{
+			"id":            transfer.ID,
+			"direction":     direction,
+			"counterparty":  counterparty,
+			"points_amount": transfer.PointsAmount,
+			"expires_at":    transfer.ExpiresAt,
+			"note":          transfer.Note,
+			"status":        transfer.Status,
+			"created_at":    transfer.CreatedAt,
+		})
+	}
+
+	c.JSON(http.StatusOK, PaginatedResponse{
+		Data:       result,
+		Total:      total,
+		Page:       pagination.Page,
+		PageSize:   pagination.PageSize,
+		TotalPages: int((total + int64(pagination.PageSize) - 1) / int64(pagination.PageSize)),
+	})
+}
+
+// HandleAdminGetPointTransfers 管理员查看积分转账审计记录
+func HandleAdminGetPointTransfers(c *gin.Context) {
+	pagination := getPagination(c)
+	var transfers []models.PointTransfer
+	var total int64
+
+	query := database.DB.Model(&models.PointTransfer{})
+	if userIDStr := c.Query("user_id"); userIDStr != "" {
+		if id, err := strconv.ParseUint(userIDStr, 10, 32); err == nil {
+			query = query.Where("from_user_id = ? OR to_user_id = ?", id, id)
+		}
+	}
+	if minPoints := c.Query("min_points"); minPoints != "" {
+		query = query.Where("points_amount >= ?", minPoints)
+	}
+
+	query.Count(&total)
+
+	offset := (pagination.Page - 1) * pagination.PageSize
+	query.Preload("FromUser").Preload("ToUser").Order("created_at DESC").
+		Offset(offset).Limit(pagination.PageSize).Find(&transfers)
+
+	c.JSON(http.StatusOK, PaginatedResponse{
+		Data:       transfers,
+		Total:      total,
+		Page:       pagination.Page,
+		PageSize:   pagination.PageSize,
+		TotalPages: int((total + int64(pagination.PageSize) - 1) / int64(pagination.PageSize)),
+	})
+}
@@ -0,0 +1,259 @@
+package handlers
+
+import (
+	"errors"
+	"log"
+	"net/http"
+	"strconv"
+
+	"claude/database"
+	"claude/models"
+	"claude/utils"
+
+	"github.com/gin-gonic/gin"
+)
+
+// TwoFactorCodeRequest 需要两步验证码的请求
+type TwoFactorCodeRequest struct {
+	Code string `json:"code" binding:"required"` // 验证器验证码或恢复码
+}
+
+// TwoFactorLoginRequest 两步验证登录请求
+type TwoFactorLoginRequest struct {
+	ChallengeToken string `json:"challenge_token" binding:"required"`
+	Code           string `json:"code" binding:"required"` // 验证器验证码或恢复码
+}
+
+// respondTwoFactorChallenge 用户已启用两步验证时创建登录挑战并返回，调用方不再签发令牌
+// 返回 true 表示已写入响应
+func respondTwoFactorChallenge(c *gin.Context, user *models.User, source string) bool {
+	if !utils.IsTwoFactorEnabled(user.ID) {
+		return false
+	}
+
+	challengeToken, err := utils.CreateTwoFactorChallenge(user.ID, source)
+	if err != nil {
+		log.Printf("创建两步验证挑战失败: user_id=%d, error=%v", user.ID, err)
+		c.JSON(http.StatusInternalServerError, AuthResponse{
+			Success: false,
+			Message: "登录失败，请稍后重试",
+		})
+		return true
+	}
+
+	c.JSON(http.StatusOK, AuthResponse{
+		Success:           false,
+		Message:           "请输入两步验证码",
+		TwoFactorRequired: true,
+		ChallengeToken:    challengeToken,
+	})
+	return true
+}
+
+// HandleTwoFactorLogin 两步验证登录：使用第一步登录返回的挑战令牌和验证码换取访问令牌
+func HandleTwoFactorLogin(c *gin.Context) {
+	var req TwoFactorLoginRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, AuthResponse{
+			Success: false,
+			Message: "请求格式错误：" + err.Error(),
+		})
+		return
+	}
+
+	// 挑战令牌本身限制了尝试次数，这里再按IP和挑战所属用户统计失败次数，
+	// 避免反复登录获取新的挑战绕过单个挑战的次数限制
+	account := ""
+	if userID, err := utils.GetTwoFactorChallengeUserID(req.ChallengeToken); err == nil {
+		account = strconv.FormatUint(uint64(userID), 10)
+	}
+	guard := utils.NewBruteForceGuard(utils.BruteForceScopeLogin, c.ClientIP(), account, "")
+	if err := guard.Check(); err != nil {
+		c.JSON(http.StatusTooManyRequests, AuthResponse{
+			Success: false,
+			Message: err.Error(),
+		})
+		return
+	}
+
+	user, source, err := utils.CompleteTwoFactorChallenge(req.ChallengeToken, req.Code)
+	if err != nil {
+		guard.Fail()
+		status := http.StatusUnauthorized
+		if errors.Is(err, utils.ErrTwoFactorChallengeExpired) {
+			status = http.StatusGone
+		}
+		c.JSON(status, AuthResponse{
+			Success: false,
+			Message: err.Error(),
+		})
+		return
+	}
+
+	guard.Succeed()
+
+	// 生成访问令牌
+	token, err := utils.GenerateAccessToken(user.ID, user.Email)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, AuthResponse{
+			Success: false,
+			Message: "生成访问令牌失败",
+		})
+		return
+	}
+
+	// 注册设备到Redis
+	deviceManager := utils.NewDeviceManager(database.TokenRedisClient, database.UserRedisClient, database.DeviceRedisClient)
+	device, err := deviceManager.RegisterDevice(
+		user.ID,
+		token,
+		c.ClientIP(),
+		c.GetHeader("User-Agent"),
+		"web",
+	)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, AuthResponse{
+			Success: false,
+			Message: "设备注册失败",
+		})
+		return
+	}
+
+	log.Printf("用户两步验证登录成功: user_id=%d, source=%s, device_id=%s, ip=%s", user.ID, source, device.ID, device.IP)
+
+	c.JSON(http.StatusOK, AuthResponse{
+		Success:      true,
+		Message:      "登录成功",
+		Token:        token,
+		RefreshToken: device.RefreshToken,
+		ExpiresIn:    utils.AccessTokenExpiresIn(),
+		User: &UserData{
+			ID:       user.ID,
+			Username: user.Username,
+			Email:    user.Email,
+			IsAdmin:  user.IsAdmin,
+		},
+	})
+}
+
+// HandleGetTwoFactorStatus 获取当前用户的两步验证状态
+func HandleGetTwoFactorStatus(c *gin.Context) {
+	var user models.User
+	if err := database.DB.Where("id = ?", c.GetUint("userID")).First(&user).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "用户不存在"})
+		return
+	}
+
+	c.JSON(http.StatusOK, utils.GetTwoFactorStatus(&user))
+}
+
+// HandleTwoFactorSetup 开始绑定两步验证，返回密钥和 otpauth 链接
+func HandleTwoFactorSetup(c *gin.Context) {
+	var user models.User
+	if err := database.DB.Where("id = ?", c.GetUint("userID")).First(&user).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "用户不存在"})
+		return
+	}
+
+	setup, err := utils.BeginTwoFactorSetup(&user)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, setup)
+}
+
+// HandleTwoFactorEnable 提交验证器验证码完成绑定，返回恢复码（只展示一次）
+func HandleTwoFactorEnable(c *gin.Context) {
+	var req TwoFactorCodeRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "参数错误: " + err.Error()})
+		return
+	}
+
+	userID := c.GetUint("userID")
+	codes, err := utils.EnableTwoFactor(userID, req.Code)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	log.Printf("用户启用两步验证: user_id=%d", userID)
+
+	c.JSON(http.StatusOK, gin.H{
+		"success":        true,
+		"message":        "已启用两步验证，请妥善保存恢复码",
+		"recovery_codes": codes,
+	})
+}
+
+// HandleTwoFactorDisable 验证后关闭两步验证
+func HandleTwoFactorDisable(c *gin.Context) {
+	var req TwoFactorCodeRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "参数错误: " + err.Error()})
+		return
+	}
+
+	userID := c.GetUint("userID")
+	if err := utils.DisableTwoFactor(userID, req.Code); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	log.Printf("用户关闭两步验证: user_id=%d", userID)
+
+	c.JSON(http.StatusOK, gin.H{
+		"success": true,
+		"message": "已关闭两步验证",
+	})
+}
+
+// HandleTwoFactorRegenerateRecoveryCodes 验证后重新生成恢复码
+func HandleTwoFactorRegenerateRecoveryCodes(c *gin.Context) {
+	var req TwoFactorCodeRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "参数错误: " + err.Error()})
+		return
+	}
+
+	codes, err := utils.RegenerateRecoveryCodes(c.GetUint("userID"), req.Code)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"success":        true,
+		"message":        "已重新生成恢复码，旧恢复码已失效",
+		"recovery_codes": codes,
+	})
+}
+
+// HandleAdminResetUserTwoFactor 管理员重置用户的两步验证（用户丢失验证器和恢复码时使用）
+func HandleAdminResetUserTwoFactor(c *gin.Context) {
+	userID, err := strconv.ParseUint(c.Param("id"), 10, 32)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "无效的用户ID"})
+		return
+	}
+
+	var user models.User
+	if err := database.DB.Where("id = ?", userID).First(&user).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "用户不存在"})
+		return
+	}
+
+	if err := utils.ResetTwoFactor(user.ID); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	log.Printf("管理员重置用户两步验证: admin_id=%d, user_id=%d", c.GetUint("userID"), user.ID)
+
+	c.JSON(http.StatusOK, gin.H{
+		"success": true,
+		"message": "已重置该用户的两步验证",
+	})
+}
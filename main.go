@@ -35,9 +35,11 @@ func main() {
 	handlers.InitRedisClient()
 	handlers.InitAuthRedisClient()
 
-	// 启动自动补给定时器
-	log.Println("启动自动补给定时器...")
-	utils.StartAutoRefillScheduler()
+	// 初始化支付渠道
+	utils.InitPaymentProviders()
+
+	// 启动定时任务调度器（自动补给、订单过期、订阅续费、钱包过期、清理任务等）
+	utils.StartJobScheduler()
 
 	// 设置Gin模式
 	if os.Getenv("GIN_MODE") == "" {
@@ -1,6 +1,7 @@
 package middleware
 
 import (
+	"errors"
 	"net/http"
 	"strings"
 
@@ -33,6 +34,15 @@ func JWTAuth() gin.HandlerFunc {
 
 		// 先验证JWT格式
 		claims, err := utils.ValidateAccessToken(token)
+		if errors.Is(err, utils.ErrAccessTokenExpired) {
+			// 客户端收到此错误码后应使用刷新令牌换取新的访问令牌
+			c.JSON(http.StatusUnauthorized, gin.H{
+				"error": "认证令牌已过期",
+				"code":  "TOKEN_EXPIRED",
+			})
+			c.Abort()
+			return
+		}
 		if err != nil {
 			c.JSON(http.StatusUnauthorized, gin.H{"error": "认证令牌格式无效"})
 			c.Abort()
@@ -114,6 +124,15 @@ func AdminAuth() gin.HandlerFunc {
 
 		// 先验证JWT格式
 		claims, err := utils.ValidateAccessToken(token)
+		if errors.Is(err, utils.ErrAccessTokenExpired) {
+			// 客户端收到此错误码后应使用刷新令牌换取新的访问令牌
+			c.JSON(http.StatusUnauthorized, gin.H{
+				"error": "认证令牌已过期",
+				"code":  "TOKEN_EXPIRED",
+			})
+			c.Abort()
+			return
+		}
 		if err != nil {
 			c.JSON(http.StatusUnauthorized, gin.H{"error": "认证令牌格式无效"})
 			c.Abort()
@@ -146,6 +165,16 @@ func AdminAuth() gin.HandlerFunc {
 			return
 		}
 
+		// 要求管理员启用两步验证时，未启用的管理员需先在账户设置中完成绑定
+		if utils.IsTwoFactorRequiredForAdmins() && !utils.IsTwoFactorEnabled(claims.UserID) {
+			c.JSON(http.StatusForbidden, gin.H{
+				"error": "管理员账户必须启用两步验证",
+				"code":  "TWO_FACTOR_REQUIRED",
+			})
+			c.Abort()
+			return
+		}
+
 		// 将用户和设备信息存储到上下文中
 		c.Set("userID", claims.UserID)
 		c.Set("deviceID", device.ID)
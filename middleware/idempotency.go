@@ -0,0 +1,130 @@
+package middleware
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"time"
+
+	"claude/database"
+
+	"github.com/gin-gonic/gin"
+)
+
+// 幂等键保留时间，期间使用相同幂等键的重复请求直接返回第一次的响应
+const idempotencyKeyTTL = 24 * time.Hour
+
+// 幂等键最大长度
+const idempotencyKeyMaxLength = 128
+
+// idempotencyRecord 幂等键对应的请求处理状态
+type idempotencyRecord struct {
+	Status      string `json:"status"`      // processing, completed
+	Fingerprint string `json:"fingerprint"` // 请求体摘要，同一幂等键不允许用于不同的请求
+	StatusCode  int    `json:"status_code,omitempty"`
+	Body        string `json:"body,omitempty"`
+}
+
+// idempotencyWriter 记录响应内容，请求完成后保存到幂等键
+type idempotencyWriter struct {
+	gin.ResponseWriter
+	body bytes.Buffer
+}
+
+func (w *idempotencyWriter) Write(data []byte) (int, error) {
+	w.body.Write(data)
+	return w.ResponseWriter.Write(data)
+}
+
+func (w *idempotencyWriter) WriteString(s string) (int, error) {
+	w.body.WriteString(s)
+	return w.ResponseWriter.WriteString(s)
+}
+
+// Idempotency 幂等键中间件，需放在 JWTAuth 之后
+// 客户端通过 Idempotency-Key 请求头标识一次操作，重试时携带相同的键不会重复执行
+// 处理中的重复请求返回 409；已完成的请求返回第一次的响应；服务端错误（5xx）不保存，允许使用同一个键重试
+func Idempotency(scope string) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		key := c.GetHeader("Idempotency-Key")
+		if key == "" {
+			c.Next()
+			return
+		}
+		if len(key) > idempotencyKeyMaxLength {
+			c.JSON(http.StatusBadRequest, gin.H{"error": fmt.Sprintf("Idempotency-Key 不能超过 %d 个字符", idempotencyKeyMaxLength)})
+			c.Abort()
+			return
+		}
+
+		body, err := io.ReadAll(c.Request.Body)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "读取请求失败"})
+			c.Abort()
+			return
+		}
+		c.Request.Body = io.NopCloser(bytes.NewReader(body))
+		sum := sha256.Sum256(body)
+		fingerprint := hex.EncodeToString(sum[:])
+
+		ctx := context.Background()
+		redisKey := fmt.Sprintf("idempotency:%s:%d:%s", scope, c.GetUint("userID"), key)
+		processing, _ := json.Marshal(idempotencyRecord{Status: "processing", Fingerprint: fingerprint})
+
+		ok, err := database.TokenRedisClient.SetNX(ctx, redisKey, processing, idempotencyKeyTTL).Result()
+		if err != nil {
+			// Redis 不可用时不阻塞请求，兑换本身有数据库条件更新保证不会重复
+			log.Printf("❌ 幂等键写入失败: key=%s, error=%v", redisKey, err)
+			c.Next()
+			return
+		}
+
+		if !ok {
+			var record idempotencyRecord
+			data, err := database.TokenRedisClient.Get(ctx, redisKey).Result()
+			if err != nil || json.Unmarshal([]byte(data), &record) != nil {
+				c.JSON(http.StatusConflict, gin.H{"error": "请求正在处理中，请稍后重试"})
+				c.Abort()
+				return
+			}
+			if record.Fingerprint != fingerprint {
+				c.JSON(http.StatusUnprocessableEntity, gin.H{"error": "Idempotency-Key 已用于其他请求"})
+				c.Abort()
+				return
+			}
+			if record.Status != "completed" {
+				c.JSON(http.StatusConflict, gin.H{"error": "请求正在处理中，请稍后重试"})
+				c.Abort()
+				return
+			}
+			c.Header("Idempotent-Replayed", "true")
+			c.Data(record.StatusCode, "application/json; charset=utf-8", []byte(record.Body))
+			c.Abort()
+			return
+		}
+
+		writer := &idempotencyWriter{ResponseWriter: c.Writer}
+		c.Writer = writer
+		c.Next()
+
+		if c.Writer.Status() >= http.StatusInternalServerError {
+			database.TokenRedisClient.Del(ctx, redisKey)
+			return
+		}
+		completed, _ := json.Marshal(idempotencyRecord{
+			Status:      "completed",
+			Fingerprint: fingerprint,
+			StatusCode:  c.Writer.Status(),
+			Body:        writer.body.String(),
+		})
+		if err := database.TokenRedisClient.Set(ctx, redisKey, completed, idempotencyKeyTTL).Err(); err != nil {
+			log.Printf("❌ 幂等键保存响应失败: key=%s, error=%v", redisKey, err)
+		}
+	}
+}
@@ -14,6 +14,7 @@ type User struct {
 	Password              *string        `gorm:"" json:"-"`                                   // 密码不在JSON中返回，可为空
 	IsAdmin               bool           `gorm:"default:false" json:"is_admin"`              // 是否是管理员
 	IsDisabled            bool           `gorm:"default:false" json:"is_disabled"`           // 是否被禁用
+	DisabledUntil         *time.Time     `gorm:"index" json:"disabled_until"`                // 临时禁用到期时间，为空表示永久禁用或未禁用
 	DegradationGuaranteed int            `gorm:"default:0" json:"degradation_guaranteed"`    // 10条内保证不降级的数量
 	DegradationSource     string         `gorm:"default:'system'" json:"degradation_source"` // system/admin/subscription
 	DegradationLocked     bool           `gorm:"default:false" json:"degradation_locked"`    // 是否锁定，不被套餐覆盖
@@ -31,6 +32,8 @@ type DeviceCode struct {
 	UserID    uint      `gorm:"not null" json:"user_id"`
 	User      User      `gorm:"foreignKey:UserID" json:"user,omitempty"`
 	Used      bool      `gorm:"default:false" json:"used"`
+	ClientID  string    `gorm:"type:varchar(64)" json:"client_id"` // 发起授权的SSO客户端，只能由该客户端兑换
+	Scope     string    `gorm:"type:varchar(255)" json:"scope"`    // 授予的权限范围
 	ExpiresAt time.Time `gorm:"not null" json:"expires_at"`
 	CreatedAt time.Time `json:"created_at"`
 }
@@ -77,6 +80,18 @@ type SubscriptionPlan struct {
 	AutoRefillThreshold int64 `gorm:"default:0" json:"auto_refill_threshold"`       // 自动补给阈值，积分低于此值时触发
 	AutoRefillAmount    int64 `gorm:"default:0" json:"auto_refill_amount"`          // 每次补给的积分数量
 	
+	// 周期订阅配置
+	IsRecurring bool  `gorm:"default:false" json:"is_recurring"` // 是否为周期订阅，周期长度为 ValidityDays
+	RolloverCap int64 `gorm:"default:0" json:"rollover_cap"`     // 续费时上一周期未用积分最多结转数量，0表示全部结转，-1表示不结转
+
+	// 版本、上下架时间和库存
+	CurrentVersion   int        `gorm:"default:0" json:"current_version"` // 当前版本号，修改权益相关字段时自动生成新版本
+	CurrentVersionID *uint      `json:"current_version_id"`               // 当前版本ID，新生成的激活码、赠送和兑换记录关联此版本
+	AvailableFrom    *time.Time `json:"available_from"`                   // 上架时间，为空表示立即可用
+	AvailableUntil   *time.Time `json:"available_until"`                  // 下架时间，为空表示不下架
+	InventoryCap     int64      `gorm:"default:0" json:"inventory_cap"`   // 库存上限，0表示不限制
+	InventoryUsed    int64      `gorm:"default:0" json:"inventory_used"`  // 已发放数量
+
 	Features              string         `gorm:"type:text" json:"features"`                 // JSON string array
 	Active                bool           `gorm:"default:true" json:"active"`
 	CreatedAt             time.Time      `json:"created_at"`
@@ -84,6 +99,40 @@ type SubscriptionPlan struct {
 	DeletedAt             gorm.DeletedAt `gorm:"index" json:"-"`
 }
 
+// SubscriptionPlanVersion 订阅计划版本，保存计划权益的不可变快照
+type SubscriptionPlanVersion struct {
+	ID                 uint `gorm:"primarykey" json:"id"`
+	SubscriptionPlanID uint `gorm:"not null;uniqueIndex:idx_plan_version" json:"subscription_plan_id"`
+	Version            int  `gorm:"not null;uniqueIndex:idx_plan_version" json:"version"`
+
+	// 权益快照
+	Title                 string  `gorm:"not null" json:"title"`
+	Description           string  `gorm:"type:text" json:"description"`
+	PointAmount           int64   `gorm:"not null" json:"point_amount"`
+	Price                 float64 `gorm:"not null" json:"price"`
+	Currency              string  `gorm:"type:varchar(10)" json:"currency"`
+	ValidityDays          int     `gorm:"not null" json:"validity_days"`
+	DegradationGuaranteed int     `gorm:"default:0" json:"degradation_guaranteed"`
+	DailyCheckinPoints    int64   `gorm:"default:0" json:"daily_checkin_points"`
+	DailyCheckinPointsMax int64   `gorm:"default:0" json:"daily_checkin_points_max"`
+	DailyMaxPoints        int64   `gorm:"default:0" json:"daily_max_points"`
+	AutoRefillEnabled     bool    `gorm:"default:false" json:"auto_refill_enabled"`
+	AutoRefillThreshold   int64   `gorm:"default:0" json:"auto_refill_threshold"`
+	AutoRefillAmount      int64   `gorm:"default:0" json:"auto_refill_amount"`
+	IsRecurring           bool    `gorm:"default:false" json:"is_recurring"`
+	RolloverCap           int64   `gorm:"default:0" json:"rollover_cap"`
+	Features              string  `gorm:"type:text" json:"features"`
+
+	ChangeNote string    `gorm:"type:varchar(500)" json:"change_note"` // 修改说明
+	CreatedBy  *uint     `json:"created_by"`                           // 创建版本的管理员，NULL表示系统迁移生成
+	CreatedAt  time.Time `json:"created_at"`
+}
+
+// 添加表名方法
+func (SubscriptionPlanVersion) TableName() string {
+	return "subscription_plan_versions"
+}
+
 // Subscription 用户订阅模型
 type Subscription struct {
 	ID                 uint             `gorm:"primarykey" json:"id"`
@@ -93,7 +142,7 @@ type Subscription struct {
 	Plan               SubscriptionPlan `gorm:"foreignKey:SubscriptionPlanID;references:ID" json:"plan,omitempty"`
 
 	// 状态和时间
-	Status      string    `gorm:"not null;index" json:"status"`       // active, expired
+	Status      string    `gorm:"not null;index" json:"status"`       // active, past_due, canceled, expired
 	ActivatedAt time.Time `gorm:"not null;index" json:"activated_at"` // 激活时间
 	ExpiresAt   time.Time `gorm:"not null;index" json:"expires_at"`   // 过期时间
 
@@ -110,6 +159,16 @@ type Subscription struct {
 	SourceID   string `gorm:"type:varchar(191)" json:"source_id"`   // 来源ID（激活码ID/支付ID等）
 	InvoiceURL string `gorm:"type:varchar(500)" json:"invoice_url"` // 发票链接
 
+	// 周期订阅信息（IsRecurring 为 true 时有效，ExpiresAt 为当前周期结束时间）
+	IsRecurring        bool       `gorm:"default:false;index" json:"is_recurring"`
+	PaymentProvider    string     `gorm:"type:varchar(32)" json:"payment_provider"` // 续费使用的支付渠道
+	CurrentPeriodStart *time.Time `json:"current_period_start"`
+	PeriodPoints       int64      `gorm:"default:0" json:"period_points"`    // 当前周期发放的积分，用于计算结转
+	RenewalAttempts    int        `gorm:"default:0" json:"renewal_attempts"` // 当前周期自动扣款尝试次数
+	LastRenewalAttempt *time.Time `json:"last_renewal_attempt"`              // 最近一次自动扣款时间
+	GracePeriodEndsAt  *time.Time `json:"grace_period_ends_at"`              // 续费失败宽限期结束时间（status 为 past_due 时有效）
+	CanceledAt         *time.Time `json:"canceled_at"`
+
 	// 其他信息
 	CancelAtPeriodEnd bool           `gorm:"default:false" json:"cancel_at_period_end"`
 	CreatedAt         time.Time      `gorm:"index" json:"created_at"`
@@ -123,13 +182,24 @@ type ActivationCode struct {
 	Code               string           `gorm:"type:varchar(191);uniqueIndex;not null" json:"code"`
 	SubscriptionPlanID uint             `gorm:"not null" json:"subscription_plan_id"` // 关联订阅计划ID
 	Plan               SubscriptionPlan `gorm:"foreignKey:SubscriptionPlanID" json:"plan,omitempty"`
-	Status             string           `gorm:"default:'unused'" json:"status"` // unused, used, expired
-	UsedByUserID       *uint            `json:"used_by_user_id"`
+	Status             string           `gorm:"default:'unused'" json:"status"` // unused（可多次使用的激活码达到兑换上限前保持unused）, used, expired, disabled
+	UsedByUserID       *uint            `json:"used_by_user_id"`                // 最近一次兑换的用户
 	UsedBy             *User            `gorm:"foreignKey:UsedByUserID" json:"used_by,omitempty"`
 	UsedAt             *time.Time       `json:"used_at"`
 	BatchNumber        string           `gorm:"type:varchar(191)" json:"batch_number"` // 批次号
-	CreatedAt          time.Time        `json:"created_at"`
-	DeletedAt          gorm.DeletedAt   `gorm:"index" json:"-"`
+	PlanVersionID      *uint            `gorm:"index" json:"plan_version_id"`          // 生成时的订阅计划版本，兑换时按该版本发放
+
+	// 兑换限制
+	ExpiresAt           *time.Time `gorm:"index" json:"expires_at"`                        // 未使用时的过期时间，为空表示永不过期
+	MaxRedemptions      int        `gorm:"not null;default:1" json:"max_redemptions"`      // 最大兑换次数
+	RedemptionCount     int        `gorm:"not null;default:0" json:"redemption_count"`     // 已兑换次数
+	AllowRepeat         bool       `gorm:"not null;default:false" json:"allow_repeat"`     // 是否允许同一用户重复兑换
+	NewUserDays         int        `gorm:"not null;default:0" json:"new_user_days"`        // 仅限注册N天内的新用户兑换，0表示不限制
+	AllowedEmailDomains string     `gorm:"type:varchar(500)" json:"allowed_email_domains"` // 限定的邮箱域名，逗号分隔，为空表示不限制
+	Channel             string     `gorm:"type:varchar(64);index" json:"channel"`          // 渠道/分销商标识
+
+	CreatedAt time.Time      `json:"created_at"`
+	DeletedAt gorm.DeletedAt `gorm:"index" json:"-"`
 }
 
 // SystemConfig 系统配置
@@ -165,6 +235,9 @@ type APITransaction struct {
 	CacheMultiplier  float64 `gorm:"default:1.0" json:"cache_multiplier"` // 缓存token倍率
 	ModelMultiplier  float64 `gorm:"default:1.0" json:"model_multiplier"` // 模型倍率
 	PointsUsed       int64   `gorm:"not null" json:"points_used"`         // 消耗的积分
+	RefundedPoints   int64   `gorm:"default:0" json:"refunded_points"`    // 管理员已退还的积分
+	WeightedTokens   int64   `gorm:"default:0" json:"weighted_tokens"`    // 计入累计计费的加权token数量，退款以此为单位
+	RefundedTokens   int64   `gorm:"default:0" json:"refunded_tokens"`    // 管理员已退还的加权token数量
 
 	// 请求详情
 	IP          string    `gorm:"type:varchar(45)" json:"ip"`             // 客户端IP
@@ -174,7 +247,11 @@ type APITransaction struct {
 	Error       string    `gorm:"type:text" json:"error,omitempty"`       // 错误信息（如果有）
 	Duration    int       `gorm:"not null" json:"duration"`               // 请求耗时（毫秒）
 	ServiceTier string    `gorm:"default:'standard'" json:"service_tier"` // 服务等级
-	CreatedAt   time.Time `gorm:"index" json:"created_at"`
+
+	// 组织计费（成员使用组织钱包时记录所属组织，UserID为实际使用的成员）
+	OrganizationID *uint `gorm:"index" json:"organization_id"`
+
+	CreatedAt time.Time `gorm:"index" json:"created_at"`
 }
 
 // DailyCheckin 每日签到记录
@@ -184,6 +261,11 @@ type DailyCheckin struct {
 	User        User      `gorm:"foreignKey:UserID" json:"user,omitempty"`
 	CheckinDate string    `gorm:"type:varchar(10);not null;index" json:"checkin_date"` // 签到日期 YYYY-MM-DD
 	Points      int64     `gorm:"not null" json:"points"`                              // 获得的积分
+	BasePoints  int64     `gorm:"not null;default:0" json:"base_points"`               // 连续签到加成前的基础积分
+	StreakDays  int       `gorm:"not null;default:1" json:"streak_days"`               // 签到时的连续签到天数
+	Multiplier  float64   `gorm:"not null;default:1" json:"multiplier"`                // 连续签到奖励倍率
+	IsMakeup    bool      `gorm:"not null;default:false;index" json:"is_makeup"`       // 是否为补签
+	MakeupCost  int64     `gorm:"not null;default:0" json:"makeup_cost"`               // 补签消耗的积分
 	CreatedAt   time.Time `gorm:"index" json:"created_at"`
 
 	// 复合唯一索引：一个用户每天只能签到一次
@@ -234,6 +316,7 @@ type GiftRecord struct {
 	Status         string `gorm:"default:'pending';index" json:"status"` // pending, completed, failed
 	SubscriptionID *uint  `json:"subscription_id"`                       // 生成的订阅ID（成功时）
 	ErrorMessage   string `gorm:"type:text" json:"error_message"`        // 失败原因（失败时）
+	PlanVersionID  *uint  `json:"plan_version_id"`                       // 赠送时的订阅计划版本
 
 	CreatedAt time.Time      `gorm:"index" json:"created_at"`
 	UpdatedAt time.Time      `json:"updated_at"`
@@ -273,7 +356,7 @@ type UserWallet struct {
 
 	// 钱包状态
 	WalletExpiresAt time.Time `gorm:"not null" json:"wallet_expires_at"`       // 钱包过期时间 (最晚的订阅过期时间)
-	Status          string    `gorm:"not null;default:'active'" json:"status"` // active, expired
+	Status          string    `gorm:"not null;default:'active'" json:"status"` // active, grace（宽限期，只读）, expired
 
 	// 统计信息
 	LastCheckinDate string `gorm:"type:varchar(10)" json:"last_checkin_date"` // 最后签到日期 YYYY-MM-DD
@@ -297,7 +380,7 @@ type RedemptionRecord struct {
 	UserID uint `gorm:"not null;index" json:"user_id"` // 用户ID
 
 	// 兑换来源
-	SourceType string `gorm:"not null;index" json:"source_type"`  // activation_code, admin_gift, daily_checkin, payment
+	SourceType string `gorm:"not null;index" json:"source_type"`  // activation_code, admin_gift, daily_checkin, checkin_makeup, payment, transfer_in, transfer_out, refund, admin_adjustment
 	SourceID   string `gorm:"type:varchar(191)" json:"source_id"` // 来源标识
 
 	// 兑换内容
@@ -306,6 +389,7 @@ type RedemptionRecord struct {
 
 	// 套餐属性 (如果是套餐兑换)
 	SubscriptionPlanID    *uint `json:"subscription_plan_id"`                    // 关联的订阅计划ID (可为空)
+	PlanVersionID         *uint `gorm:"index" json:"plan_version_id"`            // 兑换时的订阅计划版本 (可为空)
 	DailyMaxPoints        int64 `gorm:"default:0" json:"daily_max_points"`       // 每日限制
 	DegradationGuaranteed int   `gorm:"default:0" json:"degradation_guaranteed"` // 降级保证
 	DailyCheckinPoints    int64 `gorm:"default:0" json:"daily_checkin_points"`   // 签到积分范围
@@ -482,6 +566,9 @@ type ConversationLog struct {
 	OutputMultiplier float64 `gorm:"not null" json:"output_multiplier"`   // 输出token倍率
 	CacheMultiplier  float64 `gorm:"default:1.0" json:"cache_multiplier"` // 缓存token倍率
 	PointsUsed       int64   `gorm:"not null" json:"points_used"`         // 消耗的积分
+	RefundedPoints   int64   `gorm:"default:0" json:"refunded_points"`    // 管理员已退还的积分
+	WeightedTokens   int64   `gorm:"default:0" json:"weighted_tokens"`    // 计入累计计费的加权token数量，退款以此为单位
+	RefundedTokens   int64   `gorm:"default:0" json:"refunded_tokens"`    // 管理员已退还的加权token数量
 
 	// 请求性能信息
 	Duration    int    `gorm:"not null" json:"duration"`     // 请求耗时(毫秒)
@@ -505,3 +592,484 @@ type ConversationLog struct {
 func (ConversationLog) TableName() string {
 	return "conversation_logs"
 }
+
+// Organization 组织（团队）模型
+type Organization struct {
+	ID          uint   `gorm:"primarykey" json:"id"`
+	Name        string `gorm:"type:varchar(191);not null" json:"name"` // 组织名称
+	OwnerUserID uint   `gorm:"not null;index" json:"owner_user_id"`    // 所有者用户ID
+	Owner       User   `gorm:"foreignKey:OwnerUserID" json:"owner,omitempty"`
+	Status      string `gorm:"not null;default:'active';index" json:"status"` // active, disabled
+
+	CreatedAt time.Time      `gorm:"index" json:"created_at"`
+	UpdatedAt time.Time      `json:"updated_at"`
+	DeletedAt gorm.DeletedAt `gorm:"index" json:"-"`
+}
+
+// 添加表名方法
+func (Organization) TableName() string {
+	return "organizations"
+}
+
+// OrganizationWallet 组织共享钱包 - 结构与用户钱包保持一致
+type OrganizationWallet struct {
+	OrganizationID uint `gorm:"primarykey" json:"organization_id"` // 组织ID作为主键
+
+	// 积分相关
+	TotalPoints     int64 `gorm:"not null;default:0" json:"total_points"`     // 总积分 (历史累计充值)
+	AvailablePoints int64 `gorm:"not null;default:0" json:"available_points"` // 可用积分
+	UsedPoints      int64 `gorm:"not null;default:0" json:"used_points"`      // 已使用积分
+
+	// 累计token计费相关
+	AccumulatedTokens int64 `gorm:"not null;default:0" json:"accumulated_tokens"` // 累计加权token数量
+
+	// 钱包状态
+	WalletExpiresAt time.Time `gorm:"not null" json:"wallet_expires_at"`       // 钱包过期时间
+	Status          string    `gorm:"not null;default:'active'" json:"status"` // active, expired
+
+	CreatedAt time.Time `gorm:"index" json:"created_at"`
+	UpdatedAt time.Time `json:"updated_at"`
+}
+
+// 添加表名方法
+func (OrganizationWallet) TableName() string {
+	return "organization_wallets"
+}
+
+// OrganizationMember 组织成员 - 一个用户同一时间只能属于一个组织
+type OrganizationMember struct {
+	ID             uint         `gorm:"primarykey" json:"id"`
+	OrganizationID uint         `gorm:"not null;index" json:"organization_id"`
+	Organization   Organization `gorm:"foreignKey:OrganizationID" json:"organization,omitempty"`
+	UserID         uint         `gorm:"not null;uniqueIndex" json:"user_id"`
+	User           User         `gorm:"foreignKey:UserID" json:"user,omitempty"`
+	Role           string       `gorm:"type:varchar(20);not null;default:'member'" json:"role"` // owner, admin, member
+	DailyMaxPoints int64        `gorm:"default:0" json:"daily_max_points"`                      // 成员每日最大使用积分，0表示无限制
+	InvitedByID    *uint        `json:"invited_by_id"`                                          // 邀请人ID
+
+	CreatedAt time.Time `gorm:"index" json:"created_at"`
+	UpdatedAt time.Time `json:"updated_at"`
+}
+
+// 添加表名方法
+func (OrganizationMember) TableName() string {
+	return "organization_members"
+}
+
+// OrganizationInvitation 组织邀请记录
+type OrganizationInvitation struct {
+	ID               uint         `gorm:"primarykey" json:"id"`
+	OrganizationID   uint         `gorm:"not null;index" json:"organization_id"`
+	Organization     Organization `gorm:"foreignKey:OrganizationID" json:"organization,omitempty"`
+	Email            string       `gorm:"type:varchar(191);not null;index" json:"email"`          // 被邀请邮箱
+	Role             string       `gorm:"type:varchar(20);not null;default:'member'" json:"role"` // admin, member
+	TokenHash        string       `gorm:"type:varchar(64);uniqueIndex;not null" json:"-"`         // 邀请令牌哈希
+	InvitedByID      uint         `gorm:"not null" json:"invited_by_id"`                          // 邀请人ID
+	InvitedBy        User         `gorm:"foreignKey:InvitedByID" json:"invited_by,omitempty"`
+	Status           string       `gorm:"not null;default:'pending';index" json:"status"` // pending, accepted, revoked
+	ExpiresAt        time.Time    `gorm:"not null" json:"expires_at"`
+	AcceptedAt       *time.Time   `json:"accepted_at"`
+	AcceptedByUserID *uint        `json:"accepted_by_user_id"`
+
+	CreatedAt time.Time `gorm:"index" json:"created_at"`
+	UpdatedAt time.Time `json:"updated_at"`
+}
+
+// 添加表名方法
+func (OrganizationInvitation) TableName() string {
+	return "organization_invitations"
+}
+
+// OrganizationCreditRecord 组织钱包充值记录
+type OrganizationCreditRecord struct {
+	ID             uint `gorm:"primarykey" json:"id"`
+	OrganizationID uint `gorm:"not null;index" json:"organization_id"`
+
+	SourceType   string `gorm:"not null;index" json:"source_type"`  // activation_code, admin_gift, refund
+	SourceID     string `gorm:"type:varchar(191)" json:"source_id"` // 来源标识
+	PointsAmount int64  `gorm:"not null" json:"points_amount"`      // 充值积分数量
+	ValidityDays int    `gorm:"not null" json:"validity_days"`      // 有效期天数
+
+	SubscriptionPlanID *uint     `json:"subscription_plan_id"`             // 关联的订阅计划ID
+	PlanVersionID      *uint     `json:"plan_version_id"`                  // 关联的订阅计划版本
+	OperatorUserID     uint      `gorm:"not null" json:"operator_user_id"` // 操作人（组织管理员或系统管理员）
+	ExpiresAt          time.Time `gorm:"not null" json:"expires_at"`       // 过期时间
+	Reason             string    `gorm:"type:varchar(500)" json:"reason"`  // 充值原因/描述
+
+	CreatedAt time.Time `gorm:"index" json:"created_at"`
+
+	Operator *User `gorm:"foreignKey:OperatorUserID;references:ID" json:"operator,omitempty"`
+}
+
+// 添加表名方法
+func (OrganizationCreditRecord) TableName() string {
+	return "organization_credit_records"
+}
+
+// OrganizationMemberDailyUsage 组织成员每日使用记录 - 用于成员每日额度控制和用量统计
+type OrganizationMemberDailyUsage struct {
+	ID             uint   `gorm:"primarykey" json:"id"`
+	OrganizationID uint   `gorm:"not null;uniqueIndex:idx_org_member_usage_date" json:"organization_id"`
+	UserID         uint   `gorm:"not null;uniqueIndex:idx_org_member_usage_date" json:"user_id"`
+	UsageDate      string `gorm:"type:varchar(10);not null;uniqueIndex:idx_org_member_usage_date" json:"usage_date"` // 使用日期 YYYY-MM-DD
+	PointsUsed     int64  `gorm:"not null;default:0" json:"points_used"`                                             // 当日已使用积分
+
+	CreatedAt time.Time `gorm:"index" json:"created_at"`
+	UpdatedAt time.Time `json:"updated_at"`
+}
+
+// 添加表名方法
+func (OrganizationMemberDailyUsage) TableName() string {
+	return "organization_member_daily_usage"
+}
+
+// PointTransfer 用户间积分转账记录 - 用于审计和每日限额统计
+type PointTransfer struct {
+	ID           uint      `gorm:"primarykey" json:"id"`
+	FromUserID   uint      `gorm:"not null;index" json:"from_user_id"`         // 转出用户ID
+	ToUserID     uint      `gorm:"not null;index" json:"to_user_id"`           // 转入用户ID
+	PointsAmount int64     `gorm:"not null" json:"points_amount"`              // 转账积分数量
+	ExpiresAt    time.Time `gorm:"not null" json:"expires_at"`                 // 转入积分的过期时间（收款方钱包过期时间）
+	Note         string    `gorm:"type:varchar(200)" json:"note"`              // 转账备注
+	Verified     bool      `gorm:"default:false" json:"verified"`              // 是否经过邮箱验证码确认
+	IP           string    `gorm:"type:varchar(45)" json:"ip"`                 // 发起转账的IP
+	Status       string    `gorm:"not null;default:'completed'" json:"status"` // completed
+	CreatedAt    time.Time `gorm:"index" json:"created_at"`
+
+	FromUser User `gorm:"foreignKey:FromUserID;references:ID" json:"from_user,omitempty"`
+	ToUser   User `gorm:"foreignKey:ToUserID;references:ID" json:"to_user,omitempty"`
+}
+
+// 添加表名方法
+func (PointTransfer) TableName() string {
+	return "point_transfers"
+}
+
+// PaymentOrder 支付订单 - 用户直接购买订阅计划
+type PaymentOrder struct {
+	ID                 uint   `gorm:"primarykey" json:"id"`
+	OrderNo            string `gorm:"type:varchar(64);uniqueIndex;not null" json:"order_no"` // 商户订单号
+	UserID             uint   `gorm:"not null;index" json:"user_id"`
+	SubscriptionPlanID uint   `gorm:"not null" json:"subscription_plan_id"`
+	SubscriptionID     *uint  `gorm:"index" json:"subscription_id"` // 周期订阅续费订单关联的订阅
+	PlanVersionID      *uint  `json:"plan_version_id"`              // 下单时的订阅计划版本，支付成功后按该版本发放
+
+	// 支付渠道信息
+	Provider          string `gorm:"type:varchar(32);not null;index" json:"provider"`    // mock, stripe
+	ProviderOrderID   string `gorm:"type:varchar(191);index" json:"provider_order_id"`   // 渠道侧订单/会话ID
+	ProviderPaymentID string `gorm:"type:varchar(191);index" json:"provider_payment_id"` // 渠道侧支付ID（用于退款）
+	CheckoutURL       string `gorm:"type:varchar(1000)" json:"checkout_url"`             // 支付页面地址
+
+	// 金额（下单时从订阅计划复制，避免计划调价影响已有订单）
+	Amount       float64 `gorm:"not null" json:"amount"`
+	Currency     string  `gorm:"type:varchar(10);not null" json:"currency"`
+	RefundAmount float64 `gorm:"default:0" json:"refund_amount"`
+
+	// 优惠码折扣（Amount 为折后实付金额）
+	DiscountAmount    float64 `gorm:"default:0" json:"discount_amount"`
+	PromoRedemptionID *uint   `json:"promo_redemption_id"`
+
+	// 状态：pending, paid, expired, failed, cancelled, refunded
+	Status             string     `gorm:"type:varchar(20);not null;default:'pending';index" json:"status"`
+	ExpiresAt          time.Time  `gorm:"not null;index" json:"expires_at"` // 未支付订单过期时间
+	PaidAt             *time.Time `json:"paid_at"`
+	RefundedAt         *time.Time `json:"refunded_at"`
+	InvoiceURL         string     `gorm:"type:varchar(500)" json:"invoice_url"`
+	RedemptionRecordID *uint      `json:"redemption_record_id"` // 支付成功后发放套餐的兑换记录
+
+	CreatedAt time.Time `gorm:"index" json:"created_at"`
+	UpdatedAt time.Time `json:"updated_at"`
+
+	User User             `gorm:"foreignKey:UserID;references:ID" json:"user,omitempty"`
+	Plan SubscriptionPlan `gorm:"foreignKey:SubscriptionPlanID;references:ID" json:"plan,omitempty"`
+}
+
+// 添加表名方法
+func (PaymentOrder) TableName() string {
+	return "payment_orders"
+}
+
+// PaymentWebhookEvent 支付回调事件记录 - 用于回调幂等处理和排查
+type PaymentWebhookEvent struct {
+	ID        uint   `gorm:"primarykey" json:"id"`
+	Provider  string `gorm:"type:varchar(32);not null;uniqueIndex:idx_payment_webhook_event" json:"provider"`
+	EventID   string `gorm:"type:varchar(191);not null;uniqueIndex:idx_payment_webhook_event" json:"event_id"`
+	EventType string `gorm:"type:varchar(64)" json:"event_type"` // paid, refunded, expired, failed
+	OrderNo   string `gorm:"type:varchar(64);index" json:"order_no"`
+	Payload   string `gorm:"type:text" json:"payload"`
+
+	CreatedAt time.Time `gorm:"index" json:"created_at"`
+}
+
+// 添加表名方法
+func (PaymentWebhookEvent) TableName() string {
+	return "payment_webhook_events"
+}
+
+// PromoCode 营销优惠码 - 可多人使用，与一码一用的激活码相互独立
+type PromoCode struct {
+	ID          uint   `gorm:"primarykey" json:"id"`
+	Code        string `gorm:"type:varchar(64);uniqueIndex;not null" json:"code"`
+	Name        string `gorm:"type:varchar(191);not null" json:"name"`
+	Description string `gorm:"type:text" json:"description"`
+
+	// 奖励类型：points（立即发放积分）, bonus_percent（下次兑换/购买额外赠送积分）, discount_percent（下次在线购买折扣）
+	RewardType   string `gorm:"type:varchar(32);not null" json:"reward_type"`
+	PointsAmount int64  `gorm:"default:0" json:"points_amount"` // points 类型发放的积分
+	ValidityDays int    `gorm:"default:0" json:"validity_days"` // points 类型积分有效期天数
+	Percent      int    `gorm:"default:0" json:"percent"`       // bonus_percent/discount_percent 的百分比（1-100）
+
+	// 使用限制
+	MaxUses      int        `gorm:"default:0" json:"max_uses"`       // 总使用次数上限，0表示不限制
+	UsedCount    int        `gorm:"default:0" json:"used_count"`     // 已使用次数
+	PerUserLimit int        `gorm:"default:1" json:"per_user_limit"` // 每个用户可使用次数
+	StartsAt     *time.Time `json:"starts_at"`                       // 生效时间，为空表示立即生效
+	EndsAt       *time.Time `json:"ends_at"`                         // 失效时间，为空表示长期有效
+
+	// 适用条件
+	NewUsersOnly       bool   `gorm:"default:false" json:"new_users_only"`                          // 仅限从未兑换或购买过套餐的用户
+	SubscriptionPlanID *uint  `json:"subscription_plan_id"`                                         // 仅在兑换/购买指定套餐时生效（bonus_percent/discount_percent）
+	OAuthProvider      string `gorm:"column:oauth_provider;type:varchar(32)" json:"oauth_provider"` // 仅限绑定了指定第三方账号的用户，如 linux_do
+	Active             bool   `gorm:"default:true" json:"active"`
+	CreatedByAdminID   uint   `json:"created_by_admin_id"`
+
+	CreatedAt time.Time      `gorm:"index" json:"created_at"`
+	UpdatedAt time.Time      `json:"updated_at"`
+	DeletedAt gorm.DeletedAt `gorm:"index" json:"-"`
+
+	Plan *SubscriptionPlan `gorm:"foreignKey:SubscriptionPlanID;references:ID" json:"plan,omitempty"`
+}
+
+// 添加表名方法
+func (PromoCode) TableName() string {
+	return "promo_codes"
+}
+
+// PromoRedemption 优惠码使用记录
+type PromoRedemption struct {
+	ID          uint `gorm:"primarykey" json:"id"`
+	PromoCodeID uint `gorm:"not null;index" json:"promo_code_id"`
+	UserID      uint `gorm:"not null;index" json:"user_id"`
+
+	// 状态：claimed（已领取，等待下次兑换/购买时使用）, applied（已生效）, revoked（订单退款后作废）
+	Status        string     `gorm:"type:varchar(20);not null;index" json:"status"`
+	RewardType    string     `gorm:"type:varchar(32);not null" json:"reward_type"`
+	PointsAmount  int64      `gorm:"default:0" json:"points_amount"`          // 实际发放的积分（含额外赠送）
+	DiscountValue float64    `gorm:"default:0" json:"discount_value"`         // 实际抵扣金额
+	AppliedSource string     `gorm:"type:varchar(191)" json:"applied_source"` // 生效来源，如 activation_code:XXXX、payment:PO...
+	AppliedAt     *time.Time `json:"applied_at"`
+
+	CreatedAt time.Time `gorm:"index" json:"created_at"`
+	UpdatedAt time.Time `json:"updated_at"`
+
+	PromoCode PromoCode `gorm:"foreignKey:PromoCodeID;references:ID" json:"promo_code,omitempty"`
+	User      User      `gorm:"foreignKey:UserID;references:ID" json:"user,omitempty"`
+}
+
+// 添加表名方法
+func (PromoRedemption) TableName() string {
+	return "promo_redemptions"
+}
+
+// ReferralCode 用户邀请码 - 每个用户一个，首次访问邀请面板时生成
+type ReferralCode struct {
+	ID     uint   `gorm:"primarykey" json:"id"`
+	UserID uint   `gorm:"not null;uniqueIndex" json:"user_id"`
+	Code   string `gorm:"type:varchar(32);uniqueIndex;not null" json:"code"`
+
+	CreatedAt time.Time `json:"created_at"`
+}
+
+// 添加表名方法
+func (ReferralCode) TableName() string {
+	return "referral_codes"
+}
+
+// Referral 邀请关系 - 注册时记录，被邀请人首次兑换付费激活码时双方获得奖励
+type Referral struct {
+	ID         uint   `gorm:"primarykey" json:"id"`
+	ReferrerID uint   `gorm:"not null;index" json:"referrer_id"`         // 邀请人
+	RefereeID  uint   `gorm:"not null;uniqueIndex" json:"referee_id"`    // 被邀请人，每个用户只能被邀请一次
+	Code       string `gorm:"type:varchar(32);not null" json:"code"`     // 注册时使用的邀请码
+	Source     string `gorm:"type:varchar(32)" json:"source"`            // 注册方式：email, email_code, linux_do
+	RegisterIP string `gorm:"type:varchar(45);index" json:"register_ip"` // 被邀请人注册IP
+	DeviceHash string `gorm:"type:varchar(64);index" json:"device_hash"` // 被邀请人注册设备指纹摘要
+
+	// 状态：pending（等待转化）, rewarded（已发放奖励）, rejected（触发风控规则，不发放奖励）
+	Status         string     `gorm:"type:varchar(20);not null;default:'pending';index" json:"status"`
+	RejectReason   string     `gorm:"type:varchar(191)" json:"reject_reason"`
+	ReferrerPoints int64      `gorm:"default:0" json:"referrer_points"`        // 邀请人获得的积分
+	RefereePoints  int64      `gorm:"default:0" json:"referee_points"`         // 被邀请人获得的积分
+	ConvertSource  string     `gorm:"type:varchar(191)" json:"convert_source"` // 转化来源，如 activation_code:XXXX
+	ConvertedAt    *time.Time `json:"converted_at"`
+
+	CreatedAt time.Time `gorm:"index" json:"created_at"`
+	UpdatedAt time.Time `json:"updated_at"`
+
+	Referrer User `gorm:"foreignKey:ReferrerID;references:ID" json:"referrer,omitempty"`
+	Referee  User `gorm:"foreignKey:RefereeID;references:ID" json:"referee,omitempty"`
+}
+
+// 添加表名方法
+func (Referral) TableName() string {
+	return "referrals"
+}
+
+// JobRun 定时任务执行记录
+type JobRun struct {
+	ID          uint       `gorm:"primarykey" json:"id"`
+	JobName     string     `gorm:"type:varchar(64);not null;index" json:"job_name"`
+	TriggerType string     `gorm:"type:varchar(20);not null" json:"trigger_type"` // schedule（定时触发）, manual（管理员手动触发）
+	TriggeredBy *uint      `json:"triggered_by"`                                  // 手动触发的管理员ID
+	InstanceID  string     `gorm:"type:varchar(191)" json:"instance_id"`          // 执行任务的实例
+	Status      string     `gorm:"type:varchar(20);not null;index" json:"status"` // running, success, failed, skipped
+	Error       string     `gorm:"type:text" json:"error"`
+	StartedAt   time.Time  `gorm:"not null;index" json:"started_at"`
+	FinishedAt  *time.Time `json:"finished_at"`
+	DurationMs  int64      `gorm:"default:0" json:"duration_ms"`
+
+	CreatedAt time.Time `json:"created_at"`
+}
+
+// 添加表名方法
+func (JobRun) TableName() string {
+	return "job_runs"
+}
+
+// WalletExpiryRecord 钱包过期记录 - 记录钱包进入宽限期或过期时的积分快照
+type WalletExpiryRecord struct {
+	ID     uint `gorm:"primarykey" json:"id"`
+	UserID uint `gorm:"not null;index" json:"user_id"`
+
+	// 事件：grace（进入宽限期）, expired（已过期）
+	Event           string     `gorm:"type:varchar(20);not null;index" json:"event"`
+	PreviousStatus  string     `gorm:"type:varchar(20)" json:"previous_status"`
+	AvailablePoints int64      `gorm:"default:0" json:"available_points"` // 过期时剩余的可用积分
+	TotalPoints     int64      `gorm:"default:0" json:"total_points"`
+	UsedPoints      int64      `gorm:"default:0" json:"used_points"`
+	WalletExpiresAt time.Time  `gorm:"not null" json:"wallet_expires_at"`
+	GraceEndsAt     *time.Time `json:"grace_ends_at"`                 // 宽限期结束时间
+	Notified        bool       `gorm:"default:false" json:"notified"` // 是否已邮件通知用户
+
+	CreatedAt time.Time `gorm:"index" json:"created_at"`
+
+	User User `gorm:"foreignKey:UserID;references:ID" json:"user,omitempty"`
+}
+
+// 添加表名方法
+func (WalletExpiryRecord) TableName() string {
+	return "wallet_expiry_records"
+}
+
+// RiskEvent 风控事件 - 账户共享、倒卖等异常信号，进入管理员审核队列
+type RiskEvent struct {
+	ID     uint `gorm:"primarykey" json:"id"`
+	UserID uint `gorm:"not null;index" json:"user_id"`
+
+	// 信号：distinct_ips, distinct_locations, devices_per_day, concurrent_ips, batch_fresh_accounts
+	SignalType string `gorm:"type:varchar(50);not null;index" json:"signal_type"`
+	Score      int    `gorm:"not null;default:0" json:"score"`     // 该信号的风险分
+	Value      int64  `gorm:"not null;default:0" json:"value"`     // 观测值
+	Threshold  int64  `gorm:"not null;default:0" json:"threshold"` // 触发阈值
+	Details    string `gorm:"type:text" json:"details"`            // 信号详情（JSON）
+
+	// 状态：pending（待审核）, confirmed（已确认）, dismissed（已忽略）
+	Status     string `gorm:"type:varchar(20);not null;default:'pending';index" json:"status"`
+	AutoAction string `gorm:"type:varchar(20);default:'none'" json:"auto_action"` // none, device_logout, disable
+
+	// 审核信息
+	ReviewedBy   *uint      `json:"reviewed_by"`
+	ReviewAction string     `gorm:"type:varchar(20)" json:"review_action"` // 审核时执行的处置：none, device_logout, disable
+	ReviewNote   string     `gorm:"type:varchar(500)" json:"review_note"`
+	ReviewedAt   *time.Time `json:"reviewed_at"`
+
+	CreatedAt time.Time `gorm:"index" json:"created_at"`
+	UpdatedAt time.Time `json:"updated_at"`
+
+	User User `gorm:"foreignKey:UserID;references:ID" json:"user,omitempty"`
+}
+
+// 添加表名方法
+func (RiskEvent) TableName() string {
+	return "risk_events"
+}
+
+// UserTwoFactor 用户两步验证（TOTP）配置
+type UserTwoFactor struct {
+	ID           uint       `gorm:"primarykey" json:"id"`
+	UserID       uint       `gorm:"not null;uniqueIndex" json:"user_id"`
+	Secret       string     `gorm:"type:varchar(64);not null" json:"-"` // TOTP密钥（Base32）
+	Enabled      bool       `gorm:"default:false" json:"enabled"`       // 完成绑定验证后才启用
+	EnabledAt    *time.Time `json:"enabled_at"`
+	LastUsedStep int64      `gorm:"default:0" json:"-"` // 最近一次验证通过的时间步，防止验证码重放
+	CreatedAt    time.Time  `json:"created_at"`
+	UpdatedAt    time.Time  `json:"updated_at"`
+}
+
+// 添加表名方法
+func (UserTwoFactor) TableName() string {
+	return "user_two_factors"
+}
+
+// TwoFactorRecoveryCode 两步验证恢复码，只保存哈希，每个恢复码只能使用一次
+type TwoFactorRecoveryCode struct {
+	ID        uint       `gorm:"primarykey" json:"id"`
+	UserID    uint       `gorm:"not null;index" json:"user_id"`
+	CodeHash  string     `gorm:"type:varchar(64);not null;index" json:"-"`
+	UsedAt    *time.Time `json:"used_at"`
+	CreatedAt time.Time  `json:"created_at"`
+}
+
+// 添加表名方法
+func (TwoFactorRecoveryCode) TableName() string {
+	return "two_factor_recovery_codes"
+}
+
+// Passkey 用户的通行密钥（WebAuthn 凭据），一个用户可以注册多个
+type Passkey struct {
+	ID             uint       `gorm:"primarykey" json:"id"`
+	UserID         uint       `gorm:"not null;index" json:"user_id"`
+	Name           string     `gorm:"type:varchar(100)" json:"name"`                               // 用户填写的名称，便于区分设备
+	CredentialID   string     `gorm:"type:varchar(191);uniqueIndex;not null" json:"credential_id"` // 凭据ID（Base64URL）
+	PublicKey      []byte     `gorm:"type:blob;not null" json:"-"`                                 // COSE格式公钥
+	Algorithm      int        `gorm:"not null" json:"algorithm"`                                   // COSE算法：-7 ES256, -8 EdDSA, -257 RS256
+	SignCount      uint32     `gorm:"default:0" json:"-"`                                          // 签名计数器，用于发现克隆的认证器
+	AAGUID         string     `gorm:"type:varchar(36)" json:"aaguid"`                              // 认证器型号标识
+	Transports     string     `gorm:"type:varchar(100)" json:"transports"`                         // 逗号分隔：internal, hybrid, usb, nfc, ble
+	BackupEligible bool       `gorm:"default:false" json:"backup_eligible"`                        // 是否为可同步的通行密钥
+	LastUsedAt     *time.Time `json:"last_used_at"`
+	CreatedAt      time.Time  `json:"created_at"`
+}
+
+// 添加表名方法
+func (Passkey) TableName() string {
+	return "passkeys"
+}
+
+// OAuthClient 接入SSO的客户端应用，客户端密钥只保存哈希
+type OAuthClient struct {
+	ID                    uint           `gorm:"primarykey" json:"id"`
+	ClientID              string         `gorm:"type:varchar(64);uniqueIndex;not null" json:"client_id"`
+	Name                  string         `gorm:"type:varchar(100);not null" json:"name"`
+	Description           string         `gorm:"type:varchar(500)" json:"description"`
+	SecretHash            string         `gorm:"type:varchar(64);not null" json:"-"`    // 当前密钥的SHA-256
+	SecretPrefix          string         `gorm:"type:varchar(16)" json:"secret_prefix"` // 密钥前几位，便于管理员辨认
+	PreviousSecretHash    string         `gorm:"type:varchar(64)" json:"-"`             // 轮换前的密钥，宽限期内仍可使用
+	PreviousSecretExpires *time.Time     `json:"previous_secret_expires"`               // 旧密钥失效时间
+	SecretRotatedAt       *time.Time     `json:"secret_rotated_at"`
+	RedirectURIs          string         `gorm:"type:text" json:"redirect_uris"`            // JSON字符串数组，精确匹配
+	Scopes                string         `gorm:"type:varchar(255)" json:"scopes"`           // 允许的权限范围，空格分隔
+	AccessTokenTTLMinutes int            `gorm:"default:0" json:"access_token_ttl_minutes"` // 访问令牌有效期，0表示使用全局配置
+	RefreshTokenTTLDays   int            `gorm:"default:0" json:"refresh_token_ttl_days"`   // 刷新令牌有效期，0表示使用全局配置
+	Enabled               bool           `gorm:"not null;index" json:"enabled"`
+	CreatedBy             uint           `json:"created_by"`
+	LastUsedAt            *time.Time     `json:"last_used_at"`
+	CreatedAt             time.Time      `json:"created_at"`
+	UpdatedAt             time.Time      `json:"updated_at"`
+	DeletedAt             gorm.DeletedAt `gorm:"index" json:"-"`
+}
+
+// 添加表名方法
+func (OAuthClient) TableName() string {
+	return "oauth_clients"
+}
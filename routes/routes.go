@@ -34,6 +34,9 @@ func SetupRoutes(r *gin.Engine) {
 	{
 		auth.POST("/register", handlers.HandleRegister)
 		auth.POST("/login", handlers.HandleLogin)
+		auth.POST("/refresh", handlers.HandleRefreshToken)                  // 使用刷新令牌换取新的访问令牌
+		auth.POST("/forgot-password", handlers.HandleForgotPassword)        // 发送找回密码邮件
+		auth.POST("/reset-password", handlers.HandleResetPassword)          // 通过邮件链接重置密码
 		auth.POST("/logout", middleware.JWTAuth(), handlers.HandleLogout)   // 登出需要token验证
 		auth.GET("/user", middleware.JWTAuth(), handlers.HandleGetUserInfo) // 需要token验证
 
@@ -43,6 +46,9 @@ func SetupRoutes(r *gin.Engine) {
 		auth.POST("/register-with-code", handlers.HandleRegisterWithCode)
 		auth.POST("/login-with-code", handlers.HandleLoginWithCode)
 		auth.POST("/email-auth", handlers.HandleEmailOnlyAuth) // 邮箱验证码一键登录/注册
+		auth.POST("/2fa/verify", handlers.HandleTwoFactorLogin) // 两步验证登录
+		auth.POST("/passkey/login/begin", handlers.HandlePasskeyLoginBegin)   // 获取通行密钥登录选项
+		auth.POST("/passkey/login/finish", handlers.HandlePasskeyLoginFinish) // 通行密钥登录
 
 		// 设置相关路由（需要登录）
 		auth.POST("/check-username", handlers.HandleCheckUsername)                              // 检查用户名可用性
@@ -60,6 +66,12 @@ func SetupRoutes(r *gin.Engine) {
 			linuxdo.GET("/config", handlers.HandleLinuxDoConfig)       // 获取配置状态
 			linuxdo.GET("/authorize", handlers.HandleLinuxDoAuthorize) // 生成授权URL
 		}
+
+		// 通用第三方登录（Linux Do / GitHub / Google），通过 provider 参数指定提供商
+		oauth.GET("/providers", handlers.HandleGetOAuthProviders)                      // 获取第三方登录方式
+		oauth.GET("/authorize", handlers.HandleOAuthAuthorize)                         // 生成授权URL
+		oauth.GET("/temp-user", handlers.HandleGetTemporaryOAuthUser)                  // 获取临时用户信息
+		oauth.POST("/complete-registration", handlers.HandleCompleteOAuthRegistration) // 完成注册
 	}
 
 	// OAuth辅助路由（无需认证）
@@ -71,17 +83,23 @@ func SetupRoutes(r *gin.Engine) {
 
 	// Linux Do固定回调路径 - 直接在根路由处理
 	r.GET("/oauth/linuxdo", handlers.HandleLinuxDoCallback)
+	r.GET("/oauth/github", handlers.HandleGitHubCallback)
+	r.GET("/oauth/google", handlers.HandleGoogleCallback)
 
 	// SSO相关路由
 	sso := r.Group("/api/sso")
 	{
 		// authorize需要用户登录（JWT认证）
 		sso.POST("/authorize", middleware.JWTAuth(), handlers.HandleAuthorize)
-		// 以下两个端点使用客户端凭据认证，不需要用户JWT
+		// 以下端点使用客户端凭据认证，不需要用户JWT
 		sso.POST("/verify-token", handlers.HandleVerifyToken)
 		sso.POST("/verify-code", handlers.HandleVerifyCode)
+		sso.POST("/refresh-token", handlers.HandleSSORefreshToken)
 	}
 
+	// 支付渠道回调（无需认证，由渠道签名校验）
+	r.POST("/api/payments/webhook/:provider", handlers.HandlePaymentWebhook)
+
 	// API路由（需要认证）
 	api := r.Group("/api")
 	api.Use(middleware.JWTAuth()) // 应用JWT认证中间件到整个组
@@ -90,7 +108,12 @@ func SetupRoutes(r *gin.Engine) {
 		api.GET("/subscription/active", handlers.HandleGetActiveSubscription)
 		api.GET("/subscription/history", handlers.HandleGetSubscriptionHistory)
 		api.POST("/subscription/redeem/preview", handlers.HandleRedeemCouponPreview) // 预检查接口
-		api.POST("/subscription/redeem", handlers.HandleRedeemCoupon)
+		api.POST("/subscription/redeem", middleware.Idempotency("subscription_redeem"), handlers.HandleRedeemCoupon) // 同时支持激活码和优惠码，支持 Idempotency-Key
+		api.GET("/subscription/promos", handlers.HandleGetMyPromoRedemptions)
+		api.GET("/subscription/recurring", handlers.HandleGetRecurringSubscriptions)
+		api.POST("/subscription/recurring/:id/cancel", handlers.HandleCancelRecurringSubscription)
+		api.POST("/subscription/recurring/:id/resume", handlers.HandleResumeRecurringSubscription)
+		api.POST("/subscription/recurring/:id/renew", handlers.HandleRetrySubscriptionRenewal) // 宽限期内重新发起续费支付
 
 		// 积分相关路由
 		api.GET("/credits/balance", handlers.HandleGetCreditBalance)
@@ -98,10 +121,29 @@ func SetupRoutes(r *gin.Engine) {
 		api.GET("/credits/history", handlers.HandleGetCreditUsageHistory)
 		api.GET("/credits/pricing-table", handlers.HandleGetPricingTable)
 		api.GET("/credits/daily-usage", handlers.HandleGetDailyUsage)
+		api.GET("/credits/analytics", handlers.HandleGetCreditAnalytics)
+		api.GET("/credits/transfer/settings", handlers.HandleGetTransferSettings)
+		api.POST("/credits/transfer", handlers.HandleTransferPoints)
+		api.GET("/credits/transfers", handlers.HandleGetPointTransfers)
+		api.GET("/credits/statement", handlers.HandleGetStatement)
+
+		// 支付相关路由
+		api.GET("/payments/providers", handlers.HandleGetPaymentProviders)
+		api.POST("/payments/orders", handlers.HandleCreatePaymentOrder)
+		api.GET("/payments/orders", handlers.HandleGetPaymentOrders)
+		api.GET("/payments/orders/:order_no", handlers.HandleGetPaymentOrder)
+		api.POST("/payments/orders/:order_no/cancel", handlers.HandleCancelPaymentOrder)
+		api.POST("/payments/mock/:order_no/pay", handlers.HandleMockPay) // 模拟支付（仅测试环境启用）
+
+		// 邀请相关路由
+		api.GET("/referral", handlers.HandleGetReferralDashboard)
+		api.GET("/referral/invitees", handlers.HandleGetMyReferrals)
 
 		// 签到相关路由
 		api.GET("/checkin/status", handlers.HandleGetCheckinStatus)
 		api.POST("/checkin", handlers.HandleDailyCheckin)
+		api.GET("/checkin/calendar", handlers.HandleGetCheckinCalendar)
+		api.POST("/checkin/makeup", handlers.HandleCheckinMakeup)
 
 		// Claude API 代理路由
 		api.POST("/claude", handlers.HandleClaudeProxy)
@@ -116,6 +158,49 @@ func SetupRoutes(r *gin.Engine) {
 			devices.DELETE("/force", handlers.RevokeAllDevicesForce) // 强制下线所有设备
 			devices.GET("/stats", handlers.GetDeviceStats)           // 获取设备统计
 		}
+
+		// 两步验证路由
+		twoFactor := api.Group("/2fa")
+		{
+			twoFactor.GET("", handlers.HandleGetTwoFactorStatus)                               // 获取两步验证状态
+			twoFactor.POST("/setup", handlers.HandleTwoFactorSetup)                            // 获取密钥和 otpauth 链接
+			twoFactor.POST("/enable", handlers.HandleTwoFactorEnable)                          // 确认绑定并获取恢复码
+			twoFactor.POST("/disable", handlers.HandleTwoFactorDisable)                        // 关闭两步验证
+			twoFactor.POST("/recovery-codes", handlers.HandleTwoFactorRegenerateRecoveryCodes) // 重新生成恢复码
+		}
+
+		// 通行密钥路由
+		passkeys := api.Group("/passkeys")
+		{
+			passkeys.GET("", handlers.HandleGetPasskeys)                            // 获取通行密钥列表
+			passkeys.POST("/register/begin", handlers.HandlePasskeyRegisterBegin)   // 获取注册选项
+			passkeys.POST("/register/finish", handlers.HandlePasskeyRegisterFinish) // 完成注册
+			passkeys.DELETE("/:id", handlers.HandleDeletePasskey)                   // 删除通行密钥
+		}
+
+		// 第三方账号绑定路由
+		oauthAccounts := api.Group("/oauth-accounts")
+		{
+			oauthAccounts.GET("", handlers.HandleGetOAuthAccounts)                // 获取已绑定的第三方账号
+			oauthAccounts.POST("/:provider/link", handlers.HandleOAuthLinkBegin)  // 发起绑定，返回授权URL
+			oauthAccounts.DELETE("/:provider", handlers.HandleUnlinkOAuthAccount) // 解绑
+		}
+
+		// 组织相关路由
+		organizations := api.Group("/organizations")
+		{
+			organizations.POST("", handlers.HandleCreateOrganization)                                            // 创建组织
+			organizations.GET("/current", handlers.HandleGetCurrentOrganization)                                 // 获取当前所属组织
+			organizations.POST("/invitations/accept", handlers.HandleAcceptOrganizationInvitation)               // 接受邀请
+			organizations.GET("/:id/members", handlers.HandleGetOrganizationMembers)                             // 成员列表
+			organizations.PUT("/:id/members/:user_id", handlers.HandleUpdateOrganizationMember)                  // 更新成员角色/额度
+			organizations.DELETE("/:id/members/:user_id", handlers.HandleRemoveOrganizationMember)               // 移除成员/退出组织
+			organizations.GET("/:id/invitations", handlers.HandleGetOrganizationInvitations)                     // 邀请列表
+			organizations.POST("/:id/invitations", handlers.HandleCreateOrganizationInvitation)                  // 发送邀请
+			organizations.DELETE("/:id/invitations/:invitation_id", handlers.HandleRevokeOrganizationInvitation) // 撤销邀请
+			organizations.POST("/:id/redeem", handlers.HandleRedeemCouponToOrganization)                         // 兑换激活码到组织钱包
+			organizations.GET("/:id/usage", handlers.HandleGetOrganizationUsage)                                 // 按成员用量统计
+		}
 	}
 
 	// 管理员路由（需要认证 + 管理员权限）
@@ -124,15 +209,25 @@ func SetupRoutes(r *gin.Engine) {
 	{
 		// 数据看板
 		admin.GET("/dashboard", handlers.HandleAdminDashboard)
+		admin.GET("/wallet-expiry-records", handlers.HandleAdminGetWalletExpiryRecords)
 
 		// 用户管理
 		admin.GET("/users", handlers.HandleAdminGetUsers)
 		admin.PUT("/users/:id", handlers.HandleAdminUpdateUser)
 		admin.DELETE("/users/:id", handlers.HandleAdminDeleteUser)
 		admin.PUT("/users/:id/status", handlers.HandleAdminToggleUserStatus)
+		admin.POST("/users/:id/2fa/reset", handlers.HandleAdminResetUserTwoFactor)
 		admin.GET("/users/:id/subscriptions", handlers.HandleAdminGetUserSubscriptions)
 		admin.PUT("/users/:id/subscriptions/:subscription_id/limit", handlers.HandleAdminUpdateUserSubscriptionLimit)
 		admin.POST("/users/:id/gift", handlers.HandleAdminGiftSubscription)
+		admin.POST("/users/:id/adjust-points", handlers.HandleAdminAdjustUserPoints)
+
+		// 对账单导出
+		admin.GET("/statements/export", handlers.HandleAdminExportStatements)
+
+		// 退款与积分调整
+		admin.POST("/api-transactions/:id/refund", handlers.HandleAdminRefundTransaction)
+		admin.GET("/adjustments", handlers.HandleAdminGetAdjustments)
 
 		// 赠送记录管理
 		admin.GET("/gift-records", handlers.HandleAdminGetGiftRecords)
@@ -146,6 +241,9 @@ func SetupRoutes(r *gin.Engine) {
 		admin.POST("/subscription-plans", handlers.HandleAdminCreateSubscriptionPlan)
 		admin.PUT("/subscription-plans/:id", handlers.HandleAdminUpdateSubscriptionPlan)
 		admin.DELETE("/subscription-plans/:id", handlers.HandleAdminDeleteSubscriptionPlan)
+		admin.GET("/subscription-plans/:id/versions", handlers.HandleAdminGetPlanVersions)
+		admin.GET("/subscription-plans/:id/versions/diff", handlers.HandleAdminDiffPlanVersions)
+		admin.PUT("/subscription-plans/:id/schedule", handlers.HandleAdminUpdatePlanSchedule)
 
 		// 激活码管理
 		admin.GET("/activation-codes", handlers.HandleAdminGetActivationCodes)
@@ -158,15 +256,74 @@ func SetupRoutes(r *gin.Engine) {
 		admin.POST("/activation-codes/ban", handlers.HandleBanActivationCode)
 		admin.POST("/activation-codes/unban", handlers.HandleUnbanActivationCode)
 		admin.POST("/activation-codes/ban-preview", handlers.HandlePreviewBanActivationCode)
+
+		// 激活码批次管理
+		admin.GET("/activation-code-batches", handlers.HandleAdminGetActivationCodeBatches)
+		admin.GET("/activation-code-batches/:batch/stats", handlers.HandleAdminGetActivationCodeBatchStats)
+		admin.GET("/activation-code-batches/:batch/export", handlers.HandleAdminExportActivationCodeBatch)
+		admin.POST("/activation-code-batches/:batch/disable", handlers.HandleAdminDisableActivationCodeBatch)
+		admin.POST("/activation-code-batches/:batch/enable", handlers.HandleAdminEnableActivationCodeBatch)
+		admin.POST("/activation-code-batches/:batch/ban-preview", handlers.HandleAdminPreviewActivationCodeBatchBan)
+		admin.POST("/activation-code-batches/:batch/ban", handlers.HandleAdminBanActivationCodeBatch)
+		admin.POST("/activation-code-batches/:batch/unban", handlers.HandleAdminUnbanActivationCodeBatch)
 		admin.GET("/frozen-records", handlers.HandleGetFrozenRecords)
 		admin.GET("/frozen-records/:id", handlers.HandleGetFrozenRecordDetail)
 
+		// 积分转账审计
+		admin.GET("/point-transfers", handlers.HandleAdminGetPointTransfers)
+
+		// 优惠码管理
+		admin.GET("/promo-codes", handlers.HandleAdminGetPromoCodes)
+		admin.POST("/promo-codes", handlers.HandleAdminCreatePromoCode)
+		admin.PUT("/promo-codes/:id", handlers.HandleAdminUpdatePromoCode)
+		admin.DELETE("/promo-codes/:id", handlers.HandleAdminDeletePromoCode)
+		admin.GET("/promo-redemptions", handlers.HandleAdminGetPromoRedemptions)
+
+		// 定时任务管理
+		admin.GET("/jobs", handlers.HandleAdminGetJobs)
+		admin.POST("/jobs/:name/run", handlers.HandleAdminRunJob)
+		admin.PUT("/jobs/:name/schedule", handlers.HandleAdminUpdateJobSchedule)
+		admin.GET("/job-runs", handlers.HandleAdminGetJobRuns)
+
+		// 防暴力破解锁定管理
+		admin.GET("/brute-force-locks", handlers.HandleAdminGetBruteForceLocks)
+		admin.POST("/brute-force-locks/unlock", handlers.HandleAdminUnlockBruteForceSubject)
+
+		// 账户风控审核
+		admin.GET("/risk-events", handlers.HandleAdminGetRiskEvents)
+		admin.POST("/risk-events/:id/review", handlers.HandleAdminReviewRiskEvent)
+		admin.GET("/users/:id/risk", handlers.HandleAdminGetUserRisk)
+
+		// 邀请管理
+		admin.GET("/referrals", handlers.HandleAdminGetReferrals)
+		admin.GET("/referrals/report", handlers.HandleAdminGetReferralReport)
+
+		// 签到统计
+		admin.GET("/checkin-stats", handlers.HandleAdminGetCheckinStats)
+
+		// 支付订单管理
+		admin.GET("/payment-orders", handlers.HandleAdminGetPaymentOrders)
+		admin.POST("/payment-orders/:order_no/refund", handlers.HandleAdminRefundPaymentOrder)
+
+		// 组织管理
+		admin.GET("/organizations", handlers.HandleAdminGetOrganizations)
+		admin.PUT("/organizations/:id/status", handlers.HandleAdminToggleOrganizationStatus)
+		admin.POST("/organizations/:id/gift", handlers.HandleAdminGiftOrganization)
+		admin.GET("/organizations/:id/usage", handlers.HandleAdminGetOrganizationUsage)
+
 		// 公告管理
 		admin.GET("/announcements", handlers.HandleAdminGetAnnouncements)
 		admin.POST("/announcements", handlers.HandleAdminCreateAnnouncement)
 		admin.PUT("/announcements/:id", handlers.HandleAdminUpdateAnnouncement)
 		admin.DELETE("/announcements/:id", handlers.HandleAdminDeleteAnnouncement)
 
+		// SSO客户端管理
+		admin.GET("/oauth-clients", handlers.HandleAdminGetOAuthClients)
+		admin.POST("/oauth-clients", handlers.HandleAdminCreateOAuthClient)
+		admin.PUT("/oauth-clients/:id", handlers.HandleAdminUpdateOAuthClient)
+		admin.DELETE("/oauth-clients/:id", handlers.HandleAdminDeleteOAuthClient)
+		admin.POST("/oauth-clients/:id/rotate-secret", handlers.HandleAdminRotateOAuthClientSecret)
+
 		// 对话日志管理
 		admin.GET("/conversation-logs", handlers.GetConversationLogs)           // 获取对话日志列表
 		admin.GET("/conversation-logs/stats", handlers.GetConversationLogStats) // 获取对话日志统计
@@ -0,0 +1,345 @@
+package utils
+
+import (
+	"crypto/rand"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"claude/database"
+	"claude/models"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// 激活码字符集：去掉易混淆的 0/O、1/I，共32个字符
+const activationCodeAlphabet = "23456789ABCDEFGHJKLMNPQRSTUVWXYZ"
+
+// 激活码分组长度，生成的激活码每4个字符以 - 分隔
+const activationCodeGroupSize = 4
+
+// ActivationCodeFormat 激活码生成格式
+type ActivationCodeFormat struct {
+	Prefix string `json:"prefix"` // 前缀，为空表示不加前缀
+	Length int    `json:"length"` // 随机部分长度（不含前缀和校验位）
+}
+
+// GetActivationCodeFormat 获取激活码生成格式配置
+func GetActivationCodeFormat() ActivationCodeFormat {
+	format := ActivationCodeFormat{
+		Length: int(getTransferIntConfig("activation_code_length", 16)),
+	}
+	var config models.SystemConfig
+	if err := database.DB.Where("config_key = ?", "activation_code_prefix").First(&config).Error; err == nil {
+		format.Prefix = strings.ToUpper(strings.TrimSpace(config.ConfigValue))
+	}
+	if format.Length < 8 {
+		format.Length = 8
+	}
+	if format.Length > 32 {
+		format.Length = 32
+	}
+	return format
+}
+
+// ValidateActivationCodePrefix 校验激活码前缀，只允许大写字母和数字
+func ValidateActivationCodePrefix(prefix string) error {
+	if len(prefix) > 16 {
+		return fmt.Errorf("激活码前缀不能超过16个字符")
+	}
+	for _, r := range prefix {
+		if !(r >= 'A' && r <= 'Z') && !(r >= '0' && r <= '9') {
+			return fmt.Errorf("激活码前缀只能包含大写字母和数字")
+		}
+	}
+	return nil
+}
+
+// activationCodeCheckChar 使用 Luhn mod N 算法计算校验字符，可发现单个字符输错和相邻字符颠倒
+func activationCodeCheckChar(body string) (byte, bool) {
+	n := len(activationCodeAlphabet)
+	factor := 2
+	sum := 0
+	for i := len(body) - 1; i >= 0; i-- {
+		codePoint := strings.IndexByte(activationCodeAlphabet, body[i])
+		if codePoint < 0 {
+			return 0, false
+		}
+		addend := factor * codePoint
+		if factor == 2 {
+			factor = 1
+		} else {
+			factor = 2
+		}
+		sum += addend/n + addend%n
+	}
+	return activationCodeAlphabet[(n-sum%n)%n], true
+}
+
+// formatActivationCode 将随机部分和校验位按分组拼接，并加上前缀
+// 校验位单独作为最后一组，与不带校验位的旧激活码（XXXX-XXXX-XXXX-XXXX）区分
+func formatActivationCode(prefix, body string, check byte) string {
+	groups := []string{}
+	if prefix != "" {
+		groups = append(groups, prefix)
+	}
+	for i := 0; i < len(body); i += activationCodeGroupSize {
+		end := i + activationCodeGroupSize
+		if end > len(body) {
+			end = len(body)
+		}
+		groups = append(groups, body[i:end])
+	}
+	groups = append(groups, string(check))
+	return strings.Join(groups, "-")
+}
+
+// GenerateActivationCodes 使用加密随机数按配置格式生成指定数量且互不重复的激活码
+func GenerateActivationCodes(format ActivationCodeFormat, count int) ([]string, error) {
+	codes := make([]string, 0, count)
+	seen := make(map[string]bool, count)
+	buf := make([]byte, format.Length)
+	for len(codes) < count {
+		if _, err := rand.Read(buf); err != nil {
+			return nil, fmt.Errorf("生成随机数失败: %v", err)
+		}
+		body := make([]byte, format.Length)
+		for i, b := range buf {
+			// 字符集长度为32，取低5位不会产生取模偏差
+			body[i] = activationCodeAlphabet[b&31]
+		}
+		check, _ := activationCodeCheckChar(string(body))
+		code := formatActivationCode(format.Prefix, string(body), check)
+		if seen[code] {
+			continue
+		}
+		seen[code] = true
+		codes = append(codes, code)
+	}
+	return codes, nil
+}
+
+// NormalizeActivationCode 规范化用户输入的激活码
+func NormalizeActivationCode(code string) string {
+	return strings.ToUpper(strings.TrimSpace(code))
+}
+
+// CheckActivationCodeFormat 在查询数据库前校验激活码的校验位，拦截输错的激活码
+// 按结构识别带校验位的激活码（[前缀-]随机部分每4位一组-校验位），不依赖当前的前缀和长度配置，
+// 自定义格式生成的批次和配置修改前生成的激活码同样会被校验；旧格式激活码和优惠码等其他输入直接放行
+func CheckActivationCodeFormat(code string) error {
+	parts := strings.Split(NormalizeActivationCode(code), "-")
+	if len(parts) < 3 || len(parts[len(parts)-1]) != 1 {
+		return nil
+	}
+	check := parts[len(parts)-1][0]
+	groups := parts[:len(parts)-1]
+
+	// 第一组可能是前缀也可能是随机部分，任一种解析的校验位正确即可
+	structured := false
+	for _, candidate := range [][]string{groups, groups[1:]} {
+		body, ok := activationCodeBody(candidate)
+		if !ok {
+			continue
+		}
+		structured = true
+		if expected, ok := activationCodeCheckChar(body); ok && expected == check {
+			return nil
+		}
+	}
+	if !structured {
+		return nil
+	}
+	return fmt.Errorf("激活码校验失败，请检查是否输入有误。")
+}
+
+// activationCodeBody 拼接随机部分的分组：除最后一组外每组4位，字符均在激活码字符集中，总长度8-32位
+func activationCodeBody(groups []string) (string, bool) {
+	if len(groups) == 0 {
+		return "", false
+	}
+	body := strings.Join(groups, "")
+	if len(body) < 8 || len(body) > 32 {
+		return "", false
+	}
+	for i, group := range groups {
+		if len(group) == 0 || len(group) > activationCodeGroupSize ||
+			(i < len(groups)-1 && len(group) != activationCodeGroupSize) {
+			return "", false
+		}
+	}
+	for i := 0; i < len(body); i++ {
+		if strings.IndexByte(activationCodeAlphabet, body[i]) < 0 {
+			return "", false
+		}
+	}
+	return body, true
+}
+
+// ActivationCodeRestrictions 激活码兑换限制，用于兑换预检查展示
+type ActivationCodeRestrictions struct {
+	ExpiresAt            *time.Time `json:"expiresAt,omitempty"`           // 过期时间
+	MaxRedemptions       int        `json:"maxRedemptions"`                // 最大兑换次数
+	RemainingRedemptions int        `json:"remainingRedemptions"`          // 剩余兑换次数
+	AllowRepeat          bool       `json:"allowRepeat"`                   // 是否允许同一用户重复兑换
+	NewUserDays          int        `json:"newUserDays,omitempty"`         // 仅限注册N天内的新用户
+	AllowedEmailDomains  []string   `json:"allowedEmailDomains,omitempty"` // 限定的邮箱域名
+}
+
+// NormalizeEmailDomains 规范化邮箱域名列表：去空格、转小写、去掉@前缀和重复项
+func NormalizeEmailDomains(domains []string) []string {
+	result := []string{}
+	seen := map[string]bool{}
+	for _, domain := range domains {
+		domain = strings.TrimPrefix(strings.ToLower(strings.TrimSpace(domain)), "@")
+		if domain == "" || seen[domain] {
+			continue
+		}
+		seen[domain] = true
+		result = append(result, domain)
+	}
+	return result
+}
+
+// activationCodeEmailDomains 解析激活码限定的邮箱域名
+func activationCodeEmailDomains(code *models.ActivationCode) []string {
+	if code.AllowedEmailDomains == "" {
+		return nil
+	}
+	return NormalizeEmailDomains(strings.Split(code.AllowedEmailDomains, ","))
+}
+
+// GetActivationCodeRestrictions 获取激活码的兑换限制
+func GetActivationCodeRestrictions(code *models.ActivationCode) *ActivationCodeRestrictions {
+	remaining := code.MaxRedemptions - code.RedemptionCount
+	if remaining < 0 {
+		remaining = 0
+	}
+	return &ActivationCodeRestrictions{
+		ExpiresAt:            code.ExpiresAt,
+		MaxRedemptions:       code.MaxRedemptions,
+		RemainingRedemptions: remaining,
+		AllowRepeat:          code.AllowRepeat,
+		NewUserDays:          code.NewUserDays,
+		AllowedEmailDomains:  activationCodeEmailDomains(code),
+	}
+}
+
+// hasRedeemedActivationCode 判断用户是否已兑换过该激活码（包括以组织管理员身份兑换到组织钱包）
+func hasRedeemedActivationCode(db *gorm.DB, userID uint, code string) bool {
+	var count int64
+	db.Model(&models.RedemptionRecord{}).
+		Where("user_id = ? AND source_type = ? AND source_id = ?", userID, "activation_code", code).
+		Count(&count)
+	if count > 0 {
+		return true
+	}
+	db.Model(&models.OrganizationCreditRecord{}).
+		Where("operator_user_id = ? AND source_type = ? AND source_id = ?", userID, "activation_code", code).
+		Count(&count)
+	return count > 0
+}
+
+// CheckActivationCodeEligibility 检查激活码是否可由该用户兑换
+func CheckActivationCodeEligibility(db *gorm.DB, code *models.ActivationCode, user *models.User) error {
+	now := time.Now()
+
+	if code.Status != "unused" {
+		return fmt.Errorf("无效的激活码或已被使用。")
+	}
+	if code.ExpiresAt != nil && !code.ExpiresAt.After(now) {
+		return fmt.Errorf("激活码已过期。")
+	}
+	if code.MaxRedemptions > 0 && code.RedemptionCount >= code.MaxRedemptions {
+		return fmt.Errorf("激活码兑换次数已达上限。")
+	}
+
+	if code.NewUserDays > 0 && user.CreatedAt.AddDate(0, 0, code.NewUserDays).Before(now) {
+		return fmt.Errorf("该激活码仅限注册 %d 天内的新用户兑换。", code.NewUserDays)
+	}
+
+	if domains := activationCodeEmailDomains(code); len(domains) > 0 {
+		allowed := false
+		if at := strings.LastIndex(user.Email, "@"); at >= 0 {
+			emailDomain := strings.ToLower(user.Email[at+1:])
+			for _, domain := range domains {
+				if emailDomain == domain {
+					allowed = true
+					break
+				}
+			}
+		}
+		if !allowed {
+			return fmt.Errorf("该激活码仅限 %s 邮箱的用户兑换。", strings.Join(domains, "、"))
+		}
+	}
+
+	if !code.AllowRepeat && hasRedeemedActivationCode(db, user.ID, code.Code) {
+		return fmt.Errorf("您已兑换过该激活码。")
+	}
+
+	return nil
+}
+
+// ErrActivationCodeClaimed 激活码在兑换过程中已被其他请求用完
+var ErrActivationCodeClaimed = errors.New("激活码已被使用。")
+
+// claimActivationCodeTx 在事务中锁定激活码，校验兑换限制后记录一次兑换
+// 达到最大兑换次数时将激活码标记为已使用
+func claimActivationCodeTx(tx *gorm.DB, codeID, userID uint) (*models.ActivationCode, error) {
+	var code models.ActivationCode
+	if err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).Where("id = ?", codeID).First(&code).Error; err != nil {
+		return nil, fmt.Errorf("获取激活码失败: %v", err)
+	}
+
+	// 加锁后重新读取的状态才是准确的，并发兑换时后到的请求在这里被拒绝
+	if code.Status == "used" || (code.MaxRedemptions > 0 && code.RedemptionCount >= code.MaxRedemptions) {
+		return nil, ErrActivationCodeClaimed
+	}
+
+	var user models.User
+	if err := tx.Where("id = ?", userID).First(&user).Error; err != nil {
+		return nil, fmt.Errorf("获取用户信息失败: %v", err)
+	}
+
+	if err := CheckActivationCodeEligibility(tx, &code, &user); err != nil {
+		return nil, err
+	}
+
+	now := time.Now()
+	status := "unused"
+	if code.RedemptionCount+1 >= code.MaxRedemptions {
+		status = "used"
+	}
+	// 条件更新作为行锁之外的第二道保护：只有状态和兑换次数与读取时一致才会生效
+	result := tx.Model(&models.ActivationCode{}).
+		Where("id = ? AND status = ? AND redemption_count = ?", code.ID, "unused", code.RedemptionCount).
+		Updates(map[string]interface{}{
+			"status":           status,
+			"redemption_count": code.RedemptionCount + 1,
+			"used_by_user_id":  userID,
+			"used_at":          now,
+		})
+	if result.Error != nil {
+		return nil, fmt.Errorf("更新激活码状态失败: %v", result.Error)
+	}
+	if result.RowsAffected == 0 {
+		return nil, ErrActivationCodeClaimed
+	}
+
+	code.Status = status
+	code.RedemptionCount++
+	code.UsedByUserID = &userID
+	code.UsedAt = &now
+	return &code, nil
+}
+
+// ExpireActivationCodes 将到期仍未用完的激活码标记为过期
+func ExpireActivationCodes() (int64, error) {
+	result := database.DB.Model(&models.ActivationCode{}).
+		Where("status = ? AND expires_at IS NOT NULL AND expires_at <= ?", "unused", time.Now()).
+		Update("status", "expired")
+	return result.RowsAffected, result.Error
+}
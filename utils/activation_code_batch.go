@@ -0,0 +1,195 @@
+package utils
+
+import (
+	"fmt"
+	"math"
+	"time"
+
+	"claude/database"
+	"claude/models"
+
+	"gorm.io/gorm"
+)
+
+// ActivationCodeBatchSummary 激活码批次汇总
+type ActivationCodeBatchSummary struct {
+	BatchNumber        string    `json:"batch_number"`
+	SubscriptionPlanID uint      `json:"subscription_plan_id"`
+	Channel            string    `json:"channel"`
+	Total              int64     `json:"total"`       // 激活码数量
+	Unused             int64     `json:"unused"`      // 未用完
+	Used               int64     `json:"used"`        // 已用完
+	Disabled           int64     `json:"disabled"`    // 已停用
+	Expired            int64     `json:"expired"`     // 已过期
+	Redemptions        int64     `json:"redemptions"` // 累计兑换次数
+	Capacity           int64     `json:"capacity"`    // 可兑换总次数
+	CreatedAt          time.Time `json:"created_at"`
+}
+
+// ActivationCodeBatchDay 批次每日兑换情况
+type ActivationCodeBatchDay struct {
+	Date           string  `json:"date"`
+	Redemptions    int64   `json:"redemptions"`
+	Cumulative     int64   `json:"cumulative"`
+	CumulativeRate float64 `json:"cumulative_rate"` // 截至当天的累计兑换率（百分比）
+}
+
+// ActivationCodeBatchStats 批次兑换统计
+type ActivationCodeBatchStats struct {
+	ActivationCodeBatchSummary
+	RedemptionRate float64                  `json:"redemption_rate"` // 兑换率（百分比）
+	Redeemers      int64                    `json:"redeemers"`       // 兑换用户数
+	PointsGranted  int64                    `json:"points_granted"`  // 兑换发放的积分
+	PointsConsumed int64                    `json:"points_consumed"` // 兑换用户首次兑换后个人钱包消耗的积分
+	Timeline       []ActivationCodeBatchDay `json:"timeline"`
+}
+
+// batchSummarySelect 按批次汇总激活码状态的查询字段
+const batchSummarySelect = `batch_number,
+	MIN(subscription_plan_id) AS subscription_plan_id,
+	MAX(channel) AS channel,
+	COUNT(*) AS total,
+	SUM(CASE WHEN status = 'unused' THEN 1 ELSE 0 END) AS unused,
+	SUM(CASE WHEN status = 'used' THEN 1 ELSE 0 END) AS used,
+	SUM(CASE WHEN status = 'disabled' THEN 1 ELSE 0 END) AS disabled,
+	SUM(CASE WHEN status = 'expired' THEN 1 ELSE 0 END) AS expired,
+	COALESCE(SUM(redemption_count), 0) AS redemptions,
+	COALESCE(SUM(max_redemptions), 0) AS capacity,
+	MIN(created_at) AS created_at`
+
+// GetActivationCodeBatches 分页获取激活码批次汇总
+func GetActivationCodeBatches(batchNumber, channel string, limit, offset int) ([]ActivationCodeBatchSummary, int64, error) {
+	filtered := func() *gorm.DB {
+		query := database.DB.Model(&models.ActivationCode{}).Where("batch_number <> ''")
+		if batchNumber != "" {
+			query = query.Where("batch_number LIKE ?", "%"+batchNumber+"%")
+		}
+		if channel != "" {
+			query = query.Where("channel = ?", channel)
+		}
+		return query
+	}
+
+	var total int64
+	if err := filtered().Distinct("batch_number").Count(&total).Error; err != nil {
+		return nil, 0, fmt.Errorf("统计批次数量失败: %v", err)
+	}
+
+	batches := []ActivationCodeBatchSummary{}
+	if err := filtered().Select(batchSummarySelect).Group("batch_number").
+		Order("MIN(created_at) DESC").Limit(limit).Offset(offset).Scan(&batches).Error; err != nil {
+		return nil, 0, fmt.Errorf("查询批次列表失败: %v", err)
+	}
+	return batches, total, nil
+}
+
+// GetActivationCodeBatchSummary 获取单个批次的汇总
+func GetActivationCodeBatchSummary(batchNumber string) (*ActivationCodeBatchSummary, error) {
+	var summary ActivationCodeBatchSummary
+	if err := database.DB.Model(&models.ActivationCode{}).Select(batchSummarySelect).
+		Where("batch_number = ?", batchNumber).Group("batch_number").Scan(&summary).Error; err != nil {
+		return nil, fmt.Errorf("查询批次失败: %v", err)
+	}
+	if summary.Total == 0 {
+		return nil, fmt.Errorf("批次不存在")
+	}
+	return &summary, nil
+}
+
+// GetActivationCodeBatchStats 获取批次的兑换进度、每日兑换趋势和兑换用户的积分消耗
+func GetActivationCodeBatchStats(batchNumber string) (*ActivationCodeBatchStats, error) {
+	summary, err := GetActivationCodeBatchSummary(batchNumber)
+	if err != nil {
+		return nil, err
+	}
+
+	stats := &ActivationCodeBatchStats{
+		ActivationCodeBatchSummary: *summary,
+		Timeline:                   []ActivationCodeBatchDay{},
+	}
+	if summary.Capacity > 0 {
+		stats.RedemptionRate = math.Round(float64(summary.Redemptions)/float64(summary.Capacity)*10000) / 100
+	}
+
+	redemptions := func() *gorm.DB {
+		return database.DB.Model(&models.RedemptionRecord{}).
+			Where("source_type = ? AND batch_number = ?", "activation_code", batchNumber)
+	}
+
+	var totals struct {
+		Redeemers     int64
+		PointsGranted int64
+	}
+	if err := redemptions().Select("COUNT(DISTINCT user_id) AS redeemers, COALESCE(SUM(points_amount), 0) AS points_granted").
+		Scan(&totals).Error; err != nil {
+		return nil, fmt.Errorf("统计批次兑换记录失败: %v", err)
+	}
+	stats.Redeemers = totals.Redeemers
+	stats.PointsGranted = totals.PointsGranted
+
+	var days []struct {
+		Date        string
+		Redemptions int64
+	}
+	if err := redemptions().Select("DATE_FORMAT(activated_at, '%Y-%m-%d') AS date, COUNT(*) AS redemptions").
+		Group("date").Order("date").Scan(&days).Error; err != nil {
+		return nil, fmt.Errorf("统计批次每日兑换失败: %v", err)
+	}
+	var cumulative int64
+	for _, day := range days {
+		cumulative += day.Redemptions
+		item := ActivationCodeBatchDay{
+			Date:        day.Date,
+			Redemptions: day.Redemptions,
+			Cumulative:  cumulative,
+		}
+		if summary.Capacity > 0 {
+			item.CumulativeRate = math.Round(float64(cumulative)/float64(summary.Capacity)*10000) / 100
+		}
+		stats.Timeline = append(stats.Timeline, item)
+	}
+
+	// 兑换用户自首次兑换本批次激活码起，在个人钱包上消耗的积分（扣除已退还部分）
+	firstRedemptions := redemptions().Select("user_id, MIN(activated_at) AS first_at").Group("user_id")
+	if err := database.DB.Model(&models.APITransaction{}).
+		Joins("JOIN (?) AS batch_redeemers ON batch_redeemers.user_id = api_transactions.user_id AND api_transactions.created_at >= batch_redeemers.first_at", firstRedemptions).
+		Where("api_transactions.organization_id IS NULL").
+		Select("COALESCE(SUM(api_transactions.points_used - api_transactions.refunded_points), 0)").
+		Scan(&stats.PointsConsumed).Error; err != nil {
+		return nil, fmt.Errorf("统计兑换用户积分消耗失败: %v", err)
+	}
+
+	return stats, nil
+}
+
+// SetActivationCodeBatchDisabled 停用或启用整个批次中尚未用完的激活码，返回受影响的数量
+// 启用时已过期的激活码恢复为 expired，其余恢复为 unused
+func SetActivationCodeBatchDisabled(batchNumber string, disabled bool) (int64, error) {
+	if disabled {
+		result := database.DB.Model(&models.ActivationCode{}).
+			Where("batch_number = ? AND status = ?", batchNumber, "unused").
+			Update("status", "disabled")
+		return result.RowsAffected, result.Error
+	}
+
+	now := time.Now()
+	expired := database.DB.Model(&models.ActivationCode{}).
+		Where("batch_number = ? AND status = ? AND expires_at IS NOT NULL AND expires_at <= ?", batchNumber, "disabled", now).
+		Update("status", "expired")
+	if expired.Error != nil {
+		return 0, expired.Error
+	}
+	result := database.DB.Model(&models.ActivationCode{}).
+		Where("batch_number = ? AND status = ?", batchNumber, "disabled").
+		Update("status", "unused")
+	return result.RowsAffected + expired.RowsAffected, result.Error
+}
+
+// GetActivationCodeBatchCodes 获取批次中的全部激活码，用于导出
+func GetActivationCodeBatchCodes(batchNumber string) ([]models.ActivationCode, error) {
+	var codes []models.ActivationCode
+	if err := database.DB.Where("batch_number = ?", batchNumber).Order("id").Find(&codes).Error; err != nil {
+		return nil, fmt.Errorf("查询批次激活码失败: %v", err)
+	}
+	return codes, nil
+}
@@ -0,0 +1,108 @@
+package utils
+
+import (
+	"errors"
+	"fmt"
+	"sync"
+	"testing"
+	"time"
+
+	"claude/models"
+)
+
+// TestRedeemActivationCodeConcurrent 多个用户同时兑换同一个单次激活码，只能有一个成功
+func TestRedeemActivationCodeConcurrent(t *testing.T) {
+	db := openTestDB(t)
+
+	const workers = 8
+	suffix := time.Now().UnixNano()
+
+	plan := models.SubscriptionPlan{
+		Description:  "并发兑换测试",
+		PointAmount:  100,
+		Price:        10,
+		ValidityDays: 30,
+		Active:       true,
+	}
+	if err := db.Create(&plan).Error; err != nil {
+		t.Fatalf("创建订阅计划失败: %v", err)
+	}
+
+	code := models.ActivationCode{
+		Code:               fmt.Sprintf("TEST-%d", suffix),
+		SubscriptionPlanID: plan.ID,
+		Status:             "unused",
+		MaxRedemptions:     1,
+	}
+	if err := db.Create(&code).Error; err != nil {
+		t.Fatalf("创建激活码失败: %v", err)
+	}
+
+	users := make([]models.User, workers)
+	for i := range users {
+		users[i] = models.User{
+			Email:    fmt.Sprintf("redeem-%d-%d@example.com", suffix, i),
+			Username: fmt.Sprintf("redeem_%d_%d", suffix, i),
+		}
+		if err := db.Create(&users[i]).Error; err != nil {
+			t.Fatalf("创建用户失败: %v", err)
+		}
+	}
+
+	t.Cleanup(func() {
+		db.Unscoped().Where("source_type = ? AND source_id = ?", "activation_code", code.Code).Delete(&models.RedemptionRecord{})
+		for _, user := range users {
+			db.Where("user_id = ?", user.ID).Delete(&models.UserWallet{})
+			db.Unscoped().Delete(&user)
+		}
+		db.Unscoped().Delete(&code)
+		db.Unscoped().Delete(&plan)
+	})
+
+	// 所有请求都持有兑换前读取到的激活码，模拟同时通过了预检查
+	start := make(chan struct{})
+	errs := make([]error, workers)
+	var wg sync.WaitGroup
+	for i := 0; i < workers; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			snapshot := code
+			<-start
+			errs[i] = RedeemActivationCodeToWallet(users[i].ID, &snapshot)
+		}(i)
+	}
+	close(start)
+	wg.Wait()
+
+	succeeded, claimed := 0, 0
+	for i, err := range errs {
+		switch {
+		case err == nil:
+			succeeded++
+		case errors.Is(err, ErrActivationCodeClaimed):
+			claimed++
+		default:
+			t.Errorf("用户 %d 兑换返回了意外的错误: %v", i, err)
+		}
+	}
+	if succeeded != 1 || claimed != workers-1 {
+		t.Fatalf("期望 1 次成功、%d 次 ErrActivationCodeClaimed，实际成功 %d 次、已被使用 %d 次", workers-1, succeeded, claimed)
+	}
+
+	var stored models.ActivationCode
+	if err := db.Where("id = ?", code.ID).First(&stored).Error; err != nil {
+		t.Fatalf("读取激活码失败: %v", err)
+	}
+	if stored.Status != "used" || stored.RedemptionCount != 1 {
+		t.Fatalf("激活码状态应为 used 且兑换 1 次，实际 status=%s, redemption_count=%d", stored.Status, stored.RedemptionCount)
+	}
+
+	var records int64
+	db.Model(&models.RedemptionRecord{}).
+		Where("source_type = ? AND source_id = ?", "activation_code", code.Code).
+		Count(&records)
+	if records != 1 {
+		t.Fatalf("应只生成 1 条兑换记录，实际 %d 条", records)
+	}
+}
@@ -0,0 +1,329 @@
+package utils
+
+import (
+	"fmt"
+	"time"
+
+	"claude/database"
+	"claude/models"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// adjustDailyUsageTx 在事务中调整用户某日的使用记录，delta为负数时表示退还，结果不小于0
+func adjustDailyUsageTx(tx *gorm.DB, userID uint, usageDate string, delta int64) error {
+	if delta == 0 {
+		return nil
+	}
+
+	var dailyUsage models.UserDailyUsage
+	err := tx.Where("user_id = ? AND usage_date = ?", userID, usageDate).First(&dailyUsage).Error
+	if err == gorm.ErrRecordNotFound {
+		// 退还时没有当日记录，无需处理
+		if delta < 0 {
+			return nil
+		}
+		dailyUsage = models.UserDailyUsage{
+			UserID:     userID,
+			UsageDate:  usageDate,
+			PointsUsed: delta,
+			CreatedAt:  time.Now(),
+			UpdatedAt:  time.Now(),
+		}
+		return tx.Create(&dailyUsage).Error
+	} else if err != nil {
+		return fmt.Errorf("查询每日使用记录失败: %v", err)
+	}
+
+	return tx.Model(&dailyUsage).Updates(map[string]interface{}{
+		"points_used": gorm.Expr("GREATEST(points_used + ?, 0)", delta),
+		"updated_at":  time.Now(),
+	}).Error
+}
+
+// reverseAccumulatedTokens 从累计token中扣回退款的token，不足时按阈值折算退还已扣除的积分
+// 返回新的累计token数量和需要退还的积分
+func reverseAccumulatedTokens(accumulated, tokens, threshold, pointsPerThreshold int64) (int64, int64) {
+	accumulated -= tokens
+	if accumulated >= 0 {
+		return accumulated, 0
+	}
+	times := (-accumulated + threshold - 1) / threshold
+	return accumulated + times*threshold, times * pointsPerThreshold
+}
+
+// RefundAPITransaction 管理员退还API事务的用量，返回退还的积分和加权token
+// 计费以累计token为单位，退款先从钱包累计token中扣回，不足部分按阈值折算退还积分，
+// 未触发扣费的请求同样可以退款；points为按阈值折算的积分数，为0时退还全部剩余用量
+func RefundAPITransaction(adminUserID, transactionID uint, points int64, reason string) (int64, int64, error) {
+	if reason == "" {
+		return 0, 0, fmt.Errorf("退款原因不能为空")
+	}
+	if points < 0 {
+		return 0, 0, fmt.Errorf("退款积分不能为负数")
+	}
+
+	threshold, pointsPerThreshold, err := GetTokenThresholdConfig()
+	if err != nil {
+		return 0, 0, err
+	}
+	if threshold <= 0 || pointsPerThreshold <= 0 {
+		return 0, 0, fmt.Errorf("token计费阈值配置无效")
+	}
+
+	var refundedPoints, refundedTokens int64
+	err = database.DB.Transaction(func(tx *gorm.DB) error {
+		// 锁定事务记录，防止重复退款
+		var transaction models.APITransaction
+		if err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).
+			Where("id = ?", transactionID).First(&transaction).Error; err != nil {
+			return fmt.Errorf("API事务记录不存在")
+		}
+
+		if transaction.Status != "success" {
+			return fmt.Errorf("只有成功扣费的请求可以退款，当前状态: %s", transaction.Status)
+		}
+
+		if transaction.WeightedTokens <= 0 {
+			return fmt.Errorf("该请求没有可退还的用量")
+		}
+		remaining := transaction.WeightedTokens - transaction.RefundedTokens
+		if remaining <= 0 {
+			return fmt.Errorf("该请求已全额退款")
+		}
+
+		refundedTokens = remaining
+		if points > 0 {
+			refundedTokens = points * threshold / pointsPerThreshold
+			if refundedTokens > remaining {
+				return fmt.Errorf("退款积分超出可退范围，最多可退 %d 积分，不指定积分时退还全部剩余用量", remaining*pointsPerThreshold/threshold)
+			}
+		}
+
+		usageDate := transaction.CreatedAt.Format("2006-01-02")
+		sourceID := fmt.Sprintf("api_transaction_%d", transaction.ID)
+
+		// 组织计费的请求退还到组织钱包
+		if transaction.OrganizationID != nil {
+			var err error
+			refundedPoints, err = refundOrganizationTransactionTx(tx, adminUserID, &transaction, refundedTokens, threshold, pointsPerThreshold, reason, usageDate, sourceID)
+			if err != nil {
+				return err
+			}
+			return updateTransactionRefundTx(tx, transaction.ID, refundedPoints, refundedTokens)
+		}
+
+		var wallet models.UserWallet
+		if err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).
+			Where("user_id = ?", transaction.UserID).First(&wallet).Error; err != nil {
+			return fmt.Errorf("获取用户钱包失败: %v", err)
+		}
+
+		now := time.Now()
+		var accumulated int64
+		accumulated, refundedPoints = reverseAccumulatedTokens(wallet.AccumulatedTokens, refundedTokens, threshold, pointsPerThreshold)
+
+		err := tx.Model(&models.UserWallet{}).
+			Where("user_id = ?", transaction.UserID).
+			Updates(map[string]interface{}{
+				"accumulated_tokens": accumulated,
+				"available_points":   gorm.Expr("available_points + ?", refundedPoints),
+				"used_points":        gorm.Expr("GREATEST(used_points - ?, 0)", refundedPoints),
+				"updated_at":         now,
+			}).Error
+		if err != nil {
+			return fmt.Errorf("退还用户积分失败: %v", err)
+		}
+
+		if err := updateTransactionRefundTx(tx, transaction.ID, refundedPoints, refundedTokens); err != nil {
+			return err
+		}
+
+		// 只扣回了累计token，没有积分变动
+		if refundedPoints == 0 {
+			return nil
+		}
+
+		if err := adjustDailyUsageTx(tx, transaction.UserID, usageDate, -refundedPoints); err != nil {
+			return err
+		}
+
+		record := models.RedemptionRecord{
+			UserID:       transaction.UserID,
+			SourceType:   "refund",
+			SourceID:     sourceID,
+			PointsAmount: refundedPoints,
+			ValidityDays: max(validityDaysUntil(wallet.WalletExpiresAt), 0),
+			ActivatedAt:  now,
+			ExpiresAt:    wallet.WalletExpiresAt,
+			Reason:       reason,
+			AdminUserID:  &adminUserID,
+			CreatedAt:    now,
+			UpdatedAt:    now,
+		}
+		if err := tx.Create(&record).Error; err != nil {
+			return fmt.Errorf("创建退款记录失败: %v", err)
+		}
+
+		return nil
+	})
+	if err != nil {
+		return 0, 0, err
+	}
+
+	return refundedPoints, refundedTokens, nil
+}
+
+// updateTransactionRefundTx 在事务中累加API事务的已退还积分和token
+func updateTransactionRefundTx(tx *gorm.DB, transactionID uint, points, tokens int64) error {
+	err := tx.Model(&models.APITransaction{}).Where("id = ?", transactionID).
+		Updates(map[string]interface{}{
+			"refunded_points": gorm.Expr("refunded_points + ?", points),
+			"refunded_tokens": gorm.Expr("refunded_tokens + ?", tokens),
+		}).Error
+	if err != nil {
+		return fmt.Errorf("更新API事务退款记录失败: %v", err)
+	}
+	return nil
+}
+
+// refundOrganizationTransactionTx 在事务中将组织成员请求的用量退还到组织钱包，返回退还的积分
+func refundOrganizationTransactionTx(tx *gorm.DB, adminUserID uint, transaction *models.APITransaction, tokens, threshold, pointsPerThreshold int64, reason, usageDate, sourceID string) (int64, error) {
+	organizationID := *transaction.OrganizationID
+
+	var wallet models.OrganizationWallet
+	if err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).
+		Where("organization_id = ?", organizationID).First(&wallet).Error; err != nil {
+		return 0, fmt.Errorf("获取组织钱包失败: %v", err)
+	}
+
+	now := time.Now()
+	accumulated, points := reverseAccumulatedTokens(wallet.AccumulatedTokens, tokens, threshold, pointsPerThreshold)
+	err := tx.Model(&models.OrganizationWallet{}).
+		Where("organization_id = ?", organizationID).
+		Updates(map[string]interface{}{
+			"accumulated_tokens": accumulated,
+			"available_points":   gorm.Expr("available_points + ?", points),
+			"used_points":        gorm.Expr("GREATEST(used_points - ?, 0)", points),
+			"updated_at":         now,
+		}).Error
+	if err != nil {
+		return 0, fmt.Errorf("退还组织积分失败: %v", err)
+	}
+
+	// 只扣回了累计token，没有积分变动
+	if points == 0 {
+		return 0, nil
+	}
+
+	err = tx.Model(&models.OrganizationMemberDailyUsage{}).
+		Where("organization_id = ? AND user_id = ? AND usage_date = ?", organizationID, transaction.UserID, usageDate).
+		Updates(map[string]interface{}{
+			"points_used": gorm.Expr("GREATEST(points_used - ?, 0)", points),
+			"updated_at":  now,
+		}).Error
+	if err != nil {
+		return 0, fmt.Errorf("更新组织成员每日使用记录失败: %v", err)
+	}
+
+	record := models.OrganizationCreditRecord{
+		OrganizationID: organizationID,
+		SourceType:     "refund",
+		SourceID:       sourceID,
+		PointsAmount:   points,
+		ValidityDays:   max(validityDaysUntil(wallet.WalletExpiresAt), 0),
+		OperatorUserID: adminUserID,
+		ExpiresAt:      wallet.WalletExpiresAt,
+		Reason:         reason,
+		CreatedAt:      now,
+	}
+	if err := tx.Create(&record).Error; err != nil {
+		return 0, fmt.Errorf("创建组织退款记录失败: %v", err)
+	}
+
+	return points, nil
+}
+
+// AdjustWalletPoints 管理员手动调整用户钱包积分
+// points为正数时增加可用积分（validityDays>0时同时延长钱包有效期），
+// 为负数时扣减可用积分并计入当日使用量
+func AdjustWalletPoints(adminUserID, userID uint, points int64, validityDays int, reason string) (*models.RedemptionRecord, error) {
+	if points == 0 {
+		return nil, fmt.Errorf("调整积分不能为0")
+	}
+	if reason == "" {
+		return nil, fmt.Errorf("调整原因不能为空")
+	}
+
+	if _, err := GetOrCreateUserWallet(userID); err != nil {
+		return nil, fmt.Errorf("获取用户钱包失败: %v", err)
+	}
+
+	var record models.RedemptionRecord
+	err := database.DB.Transaction(func(tx *gorm.DB) error {
+		var wallet models.UserWallet
+		if err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).
+			Where("user_id = ?", userID).First(&wallet).Error; err != nil {
+			return fmt.Errorf("获取用户钱包失败: %v", err)
+		}
+
+		now := time.Now()
+		expiresAt := wallet.WalletExpiresAt
+		updates := map[string]interface{}{
+			"updated_at": now,
+		}
+
+		if points > 0 {
+			updates["total_points"] = gorm.Expr("total_points + ?", points)
+			updates["available_points"] = gorm.Expr("available_points + ?", points)
+			if validityDays > 0 {
+				expiresAt = maxTime(wallet.WalletExpiresAt, now.Add(time.Duration(validityDays)*24*time.Hour))
+				updates["wallet_expires_at"] = expiresAt
+				updates["status"] = "active"
+			}
+		} else {
+			deduct := -points
+			if wallet.AvailablePoints < deduct {
+				return fmt.Errorf("用户可用积分不足，当前可用 %d 积分", wallet.AvailablePoints)
+			}
+			updates["available_points"] = gorm.Expr("available_points - ?", deduct)
+			updates["used_points"] = gorm.Expr("used_points + ?", deduct)
+		}
+
+		if err := tx.Model(&models.UserWallet{}).Where("user_id = ?", userID).Updates(updates).Error; err != nil {
+			return fmt.Errorf("更新用户钱包失败: %v", err)
+		}
+
+		// 扣减视为当日使用
+		if points < 0 {
+			if err := adjustDailyUsageTx(tx, userID, now.Format("2006-01-02"), -points); err != nil {
+				return err
+			}
+		}
+
+		record = models.RedemptionRecord{
+			UserID:       userID,
+			SourceType:   "admin_adjustment",
+			SourceID:     fmt.Sprintf("adjust_%d_%d", adminUserID, now.UnixNano()),
+			PointsAmount: points,
+			ValidityDays: max(validityDaysUntil(expiresAt), 0),
+			ActivatedAt:  now,
+			ExpiresAt:    expiresAt,
+			Reason:       reason,
+			AdminUserID:  &adminUserID,
+			CreatedAt:    now,
+			UpdatedAt:    now,
+		}
+		if err := tx.Create(&record).Error; err != nil {
+			return fmt.Errorf("创建调整记录失败: %v", err)
+		}
+
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return &record, nil
+}
@@ -0,0 +1,25 @@
+package utils
+
+import "testing"
+
+func TestReverseAccumulatedTokens(t *testing.T) {
+	tests := []struct {
+		name                string
+		accumulated, tokens int64
+		wantAccumulated     int64
+		wantPoints          int64
+	}{
+		{"累计token足够扣回", 3000, 1200, 1800, 0},
+		{"恰好扣回全部累计token", 1200, 1200, 0, 0},
+		{"不足一个阈值时退还一次扣费", 200, 1200, 4000, 2},
+		{"跨越多个阈值", 0, 12000, 3000, 6},
+		{"恰好整数个阈值", 0, 10000, 0, 4},
+	}
+	for _, tt := range tests {
+		accumulated, points := reverseAccumulatedTokens(tt.accumulated, tt.tokens, 5000, 2)
+		if accumulated != tt.wantAccumulated || points != tt.wantPoints {
+			t.Errorf("%s: 期望累计 %d、退还 %d 积分，实际累计 %d、退还 %d 积分",
+				tt.name, tt.wantAccumulated, tt.wantPoints, accumulated, points)
+		}
+	}
+}
@@ -0,0 +1,223 @@
+package utils
+
+import (
+	"fmt"
+	"sort"
+	"time"
+
+	"claude/database"
+	"claude/models"
+)
+
+// analyticsBucketSQL 各统计粒度对应的时间分桶表达式
+var analyticsBucketSQL = map[string]string{
+	"hour":  "DATE_FORMAT(created_at, '%Y-%m-%d %H:00')",
+	"day":   "DATE_FORMAT(created_at, '%Y-%m-%d')",
+	"week":  "DATE_FORMAT(DATE_SUB(created_at, INTERVAL WEEKDAY(created_at) DAY), '%Y-%m-%d')",
+	"month": "DATE_FORMAT(created_at, '%Y-%m')",
+}
+
+// analyticsMaxBuckets 单次查询允许的最大分桶数量
+const analyticsMaxBuckets = 1000
+
+// UsageAggregate 用量聚合指标
+type UsageAggregate struct {
+	Requests                 int64   `json:"requests"`
+	FailedRequests           int64   `json:"failed_requests"`
+	ErrorRate                float64 `json:"error_rate"` // 失败请求占比
+	InputTokens              int64   `json:"input_tokens"`
+	OutputTokens             int64   `json:"output_tokens"`
+	CacheCreationInputTokens int64   `json:"cache_creation_input_tokens"`
+	CacheReadInputTokens     int64   `json:"cache_read_input_tokens"`
+	CacheHitRatio            float64 `json:"cache_hit_ratio"` // 缓存读取tokens / 全部输入tokens（含缓存）
+	Points                   float64 `json:"points"`          // 按累计token计费规则折算的积分
+	AvgDurationMs            float64 `json:"avg_duration_ms"`
+
+	totalDuration  int64
+	weightedTokens float64
+}
+
+// ModelUsageAggregate 按模型的用量聚合
+type ModelUsageAggregate struct {
+	Model string `json:"model"`
+	UsageAggregate
+}
+
+// UsageBucket 单个时间分桶的用量
+type UsageBucket struct {
+	Bucket string                `json:"bucket"`
+	Totals UsageAggregate        `json:"totals"`
+	Models []ModelUsageAggregate `json:"models"`
+}
+
+// UsageAnalytics 用量分析结果
+type UsageAnalytics struct {
+	Granularity string                `json:"granularity"`
+	From        time.Time             `json:"from"`
+	To          time.Time             `json:"to"`
+	Summary     UsageAggregate        `json:"summary"`
+	ByModel     []ModelUsageAggregate `json:"by_model"`
+	Buckets     []UsageBucket         `json:"buckets"`
+}
+
+// add 累加一行原始统计数据
+func (a *UsageAggregate) add(other *UsageAggregate) {
+	a.Requests += other.Requests
+	a.FailedRequests += other.FailedRequests
+	a.InputTokens += other.InputTokens
+	a.OutputTokens += other.OutputTokens
+	a.CacheCreationInputTokens += other.CacheCreationInputTokens
+	a.CacheReadInputTokens += other.CacheReadInputTokens
+	a.totalDuration += other.totalDuration
+	a.weightedTokens += other.weightedTokens
+}
+
+// finalize 计算比率类指标
+func (a *UsageAggregate) finalize(threshold, pointsPerThreshold int64) {
+	if a.Requests > 0 {
+		a.ErrorRate = roundRatio(float64(a.FailedRequests) / float64(a.Requests))
+		a.AvgDurationMs = roundPoints(float64(a.totalDuration) / float64(a.Requests))
+	}
+
+	allInput := a.InputTokens + a.CacheCreationInputTokens + a.CacheReadInputTokens
+	if allInput > 0 {
+		a.CacheHitRatio = roundRatio(float64(a.CacheReadInputTokens) / float64(allInput))
+	}
+
+	if threshold > 0 {
+		a.Points = roundPoints(a.weightedTokens / float64(threshold) * float64(pointsPerThreshold))
+	}
+}
+
+// roundRatio 比率保留四位小数
+func roundRatio(ratio float64) float64 {
+	return float64(int64(ratio*10000+0.5)) / 10000
+}
+
+// ValidateAnalyticsRange 校验统计粒度和时间范围，避免分桶数量过多
+func ValidateAnalyticsRange(granularity string, from, to time.Time) error {
+	if _, ok := analyticsBucketSQL[granularity]; !ok {
+		return fmt.Errorf("不支持的统计粒度: %s，可选 hour/day/week/month", granularity)
+	}
+	if !to.After(from) {
+		return fmt.Errorf("结束时间必须晚于开始时间")
+	}
+
+	var bucketSize time.Duration
+	switch granularity {
+	case "hour":
+		bucketSize = time.Hour
+	case "day":
+		bucketSize = 24 * time.Hour
+	case "week":
+		bucketSize = 7 * 24 * time.Hour
+	case "month":
+		bucketSize = 28 * 24 * time.Hour
+	}
+	if to.Sub(from)/bucketSize > analyticsMaxBuckets {
+		return fmt.Errorf("时间范围过大，请缩小范围或使用更粗的统计粒度")
+	}
+
+	return nil
+}
+
+// GetUserUsageAnalytics 按时间分桶和模型统计用户的API用量
+func GetUserUsageAnalytics(userID uint, from, to time.Time, granularity, model string) (*UsageAnalytics, error) {
+	if err := ValidateAnalyticsRange(granularity, from, to); err != nil {
+		return nil, err
+	}
+
+	threshold, pointsPerThreshold, err := GetTokenThresholdConfig()
+	if err != nil {
+		return nil, err
+	}
+
+	var rows []struct {
+		Bucket                   string
+		Model                    string
+		Requests                 int64
+		FailedRequests           int64
+		InputTokens              int64
+		OutputTokens             int64
+		CacheCreationInputTokens int64
+		CacheReadInputTokens     int64
+		TotalDuration            int64
+		WeightedTokens           float64
+	}
+
+	query := database.DB.Model(&models.APITransaction{}).
+		Select(analyticsBucketSQL[granularity]+" AS bucket, model, "+
+			"COUNT(*) AS requests, "+
+			"SUM(CASE WHEN status <> 'success' THEN 1 ELSE 0 END) AS failed_requests, "+
+			"COALESCE(SUM(input_tokens), 0) AS input_tokens, "+
+			"COALESCE(SUM(output_tokens), 0) AS output_tokens, "+
+			"COALESCE(SUM(cache_creation_input_tokens), 0) AS cache_creation_input_tokens, "+
+			"COALESCE(SUM(cache_read_input_tokens), 0) AS cache_read_input_tokens, "+
+			"COALESCE(SUM(duration), 0) AS total_duration, "+
+			"COALESCE(SUM(CASE WHEN status = 'success' THEN "+weightedTokensSQL+" ELSE 0 END), 0) AS weighted_tokens").
+		Where("user_id = ? AND created_at >= ? AND created_at < ?", userID, from, to)
+	if model != "" {
+		query = query.Where("model = ?", model)
+	}
+
+	if err := query.Group("bucket, model").Order("bucket ASC").Scan(&rows).Error; err != nil {
+		return nil, fmt.Errorf("统计用量失败: %v", err)
+	}
+
+	analytics := &UsageAnalytics{
+		Granularity: granularity,
+		From:        from,
+		To:          to,
+		ByModel:     []ModelUsageAggregate{},
+		Buckets:     []UsageBucket{},
+	}
+
+	byModel := make(map[string]*ModelUsageAggregate)
+	bucketIndex := make(map[string]int)
+	for _, row := range rows {
+		item := UsageAggregate{
+			Requests:                 row.Requests,
+			FailedRequests:           row.FailedRequests,
+			InputTokens:              row.InputTokens,
+			OutputTokens:             row.OutputTokens,
+			CacheCreationInputTokens: row.CacheCreationInputTokens,
+			CacheReadInputTokens:     row.CacheReadInputTokens,
+			totalDuration:            row.TotalDuration,
+			weightedTokens:           row.WeightedTokens,
+		}
+
+		analytics.Summary.add(&item)
+
+		if _, ok := byModel[row.Model]; !ok {
+			byModel[row.Model] = &ModelUsageAggregate{Model: row.Model}
+		}
+		byModel[row.Model].add(&item)
+
+		idx, ok := bucketIndex[row.Bucket]
+		if !ok {
+			idx = len(analytics.Buckets)
+			bucketIndex[row.Bucket] = idx
+			analytics.Buckets = append(analytics.Buckets, UsageBucket{Bucket: row.Bucket, Models: []ModelUsageAggregate{}})
+		}
+		bucket := &analytics.Buckets[idx]
+		bucket.Totals.add(&item)
+
+		modelItem := ModelUsageAggregate{Model: row.Model, UsageAggregate: item}
+		modelItem.finalize(threshold, pointsPerThreshold)
+		bucket.Models = append(bucket.Models, modelItem)
+	}
+
+	analytics.Summary.finalize(threshold, pointsPerThreshold)
+	for i := range analytics.Buckets {
+		analytics.Buckets[i].Totals.finalize(threshold, pointsPerThreshold)
+	}
+	for _, item := range byModel {
+		item.finalize(threshold, pointsPerThreshold)
+		analytics.ByModel = append(analytics.ByModel, *item)
+	}
+	sort.Slice(analytics.ByModel, func(i, j int) bool {
+		return analytics.ByModel[i].Requests > analytics.ByModel[j].Requests
+	})
+
+	return analytics, nil
+}
@@ -1,46 +1,23 @@
 package utils
 
 import (
+	"errors"
 	"fmt"
 	"log"
 	"time"
 
 	"claude/database"
 	"claude/models"
-)
-
-// StartAutoRefillScheduler 启动自动补给定时器
-func StartAutoRefillScheduler() {
-	log.Println("🚀 启动自动补给定时器...")
-
-	// 立即执行一次检查
-	go func() {
-		if err := ExecuteAutoRefillCheck(); err != nil {
-			log.Printf("❌ 自动补给检查失败: %v", err)
-		}
-	}()
 
-	// 设置定时器，每分钟检查一次是否到达执行时间点
-	ticker := time.NewTicker(1 * time.Minute)
-	go func() {
-		lastExecutedHour := -1 // 记录上次执行的小时，避免重复执行
-
-		for range ticker.C {
-			now := time.Now()
-			hour := now.Hour()
+	"gorm.io/gorm"
+)
 
-			// 只在0点、4点、8点、12点、16点、20点执行补给
-			if hour%4 == 0 && hour != lastExecutedHour {
-				log.Printf("⏰ 开始执行自动补给检查 (时间: %s)", now.Format("2006-01-02 15:04:05"))
-				if err := ExecuteAutoRefillCheck(); err != nil {
-					log.Printf("❌ 自动补给检查失败: %v", err)
-				}
-				lastExecutedHour = hour // 记录本次执行的小时
-			}
-		}
-	}()
+// errAutoRefillSkipped 当前时间段已补给过或积分已高于阈值，本次不补给
+var errAutoRefillSkipped = errors.New("当前时间段已补给")
 
-	log.Println("✅ 自动补给定时器已启动，将在每天0点、4点、8点、12点、16点、20点执行检查")
+// autoRefillSlotStart 返回当前补给时间段（每4小时一段）的起始时间
+func autoRefillSlotStart(now time.Time) time.Time {
+	return time.Date(now.Year(), now.Month(), now.Day(), now.Hour()-now.Hour()%4, 0, 0, 0, now.Location())
 }
 
 // ExecuteAutoRefillCheck 执行自动补给检查
@@ -49,7 +26,8 @@ func ExecuteAutoRefillCheck() error {
 
 	// 查询所有启用了自动补给的用户钱包
 	var wallets []models.UserWallet
-	err := database.DB.Where("auto_refill_enabled = ? AND status = ?", true, "active").Find(&wallets).Error
+	err := database.DB.Where("auto_refill_enabled = ? AND status = ? AND wallet_expires_at > ?", true, "active", time.Now()).
+		Find(&wallets).Error
 	if err != nil {
 		return fmt.Errorf("查询启用自动补给的钱包失败: %v", err)
 	}
@@ -65,26 +43,13 @@ func ExecuteAutoRefillCheck() error {
 	for _, wallet := range wallets {
 		// 检查是否需要补给
 		if wallet.AvailablePoints <= wallet.AutoRefillThreshold {
-			// 检查是否已经在当前时间点补给过
-			if wallet.LastAutoRefillTime != nil {
-				now := time.Now()
-				currentTimeSlot := now.Hour() - (now.Hour() % 4) // 当前时间段的起始小时 (0,4,8,12,16,20)
-
-				// 如果上次补给时间在当前时间段内，则跳过
-				lastRefillHour := wallet.LastAutoRefillTime.Hour()
-				lastRefillTimeSlot := lastRefillHour - (lastRefillHour % 4)
-
-				// 如果是同一天且在同一个时间段内补给过，跳过
-				if wallet.LastAutoRefillTime.Format("2006-01-02") == now.Format("2006-01-02") &&
-					lastRefillTimeSlot == currentTimeSlot {
-					log.Printf("⏭️ 用户 %d 在当前时间段(%d点)已经补给过，跳过", wallet.UserID, currentTimeSlot)
-					continue
-				}
-			}
-
-			// 执行补给
+			// 执行补给，多实例同时执行时由条件更新保证同一时间段只补给一次
 			if err := executeAutoRefill(&wallet); err != nil {
-				log.Printf("❌ 用户 %d 自动补给失败: %v", wallet.UserID, err)
+				if errors.Is(err, errAutoRefillSkipped) {
+					log.Printf("⏭️ 用户 %d 在当前时间段已经补给过，跳过", wallet.UserID)
+				} else {
+					log.Printf("❌ 用户 %d 自动补给失败: %v", wallet.UserID, err)
+				}
 				continue
 			}
 
@@ -111,18 +76,23 @@ func executeAutoRefill(wallet *models.UserWallet) error {
 		}
 	}()
 
-	// 1. 更新用户钱包积分
+	// 1. 更新用户钱包积分（条件更新：当前时间段未补给过且积分仍低于阈值）
 	now := time.Now()
-	err := tx.Model(&models.UserWallet{}).
-		Where("user_id = ?", wallet.UserID).
+	result := tx.Model(&models.UserWallet{}).
+		Where("user_id = ? AND available_points <= auto_refill_threshold", wallet.UserID).
+		Where("last_auto_refill_time IS NULL OR last_auto_refill_time < ?", autoRefillSlotStart(now)).
 		Updates(map[string]interface{}{
-			"available_points":      wallet.AvailablePoints + wallet.AutoRefillAmount,
-			"total_points":          wallet.TotalPoints + wallet.AutoRefillAmount,
+			"available_points":      gorm.Expr("available_points + ?", wallet.AutoRefillAmount),
+			"total_points":          gorm.Expr("total_points + ?", wallet.AutoRefillAmount),
 			"last_auto_refill_time": now,
-		}).Error
-	if err != nil {
+		})
+	if result.Error != nil {
 		tx.Rollback()
-		return fmt.Errorf("更新用户钱包失败: %v", err)
+		return fmt.Errorf("更新用户钱包失败: %v", result.Error)
+	}
+	if result.RowsAffected == 0 {
+		tx.Rollback()
+		return errAutoRefillSkipped
 	}
 
 	// 2. 创建兑换记录
@@ -140,8 +110,7 @@ func executeAutoRefill(wallet *models.UserWallet) error {
 		Reason:              fmt.Sprintf("自动补给积分，触发条件：可用积分(%d) <= 阈值(%d)", wallet.AvailablePoints, wallet.AutoRefillThreshold),
 	}
 
-	err = tx.Create(&redemptionRecord).Error
-	if err != nil {
+	if err := tx.Create(&redemptionRecord).Error; err != nil {
 		tx.Rollback()
 		return fmt.Errorf("创建兑换记录失败: %v", err)
 	}
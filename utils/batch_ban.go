@@ -0,0 +1,397 @@
+package utils
+
+import (
+	"fmt"
+	"log"
+	"time"
+
+	"claude/database"
+	"claude/models"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// BatchBanCodeResult 批次封禁中单个卡密的冻结情况
+type BatchBanCodeResult struct {
+	Code           string `json:"code"`
+	FrozenPoints   int64  `json:"frozen_points"`   // 冻结的剩余积分
+	ConsumedPoints int64  `json:"consumed_points"` // 估算已消费积分
+}
+
+// BatchBanUserResult 批次封禁（或解禁）中单个用户的处理结果
+type BatchBanUserResult struct {
+	UserID          uint                 `json:"user_id"`
+	Username        string               `json:"username"`
+	Codes           []BatchBanCodeResult `json:"codes"`
+	SkippedCodes    []string             `json:"skipped_codes,omitempty"` // 已封禁/未封禁或无剩余积分而跳过的卡密
+	FrozenPoints    int64                `json:"frozen_points"`           // 该用户冻结（解禁时为恢复）的积分合计
+	AvailableBefore int64                `json:"available_before"`
+	AvailableAfter  int64                `json:"available_after"`
+	WillResetWallet bool                 `json:"will_reset_wallet"` // 封禁后没有剩余有效卡密，钱包将被清空并过期
+	Success         bool                 `json:"success"`
+	Error           string               `json:"error,omitempty"`
+}
+
+// BatchBanReport 批次封禁（或解禁）汇总报告
+type BatchBanReport struct {
+	BatchNumber    string               `json:"batch_number"`
+	Action         string               `json:"action"` // ban, unban
+	DryRun         bool                 `json:"dry_run"`
+	AffectedUsers  int                  `json:"affected_users"`
+	AffectedCodes  int                  `json:"affected_codes"`
+	TotalPoints    int64                `json:"total_points"` // 冻结（解禁时为恢复）的积分合计
+	SucceededUsers int                  `json:"succeeded_users"`
+	FailedUsers    int                  `json:"failed_users"`
+	DisabledCodes  int64                `json:"disabled_codes"` // 同时停用的未兑换激活码数量
+	Users          []BatchBanUserResult `json:"users"`
+}
+
+// batchRedeemedCodes 按用户分组获取批次中已兑换的卡密
+func batchRedeemedCodes(batchNumber string) ([]uint, map[uint][]string, error) {
+	var rows []struct {
+		UserID   uint
+		SourceID string
+	}
+	if err := database.DB.Model(&models.RedemptionRecord{}).
+		Select("DISTINCT user_id, source_id").
+		Where("source_type = ? AND batch_number = ?", "activation_code", batchNumber).
+		Order("user_id, source_id").Scan(&rows).Error; err != nil {
+		return nil, nil, fmt.Errorf("查询批次兑换记录失败: %w", err)
+	}
+
+	userIDs := []uint{}
+	codesByUser := map[uint][]string{}
+	for _, row := range rows {
+		if _, ok := codesByUser[row.UserID]; !ok {
+			userIDs = append(userIDs, row.UserID)
+		}
+		codesByUser[row.UserID] = append(codesByUser[row.UserID], row.SourceID)
+	}
+	return userIDs, codesByUser, nil
+}
+
+// batchBanUsernames 批量获取用户名
+func batchBanUsernames(userIDs []uint) map[uint]string {
+	names := map[uint]string{}
+	if len(userIDs) == 0 {
+		return names
+	}
+	var users []models.User
+	database.DB.Select("id, username").Where("id IN ?", userIDs).Find(&users)
+	for _, user := range users {
+		names[user.ID] = user.Username
+	}
+	return names
+}
+
+// applyBatchBanForUser 计算并（非预览时）执行单个用户的批次封禁
+// 使用与单卡密封禁相同的虚拟消费计算，多个卡密合并为一次钱包更新，每个卡密各写一条冻结记录
+func applyBatchBanForUser(tx *gorm.DB, result *BatchBanUserResult, codes []string, reason string, adminUserID uint, dryRun bool) error {
+	wallet := &models.UserWallet{}
+	query := tx
+	if !dryRun {
+		query = tx.Clauses(clause.Locking{Strength: "UPDATE"})
+	}
+	if err := query.Where("user_id = ?", result.UserID).First(wallet).Error; err != nil {
+		return fmt.Errorf("获取用户钱包失败: %w", err)
+	}
+	result.AvailableBefore = wallet.AvailablePoints
+
+	// 已封禁的卡密跳过
+	var frozenCodes []string
+	tx.Model(&models.FrozenPointsRecord{}).
+		Where("user_id = ? AND status = ? AND banned_activation_code IN ?", result.UserID, "frozen", codes).
+		Pluck("banned_activation_code", &frozenCodes)
+	alreadyFrozen := map[string]bool{}
+	for _, code := range frozenCodes {
+		alreadyFrozen[code] = true
+	}
+
+	var allRedemptions []models.RedemptionRecord
+	if err := tx.Where("user_id = ?", result.UserID).Find(&allRedemptions).Error; err != nil {
+		return fmt.Errorf("获取兑换记录失败: %w", err)
+	}
+	calculator := &VirtualConsumptionCalculator{
+		UserID:          result.UserID,
+		AllRedemptions:  allRedemptions,
+		TotalUsedPoints: wallet.UsedPoints,
+	}
+	activeCards := calculator.getSortedActiveCards()
+	if len(activeCards) == 0 {
+		result.SkippedCodes = append(result.SkippedCodes, codes...)
+		result.AvailableAfter = wallet.AvailablePoints
+		return nil
+	}
+	consumption, err := calculator.CalculateCardConsumption(activeCards[0].SourceID)
+	if err != nil {
+		return fmt.Errorf("计算卡密消费情况失败: %w", err)
+	}
+
+	// 按卡密汇总剩余和已消费积分（同一卡密可能被同一用户多次兑换）
+	banned := map[string]bool{}
+	frozenByCode := map[string]*BatchBanCodeResult{}
+	for _, code := range codes {
+		if alreadyFrozen[code] {
+			result.SkippedCodes = append(result.SkippedCodes, code)
+			continue
+		}
+		banned[code] = true
+	}
+	for _, card := range consumption.AllCards {
+		if !banned[card.CardCode] {
+			continue
+		}
+		item, ok := frozenByCode[card.CardCode]
+		if !ok {
+			item = &BatchBanCodeResult{Code: card.CardCode}
+			frozenByCode[card.CardCode] = item
+		}
+		item.FrozenPoints += card.RemainingPoints
+		item.ConsumedPoints += card.ConsumedPoints
+	}
+	for _, code := range codes {
+		if !banned[code] {
+			continue
+		}
+		if item, ok := frozenByCode[code]; ok {
+			result.Codes = append(result.Codes, *item)
+			result.FrozenPoints += item.FrozenPoints
+		} else {
+			// 同级兑换前的卡密不参与消费计算，没有可冻结的积分
+			result.SkippedCodes = append(result.SkippedCodes, code)
+		}
+	}
+
+	hasRemainingCards := false
+	for _, card := range consumption.AllCards {
+		if !banned[card.CardCode] && card.RemainingPoints > 0 {
+			hasRemainingCards = true
+			break
+		}
+	}
+	result.WillResetWallet = len(result.Codes) > 0 && !hasRemainingCards
+	result.AvailableAfter = wallet.AvailablePoints - result.FrozenPoints
+	if result.WillResetWallet {
+		result.AvailableAfter = 0
+	}
+	if dryRun || len(result.Codes) == 0 {
+		return nil
+	}
+
+	beforeBanSnapshot, err := createWalletSnapshot(wallet)
+	if err != nil {
+		return fmt.Errorf("创建钱包快照失败: %w", err)
+	}
+	beforeBenefitsSnapshot, err := createBenefitsSnapshot(wallet)
+	if err != nil {
+		return fmt.Errorf("创建权益快照失败: %w", err)
+	}
+
+	wallet.AvailablePoints -= result.FrozenPoints
+	wallet.TotalPoints -= result.FrozenPoints
+
+	newBenefits, err := calculateRemainingBenefitsExcluding(consumption.AllCards, banned, tx)
+	if err != nil {
+		return fmt.Errorf("重新计算权益失败: %w", err)
+	}
+	updateWalletBenefits(wallet, newBenefits)
+
+	if result.WillResetWallet {
+		wallet.AvailablePoints = 0
+		wallet.TotalPoints = 0
+		wallet.UsedPoints = 0
+		wallet.Status = "expired"
+		wallet.WalletExpiresAt = time.Now()
+	}
+
+	if err := tx.Save(wallet).Error; err != nil {
+		return fmt.Errorf("更新钱包失败: %w", err)
+	}
+
+	for _, item := range result.Codes {
+		var targetCard models.RedemptionRecord
+		for _, record := range allRedemptions {
+			if record.SourceType == "activation_code" && record.SourceID == item.Code {
+				targetCard = record
+			}
+		}
+		frozenRecord := &models.FrozenPointsRecord{
+			UserID:               result.UserID,
+			BannedActivationCode: item.Code,
+			BannedCodeID:         getBannedCodeID(item.Code, tx),
+			FrozenPoints:         item.FrozenPoints,
+			FrozenBenefits:       extractCardBenefitsJSON(targetCard),
+			BeforeBanWalletState: beforeBanSnapshot,
+			BeforeBanBenefits:    beforeBenefitsSnapshot,
+			CalculationMethod: generateCalculationLog(&CardConsumptionResult{
+				TargetCard:      targetCard,
+				RemainingPoints: item.FrozenPoints,
+				ConsumedPoints:  item.ConsumedPoints,
+				AllCards:        consumption.AllCards,
+			}),
+			EstimatedUsage: item.ConsumedPoints,
+			BanReason:      reason,
+			AdminUserID:    &adminUserID,
+			Status:         "frozen",
+		}
+		if err := tx.Create(frozenRecord).Error; err != nil {
+			return fmt.Errorf("创建冻结记录失败: %w", err)
+		}
+	}
+
+	return nil
+}
+
+// BanActivationCodeBatch 封禁整个批次：对每个兑换过该批次卡密的用户执行冻结计算
+// 每个用户单独一个事务，单个用户失败不影响其他用户；dryRun 时只计算不写入
+// disableUnused 为 true 时同时停用批次中尚未用完的激活码
+func BanActivationCodeBatch(batchNumber, reason string, adminUserID uint, dryRun, disableUnused bool) (*BatchBanReport, error) {
+	if _, err := GetActivationCodeBatchSummary(batchNumber); err != nil {
+		return nil, err
+	}
+
+	userIDs, codesByUser, err := batchRedeemedCodes(batchNumber)
+	if err != nil {
+		return nil, err
+	}
+	if reason == "" {
+		reason = fmt.Sprintf("批次 %s 封禁", batchNumber)
+	}
+
+	usernames := batchBanUsernames(userIDs)
+	report := &BatchBanReport{
+		BatchNumber: batchNumber,
+		Action:      "ban",
+		DryRun:      dryRun,
+		Users:       []BatchBanUserResult{},
+	}
+
+	for _, userID := range userIDs {
+		result := BatchBanUserResult{
+			UserID:   userID,
+			Username: usernames[userID],
+			Codes:    []BatchBanCodeResult{},
+		}
+
+		if dryRun {
+			err = applyBatchBanForUser(database.DB, &result, codesByUser[userID], reason, adminUserID, true)
+		} else {
+			err = database.DB.Transaction(func(tx *gorm.DB) error {
+				return applyBatchBanForUser(tx, &result, codesByUser[userID], reason, adminUserID, false)
+			})
+		}
+
+		if err != nil {
+			result.Error = err.Error()
+			result.Codes = []BatchBanCodeResult{}
+			result.FrozenPoints = 0
+			report.FailedUsers++
+			log.Printf("❌ 批次封禁用户失败: batch=%s, user_id=%d, error=%v", batchNumber, userID, err)
+		} else {
+			result.Success = true
+			report.SucceededUsers++
+			report.AffectedCodes += len(result.Codes)
+			report.TotalPoints += result.FrozenPoints
+			if len(result.Codes) > 0 {
+				report.AffectedUsers++
+			}
+		}
+		report.Users = append(report.Users, result)
+	}
+
+	if disableUnused {
+		if dryRun {
+			database.DB.Model(&models.ActivationCode{}).
+				Where("batch_number = ? AND status = ?", batchNumber, "unused").
+				Count(&report.DisabledCodes)
+		} else if report.DisabledCodes, err = SetActivationCodeBatchDisabled(batchNumber, true); err != nil {
+			log.Printf("❌ 批次封禁停用激活码失败: batch=%s, error=%v", batchNumber, err)
+		}
+	}
+
+	return report, nil
+}
+
+// UnbanActivationCodeBatch 解禁整个批次：恢复该批次所有仍处于冻结状态的卡密，每个用户单独一个事务
+func UnbanActivationCodeBatch(batchNumber string, adminUserID uint, dryRun bool) (*BatchBanReport, error) {
+	if _, err := GetActivationCodeBatchSummary(batchNumber); err != nil {
+		return nil, err
+	}
+
+	var records []models.FrozenPointsRecord
+	if err := database.DB.Where("status = ? AND banned_activation_code IN (?)", "frozen",
+		database.DB.Model(&models.ActivationCode{}).Select("code").Where("batch_number = ?", batchNumber)).
+		Order("user_id, id").Find(&records).Error; err != nil {
+		return nil, fmt.Errorf("查询冻结记录失败: %w", err)
+	}
+
+	userIDs := []uint{}
+	recordsByUser := map[uint][]models.FrozenPointsRecord{}
+	for _, record := range records {
+		if _, ok := recordsByUser[record.UserID]; !ok {
+			userIDs = append(userIDs, record.UserID)
+		}
+		recordsByUser[record.UserID] = append(recordsByUser[record.UserID], record)
+	}
+
+	usernames := batchBanUsernames(userIDs)
+	report := &BatchBanReport{
+		BatchNumber: batchNumber,
+		Action:      "unban",
+		DryRun:      dryRun,
+		Users:       []BatchBanUserResult{},
+	}
+
+	for _, userID := range userIDs {
+		result := BatchBanUserResult{
+			UserID:   userID,
+			Username: usernames[userID],
+			Codes:    []BatchBanCodeResult{},
+		}
+		for _, record := range recordsByUser[userID] {
+			result.Codes = append(result.Codes, BatchBanCodeResult{
+				Code:           record.BannedActivationCode,
+				FrozenPoints:   record.FrozenPoints,
+				ConsumedPoints: record.EstimatedUsage,
+			})
+			result.FrozenPoints += record.FrozenPoints
+		}
+
+		var wallet models.UserWallet
+		if err := database.DB.Where("user_id = ?", userID).First(&wallet).Error; err == nil {
+			result.AvailableBefore = wallet.AvailablePoints
+			result.AvailableAfter = wallet.AvailablePoints + result.FrozenPoints
+		}
+
+		var err error
+		if !dryRun {
+			err = database.DB.Transaction(func(tx *gorm.DB) error {
+				for _, item := range result.Codes {
+					if err := unbanActivationCodeTx(tx, userID, item.Code); err != nil {
+						return fmt.Errorf("解禁卡密 %s 失败: %w", item.Code, err)
+					}
+				}
+				return nil
+			})
+		}
+
+		if err != nil {
+			result.Error = err.Error()
+			report.FailedUsers++
+			log.Printf("❌ 批次解禁用户失败: batch=%s, user_id=%d, error=%v", batchNumber, userID, err)
+		} else {
+			result.Success = true
+			report.SucceededUsers++
+			report.AffectedUsers++
+			report.AffectedCodes += len(result.Codes)
+			report.TotalPoints += result.FrozenPoints
+		}
+		report.Users = append(report.Users, result)
+	}
+
+	if !dryRun {
+		log.Printf("管理员批次解禁激活码: admin_id=%d, batch=%s, users=%d, codes=%d", adminUserID, batchNumber, report.AffectedUsers, report.AffectedCodes)
+	}
+	return report, nil
+}
@@ -0,0 +1,359 @@
+package utils
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"strings"
+	"time"
+
+	"claude/database"
+	"claude/models"
+
+	"github.com/go-redis/redis/v8"
+)
+
+// 防暴力破解的场景
+const (
+	BruteForceScopeLogin         = "login"          // 密码/验证码登录
+	BruteForceScopeCoupon        = "coupon"         // 激活码兑换及预检查
+	BruteForceScopeCheckEmail    = "check_email"    // 邮箱注册检查
+	BruteForceScopePasswordReset = "password_reset" // 找回密码邮件发送及重置
+	BruteForceScopeTransfer      = "transfer"       // 积分转账验证码确认
+)
+
+// 防暴力破解的计数维度
+const (
+	BruteForceKindIP        = "ip"
+	BruteForceKindAccount   = "account"
+	BruteForceKindCodeGroup = "code_group"
+)
+
+// 被锁定对象的索引，score 为解锁时间
+const bruteForceLockIndexKey = "brute_force:locks"
+
+// BruteForceSettings 防暴力破解配置
+type BruteForceSettings struct {
+	Enabled               bool  `json:"enabled"`
+	IPMaxFailures         int64 `json:"ip_max_failures"`          // 同一IP在统计窗口内允许的失败次数，0表示不限制
+	AccountMaxFailures    int64 `json:"account_max_failures"`     // 同一账户在统计窗口内允许的失败次数，0表示不限制
+	CodeGroupMaxFailures  int64 `json:"code_group_max_failures"`  // 同一激活码分组在统计窗口内允许的失败次数，0表示不限制
+	CheckEmailMaxRequests int64 `json:"check_email_max_requests"` // 同一IP在统计窗口内允许的邮箱检查次数，0表示不限制
+	WindowSeconds         int64 `json:"window_seconds"`           // 失败次数统计窗口
+	LockoutBaseSeconds    int64 `json:"lockout_base_seconds"`     // 首次锁定时长，之后每次锁定翻倍
+	LockoutMaxSeconds     int64 `json:"lockout_max_seconds"`      // 最长锁定时长
+}
+
+// GetBruteForceSettings 获取防暴力破解配置
+func GetBruteForceSettings() *BruteForceSettings {
+	settings := &BruteForceSettings{
+		Enabled:               true,
+		IPMaxFailures:         getTransferIntConfig("brute_force_ip_max_failures", 20),
+		AccountMaxFailures:    getTransferIntConfig("brute_force_account_max_failures", 5),
+		CodeGroupMaxFailures:  getTransferIntConfig("brute_force_code_group_max_failures", 10),
+		CheckEmailMaxRequests: getTransferIntConfig("brute_force_check_email_max_requests", 30),
+		WindowSeconds:         getTransferIntConfig("brute_force_window_seconds", 900),
+		LockoutBaseSeconds:    getTransferIntConfig("brute_force_lockout_base_seconds", 60),
+		LockoutMaxSeconds:     getTransferIntConfig("brute_force_lockout_max_seconds", 86400),
+	}
+
+	var config models.SystemConfig
+	if err := database.DB.Where("config_key = ?", "brute_force_enabled").First(&config).Error; err == nil {
+		settings.Enabled = config.ConfigValue == "true"
+	}
+
+	if settings.WindowSeconds < 1 {
+		settings.WindowSeconds = 900
+	}
+	if settings.LockoutBaseSeconds < 1 {
+		settings.LockoutBaseSeconds = 60
+	}
+	if settings.LockoutMaxSeconds < settings.LockoutBaseSeconds {
+		settings.LockoutMaxSeconds = settings.LockoutBaseSeconds
+	}
+
+	return settings
+}
+
+// maxFailures 获取指定场景和维度允许的失败次数
+func (s *BruteForceSettings) maxFailures(scope, kind string) int64 {
+	if scope == BruteForceScopeCheckEmail {
+		return s.CheckEmailMaxRequests
+	}
+	switch kind {
+	case BruteForceKindIP:
+		return s.IPMaxFailures
+	case BruteForceKindAccount:
+		return s.AccountMaxFailures
+	case BruteForceKindCodeGroup:
+		return s.CodeGroupMaxFailures
+	}
+	return 0
+}
+
+// lockoutDuration 计算第 level 次锁定的时长，每次翻倍直至上限
+func (s *BruteForceSettings) lockoutDuration(level int64) time.Duration {
+	seconds := s.LockoutBaseSeconds
+	for i := int64(1); i < level && seconds < s.LockoutMaxSeconds; i++ {
+		seconds *= 2
+	}
+	if seconds > s.LockoutMaxSeconds {
+		seconds = s.LockoutMaxSeconds
+	}
+	return time.Duration(seconds) * time.Second
+}
+
+// BruteForceSubject 失败计数的对象，例如某个场景下的某个IP
+type BruteForceSubject struct {
+	Scope string `json:"scope" binding:"required"`
+	Kind  string `json:"kind" binding:"required"`
+	Value string `json:"value" binding:"required"`
+}
+
+// id 对象标识
+func (s BruteForceSubject) id() string {
+	return fmt.Sprintf("%s:%s:%s", s.Scope, s.Kind, s.Value)
+}
+
+// BruteForceLock 锁定状态
+type BruteForceLock struct {
+	BruteForceSubject
+	Failures         int64     `json:"failures"` // 触发锁定时的失败次数
+	Level            int64     `json:"level"`    // 连续第几次被锁定
+	LockedAt         time.Time `json:"locked_at"`
+	LockedUntil      time.Time `json:"locked_until"`
+	RemainingSeconds int64     `json:"remaining_seconds"`
+}
+
+// BruteForceLockedError 对象被锁定时返回的错误
+type BruteForceLockedError struct {
+	RetryAfter time.Duration
+}
+
+func (e *BruteForceLockedError) Error() string {
+	return fmt.Sprintf("尝试次数过多，请在 %s 后重试", formatLockoutDuration(e.RetryAfter))
+}
+
+// formatLockoutDuration 将锁定剩余时间格式化为中文描述
+func formatLockoutDuration(d time.Duration) string {
+	if d < time.Minute {
+		seconds := int64(d.Seconds())
+		if seconds < 1 {
+			seconds = 1
+		}
+		return fmt.Sprintf("%d 秒", seconds)
+	}
+	if d < time.Hour {
+		return fmt.Sprintf("%d 分钟", int64((d+time.Minute-1)/time.Minute))
+	}
+	return fmt.Sprintf("%d 小时", int64((d+time.Hour-1)/time.Hour))
+}
+
+func bruteForceFailKey(s BruteForceSubject) string  { return "brute_force:fail:" + s.id() }
+func bruteForceLockKey(s BruteForceSubject) string  { return "brute_force:lock:" + s.id() }
+func bruteForceLevelKey(s BruteForceSubject) string { return "brute_force:level:" + s.id() }
+
+// BruteForceGuard 一次请求涉及的全部计数对象
+// 任一对象被锁定则拒绝请求，失败时所有对象同时计数
+type BruteForceGuard struct {
+	settings *BruteForceSettings
+	subjects []BruteForceSubject
+}
+
+// NewBruteForceGuard 创建防暴力破解检查，account 和 codeGroup 为空时不按该维度计数
+// 激活码按前缀加第一组随机字符计数（见 ActivationCodeGuessGroup），不按整个前缀计数：
+// 同一批次的激活码共用前缀，按前缀锁定会阻断整批兑换
+func NewBruteForceGuard(scope, ip, account, codeGroup string) *BruteForceGuard {
+	guard := &BruteForceGuard{settings: GetBruteForceSettings()}
+	add := func(kind, value string) {
+		value = strings.ToLower(strings.TrimSpace(value))
+		if value == "" || guard.settings.maxFailures(scope, kind) == 0 {
+			return
+		}
+		guard.subjects = append(guard.subjects, BruteForceSubject{Scope: scope, Kind: kind, Value: value})
+	}
+	add(BruteForceKindIP, ip)
+	add(BruteForceKindAccount, account)
+	add(BruteForceKindCodeGroup, codeGroup)
+	return guard
+}
+
+// Check 检查IP和账户是否处于锁定状态，Redis 不可用时放行
+// 激活码分组的锁定不在这里检查，避免拒绝同一分组中真实存在的激活码，见 CheckCodeGroup
+func (g *BruteForceGuard) Check() error {
+	return g.check(func(kind string) bool { return kind != BruteForceKindCodeGroup })
+}
+
+// CheckCodeGroup 激活码不存在时检查所在分组是否处于锁定状态
+func (g *BruteForceGuard) CheckCodeGroup() error {
+	return g.check(func(kind string) bool { return kind == BruteForceKindCodeGroup })
+}
+
+// check 检查符合条件的对象是否处于锁定状态
+func (g *BruteForceGuard) check(match func(kind string) bool) error {
+	if !g.settings.Enabled || len(g.subjects) == 0 {
+		return nil
+	}
+
+	ctx := context.Background()
+	var retryAfter time.Duration
+	for _, subject := range g.subjects {
+		if !match(subject.Kind) {
+			continue
+		}
+		ttl, err := database.TokenRedisClient.PTTL(ctx, bruteForceLockKey(subject)).Result()
+		if err != nil {
+			log.Printf("❌ 查询锁定状态失败: subject=%s, error=%v", subject.id(), err)
+			continue
+		}
+		if ttl > retryAfter {
+			retryAfter = ttl
+		}
+	}
+	if retryAfter > 0 {
+		return &BruteForceLockedError{RetryAfter: retryAfter}
+	}
+	return nil
+}
+
+// Fail 记录一次失败，达到阈值的对象按指数退避锁定
+func (g *BruteForceGuard) Fail() {
+	if !g.settings.Enabled {
+		return
+	}
+
+	ctx := context.Background()
+	window := time.Duration(g.settings.WindowSeconds) * time.Second
+	for _, subject := range g.subjects {
+		failKey := bruteForceFailKey(subject)
+		failures, err := database.TokenRedisClient.Incr(ctx, failKey).Result()
+		if err != nil {
+			log.Printf("❌ 记录失败次数失败: subject=%s, error=%v", subject.id(), err)
+			continue
+		}
+		if failures == 1 {
+			database.TokenRedisClient.Expire(ctx, failKey, window)
+		}
+		if failures >= g.settings.maxFailures(subject.Scope, subject.Kind) {
+			g.lock(ctx, subject, failures)
+		}
+	}
+}
+
+// lock 锁定对象，锁定等级在最长锁定时长内未再次触发时清零
+func (g *BruteForceGuard) lock(ctx context.Context, subject BruteForceSubject, failures int64) {
+	levelKey := bruteForceLevelKey(subject)
+	level, err := database.TokenRedisClient.Incr(ctx, levelKey).Result()
+	if err != nil {
+		log.Printf("❌ 记录锁定等级失败: subject=%s, error=%v", subject.id(), err)
+		level = 1
+	}
+	duration := g.settings.lockoutDuration(level)
+	database.TokenRedisClient.Expire(ctx, levelKey, duration+time.Duration(g.settings.LockoutMaxSeconds)*time.Second)
+
+	now := time.Now()
+	lock := BruteForceLock{
+		BruteForceSubject: subject,
+		Failures:          failures,
+		Level:             level,
+		LockedAt:          now,
+		LockedUntil:       now.Add(duration),
+	}
+	data, _ := json.Marshal(lock)
+
+	pipe := database.TokenRedisClient.TxPipeline()
+	pipe.Set(ctx, bruteForceLockKey(subject), data, duration)
+	pipe.Del(ctx, bruteForceFailKey(subject))
+	pipe.ZAdd(ctx, bruteForceLockIndexKey, &redis.Z{Score: float64(lock.LockedUntil.Unix()), Member: subject.id()})
+	if _, err := pipe.Exec(ctx); err != nil {
+		log.Printf("❌ 锁定失败: subject=%s, error=%v", subject.id(), err)
+		return
+	}
+	log.Printf("⚠️ 失败次数过多已锁定: subject=%s, failures=%d, level=%d, duration=%s", subject.id(), failures, level, duration)
+}
+
+// Succeed 成功后清除账户维度的失败次数，IP 和激活码分组维度不清除，避免用自己的账户刷新计数
+func (g *BruteForceGuard) Succeed() {
+	if !g.settings.Enabled {
+		return
+	}
+	ctx := context.Background()
+	for _, subject := range g.subjects {
+		if subject.Kind == BruteForceKindAccount {
+			database.TokenRedisClient.Del(ctx, bruteForceFailKey(subject))
+		}
+	}
+}
+
+// ActivationCodeGuessGroup 获取用于失败计数的激活码分组：带前缀时为前缀加第一组随机字符，
+// 否则为第一组随机字符，没有分组时取前4位
+func ActivationCodeGuessGroup(code string) string {
+	code = NormalizeActivationCode(code)
+	parts := strings.Split(code, "-")
+	if len(parts) == 1 {
+		if len(code) > activationCodeGroupSize {
+			return code[:activationCodeGroupSize]
+		}
+		return code
+	}
+	// 第一组不是4位激活码字符或等于配置的前缀时视为前缀
+	first := parts[0]
+	if len(first) != activationCodeGroupSize || strings.Trim(first, activationCodeAlphabet) != "" ||
+		first == GetActivationCodeFormat().Prefix {
+		return first + "-" + parts[1]
+	}
+	return first
+}
+
+// GetBruteForceLocks 获取当前处于锁定状态的对象，按解锁时间排序
+func GetBruteForceLocks(scope string) ([]BruteForceLock, error) {
+	ctx := context.Background()
+	now := time.Now()
+
+	// 清理已过期的索引
+	database.TokenRedisClient.ZRemRangeByScore(ctx, bruteForceLockIndexKey, "-inf", fmt.Sprintf("%d", now.Unix()))
+
+	ids, err := database.TokenRedisClient.ZRangeByScore(ctx, bruteForceLockIndexKey, &redis.ZRangeBy{
+		Min: fmt.Sprintf("(%d", now.Unix()),
+		Max: "+inf",
+	}).Result()
+	if err != nil {
+		return nil, fmt.Errorf("查询锁定列表失败: %v", err)
+	}
+
+	locks := []BruteForceLock{}
+	for _, id := range ids {
+		data, err := database.TokenRedisClient.Get(ctx, "brute_force:lock:"+id).Result()
+		if err != nil {
+			continue
+		}
+		var lock BruteForceLock
+		if err := json.Unmarshal([]byte(data), &lock); err != nil {
+			continue
+		}
+		if scope != "" && lock.Scope != scope {
+			continue
+		}
+		lock.RemainingSeconds = int64(lock.LockedUntil.Sub(now).Seconds())
+		locks = append(locks, lock)
+	}
+	return locks, nil
+}
+
+// UnlockBruteForceSubject 手动解除锁定，同时清除失败次数和锁定等级
+func UnlockBruteForceSubject(subject BruteForceSubject) error {
+	subject.Value = strings.ToLower(strings.TrimSpace(subject.Value))
+	ctx := context.Background()
+
+	pipe := database.TokenRedisClient.TxPipeline()
+	deleted := pipe.Del(ctx, bruteForceLockKey(subject), bruteForceFailKey(subject), bruteForceLevelKey(subject))
+	pipe.ZRem(ctx, bruteForceLockIndexKey, subject.id())
+	if _, err := pipe.Exec(ctx); err != nil {
+		return fmt.Errorf("解除锁定失败: %v", err)
+	}
+	if deleted.Val() == 0 {
+		return fmt.Errorf("该对象未被锁定")
+	}
+	return nil
+}
@@ -0,0 +1,182 @@
+package utils
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"math"
+)
+
+// 最小化的 CBOR（RFC 8949）解码器，只用于解析 WebAuthn 的 attestationObject 和 COSE 公钥
+// 只支持定长编码，WebAuthn 规范要求认证器使用 CTAP2 规范编码（不含不定长编码）
+
+// cbor 嵌套深度上限，防止恶意输入导致栈溢出
+const cborMaxDepth = 16
+
+var errCBORTruncated = errors.New("CBOR数据不完整")
+
+// decodeCBOR 解码一个 CBOR 数据项，返回解码结果和剩余字节
+// 整数解码为 int64，字节串为 []byte，文本为 string，数组为 []interface{}，映射为 map[interface{}]interface{}
+func decodeCBOR(data []byte) (interface{}, []byte, error) {
+	return decodeCBORItem(data, 0)
+}
+
+// readCBORArgument 读取数据项头部的参数（长度或整数值）
+func readCBORArgument(data []byte) (byte, uint64, []byte, error) {
+	if len(data) == 0 {
+		return 0, 0, nil, errCBORTruncated
+	}
+	major := data[0] >> 5
+	info := data[0] & 0x1f
+	data = data[1:]
+
+	switch {
+	case info < 24:
+		return major, uint64(info), data, nil
+	case info == 24:
+		if len(data) < 1 {
+			return 0, 0, nil, errCBORTruncated
+		}
+		return major, uint64(data[0]), data[1:], nil
+	case info == 25:
+		if len(data) < 2 {
+			return 0, 0, nil, errCBORTruncated
+		}
+		return major, uint64(binary.BigEndian.Uint16(data)), data[2:], nil
+	case info == 26:
+		if len(data) < 4 {
+			return 0, 0, nil, errCBORTruncated
+		}
+		return major, uint64(binary.BigEndian.Uint32(data)), data[4:], nil
+	case info == 27:
+		if len(data) < 8 {
+			return 0, 0, nil, errCBORTruncated
+		}
+		return major, binary.BigEndian.Uint64(data), data[8:], nil
+	}
+	return 0, 0, nil, fmt.Errorf("不支持的CBOR编码: 0x%02x", info)
+}
+
+func decodeCBORItem(data []byte, depth int) (interface{}, []byte, error) {
+	if depth > cborMaxDepth {
+		return nil, nil, errors.New("CBOR嵌套层级过深")
+	}
+	if len(data) > 0 && data[0]>>5 == 7 {
+		return decodeCBORSimple(data)
+	}
+
+	major, arg, rest, err := readCBORArgument(data)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	switch major {
+	case 0: // 无符号整数
+		if arg > math.MaxInt64 {
+			return nil, nil, errors.New("CBOR整数溢出")
+		}
+		return int64(arg), rest, nil
+	case 1: // 负整数
+		if arg > math.MaxInt64 {
+			return nil, nil, errors.New("CBOR整数溢出")
+		}
+		return -1 - int64(arg), rest, nil
+	case 2, 3: // 字节串、文本
+		if uint64(len(rest)) < arg {
+			return nil, nil, errCBORTruncated
+		}
+		value := rest[:arg]
+		if major == 3 {
+			return string(value), rest[arg:], nil
+		}
+		return append([]byte(nil), value...), rest[arg:], nil
+	case 4: // 数组
+		if arg > uint64(len(rest)) {
+			return nil, nil, errCBORTruncated
+		}
+		items := make([]interface{}, 0, arg)
+		for i := uint64(0); i < arg; i++ {
+			var item interface{}
+			item, rest, err = decodeCBORItem(rest, depth+1)
+			if err != nil {
+				return nil, nil, err
+			}
+			items = append(items, item)
+		}
+		return items, rest, nil
+	case 5: // 映射，键只支持整数和文本
+		if arg > uint64(len(rest)) {
+			return nil, nil, errCBORTruncated
+		}
+		items := make(map[interface{}]interface{}, arg)
+		for i := uint64(0); i < arg; i++ {
+			var key, value interface{}
+			key, rest, err = decodeCBORItem(rest, depth+1)
+			if err != nil {
+				return nil, nil, err
+			}
+			switch key.(type) {
+			case int64, string:
+			default:
+				return nil, nil, errors.New("不支持的CBOR映射键类型")
+			}
+			value, rest, err = decodeCBORItem(rest, depth+1)
+			if err != nil {
+				return nil, nil, err
+			}
+			items[key] = value
+		}
+		return items, rest, nil
+	case 6: // 标签，忽略标签本身
+		return decodeCBORItem(rest, depth+1)
+	}
+	return nil, nil, fmt.Errorf("不支持的CBOR类型: %d", major)
+}
+
+// decodeCBORSimple 解码简单值和浮点数
+func decodeCBORSimple(data []byte) (interface{}, []byte, error) {
+	info := data[0] & 0x1f
+	rest := data[1:]
+	switch info {
+	case 20:
+		return false, rest, nil
+	case 21:
+		return true, rest, nil
+	case 22, 23:
+		return nil, rest, nil
+	case 25:
+		if len(rest) < 2 {
+			return nil, nil, errCBORTruncated
+		}
+		return float64(decodeHalfFloat(binary.BigEndian.Uint16(rest))), rest[2:], nil
+	case 26:
+		if len(rest) < 4 {
+			return nil, nil, errCBORTruncated
+		}
+		return float64(math.Float32frombits(binary.BigEndian.Uint32(rest))), rest[4:], nil
+	case 27:
+		if len(rest) < 8 {
+			return nil, nil, errCBORTruncated
+		}
+		return math.Float64frombits(binary.BigEndian.Uint64(rest)), rest[8:], nil
+	}
+	return nil, nil, fmt.Errorf("不支持的CBOR简单值: %d", info)
+}
+
+// decodeHalfFloat 解码半精度浮点数
+func decodeHalfFloat(bits uint16) float32 {
+	sign := uint32(bits>>15) << 31
+	exp := uint32(bits>>10) & 0x1f
+	frac := uint32(bits) & 0x3ff
+	switch exp {
+	case 0:
+		value := float32(frac) / 1024 / 16384
+		if sign != 0 {
+			return -value
+		}
+		return value
+	case 0x1f:
+		return math.Float32frombits(sign | 0x7f800000 | frac<<13)
+	}
+	return math.Float32frombits(sign | (exp+112)<<23 | frac<<13)
+}
@@ -0,0 +1,193 @@
+package utils
+
+import (
+	"bytes"
+	"encoding/binary"
+	"encoding/hex"
+	"reflect"
+	"testing"
+)
+
+// cborPair 有序的映射键值对，保证编码结果稳定
+type cborPair struct {
+	key   interface{}
+	value interface{}
+}
+
+// encodeCBORHead 编码数据项头部，总是使用最短编码
+func encodeCBORHead(major byte, arg uint64) []byte {
+	switch {
+	case arg < 24:
+		return []byte{major<<5 | byte(arg)}
+	case arg <= 0xff:
+		return []byte{major<<5 | 24, byte(arg)}
+	case arg <= 0xffff:
+		return binary.BigEndian.AppendUint16([]byte{major<<5 | 25}, uint16(arg))
+	case arg <= 0xffffffff:
+		return binary.BigEndian.AppendUint32([]byte{major<<5 | 26}, uint32(arg))
+	}
+	return binary.BigEndian.AppendUint64([]byte{major<<5 | 27}, arg)
+}
+
+// encodeCBOR 测试用的最小 CBOR 编码器，用于构造认证器返回的数据
+func encodeCBOR(value interface{}) []byte {
+	switch v := value.(type) {
+	case int:
+		if v < 0 {
+			return encodeCBORHead(1, uint64(-1-v))
+		}
+		return encodeCBORHead(0, uint64(v))
+	case []byte:
+		return append(encodeCBORHead(2, uint64(len(v))), v...)
+	case string:
+		return append(encodeCBORHead(3, uint64(len(v))), v...)
+	case []interface{}:
+		out := encodeCBORHead(4, uint64(len(v)))
+		for _, item := range v {
+			out = append(out, encodeCBOR(item)...)
+		}
+		return out
+	case []cborPair:
+		out := encodeCBORHead(5, uint64(len(v)))
+		for _, pair := range v {
+			out = append(out, encodeCBOR(pair.key)...)
+			out = append(out, encodeCBOR(pair.value)...)
+		}
+		return out
+	}
+	panic("不支持的测试CBOR类型")
+}
+
+func mustHex(t testing.TB, value string) []byte {
+	t.Helper()
+	data, err := hex.DecodeString(value)
+	if err != nil {
+		t.Fatalf("无效的十六进制: %s", value)
+	}
+	return data
+}
+
+// TestDecodeCBOR 使用 RFC 8949 附录 A 的示例向量
+func TestDecodeCBOR(t *testing.T) {
+	tests := []struct {
+		hex  string
+		want interface{}
+	}{
+		{"00", int64(0)},
+		{"17", int64(23)},
+		{"1818", int64(24)},
+		{"190100", int64(256)},
+		{"1a000f4240", int64(1000000)},
+		{"1b000000e8d4a51000", int64(1000000000000)},
+		{"20", int64(-1)},
+		{"3863", int64(-100)},
+		{"3903e7", int64(-1000)},
+		{"40", []byte(nil)},
+		{"4401020304", []byte{1, 2, 3, 4}},
+		{"60", ""},
+		{"6449455446", "IETF"},
+		{"62c3bc", "ü"},
+		{"80", []interface{}{}},
+		{"83010203", []interface{}{int64(1), int64(2), int64(3)}},
+		{"8301820203820405", []interface{}{int64(1), []interface{}{int64(2), int64(3)}, []interface{}{int64(4), int64(5)}}},
+		{"a0", map[interface{}]interface{}{}},
+		{"a201020304", map[interface{}]interface{}{int64(1): int64(2), int64(3): int64(4)}},
+		{"a26161016162820203", map[interface{}]interface{}{"a": int64(1), "b": []interface{}{int64(2), int64(3)}}},
+		{"f4", false},
+		{"f5", true},
+		{"f6", nil},
+		{"f7", nil},
+		{"f93c00", float64(1)},
+		{"f9c400", float64(-4)},
+		{"f90001", float64(5.960464477539063e-08)},
+		{"fa47c35000", float64(100000)},
+		{"fb3ff199999999999a", 1.1},
+		{"c11a514b67b0", int64(1363896240)},
+	}
+	for _, tt := range tests {
+		got, rest, err := decodeCBOR(mustHex(t, tt.hex))
+		if err != nil {
+			t.Errorf("%s: 解码失败: %v", tt.hex, err)
+			continue
+		}
+		if len(rest) != 0 {
+			t.Errorf("%s: 剩余 %d 字节未解码", tt.hex, len(rest))
+		}
+		if !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("%s: 期望 %#v，实际 %#v", tt.hex, tt.want, got)
+		}
+	}
+}
+
+// TestDecodeCBORRest 解码一个数据项后返回剩余字节，用于截取 authenticatorData 中的公钥
+func TestDecodeCBORRest(t *testing.T) {
+	got, rest, err := decodeCBOR(mustHex(t, "6449455446ff01"))
+	if err != nil {
+		t.Fatalf("解码失败: %v", err)
+	}
+	if got != "IETF" || !bytes.Equal(rest, []byte{0xff, 0x01}) {
+		t.Fatalf("期望 IETF 和剩余字节 ff01，实际 %#v, %x", got, rest)
+	}
+}
+
+func TestDecodeCBORInvalid(t *testing.T) {
+	deep := bytes.Repeat([]byte{0x81}, cborMaxDepth+2)
+	deep = append(deep, 0x00)
+
+	tests := []struct {
+		name string
+		data []byte
+	}{
+		{"空输入", nil},
+		{"整数参数不完整", mustHex(t, "19")},
+		{"字节串长度超出", mustHex(t, "4401")},
+		{"文本长度超出", mustHex(t, "6449")},
+		{"数组元素缺失", mustHex(t, "8301")},
+		{"映射值缺失", mustHex(t, "a101")},
+		{"数组长度远超输入", mustHex(t, "9bffffffffffffffff")},
+		{"映射长度远超输入", mustHex(t, "bbffffffffffffffff")},
+		{"字节串长度溢出", mustHex(t, "5bffffffffffffffff")},
+		{"无符号整数溢出", mustHex(t, "1bffffffffffffffff")},
+		{"负整数溢出", mustHex(t, "3bffffffffffffffff")},
+		{"不定长字节串", mustHex(t, "5f41014102ff")},
+		{"不定长数组", mustHex(t, "9f01ff")},
+		{"保留的附加信息", mustHex(t, "1c")},
+		{"字节串作为映射键", mustHex(t, "a1410102")},
+		{"数组作为映射键", mustHex(t, "a1800102")},
+		{"浮点数不完整", mustHex(t, "fb3ff1")},
+		{"未分配的简单值", mustHex(t, "f0")},
+		{"嵌套过深", deep},
+	}
+	for _, tt := range tests {
+		if _, _, err := decodeCBOR(tt.data); err == nil {
+			t.Errorf("%s: 应返回错误", tt.name)
+		}
+	}
+}
+
+// FuzzDecodeCBOR 任意输入都不能导致崩溃，成功时剩余字节必须是输入的后缀
+func FuzzDecodeCBOR(f *testing.F) {
+	for _, seed := range []string{
+		"00", "1bffffffffffffffff", "3863", "4401020304", "6449455446", "83010203",
+		"a26161016162820203", "f93c00", "fb3ff199999999999a", "c11a514b67b0",
+		"9bffffffffffffffff", "5f41014102ff",
+	} {
+		data, _ := hex.DecodeString(seed)
+		f.Add(data)
+	}
+	f.Add(encodeCBOR([]cborPair{
+		{"fmt", "none"},
+		{"attStmt", []cborPair{}},
+		{"authData", bytes.Repeat([]byte{0xaa}, 37)},
+	}))
+
+	f.Fuzz(func(t *testing.T, data []byte) {
+		_, rest, err := decodeCBOR(data)
+		if err != nil {
+			return
+		}
+		if len(rest) >= len(data) || !bytes.Equal(rest, data[len(data)-len(rest):]) {
+			t.Fatalf("剩余字节不是输入的后缀: data=%x rest=%x", data, rest)
+		}
+	})
+}
@@ -0,0 +1,492 @@
+package utils
+
+import (
+	"encoding/json"
+	"fmt"
+	"math"
+	"sort"
+	"strconv"
+	"time"
+
+	"claude/database"
+	"claude/models"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// 计算连续签到天数时最多回溯的天数
+const checkinStreakLookbackDays = 366
+
+// CheckinStreakTier 连续签到奖励档位：连续签到达到 Days 天后按 Multiplier 倍发放
+type CheckinStreakTier struct {
+	Days       int     `json:"days"`
+	Multiplier float64 `json:"multiplier"`
+}
+
+// CheckinMakeupSettings 补签配置
+type CheckinMakeupSettings struct {
+	Enabled      bool  `json:"enabled"`
+	Cost         int64 `json:"cost"`          // 每次补签消耗的积分
+	MaxDays      int   `json:"max_days"`      // 最多可补签多少天以内的漏签
+	MonthlyLimit int   `json:"monthly_limit"` // 每月最多补签次数，0表示不限制
+}
+
+// CheckinStreakInfo 用户当前的连续签到信息
+type CheckinStreakInfo struct {
+	StreakDays     int                 `json:"streakDays"`     // 当前连续签到天数
+	NextMultiplier float64             `json:"nextMultiplier"` // 下一次签到的奖励倍率
+	NextTier       *CheckinStreakTier  `json:"nextTier"`       // 下一个奖励档位，已达最高档时为空
+	Tiers          []CheckinStreakTier `json:"tiers"`          // 全部奖励档位
+}
+
+// CheckinCalendarDay 签到日历中的一天
+type CheckinCalendarDay struct {
+	Date       string  `json:"date"`
+	Checked    bool    `json:"checked"`
+	Points     int64   `json:"points"`
+	StreakDays int     `json:"streakDays"`
+	Multiplier float64 `json:"multiplier"`
+	IsMakeup   bool    `json:"isMakeup"`
+	CanMakeup  bool    `json:"canMakeup"` // 是否可以补签
+}
+
+// CheckinCalendar 按月的签到日历
+type CheckinCalendar struct {
+	Month       string                `json:"month"` // YYYY-MM
+	Days        []CheckinCalendarDay  `json:"days"`
+	CheckedDays int                   `json:"checkedDays"`
+	TotalPoints int64                 `json:"totalPoints"`
+	Streak      *CheckinStreakInfo    `json:"streak"`
+	Makeup      CheckinMakeupSettings `json:"makeup"`
+}
+
+// CheckinDailyStat 每日签到统计
+type CheckinDailyStat struct {
+	Date    string `json:"date"`
+	Users   int64  `json:"users"`
+	Points  int64  `json:"points"`
+	Makeups int64  `json:"makeups"`
+}
+
+// CheckinStreakBucket 连续签到天数分布
+type CheckinStreakBucket struct {
+	Label string `json:"label"`
+	Users int64  `json:"users"`
+}
+
+// CheckinStats 签到参与情况统计
+type CheckinStats struct {
+	TotalCheckins      int64                 `json:"total_checkins"`
+	UniqueUsers        int64                 `json:"unique_users"`
+	TotalPoints        int64                 `json:"total_points"`
+	MakeupCount        int64                 `json:"makeup_count"`
+	MakeupPointsSpent  int64                 `json:"makeup_points_spent"`
+	EligibleUsers      int64                 `json:"eligible_users"`      // 当前可签到（钱包有效且有签到奖励）的用户数
+	TodayUsers         int64                 `json:"today_users"`         // 今日签到用户数
+	ParticipationRate  float64               `json:"participation_rate"`  // 今日签到率（百分比）
+	Daily              []CheckinDailyStat    `json:"daily"`               // 按日统计
+	StreakDistribution []CheckinStreakBucket `json:"streak_distribution"` // 今日签到用户的连续天数分布
+}
+
+// getCheckinBoolConfig 读取签到相关的布尔配置
+func getCheckinBoolConfig(key string, defaultValue bool) bool {
+	var config models.SystemConfig
+	if err := database.DB.Where("config_key = ?", key).First(&config).Error; err != nil {
+		return defaultValue
+	}
+	return config.ConfigValue == "true"
+}
+
+// GetCheckinStreakTiers 获取连续签到奖励档位，按天数升序
+func GetCheckinStreakTiers() []CheckinStreakTier {
+	tiers := []CheckinStreakTier{}
+
+	var config models.SystemConfig
+	if err := database.DB.Where("config_key = ?", "daily_checkin_streak_bonus").First(&config).Error; err != nil {
+		return tiers
+	}
+
+	var mapping map[string]float64
+	if err := json.Unmarshal([]byte(config.ConfigValue), &mapping); err != nil {
+		return tiers
+	}
+	for key, multiplier := range mapping {
+		days, err := strconv.Atoi(key)
+		if err != nil || days < 1 || multiplier <= 0 {
+			continue
+		}
+		tiers = append(tiers, CheckinStreakTier{Days: days, Multiplier: multiplier})
+	}
+	sort.Slice(tiers, func(i, j int) bool { return tiers[i].Days < tiers[j].Days })
+	return tiers
+}
+
+// checkinMultiplier 根据连续签到天数计算奖励倍率
+func checkinMultiplier(tiers []CheckinStreakTier, streakDays int) float64 {
+	multiplier := 1.0
+	for _, tier := range tiers {
+		if streakDays >= tier.Days {
+			multiplier = tier.Multiplier
+		}
+	}
+	return multiplier
+}
+
+// GetCheckinMakeupSettings 获取补签配置
+func GetCheckinMakeupSettings() CheckinMakeupSettings {
+	settings := CheckinMakeupSettings{
+		Enabled:      getCheckinBoolConfig("daily_checkin_makeup_enabled", false),
+		Cost:         getTransferIntConfig("daily_checkin_makeup_cost", 100),
+		MaxDays:      int(getTransferIntConfig("daily_checkin_makeup_max_days", 7)),
+		MonthlyLimit: int(getTransferIntConfig("daily_checkin_makeup_monthly_limit", 3)),
+	}
+	if settings.MaxDays < 1 {
+		settings.MaxDays = 1
+	}
+	return settings
+}
+
+// checkinStreakEndingAt 计算截至指定日期（含）的连续签到天数
+func checkinStreakEndingAt(db *gorm.DB, userID uint, date time.Time) (int, error) {
+	from := date.AddDate(0, 0, -checkinStreakLookbackDays).Format("2006-01-02")
+	to := date.Format("2006-01-02")
+
+	var dates []string
+	if err := db.Model(&models.DailyCheckin{}).
+		Where("user_id = ? AND checkin_date > ? AND checkin_date <= ?", userID, from, to).
+		Order("checkin_date DESC").Pluck("checkin_date", &dates).Error; err != nil {
+		return 0, err
+	}
+
+	streak := 0
+	expected := to
+	for _, d := range dates {
+		if d != expected {
+			break
+		}
+		streak++
+		expected = date.AddDate(0, 0, -streak).Format("2006-01-02")
+	}
+	return streak, nil
+}
+
+// startOfDay 返回指定时间当天的零点
+func startOfDay(t time.Time) time.Time {
+	return time.Date(t.Year(), t.Month(), t.Day(), 0, 0, 0, 0, t.Location())
+}
+
+// GetCheckinStreakInfo 获取用户当前的连续签到信息；今天未签到时按截至昨天计算
+func GetCheckinStreakInfo(userID uint) (*CheckinStreakInfo, error) {
+	today := startOfDay(time.Now())
+
+	streak, err := checkinStreakEndingAt(database.DB, userID, today)
+	if err != nil {
+		return nil, fmt.Errorf("计算连续签到天数失败: %v", err)
+	}
+	nextStreak := streak + 1
+	if streak == 0 {
+		if streak, err = checkinStreakEndingAt(database.DB, userID, today.AddDate(0, 0, -1)); err != nil {
+			return nil, fmt.Errorf("计算连续签到天数失败: %v", err)
+		}
+		nextStreak = streak + 1
+	}
+
+	tiers := GetCheckinStreakTiers()
+	info := &CheckinStreakInfo{
+		StreakDays:     streak,
+		NextMultiplier: checkinMultiplier(tiers, nextStreak),
+		Tiers:          tiers,
+	}
+	for i := range tiers {
+		if tiers[i].Days > streak {
+			info.NextTier = &tiers[i]
+			break
+		}
+	}
+	return info, nil
+}
+
+// ApplyCheckinStreakBonus 根据截至昨天的连续签到天数计算今天签到的连续天数、倍率和最终积分
+func ApplyCheckinStreakBonus(userID uint, basePoints int64) (streakDays int, multiplier float64, points int64, err error) {
+	yesterday := startOfDay(time.Now()).AddDate(0, 0, -1)
+	streak, err := checkinStreakEndingAt(database.DB, userID, yesterday)
+	if err != nil {
+		return 0, 0, 0, fmt.Errorf("计算连续签到天数失败: %v", err)
+	}
+
+	streakDays = streak + 1
+	multiplier = checkinMultiplier(GetCheckinStreakTiers(), streakDays)
+	points = int64(math.Round(float64(basePoints) * multiplier))
+	return streakDays, multiplier, points, nil
+}
+
+// canMakeupDate 判断指定日期是否在允许补签的范围内
+func canMakeupDate(settings CheckinMakeupSettings, date, today, registeredAt time.Time) error {
+	if !date.Before(today) {
+		return fmt.Errorf("只能补签今天之前的日期")
+	}
+	if date.Before(today.AddDate(0, 0, -settings.MaxDays)) {
+		return fmt.Errorf("只能补签最近%d天内的漏签", settings.MaxDays)
+	}
+	if date.Before(startOfDay(registeredAt)) {
+		return fmt.Errorf("不能补签注册之前的日期")
+	}
+	return nil
+}
+
+// MakeupCheckin 消耗积分补签指定日期，补签只用于延续连续签到，不发放签到奖励
+func MakeupCheckin(userID uint, dateStr string) (*models.DailyCheckin, error) {
+	settings := GetCheckinMakeupSettings()
+	if !settings.Enabled {
+		return nil, fmt.Errorf("补签功能未开启")
+	}
+
+	date, err := time.ParseInLocation("2006-01-02", dateStr, time.Local)
+	if err != nil {
+		return nil, fmt.Errorf("日期格式错误，应为 YYYY-MM-DD")
+	}
+
+	var user models.User
+	if err := database.DB.Where("id = ?", userID).First(&user).Error; err != nil {
+		return nil, fmt.Errorf("获取用户信息失败")
+	}
+	if user.IsDisabled {
+		return nil, fmt.Errorf("您的账户已被管理员禁用，无法补签")
+	}
+
+	now := time.Now()
+	if err := canMakeupDate(settings, date, startOfDay(now), user.CreatedAt); err != nil {
+		return nil, err
+	}
+
+	var checkin models.DailyCheckin
+	err = database.DB.Transaction(func(tx *gorm.DB) error {
+		// 锁定钱包，保证同一用户的补签串行执行
+		var wallet models.UserWallet
+		if err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).
+			Where("user_id = ?", userID).First(&wallet).Error; err != nil {
+			return fmt.Errorf("获取用户钱包失败")
+		}
+		if wallet.Status != "active" || !wallet.WalletExpiresAt.After(now) {
+			return fmt.Errorf("钱包已过期，无法补签")
+		}
+
+		var exists int64
+		tx.Model(&models.DailyCheckin{}).Where("user_id = ? AND checkin_date = ?", userID, dateStr).Count(&exists)
+		if exists > 0 {
+			return fmt.Errorf("该日期已签到，无需补签")
+		}
+
+		if settings.MonthlyLimit > 0 {
+			monthStart := time.Date(now.Year(), now.Month(), 1, 0, 0, 0, 0, now.Location())
+			var used int64
+			tx.Model(&models.DailyCheckin{}).
+				Where("user_id = ? AND is_makeup = ? AND created_at >= ?", userID, true, monthStart).
+				Count(&used)
+			if used >= int64(settings.MonthlyLimit) {
+				return fmt.Errorf("本月补签次数已用完（每月%d次）", settings.MonthlyLimit)
+			}
+		}
+
+		if settings.Cost > 0 {
+			result := tx.Model(&models.UserWallet{}).
+				Where("user_id = ? AND available_points >= ?", userID, settings.Cost).
+				Updates(map[string]interface{}{
+					"total_points":     gorm.Expr("total_points - ?", settings.Cost),
+					"available_points": gorm.Expr("available_points - ?", settings.Cost),
+					"updated_at":       now,
+				})
+			if result.Error != nil {
+				return fmt.Errorf("扣减补签积分失败: %v", result.Error)
+			}
+			if result.RowsAffected == 0 {
+				return fmt.Errorf("可用积分不足，补签需要 %d 积分", settings.Cost)
+			}
+
+			record := models.RedemptionRecord{
+				UserID:       userID,
+				SourceType:   "checkin_makeup",
+				SourceID:     fmt.Sprintf("checkin_makeup_%s", dateStr),
+				PointsAmount: -settings.Cost,
+				ValidityDays: validityDaysUntil(wallet.WalletExpiresAt),
+				ActivatedAt:  now,
+				ExpiresAt:    wallet.WalletExpiresAt,
+				Reason:       fmt.Sprintf("补签 %s", dateStr),
+				CreatedAt:    now,
+				UpdatedAt:    now,
+			}
+			if err := tx.Create(&record).Error; err != nil {
+				return fmt.Errorf("创建兑换记录失败: %v", err)
+			}
+		}
+
+		checkin = models.DailyCheckin{
+			UserID:      userID,
+			CheckinDate: dateStr,
+			StreakDays:  1,
+			Multiplier:  1,
+			IsMakeup:    true,
+			MakeupCost:  settings.Cost,
+			CreatedAt:   now,
+		}
+		if err := tx.Create(&checkin).Error; err != nil {
+			if isDuplicateKeyError(err) {
+				return fmt.Errorf("该日期已签到，无需补签")
+			}
+			return fmt.Errorf("创建补签记录失败: %v", err)
+		}
+
+		streak, err := checkinStreakEndingAt(tx, userID, date)
+		if err != nil {
+			return fmt.Errorf("计算连续签到天数失败: %v", err)
+		}
+		checkin.StreakDays = streak
+		return tx.Model(&checkin).Update("streak_days", streak).Error
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return &checkin, nil
+}
+
+// GetCheckinCalendar 获取用户指定月份的签到日历
+func GetCheckinCalendar(userID uint, month string) (*CheckinCalendar, error) {
+	monthStart, err := time.ParseInLocation("2006-01", month, time.Local)
+	if err != nil {
+		return nil, fmt.Errorf("月份格式错误，应为 YYYY-MM")
+	}
+	monthEnd := monthStart.AddDate(0, 1, 0)
+
+	var checkins []models.DailyCheckin
+	if err := database.DB.Where("user_id = ? AND checkin_date >= ? AND checkin_date < ?",
+		userID, monthStart.Format("2006-01-02"), monthEnd.Format("2006-01-02")).
+		Find(&checkins).Error; err != nil {
+		return nil, fmt.Errorf("查询签到记录失败: %v", err)
+	}
+	byDate := make(map[string]models.DailyCheckin, len(checkins))
+	for _, checkin := range checkins {
+		byDate[checkin.CheckinDate] = checkin
+	}
+
+	var user models.User
+	if err := database.DB.Where("id = ?", userID).First(&user).Error; err != nil {
+		return nil, fmt.Errorf("获取用户信息失败")
+	}
+
+	streak, err := GetCheckinStreakInfo(userID)
+	if err != nil {
+		return nil, err
+	}
+
+	settings := GetCheckinMakeupSettings()
+	today := startOfDay(time.Now())
+	calendar := &CheckinCalendar{
+		Month:  monthStart.Format("2006-01"),
+		Days:   []CheckinCalendarDay{},
+		Streak: streak,
+		Makeup: settings,
+	}
+	for day := monthStart; day.Before(monthEnd); day = day.AddDate(0, 0, 1) {
+		date := day.Format("2006-01-02")
+		item := CheckinCalendarDay{Date: date}
+		if checkin, ok := byDate[date]; ok {
+			item.Checked = true
+			item.Points = checkin.Points
+			item.StreakDays = checkin.StreakDays
+			item.Multiplier = checkin.Multiplier
+			item.IsMakeup = checkin.IsMakeup
+			calendar.CheckedDays++
+			calendar.TotalPoints += checkin.Points
+		} else if settings.Enabled {
+			item.CanMakeup = canMakeupDate(settings, day, today, user.CreatedAt) == nil
+		}
+		calendar.Days = append(calendar.Days, item)
+	}
+
+	return calendar, nil
+}
+
+// GetCheckinStats 统计指定日期范围 [start, end) 内的签到参与情况
+func GetCheckinStats(start, end time.Time) (*CheckinStats, error) {
+	from := start.Format("2006-01-02")
+	to := end.Format("2006-01-02")
+	stats := &CheckinStats{
+		Daily:              []CheckinDailyStat{},
+		StreakDistribution: []CheckinStreakBucket{},
+	}
+
+	rangeQuery := func() *gorm.DB {
+		return database.DB.Model(&models.DailyCheckin{}).Where("checkin_date >= ? AND checkin_date < ?", from, to)
+	}
+
+	var totals struct {
+		TotalCheckins     int64
+		UniqueUsers       int64
+		TotalPoints       int64
+		MakeupCount       int64
+		MakeupPointsSpent int64
+	}
+	if err := rangeQuery().Select(`COUNT(*) AS total_checkins,
+		COUNT(DISTINCT user_id) AS unique_users,
+		COALESCE(SUM(points), 0) AS total_points,
+		COALESCE(SUM(CASE WHEN is_makeup THEN 1 ELSE 0 END), 0) AS makeup_count,
+		COALESCE(SUM(makeup_cost), 0) AS makeup_points_spent`).Scan(&totals).Error; err != nil {
+		return nil, fmt.Errorf("统计签到数据失败: %v", err)
+	}
+	stats.TotalCheckins = totals.TotalCheckins
+	stats.UniqueUsers = totals.UniqueUsers
+	stats.TotalPoints = totals.TotalPoints
+	stats.MakeupCount = totals.MakeupCount
+	stats.MakeupPointsSpent = totals.MakeupPointsSpent
+
+	if err := rangeQuery().Select(`checkin_date AS date,
+		COUNT(DISTINCT user_id) AS users,
+		COALESCE(SUM(points), 0) AS points,
+		COALESCE(SUM(CASE WHEN is_makeup THEN 1 ELSE 0 END), 0) AS makeups`).
+		Group("checkin_date").Order("checkin_date").Scan(&stats.Daily).Error; err != nil {
+		return nil, fmt.Errorf("统计每日签到数据失败: %v", err)
+	}
+
+	// 今日签到率：今日签到用户数 / 钱包有效且有签到奖励的用户数
+	now := time.Now()
+	today := now.Format("2006-01-02")
+	database.DB.Model(&models.UserWallet{}).
+		Where("status = ? AND wallet_expires_at > ? AND daily_checkin_points > 0", "active", now).
+		Count(&stats.EligibleUsers)
+	database.DB.Model(&models.DailyCheckin{}).Where("checkin_date = ?", today).Count(&stats.TodayUsers)
+	if stats.EligibleUsers > 0 {
+		stats.ParticipationRate = math.Round(float64(stats.TodayUsers)/float64(stats.EligibleUsers)*10000) / 100
+	}
+
+	// 按奖励档位划分今日签到用户的连续天数
+	var streaks []int
+	database.DB.Model(&models.DailyCheckin{}).Where("checkin_date = ?", today).Pluck("streak_days", &streaks)
+	bounds := []int{1}
+	for _, tier := range GetCheckinStreakTiers() {
+		if tier.Days > bounds[len(bounds)-1] {
+			bounds = append(bounds, tier.Days)
+		}
+	}
+	for i, lower := range bounds {
+		bucket := CheckinStreakBucket{Label: fmt.Sprintf("%d+", lower)}
+		upper := 0
+		if i+1 < len(bounds) {
+			upper = bounds[i+1]
+			if upper-1 == lower {
+				bucket.Label = strconv.Itoa(lower)
+			} else {
+				bucket.Label = fmt.Sprintf("%d-%d", lower, upper-1)
+			}
+		}
+		for _, streak := range streaks {
+			if streak >= lower && (upper == 0 || streak < upper) {
+				bucket.Users++
+			}
+		}
+		stats.StreakDistribution = append(stats.StreakDistribution, bucket)
+	}
+
+	return stats, nil
+}
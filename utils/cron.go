@@ -0,0 +1,158 @@
+package utils
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// CronSchedule 解析后的5段式cron表达式：分 时 日 月 周
+type CronSchedule struct {
+	expr   string
+	minute uint64
+	hour   uint64
+	dom    uint64
+	month  uint64
+	dow    uint64
+	anyDom bool
+	anyDow bool
+}
+
+// cron 各字段的取值范围
+var cronFieldBounds = [5][2]int{
+	{0, 59}, // 分
+	{0, 23}, // 时
+	{1, 31}, // 日
+	{1, 12}, // 月
+	{0, 6},  // 周（0为周日，7也视为周日）
+}
+
+// ParseCronSchedule 解析cron表达式，支持 *、数字、范围(a-b)、列表(a,b)和步长(*/n、a-b/n)
+func ParseCronSchedule(expr string) (*CronSchedule, error) {
+	fields := strings.Fields(expr)
+	if len(fields) != 5 {
+		return nil, fmt.Errorf("cron表达式应为5段（分 时 日 月 周）: %q", expr)
+	}
+
+	schedule := &CronSchedule{
+		expr:   strings.Join(fields, " "),
+		anyDom: fields[2] == "*",
+		anyDow: fields[4] == "*",
+	}
+	targets := []*uint64{&schedule.minute, &schedule.hour, &schedule.dom, &schedule.month, &schedule.dow}
+	for i, field := range fields {
+		bits, err := parseCronField(field, cronFieldBounds[i][0], cronFieldBounds[i][1], i == 4)
+		if err != nil {
+			return nil, fmt.Errorf("cron表达式第%d段错误: %v", i+1, err)
+		}
+		*targets[i] = bits
+	}
+	return schedule, nil
+}
+
+// parseCronField 解析单个cron字段为位图
+func parseCronField(field string, min, max int, isDow bool) (uint64, error) {
+	var bits uint64
+	for _, part := range strings.Split(field, ",") {
+		step := 1
+		if idx := strings.Index(part, "/"); idx >= 0 {
+			n, err := strconv.Atoi(part[idx+1:])
+			if err != nil || n <= 0 {
+				return 0, fmt.Errorf("无效的步长: %q", part)
+			}
+			step = n
+			part = part[:idx]
+		}
+
+		start, end := min, max
+		switch {
+		case part == "*":
+		case strings.Contains(part, "-"):
+			bounds := strings.SplitN(part, "-", 2)
+			a, err1 := strconv.Atoi(bounds[0])
+			b, err2 := strconv.Atoi(bounds[1])
+			if err1 != nil || err2 != nil {
+				return 0, fmt.Errorf("无效的范围: %q", part)
+			}
+			start, end = a, b
+		default:
+			n, err := strconv.Atoi(part)
+			if err != nil {
+				return 0, fmt.Errorf("无效的数值: %q", part)
+			}
+			start, end = n, n
+			if step > 1 {
+				end = max
+			}
+		}
+
+		if isDow && end == 7 {
+			// 周日既可以写0也可以写7
+			bits |= 1
+			if start == 7 {
+				continue
+			}
+			end = 6
+		}
+		if start < min || end > max || start > end {
+			return 0, fmt.Errorf("取值超出范围 %d-%d: %q", min, max, part)
+		}
+		for v := start; v <= end; v += step {
+			bits |= 1 << uint(v)
+		}
+	}
+	return bits, nil
+}
+
+// String 返回规范化后的cron表达式
+func (s *CronSchedule) String() string {
+	return s.expr
+}
+
+// Matches 判断指定时间（精确到分钟）是否命中该表达式
+func (s *CronSchedule) Matches(t time.Time) bool {
+	if s.minute&(1<<uint(t.Minute())) == 0 ||
+		s.hour&(1<<uint(t.Hour())) == 0 ||
+		s.month&(1<<uint(t.Month())) == 0 {
+		return false
+	}
+
+	return s.matchesDay(t)
+}
+
+// matchesDay 判断日期是否命中，与标准cron一致：日和周都有限制时满足其一即可
+func (s *CronSchedule) matchesDay(t time.Time) bool {
+	domMatch := s.dom&(1<<uint(t.Day())) != 0
+	dowMatch := s.dow&(1<<uint(t.Weekday())) != 0
+	switch {
+	case s.anyDom && s.anyDow:
+		return true
+	case s.anyDom:
+		return dowMatch
+	case s.anyDow:
+		return domMatch
+	default:
+		return domMatch || dowMatch
+	}
+}
+
+// Next 返回晚于指定时间的下一次执行时间，一年内没有命中时返回零值
+func (s *CronSchedule) Next(after time.Time) time.Time {
+	t := after.Truncate(time.Minute).Add(time.Minute)
+	limit := t.AddDate(1, 0, 0)
+	for t.Before(limit) {
+		if s.Matches(t) {
+			return t
+		}
+		// 月份、日期或小时不匹配时直接跳到下一天/下一小时，避免逐分钟遍历
+		if s.month&(1<<uint(t.Month())) == 0 || !s.matchesDay(t) {
+			t = time.Date(t.Year(), t.Month(), t.Day()+1, 0, 0, 0, 0, t.Location())
+		} else if s.hour&(1<<uint(t.Hour())) == 0 {
+			t = time.Date(t.Year(), t.Month(), t.Day(), t.Hour()+1, 0, 0, 0, t.Location())
+		} else {
+			t = t.Add(time.Minute)
+		}
+	}
+	return time.Time{}
+}
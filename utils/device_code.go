@@ -26,8 +26,8 @@ func GenerateDeviceCode() string {
 	return result.String()
 }
 
-// StoreDeviceCode 存储设备码到数据库
-func StoreDeviceCode(userID uint) (string, error) {
+// StoreDeviceCode 存储设备码到数据库，设备码只能由发起授权的客户端兑换
+func StoreDeviceCode(userID uint, clientID string, scope string) (string, error) {
 	// 生成唯一的设备码
 	var code string
 	var exists bool
@@ -61,6 +61,8 @@ func StoreDeviceCode(userID uint) (string, error) {
 		Code:      code,
 		UserID:    userID,
 		Used:      false,
+		ClientID:  clientID,
+		Scope:     scope,
 		ExpiresAt: expiresAt,
 	}
 
@@ -72,33 +74,41 @@ func StoreDeviceCode(userID uint) (string, error) {
 	return code, nil
 }
 
-// ValidateDeviceCode 验证设备码并返回用户信息
-func ValidateDeviceCode(code string) (*models.User, error) {
+// ValidateDeviceCode 验证设备码并返回用户信息和授予的权限范围
+func ValidateDeviceCode(code string, clientID string) (*models.User, string, error) {
 	var deviceCode models.DeviceCode
 	
 	// 查找设备码并预加载用户信息
 	err := database.DB.Preload("User").Where("code = ?", code).First(&deviceCode).Error
 	if err != nil {
-		return nil, fmt.Errorf("device code not found")
+		return nil, "", fmt.Errorf("device code not found")
 	}
 
 	// 检查是否已经使用
 	if deviceCode.Used {
-		return nil, fmt.Errorf("device code already used")
+		return nil, "", fmt.Errorf("device code already used")
 	}
 
 	// 检查是否过期
 	if time.Now().After(deviceCode.ExpiresAt) {
-		return nil, fmt.Errorf("device code expired")
+		return nil, "", fmt.Errorf("device code expired")
 	}
 
-	// 标记为已使用
-	deviceCode.Used = true
-	if err := database.DB.Save(&deviceCode).Error; err != nil {
-		return nil, fmt.Errorf("failed to mark device code as used: %w", err)
+	// 检查是否由发起授权的客户端兑换
+	if deviceCode.ClientID != "" && deviceCode.ClientID != clientID {
+		return nil, "", fmt.Errorf("device code not found")
 	}
 
-	return &deviceCode.User, nil
+	// 标记为已使用，条件更新避免并发兑换
+	result := database.DB.Model(&deviceCode).Where("used = ?", false).Update("used", true)
+	if result.Error != nil {
+		return nil, "", fmt.Errorf("failed to mark device code as used: %w", result.Error)
+	}
+	if result.RowsAffected == 0 {
+		return nil, "", fmt.Errorf("device code already used")
+	}
+
+	return &deviceCode.User, deviceCode.Scope, nil
 }
 
 // CleanExpiredDeviceCodes 清理过期的设备码
@@ -26,7 +26,48 @@ type DeviceInfo struct {
 	Source     string    `json:"source"` // "web" or "sso"
 	CreatedAt  time.Time `json:"created_at"`
 	LastActive time.Time `json:"last_active"`
-	ExpiresAt  time.Time `json:"expires_at"`
+	ExpiresAt  time.Time `json:"expires_at"` // 刷新令牌到期时间，为空表示升级前登录的旧设备
+
+	// 刷新令牌链：每台设备一个族，每次刷新轮换令牌并递增代数
+	RefreshFamily     string `json:"refresh_family,omitempty"`
+	RefreshTokenHash  string `json:"refresh_token_hash,omitempty"`
+	RefreshGeneration int    `json:"refresh_generation,omitempty"`
+	RefreshToken      string `json:"-"` // 仅在签发时返回给客户端，不落库
+
+	// SSO设备记录创建它的客户端及授予的权限，令牌有效期按客户端配置
+	ClientID   string `json:"client_id,omitempty"`
+	Scope      string `json:"scope,omitempty"`
+	AccessTTL  int64  `json:"access_ttl,omitempty"`  // 访问令牌有效期（秒），0表示使用全局配置
+	RefreshTTL int64  `json:"refresh_ttl,omitempty"` // 刷新令牌有效期（秒），0表示使用全局配置
+}
+
+// DeviceTokenOptions 注册设备时的可选参数，SSO客户端按自身配置签发令牌
+type DeviceTokenOptions struct {
+	ClientID   string
+	Scope      string
+	AccessTTL  time.Duration
+	RefreshTTL time.Duration
+}
+
+// AccessTokenTTL 设备的访问令牌有效期
+func (d *DeviceInfo) AccessTokenTTL() time.Duration {
+	if d.AccessTTL > 0 {
+		return time.Duration(d.AccessTTL) * time.Second
+	}
+	return AccessTokenTTL()
+}
+
+// RefreshTokenTTL 设备的刷新令牌有效期
+func (d *DeviceInfo) RefreshTokenTTL() time.Duration {
+	if d.RefreshTTL > 0 {
+		return time.Duration(d.RefreshTTL) * time.Second
+	}
+	return RefreshTokenTTL()
+}
+
+// ExpiresIn 访问令牌有效期（秒），随令牌一起返回给客户端
+func (d *DeviceInfo) ExpiresIn() int {
+	return int(d.AccessTokenTTL() / time.Second)
 }
 
 type DeviceManager struct {
@@ -231,6 +272,11 @@ func (dm *DeviceManager) formatCityName(city string) string {
 
 // 注册新设备
 func (dm *DeviceManager) RegisterDevice(userID uint, token string, ip string, userAgent string, source string) (*DeviceInfo, error) {
+	return dm.RegisterDeviceWithOptions(userID, token, ip, userAgent, source, DeviceTokenOptions{})
+}
+
+// RegisterDeviceWithOptions 注册新设备，SSO设备需标记创建它的客户端
+func (dm *DeviceManager) RegisterDeviceWithOptions(userID uint, token string, ip string, userAgent string, source string, options DeviceTokenOptions) (*DeviceInfo, error) {
 	ctx := context.Background()
 
 	deviceID := uuid.New().String()
@@ -250,7 +296,16 @@ func (dm *DeviceManager) RegisterDevice(userID uint, token string, ip string, us
 		Source:     source,
 		CreatedAt:  time.Now(),
 		LastActive: time.Now(),
-		ExpiresAt:  time.Time{}, // Token永不过期
+		ClientID:   options.ClientID,
+		Scope:      options.Scope,
+		AccessTTL:  int64(options.AccessTTL / time.Second),
+		RefreshTTL: int64(options.RefreshTTL / time.Second),
+	}
+
+	// 为设备签发刷新令牌，开启新的刷新令牌族
+	refreshToken, err := dm.issueRefreshToken(device, uuid.New().String(), 1)
+	if err != nil {
+		return nil, err
 	}
 
 	// 序列化设备信息
@@ -260,8 +315,8 @@ func (dm *DeviceManager) RegisterDevice(userID uint, token string, ip string, us
 	}
 
 	// 分别在不同的Redis DB中存储数据
-	// 1. 在DB 0中建立Token映射
-	err = dm.tokenRedis.Set(ctx, fmt.Sprintf("token:%s", tokenHash), deviceID, 0).Err() // 永不过期
+	// 1. 在DB 0中建立Token映射，与访问令牌同时过期
+	err = dm.tokenRedis.Set(ctx, fmt.Sprintf("token:%s", tokenHash), deviceID, device.AccessTokenTTL()).Err()
 	if err != nil {
 		return nil, err
 	}
@@ -278,6 +333,12 @@ func (dm *DeviceManager) RegisterDevice(userID uint, token string, ip string, us
 		return nil, err
 	}
 
+	// 4. 在DB 1中记录客户端创建的设备，停用客户端时统一下线
+	if device.ClientID != "" {
+		dm.userRedis.SAdd(ctx, fmt.Sprintf("client_devices:%s", device.ClientID), deviceID)
+	}
+
+	device.RefreshToken = refreshToken
 	return device, nil
 }
 
@@ -375,6 +436,9 @@ func (dm *DeviceManager) RevokeDevice(userID uint, deviceID string) error {
 	if err != nil {
 		return err
 	}
+	if device.ClientID != "" {
+		dm.userRedis.SRem(ctx, fmt.Sprintf("client_devices:%s", device.ClientID), deviceID)
+	}
 
 	// 2. 从DB 2删除设备信息
 	err = dm.deviceRedis.Del(ctx, fmt.Sprintf("device:%s", deviceID)).Err()
@@ -382,8 +446,14 @@ func (dm *DeviceManager) RevokeDevice(userID uint, deviceID string) error {
 		return err
 	}
 
-	// 3. 从DB 0删除Token映射
+	// 3. 从DB 0删除Token映射和刷新令牌
 	err = dm.tokenRedis.Del(ctx, fmt.Sprintf("token:%s", device.TokenHash)).Err()
+	if err != nil {
+		return err
+	}
+	if device.RefreshTokenHash != "" {
+		err = dm.tokenRedis.Del(ctx, fmt.Sprintf("refresh_token:%s", device.RefreshTokenHash)).Err()
+	}
 	return err
 }
 
@@ -400,8 +470,14 @@ func (dm *DeviceManager) RevokeAllUserDevices(userID uint) error {
 	for _, device := range devices {
 		// 从DB 2删除设备信息
 		dm.deviceRedis.Del(ctx, fmt.Sprintf("device:%s", device.ID))
-		// 从DB 0删除Token映射
+		// 从DB 0删除Token映射和刷新令牌
 		dm.tokenRedis.Del(ctx, fmt.Sprintf("token:%s", device.TokenHash))
+		if device.RefreshTokenHash != "" {
+			dm.tokenRedis.Del(ctx, fmt.Sprintf("refresh_token:%s", device.RefreshTokenHash))
+		}
+		if device.ClientID != "" {
+			dm.userRedis.SRem(ctx, fmt.Sprintf("client_devices:%s", device.ClientID), device.ID)
+		}
 	}
 
 	// 从DB 1删除用户设备集合
@@ -409,6 +485,34 @@ func (dm *DeviceManager) RevokeAllUserDevices(userID uint) error {
 	return err
 }
 
+// RevokeClientDevices 下线SSO客户端创建的所有设备，返回下线数量
+func (dm *DeviceManager) RevokeClientDevices(clientID string) (int, error) {
+	ctx := context.Background()
+	key := fmt.Sprintf("client_devices:%s", clientID)
+
+	deviceIDs, err := dm.userRedis.SMembers(ctx, key).Result()
+	if err != nil {
+		return 0, err
+	}
+
+	revoked := 0
+	for _, deviceID := range deviceIDs {
+		deviceData, err := dm.deviceRedis.Get(ctx, fmt.Sprintf("device:%s", deviceID)).Result()
+		if err != nil {
+			continue
+		}
+		var device DeviceInfo
+		if err := json.Unmarshal([]byte(deviceData), &device); err != nil {
+			continue
+		}
+		if err := dm.RevokeDevice(device.UserID, device.ID); err == nil {
+			revoked++
+		}
+	}
+
+	return revoked, dm.userRedis.Del(ctx, key).Err()
+}
+
 // 清理过期设备（可以设置定时任务调用）
 func (dm *DeviceManager) CleanupExpiredDevices() error {
 	ctx := context.Background()
@@ -426,11 +530,17 @@ func (dm *DeviceManager) CleanupExpiredDevices() error {
 			continue
 		}
 		
-		// 获取该用户的所有设备并清理过期的（GetUserDevices会自动清理过期设备）
-		_, err := dm.GetUserDevices(userID)
+		// 获取该用户的所有设备，刷新令牌已过期的设备无法再续期，直接下线
+		devices, err := dm.GetUserDevices(userID)
 		if err != nil {
 			continue
 		}
+		now := time.Now()
+		for _, device := range devices {
+			if !device.ExpiresAt.IsZero() && device.ExpiresAt.Before(now) {
+				dm.RevokeDevice(userID, device.ID)
+			}
+		}
 	}
 	
 	return nil
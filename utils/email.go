@@ -12,6 +12,7 @@ import (
 	"time"
 
 	"claude/config"
+	"claude/models"
 )
 
 type PlainAuthIgnoreTLS struct {
@@ -283,6 +284,44 @@ func SendSettingsVerificationEmail(to, code, emailType string) error {
         </div>
     </div>
 </body>
+</html>`, appName, appName, code, config.AppConfig.VerificationCodeExpireMinutes, appName)
+	case "transfer_points":
+		subject = appName + " 积分转账验证码"
+		body = fmt.Sprintf(`
+<!DOCTYPE html>
+<html>
+<head>
+    <meta charset="UTF-8">
+    <title>积分转账验证</title>
+</head>
+<body style="font-family: Arial, sans-serif; line-height: 1.6; color: #333;">
+    <div style="max-width: 600px; margin: 0 auto; padding: 20px; border: 1px solid #ddd;">
+        <div style="text-align: center; margin-bottom: 30px;">
+            <h1 style="color: #007bff;">%s</h1>
+            <h2 style="color: #666;">积分转账验证</h2>
+        </div>
+        
+        <div style="background-color: #f8f9fa; padding: 20px; border-radius: 5px; margin: 20px 0;">
+            <p>尊敬的用户，您好！</p>
+            <p>您正在%s发起一笔积分转账。为了保护您的账户安全，请使用以下验证码确认转账：</p>
+            
+            <div style="text-align: center; margin: 30px 0;">
+                <span style="font-size: 24px; font-weight: bold; color: #fd7e14; background-color: #fff3e0; padding: 10px 20px; border-radius: 5px; letter-spacing: 2px;">%s</span>
+            </div>
+            
+            <p style="color: #666; font-size: 14px;">
+                • 验证码有效期：%d分钟<br>
+                • 转账完成后无法撤回，请确认收款人信息<br>
+                • 如非本人操作，请立即修改密码并联系客服
+            </p>
+        </div>
+        
+        <div style="margin-top: 30px; padding-top: 20px; border-top: 1px solid #eee; text-align: center; color: #999; font-size: 12px;">
+            <p>此邮件由系统自动发送，请勿回复。</p>
+            <p>%s团队</p>
+        </div>
+    </div>
+</body>
 </html>`, appName, appName, code, config.AppConfig.VerificationCodeExpireMinutes, appName)
 	default:
 		return fmt.Errorf("unsupported email type: %s", emailType)
@@ -329,6 +368,80 @@ Content-Transfer-Encoding: 8bit
 	}
 }
 
+// SendOrganizationInvitationEmail 发送组织邀请邮件
+func SendOrganizationInvitationEmail(to, organizationName, inviterName, inviteURL string, expiresAt time.Time) error {
+	appName := config.AppConfig.AppName
+	subject := fmt.Sprintf("%s 邀请您加入组织「%s」", appName, organizationName)
+	body := fmt.Sprintf(`
+<!DOCTYPE html>
+<html>
+<head>
+    <meta charset="UTF-8">
+    <title>组织邀请</title>
+</head>
+<body style="font-family: Arial, sans-serif; line-height: 1.6; color: #333;">
+    <div style="max-width: 600px; margin: 0 auto; padding: 20px; border: 1px solid #ddd;">
+        <div style="text-align: center; margin-bottom: 30px;">
+            <h1 style="color: #007bff;">%s</h1>
+            <h2 style="color: #666;">组织邀请</h2>
+        </div>
+        
+        <div style="background-color: #f8f9fa; padding: 20px; border-radius: 5px; margin: 20px 0;">
+            <p>尊敬的用户，您好！</p>
+            <p>%s 邀请您加入%s上的组织「%s」，加入后您将共享该组织的积分钱包。</p>
+            
+            <div style="text-align: center; margin: 30px 0;">
+                <a href="%s" style="font-size: 16px; font-weight: bold; color: #fff; background-color: #007bff; padding: 10px 20px; border-radius: 5px; text-decoration: none;">接受邀请</a>
+            </div>
+            
+            <p style="color: #666; font-size: 14px;">
+                • 邀请有效期至：%s<br>
+                • 请使用本邮箱对应的账号登录后接受邀请<br>
+                • 如非预期邀请，请忽略此邮件
+            </p>
+        </div>
+        
+        <div style="margin-top: 30px; padding-top: 20px; border-top: 1px solid #eee; text-align: center; color: #999; font-size: 12px;">
+            <p>此邮件由系统自动发送，请勿回复。</p>
+            <p>%s团队</p>
+        </div>
+    </div>
+</body>
+</html>`, appName, inviterName, appName, organizationName, inviteURL, expiresAt.Format("2006-01-02 15:04"), appName)
+
+	return sendHTMLEmail(to, subject, body)
+}
+
+// sendHTMLEmail 发送HTML邮件，根据端口和配置选择连接方式
+func sendHTMLEmail(to, subject, body string) error {
+	from := config.AppConfig.SMTPFrom
+	password := config.AppConfig.SMTPPassword
+	host := config.AppConfig.SMTPHost
+	port := config.AppConfig.SMTPPort
+
+	msg := []byte(fmt.Sprintf(`From: %s
+To: %s
+Subject: %s
+MIME-Version: 1.0
+Content-Type: text/html; charset=UTF-8
+Content-Transfer-Encoding: 8bit
+
+%s`, from, to, subject, body))
+
+	if config.AppConfig.SMTPPlainAuthEnabled {
+		return sendMailWithPlainAuth(host, port, config.AppConfig.SMTPUser, password, from, []string{to}, msg)
+	}
+
+	switch port {
+	case "465":
+		return sendMailWithTLS(host, port, config.AppConfig.SMTPUser, password, from, []string{to}, msg)
+	case "587":
+		return sendMailWithSTARTTLS(host, port, config.AppConfig.SMTPUser, password, from, []string{to}, msg)
+	default:
+		return sendMailStandard(host, port, config.AppConfig.SMTPUser, password, from, []string{to}, msg)
+	}
+}
+
 // sendMailStandard 使用标准SMTP发送邮件（支持明文认证）
 func sendMailStandard(host, port, username, password, from string, to []string, msg []byte) error {
 	log.Printf("使用标准SMTP发送邮件到: %s:%s", host, port)
@@ -547,3 +660,137 @@ func sendMailWithTLS(host, port, username, password, from string, to []string, m
 	log.Printf("Email sent successfully via TLS to: %v", to)
 	return nil
 }
+
+// SendWalletExpiryEmail 发送钱包进入宽限期或已过期的通知邮件
+func SendWalletExpiryEmail(to string, record *models.WalletExpiryRecord) error {
+	appName := config.AppConfig.AppName
+
+	var subject, title, message string
+	if record.Event == "grace" && record.GraceEndsAt != nil {
+		subject = appName + " 钱包已到期，进入宽限期"
+		title = "钱包已到期"
+		message = fmt.Sprintf("您的钱包已于 %s 到期，目前处于宽限期，剩余 %d 积分暂时无法使用。请在 %s 前兑换或购买套餐，以恢复剩余积分。",
+			record.WalletExpiresAt.Format("2006-01-02 15:04"), record.AvailablePoints, record.GraceEndsAt.Format("2006-01-02 15:04"))
+	} else {
+		subject = appName + " 钱包已过期"
+		title = "钱包已过期"
+		message = fmt.Sprintf("您的钱包已于 %s 到期，剩余 %d 积分已不可使用。兑换或购买套餐后即可继续使用服务。",
+			record.WalletExpiresAt.Format("2006-01-02 15:04"), record.AvailablePoints)
+	}
+
+	body := fmt.Sprintf(`
+<!DOCTYPE html>
+<html>
+<head>
+    <meta charset="UTF-8">
+    <title>%s</title>
+</head>
+<body style="font-family: Arial, sans-serif; line-height: 1.6; color: #333;">
+    <div style="max-width: 600px; margin: 0 auto; padding: 20px; border: 1px solid #ddd;">
+        <div style="text-align: center; margin-bottom: 30px;">
+            <h1 style="color: #007bff;">%s</h1>
+            <h2 style="color: #666;">%s</h2>
+        </div>
+        
+        <div style="background-color: #f8f9fa; padding: 20px; border-radius: 5px; margin: 20px 0;">
+            <p>尊敬的用户，您好！</p>
+            <p>%s</p>
+            
+            <div style="text-align: center; margin: 30px 0;">
+                <a href="%s" style="font-size: 16px; font-weight: bold; color: #fff; background-color: #007bff; padding: 10px 20px; border-radius: 5px; text-decoration: none;">查看我的钱包</a>
+            </div>
+        </div>
+        
+        <div style="margin-top: 30px; padding-top: 20px; border-top: 1px solid #eee; text-align: center; color: #999; font-size: 12px;">
+            <p>此邮件由系统自动发送，请勿回复。</p>
+            <p>%s团队</p>
+        </div>
+    </div>
+</body>
+</html>`, title, appName, title, message, config.AppConfig.FrontendURL, appName)
+
+	return sendHTMLEmail(to, subject, body)
+}
+
+// SendPasswordResetEmail 发送找回密码邮件
+func SendPasswordResetEmail(to, resetURL string, expireMinutes int) error {
+	appName := config.AppConfig.AppName
+	subject := appName + " 重置密码"
+	body := fmt.Sprintf(`
+<!DOCTYPE html>
+<html>
+<head>
+    <meta charset="UTF-8">
+    <title>重置密码</title>
+</head>
+<body style="font-family: Arial, sans-serif; line-height: 1.6; color: #333;">
+    <div style="max-width: 600px; margin: 0 auto; padding: 20px; border: 1px solid #ddd;">
+        <div style="text-align: center; margin-bottom: 30px;">
+            <h1 style="color: #007bff;">%s</h1>
+            <h2 style="color: #666;">重置密码</h2>
+        </div>
+        
+        <div style="background-color: #f8f9fa; padding: 20px; border-radius: 5px; margin: 20px 0;">
+            <p>尊敬的用户，您好！</p>
+            <p>我们收到了重置您账户密码的请求，请点击下方按钮设置新密码。</p>
+            
+            <div style="text-align: center; margin: 30px 0;">
+                <a href="%s" style="font-size: 16px; font-weight: bold; color: #fff; background-color: #007bff; padding: 10px 20px; border-radius: 5px; text-decoration: none;">重置密码</a>
+            </div>
+            
+            <p style="color: #666; font-size: 14px;">
+                • 链接有效期为 %d 分钟，且只能使用一次<br>
+                • 重置成功后所有已登录设备将被强制下线<br>
+                • 如非本人操作，请忽略此邮件，您的密码不会被修改
+            </p>
+        </div>
+        
+        <div style="margin-top: 30px; padding-top: 20px; border-top: 1px solid #eee; text-align: center; color: #999; font-size: 12px;">
+            <p>此邮件由系统自动发送，请勿回复。</p>
+            <p>%s团队</p>
+        </div>
+    </div>
+</body>
+</html>`, appName, resetURL, expireMinutes, appName)
+
+	return sendHTMLEmail(to, subject, body)
+}
+
+// SendPasswordChangedEmail 发送密码已重置的确认邮件
+func SendPasswordChangedEmail(to, ip string, changedAt time.Time) error {
+	appName := config.AppConfig.AppName
+	subject := appName + " 密码已重置"
+	body := fmt.Sprintf(`
+<!DOCTYPE html>
+<html>
+<head>
+    <meta charset="UTF-8">
+    <title>密码已重置</title>
+</head>
+<body style="font-family: Arial, sans-serif; line-height: 1.6; color: #333;">
+    <div style="max-width: 600px; margin: 0 auto; padding: 20px; border: 1px solid #ddd;">
+        <div style="text-align: center; margin-bottom: 30px;">
+            <h1 style="color: #007bff;">%s</h1>
+            <h2 style="color: #666;">密码已重置</h2>
+        </div>
+        
+        <div style="background-color: #f8f9fa; padding: 20px; border-radius: 5px; margin: 20px 0;">
+            <p>尊敬的用户，您好！</p>
+            <p>您的账户密码已于 %s 重置成功，所有已登录设备均已下线，请使用新密码重新登录。</p>
+            
+            <p style="color: #666; font-size: 14px;">
+                • 操作IP：%s<br>
+                • 如非本人操作，请立即通过找回密码重新设置密码并联系管理员
+            </p>
+        </div>
+        
+        <div style="margin-top: 30px; padding-top: 20px; border-top: 1px solid #eee; text-align: center; color: #999; font-size: 12px;">
+            <p>此邮件由系统自动发送，请勿回复。</p>
+            <p>%s团队</p>
+        </div>
+    </div>
+</body>
+</html>`, appName, changedAt.Format("2006-01-02 15:04"), ip, appName)
+
+	return sendHTMLEmail(to, subject, body)
+}
@@ -12,6 +12,7 @@ import (
 	"claude/models"
 
 	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
 )
 
 // CardUsageDetail 卡密使用详情
@@ -217,8 +218,20 @@ func BanActivationCode(userID uint, activationCode string, reason string, adminU
 			}
 		}
 
+		var expiryRecord *models.WalletExpiryRecord
 		if !hasRemainingCards {
-			// 没有剩余有效卡密，清空钱包积分并设为过期状态
+			// 没有剩余有效卡密，清空钱包积分并设为过期状态，作废的积分记为过期以便对账
+			if wallet.AvailablePoints > 0 && wallet.Status != "expired" {
+				expiryRecord = &models.WalletExpiryRecord{
+					UserID:          userID,
+					Event:           "expired",
+					PreviousStatus:  wallet.Status,
+					AvailablePoints: wallet.AvailablePoints,
+					TotalPoints:     wallet.TotalPoints,
+					UsedPoints:      wallet.UsedPoints,
+					WalletExpiresAt: wallet.WalletExpiresAt,
+				}
+			}
 			wallet.AvailablePoints = 0
 			wallet.TotalPoints = 0
 			wallet.UsedPoints = 0
@@ -254,58 +267,73 @@ func BanActivationCode(userID uint, activationCode string, reason string, adminU
 			return fmt.Errorf("创建冻结记录失败: %w", err)
 		}
 
+		if expiryRecord != nil {
+			if err := tx.Create(expiryRecord).Error; err != nil {
+				return fmt.Errorf("创建钱包过期记录失败: %w", err)
+			}
+		}
+
 		return nil
 	})
 }
 
 // UnbanActivationCode 解禁激活码
 func UnbanActivationCode(userID uint, activationCode string, adminUserID uint) error {
+	if _, err := GetOrCreateUserWallet(userID); err != nil {
+		return fmt.Errorf("获取用户钱包失败: %w", err)
+	}
+
 	return database.DB.Transaction(func(tx *gorm.DB) error {
-		// 1. 查找冻结记录
-		var frozenRecord models.FrozenPointsRecord
-		err := tx.Where("user_id = ? AND banned_activation_code = ? AND status = 'frozen'",
-			userID, activationCode).First(&frozenRecord).Error
-		if err != nil {
-			if errors.Is(err, gorm.ErrRecordNotFound) {
-				return errors.New("未找到该卡密的封禁记录")
-			}
-			return fmt.Errorf("查询冻结记录失败: %w", err)
-		}
+		return unbanActivationCodeTx(tx, userID, activationCode)
+	})
+}
 
-		// 2. 获取当前钱包状态
-		wallet, err := GetOrCreateUserWallet(userID)
-		if err != nil {
-			return fmt.Errorf("获取用户钱包失败: %w", err)
+// unbanActivationCodeTx 在事务中解禁激活码，钱包在事务内加锁读取，便于同一用户连续解禁多个卡密
+func unbanActivationCodeTx(tx *gorm.DB, userID uint, activationCode string) error {
+	// 1. 查找冻结记录
+	var frozenRecord models.FrozenPointsRecord
+	err := tx.Where("user_id = ? AND banned_activation_code = ? AND status = 'frozen'",
+		userID, activationCode).First(&frozenRecord).Error
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return errors.New("未找到该卡密的封禁记录")
 		}
+		return fmt.Errorf("查询冻结记录失败: %w", err)
+	}
+
+	// 2. 获取当前钱包状态
+	wallet := &models.UserWallet{}
+	if err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).Where("user_id = ?", userID).First(wallet).Error; err != nil {
+		return fmt.Errorf("获取用户钱包失败: %w", err)
+	}
 
-		// 3. 恢复冻结的积分
-		wallet.AvailablePoints += frozenRecord.FrozenPoints
-		wallet.TotalPoints += frozenRecord.FrozenPoints
+	// 3. 恢复冻结的积分
+	wallet.AvailablePoints += frozenRecord.FrozenPoints
+	wallet.TotalPoints += frozenRecord.FrozenPoints
 
-		// 4. 重新计算包含该卡密的权益
-		newBenefits, err := recalculateBenefitsWithUnbannedCard(userID, activationCode, tx)
-		if err != nil {
-			return fmt.Errorf("重新计算权益失败: %w", err)
-		}
+	// 4. 重新计算包含该卡密的权益
+	newBenefits, err := recalculateBenefitsWithUnbannedCard(userID, activationCode, tx)
+	if err != nil {
+		return fmt.Errorf("重新计算权益失败: %w", err)
+	}
 
-		// 5. 更新钱包权益
-		updateWalletBenefits(wallet, newBenefits)
+	// 5. 更新钱包权益
+	updateWalletBenefits(wallet, newBenefits)
 
-		// 6. 更新冻结记录状态
-		frozenRecord.Status = "restored"
-		frozenRecord.UpdatedAt = time.Now()
+	// 6. 更新冻结记录状态
+	frozenRecord.Status = "restored"
+	frozenRecord.UpdatedAt = time.Now()
 
-		// 7. 更新数据库
-		if err := tx.Save(wallet).Error; err != nil {
-			return fmt.Errorf("更新钱包失败: %w", err)
-		}
+	// 7. 更新数据库
+	if err := tx.Save(wallet).Error; err != nil {
+		return fmt.Errorf("更新钱包失败: %w", err)
+	}
 
-		if err := tx.Save(&frozenRecord).Error; err != nil {
-			return fmt.Errorf("更新冻结记录失败: %w", err)
-		}
+	if err := tx.Save(&frozenRecord).Error; err != nil {
+		return fmt.Errorf("更新冻结记录失败: %w", err)
+	}
 
-		return nil
-	})
+	return nil
 }
 
 // 辅助函数们...
@@ -357,11 +385,16 @@ func createBenefitsSnapshot(wallet *models.UserWallet) (string, error) {
 
 // calculateRemainingBenefits 计算剩余卡密的综合权益
 func calculateRemainingBenefits(userID uint, bannedCode string, allCards []CardUsageDetail, tx *gorm.DB) (map[string]interface{}, error) {
+	return calculateRemainingBenefitsExcluding(allCards, map[string]bool{bannedCode: true}, tx)
+}
+
+// calculateRemainingBenefitsExcluding 计算排除一组被封禁卡密后剩余卡密的综合权益
+func calculateRemainingBenefitsExcluding(allCards []CardUsageDetail, bannedCodes map[string]bool, tx *gorm.DB) (map[string]interface{}, error) {
 	remainingCards := make([]CardUsageDetail, 0)
 
 	// 找出所有还有剩余积分的卡密（除了被封禁的）
 	for _, card := range allCards {
-		if card.CardCode != bannedCode && card.RemainingPoints > 0 {
+		if !bannedCodes[card.CardCode] && card.RemainingPoints > 0 {
 			remainingCards = append(remainingCards, card)
 		}
 	}
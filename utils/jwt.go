@@ -1,14 +1,21 @@
 package utils
 
 import (
+	"errors"
 	"fmt"
 	"time"
 
 	"claude/config"
+	"claude/database"
+	"claude/models"
 
 	"github.com/golang-jwt/jwt/v5"
+	"github.com/google/uuid"
 )
 
+// ErrAccessTokenExpired 访问令牌已过期，客户端应使用刷新令牌换取新令牌
+var ErrAccessTokenExpired = errors.New("访问令牌已过期")
+
 // Claims JWT载荷结构
 type Claims struct {
 	UserID uint   `json:"user_id"`
@@ -16,15 +23,39 @@ type Claims struct {
 	jwt.RegisteredClaims
 }
 
-// GenerateAccessToken 生成访问令牌
+// AccessTokenTTL 访问令牌有效期
+func AccessTokenTTL() time.Duration {
+	hours := config.AppConfig.AccessTokenExpireHours
+	if hours <= 0 {
+		hours = 2
+	}
+	return time.Duration(hours) * time.Hour
+}
+
+// RefreshTokenTTL 刷新令牌有效期
+func RefreshTokenTTL() time.Duration {
+	days := config.AppConfig.RefreshTokenExpireDays
+	if days <= 0 {
+		days = 30
+	}
+	return time.Duration(days) * 24 * time.Hour
+}
+
+// GenerateAccessToken 生成访问令牌，过期后需使用刷新令牌换取新的访问令牌
 func GenerateAccessToken(userID uint, email string) (string, error) {
-	// 创建claims（不设置过期时间，永不过期）
+	return GenerateAccessTokenWithTTL(userID, email, AccessTokenTTL())
+}
+
+// GenerateAccessTokenWithTTL 按指定有效期生成访问令牌，用于按客户端配置有效期的SSO令牌
+func GenerateAccessTokenWithTTL(userID uint, email string, ttl time.Duration) (string, error) {
+	now := time.Now()
 	claims := &Claims{
 		UserID: userID,
 		Email:  email,
 		RegisteredClaims: jwt.RegisteredClaims{
-			// ExpiresAt: nil, // 不设置过期时间，永不过期
-			IssuedAt:  jwt.NewNumericDate(time.Now()),
+			ID:        uuid.New().String(), // 同一秒内签发的令牌也互不相同
+			IssuedAt:  jwt.NewNumericDate(now),
+			ExpiresAt: jwt.NewNumericDate(now.Add(ttl)),
 			Subject:   fmt.Sprintf("%d", userID),
 		},
 	}
@@ -52,6 +83,9 @@ func ValidateAccessToken(tokenString string) (*Claims, error) {
 		return []byte(config.AppConfig.JWTSecret), nil
 	})
 
+	if errors.Is(err, jwt.ErrTokenExpired) {
+		return nil, ErrAccessTokenExpired
+	}
 	if err != nil {
 		return nil, fmt.Errorf("failed to parse token: %w", err)
 	}
@@ -62,10 +96,19 @@ func ValidateAccessToken(tokenString string) (*Claims, error) {
 		return nil, fmt.Errorf("invalid token")
 	}
 
-	// 跳过过期检查，因为JWT设置为永不过期
-	// if claims.ExpiresAt.Before(time.Now()) {
-	//     return nil, fmt.Errorf("token expired")
-	// }
+	// 升级前签发的令牌没有过期时间，只在允许旧令牌时接受
+	if claims.ExpiresAt == nil && !legacyAccessTokensAllowed() {
+		return nil, fmt.Errorf("token has no expiration")
+	}
 
 	return claims, nil
-} 
\ No newline at end of file
+}
+
+// legacyAccessTokensAllowed 是否继续接受没有过期时间的旧访问令牌
+func legacyAccessTokensAllowed() bool {
+	var setting models.SystemConfig
+	if err := database.DB.Where("config_key = ?", "legacy_access_tokens_allowed").First(&setting).Error; err != nil {
+		return true
+	}
+	return setting.ConfigValue == "true"
+}
@@ -0,0 +1,331 @@
+package utils
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"sort"
+	"strings"
+	"time"
+
+	"claude/database"
+
+	"github.com/go-redis/redis/v8"
+)
+
+// OAuth 登录流程的用途
+const (
+	OAuthModeLogin = "login" // 登录或注册
+	OAuthModeLink  = "link"  // 已登录用户绑定第三方账号
+)
+
+// OAuth state 有效期，超时后需重新发起授权
+const oauthStateTTL = 10 * time.Minute
+
+var (
+	ErrOAuthProviderNotFound      = errors.New("不支持的第三方登录方式")
+	ErrOAuthProviderNotConfigured = errors.New("该第三方登录服务未配置")
+	ErrOAuthStateInvalid          = errors.New("授权请求无效或已过期，请重新登录")
+)
+
+// OAuthToken 第三方令牌响应
+type OAuthToken struct {
+	AccessToken  string `json:"access_token"`
+	TokenType    string `json:"token_type"`
+	RefreshToken string `json:"refresh_token"`
+	ExpiresIn    int    `json:"expires_in"`
+	Scope        string `json:"scope"`
+}
+
+// OAuthProfile 第三方用户资料，各提供商统一转换为此结构
+type OAuthProfile struct {
+	ProviderUID    string `json:"id"`
+	Username       string `json:"username"`
+	Name           string `json:"name"`
+	Email          string `json:"email,omitempty"`
+	EmailVerified  bool   `json:"email_verified,omitempty"`
+	AvatarTemplate string `json:"avatar_template"` // 头像地址，Linux Do 为带 {size} 的模板
+
+	// Linux Do Connect 特有字段
+	Active      bool   `json:"active"`
+	TrustLevel  int    `json:"trust_level"`
+	Silenced    bool   `json:"silenced"`
+	ExternalIDs string `json:"-"`
+	APIKey      string `json:"-"`
+}
+
+// OAuthProvider 第三方登录提供商
+type OAuthProvider interface {
+	// Name 提供商标识，与 OAuthAccount.Provider 和注册套餐配置的键一致
+	Name() string
+	// DisplayName 展示名称
+	DisplayName() string
+	// Configured 是否已配置客户端凭据
+	Configured() bool
+	// CallbackPath 回调路径，需与在提供商处登记的回调地址一致
+	CallbackPath() string
+	// AuthorizeURL 构建授权地址，codeChallenge 为 PKCE S256 挑战值
+	AuthorizeURL(state, codeChallenge, redirectURI string) string
+	// ExchangeCode 使用授权码和 PKCE 校验值换取令牌
+	ExchangeCode(code, codeVerifier, redirectURI string) (*OAuthToken, error)
+	// FetchProfile 获取第三方用户资料
+	FetchProfile(token *OAuthToken) (*OAuthProfile, error)
+}
+
+var oauthProviders = map[string]OAuthProvider{}
+
+// RegisterOAuthProvider 注册第三方登录提供商
+func RegisterOAuthProvider(provider OAuthProvider) {
+	oauthProviders[provider.Name()] = provider
+}
+
+func init() {
+	RegisterOAuthProvider(&linuxDoProvider{})
+	RegisterOAuthProvider(&gitHubProvider{})
+	RegisterOAuthProvider(&googleProvider{})
+}
+
+// GetOAuthProvider 获取已配置的提供商
+func GetOAuthProvider(name string) (OAuthProvider, error) {
+	provider, ok := oauthProviders[name]
+	if !ok {
+		return nil, ErrOAuthProviderNotFound
+	}
+	if !provider.Configured() {
+		return nil, ErrOAuthProviderNotConfigured
+	}
+	return provider, nil
+}
+
+// ListOAuthProviders 列出所有提供商，按名称排序
+func ListOAuthProviders() []OAuthProvider {
+	providers := make([]OAuthProvider, 0, len(oauthProviders))
+	for _, provider := range oauthProviders {
+		providers = append(providers, provider)
+	}
+	sort.Slice(providers, func(i, j int) bool { return providers[i].Name() < providers[j].Name() })
+	return providers
+}
+
+// OAuthState 授权请求状态，保存在 Redis 中并在回调时一次性取出
+type OAuthState struct {
+	Provider     string    `json:"provider"`
+	Mode         string    `json:"mode"`
+	UserID       uint      `json:"user_id,omitempty"` // 绑定模式下发起绑定的用户
+	CodeVerifier string    `json:"code_verifier"`
+	RedirectURI  string    `json:"redirect_uri"`
+	CreatedAt    time.Time `json:"created_at"`
+}
+
+func oauthStateKey(state string) string { return "oauth_state:" + state }
+
+// OAuthStateCookieName 保存 state 摘要的 Cookie，将授权请求绑定到发起它的浏览器，防止登录CSRF
+const OAuthStateCookieName = "oauth_state"
+
+// OAuthStateCookieMaxAge Cookie 有效期（秒），与 state 有效期一致
+const OAuthStateCookieMaxAge = int(oauthStateTTL / time.Second)
+
+// OAuthStateHash 计算 state 的摘要，写入 Cookie 时不保存 state 原文
+func OAuthStateHash(state string) string {
+	sum := sha256.Sum256([]byte(state))
+	return hex.EncodeToString(sum[:])
+}
+
+// VerifyOAuthStateHash 校验回调中的 state 与浏览器 Cookie 中的摘要是否一致
+func VerifyOAuthStateHash(state, hash string) bool {
+	if state == "" || hash == "" {
+		return false
+	}
+	return subtle.ConstantTimeCompare([]byte(OAuthStateHash(state)), []byte(hash)) == 1
+}
+
+func randomOAuthString(size int) (string, error) {
+	buf := make([]byte, size)
+	if _, err := rand.Read(buf); err != nil {
+		return "", err
+	}
+	return base64.RawURLEncoding.EncodeToString(buf), nil
+}
+
+// pkceChallenge 计算 PKCE S256 挑战值
+func pkceChallenge(verifier string) string {
+	sum := sha256.Sum256([]byte(verifier))
+	return base64.RawURLEncoding.EncodeToString(sum[:])
+}
+
+// BeginOAuth 生成 state 和 PKCE 校验值并存入 Redis，返回授权地址和 state
+func BeginOAuth(provider OAuthProvider, mode string, userID uint, redirectURI string) (string, string, error) {
+	stateBytes := make([]byte, 16)
+	if _, err := rand.Read(stateBytes); err != nil {
+		return "", "", err
+	}
+	state := hex.EncodeToString(stateBytes)
+
+	verifier, err := randomOAuthString(32)
+	if err != nil {
+		return "", "", err
+	}
+
+	data, err := json.Marshal(OAuthState{
+		Provider:     provider.Name(),
+		Mode:         mode,
+		UserID:       userID,
+		CodeVerifier: verifier,
+		RedirectURI:  redirectURI,
+		CreatedAt:    time.Now(),
+	})
+	if err != nil {
+		return "", "", err
+	}
+	if err := database.TokenRedisClient.Set(context.Background(), oauthStateKey(state), data, oauthStateTTL).Err(); err != nil {
+		return "", "", err
+	}
+
+	return provider.AuthorizeURL(state, pkceChallenge(verifier), redirectURI), state, nil
+}
+
+// ConsumeOAuthState 取出并删除 state，state 只能使用一次且必须属于当前提供商
+func ConsumeOAuthState(providerName, state string) (*OAuthState, error) {
+	if state == "" {
+		return nil, ErrOAuthStateInvalid
+	}
+	ctx := context.Background()
+	key := oauthStateKey(state)
+
+	data, err := database.TokenRedisClient.Get(ctx, key).Result()
+	if err == redis.Nil {
+		return nil, ErrOAuthStateInvalid
+	} else if err != nil {
+		return nil, err
+	}
+	deleted, err := database.TokenRedisClient.Del(ctx, key).Result()
+	if err != nil {
+		return nil, err
+	}
+	if deleted == 0 {
+		return nil, ErrOAuthStateInvalid
+	}
+
+	var oauthState OAuthState
+	if err := json.Unmarshal([]byte(data), &oauthState); err != nil {
+		return nil, ErrOAuthStateInvalid
+	}
+	if oauthState.Provider != providerName {
+		return nil, ErrOAuthStateInvalid
+	}
+	return &oauthState, nil
+}
+
+// OAuth2 错误响应
+type oauthErrorResponse struct {
+	Error            string `json:"error"`
+	ErrorDescription string `json:"error_description"`
+}
+
+var oauthHTTPClient = &http.Client{Timeout: 30 * time.Second}
+
+// exchangeOAuthCode 以表单方式请求令牌端点
+func exchangeOAuthCode(tokenURL string, data url.Values) (*OAuthToken, error) {
+	req, err := http.NewRequest("POST", tokenURL, strings.NewReader(data.Encode()))
+	if err != nil {
+		return nil, fmt.Errorf("创建请求失败: %w", err)
+	}
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	req.Header.Set("Accept", "application/json")
+
+	resp, err := oauthHTTPClient.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("请求失败: %w", err)
+	}
+	defer resp.Body.Close()
+
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return nil, fmt.Errorf("读取响应失败: %w", err)
+	}
+
+	// GitHub 出错时也返回 200，需同时检查 error 字段
+	var errorResp oauthErrorResponse
+	if json.Unmarshal(body, &errorResp) == nil && errorResp.Error != "" {
+		return nil, fmt.Errorf("获取令牌失败: %s - %s", errorResp.Error, errorResp.ErrorDescription)
+	}
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("获取令牌失败，状态码: %d, 响应: %s", resp.StatusCode, string(body))
+	}
+
+	var token OAuthToken
+	if err := json.Unmarshal(body, &token); err != nil {
+		return nil, fmt.Errorf("解析令牌响应失败: %w", err)
+	}
+	if token.AccessToken == "" {
+		return nil, fmt.Errorf("令牌响应缺少access_token")
+	}
+	return &token, nil
+}
+
+// fetchOAuthJSON 携带访问令牌请求资料接口并解析 JSON
+func fetchOAuthJSON(apiURL, accessToken string, out interface{}) error {
+	req, err := http.NewRequest("GET", apiURL, nil)
+	if err != nil {
+		return fmt.Errorf("创建请求失败: %w", err)
+	}
+	req.Header.Set("Authorization", "Bearer "+accessToken)
+	req.Header.Set("Accept", "application/json")
+
+	resp, err := oauthHTTPClient.Do(req)
+	if err != nil {
+		return fmt.Errorf("请求失败: %w", err)
+	}
+	defer resp.Body.Close()
+
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return fmt.Errorf("读取响应失败: %w", err)
+	}
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("获取用户信息失败，状态码: %d, 响应: %s", resp.StatusCode, string(body))
+	}
+	if err := json.Unmarshal(body, out); err != nil {
+		return fmt.Errorf("解析用户信息失败: %w", err)
+	}
+	return nil
+}
+
+// buildOAuthAuthorizeURL 拼接授权地址的通用参数
+func buildOAuthAuthorizeURL(authorizeURL, clientID, redirectURI, scope, state, codeChallenge string, extra url.Values) string {
+	params := url.Values{}
+	params.Set("client_id", clientID)
+	params.Set("redirect_uri", redirectURI)
+	params.Set("response_type", "code")
+	params.Set("scope", scope)
+	params.Set("state", state)
+	params.Set("code_challenge", codeChallenge)
+	params.Set("code_challenge_method", "S256")
+	for key, values := range extra {
+		for _, value := range values {
+			params.Add(key, value)
+		}
+	}
+	return authorizeURL + "?" + params.Encode()
+}
+
+// oauthTokenForm 构建授权码换取令牌的表单
+func oauthTokenForm(clientID, clientSecret, code, codeVerifier, redirectURI string) url.Values {
+	data := url.Values{}
+	data.Set("client_id", clientID)
+	data.Set("client_secret", clientSecret)
+	data.Set("code", code)
+	data.Set("code_verifier", codeVerifier)
+	data.Set("redirect_uri", redirectURI)
+	data.Set("grant_type", "authorization_code")
+	return data
+}
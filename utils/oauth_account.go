@@ -0,0 +1,216 @@
+package utils
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"time"
+
+	"claude/database"
+	"claude/models"
+
+	"gorm.io/gorm"
+)
+
+var (
+	ErrOAuthAccountLinkedToOther = errors.New("该第三方账号已绑定其他用户")
+	ErrOAuthProviderAlreadyBound = errors.New("您已绑定该平台的其他账号，请先解绑")
+	ErrOAuthAccountNotFound      = errors.New("未绑定该第三方账号")
+	ErrOAuthLastLoginMethod      = errors.New("这是您唯一的登录方式，请先设置密码或绑定其他登录方式后再解绑")
+	ErrOAuthTempUserExpired      = errors.New("临时用户信息不存在或已过期")
+)
+
+// 临时用户信息有效期，第三方账号首次登录时需在此期间内完成注册
+const oauthTempUserTTL = 30 * time.Minute
+
+// TemporaryOAuthUser 首次使用第三方账号登录、尚未完成注册的用户信息
+type TemporaryOAuthUser struct {
+	Provider  string        `json:"provider"`
+	UserInfo  *OAuthProfile `json:"user_info"`
+	TokenResp *OAuthToken   `json:"token_resp"`
+	CreatedAt time.Time     `json:"created_at"`
+}
+
+func oauthTempUserKey(tempToken string) string { return "temp_oauth_user:" + tempToken }
+
+// StoreTemporaryOAuthUser 暂存第三方用户信息，返回临时令牌
+func StoreTemporaryOAuthUser(provider string, profile *OAuthProfile, token *OAuthToken) (string, error) {
+	tempToken, err := randomOAuthString(24)
+	if err != nil {
+		return "", err
+	}
+
+	jsonData, err := json.Marshal(TemporaryOAuthUser{
+		Provider:  provider,
+		UserInfo:  profile,
+		TokenResp: token,
+		CreatedAt: time.Now(),
+	})
+	if err != nil {
+		return "", fmt.Errorf("序列化临时用户信息失败: %w", err)
+	}
+
+	if err := database.TokenRedisClient.Set(context.Background(), oauthTempUserKey(tempToken), jsonData, oauthTempUserTTL).Err(); err != nil {
+		return "", fmt.Errorf("存储到Redis失败: %w", err)
+	}
+	return tempToken, nil
+}
+
+// GetTemporaryOAuthUser 读取暂存的第三方用户信息，provider 不为空时校验所属提供商
+func GetTemporaryOAuthUser(provider, tempToken string) (*TemporaryOAuthUser, error) {
+	jsonData, err := database.TokenRedisClient.Get(context.Background(), oauthTempUserKey(tempToken)).Result()
+	if err != nil {
+		return nil, ErrOAuthTempUserExpired
+	}
+
+	var tempUser TemporaryOAuthUser
+	if err := json.Unmarshal([]byte(jsonData), &tempUser); err != nil {
+		return nil, fmt.Errorf("解析用户信息失败: %w", err)
+	}
+	if provider != "" && tempUser.Provider != provider {
+		return nil, ErrOAuthTempUserExpired
+	}
+	return &tempUser, nil
+}
+
+// DeleteTemporaryOAuthUser 删除暂存的第三方用户信息
+func DeleteTemporaryOAuthUser(tempToken string) {
+	database.TokenRedisClient.Del(context.Background(), oauthTempUserKey(tempToken))
+}
+
+// FindOAuthAccount 查找已绑定的第三方账号
+func FindOAuthAccount(provider, providerUID string) (*models.OAuthAccount, error) {
+	var account models.OAuthAccount
+	if err := database.DB.Where("provider = ? AND provider_uid = ?", provider, providerUID).First(&account).Error; err != nil {
+		return nil, err
+	}
+	return &account, nil
+}
+
+// oauthTokenExpiry 计算第三方令牌过期时间
+func oauthTokenExpiry(token *OAuthToken) *time.Time {
+	if token == nil || token.ExpiresIn <= 0 {
+		return nil
+	}
+	expiry := time.Now().Add(time.Duration(token.ExpiresIn) * time.Second)
+	return &expiry
+}
+
+// CreateOAuthAccount 为用户创建第三方账号绑定
+func CreateOAuthAccount(tx *gorm.DB, user *models.User, provider string, profile *OAuthProfile, token *OAuthToken) error {
+	email := profile.Email
+	if email == "" {
+		email = user.Email // 第三方未返回邮箱时使用本地用户的邮箱
+	}
+	if token == nil {
+		token = &OAuthToken{}
+	}
+
+	now := time.Now()
+	account := models.OAuthAccount{
+		UserID:         user.ID,
+		Provider:       provider,
+		ProviderUID:    profile.ProviderUID,
+		Email:          email,
+		Username:       profile.Username,
+		Name:           profile.Name,
+		AvatarTemplate: profile.AvatarTemplate,
+		Active:         profile.Active,
+		TrustLevel:     profile.TrustLevel,
+		Silenced:       profile.Silenced,
+		ExternalIDs:    profile.ExternalIDs,
+		APIKey:         profile.APIKey,
+		AccessToken:    token.AccessToken,
+		RefreshToken:   token.RefreshToken,
+		TokenExpiry:    oauthTokenExpiry(token),
+		SyncEnabled:    true,
+		LastSyncAt:     &now,
+	}
+	return tx.Create(&account).Error
+}
+
+// UpdateOAuthAccount 每次登录时同步第三方资料和令牌
+func UpdateOAuthAccount(account *models.OAuthAccount, profile *OAuthProfile, token *OAuthToken) error {
+	now := time.Now()
+	updates := map[string]interface{}{
+		"username":        profile.Username,
+		"name":            profile.Name,
+		"avatar_template": profile.AvatarTemplate,
+		"active":          profile.Active,
+		"trust_level":     profile.TrustLevel,
+		"silenced":        profile.Silenced,
+		"external_ids":    profile.ExternalIDs,
+		"api_key":         profile.APIKey,
+		"access_token":    token.AccessToken,
+		"refresh_token":   token.RefreshToken,
+		"token_expiry":    oauthTokenExpiry(token),
+		"last_sync_at":    &now,
+		"updated_at":      now,
+	}
+	return database.DB.Model(account).Updates(updates).Error
+}
+
+// LinkOAuthAccount 已登录用户绑定第三方账号，每个平台只能绑定一个账号
+func LinkOAuthAccount(userID uint, provider string, profile *OAuthProfile, token *OAuthToken) error {
+	return database.DB.Transaction(func(tx *gorm.DB) error {
+		var user models.User
+		if err := tx.Where("id = ?", userID).First(&user).Error; err != nil {
+			return fmt.Errorf("用户不存在")
+		}
+
+		var existing models.OAuthAccount
+		err := tx.Where("provider = ? AND provider_uid = ?", provider, profile.ProviderUID).First(&existing).Error
+		if err == nil {
+			if existing.UserID != userID {
+				return ErrOAuthAccountLinkedToOther
+			}
+			// 重复绑定同一账号，只更新资料
+			return UpdateOAuthAccount(&existing, profile, token)
+		}
+
+		var count int64
+		tx.Model(&models.OAuthAccount{}).Where("user_id = ? AND provider = ?", userID, provider).Count(&count)
+		if count > 0 {
+			return ErrOAuthProviderAlreadyBound
+		}
+
+		return CreateOAuthAccount(tx, &user, provider, profile, token)
+	})
+}
+
+// UnlinkOAuthAccount 解绑第三方账号，不允许解绑用户唯一的登录方式
+func UnlinkOAuthAccount(userID uint, provider string) error {
+	return database.DB.Transaction(func(tx *gorm.DB) error {
+		var user models.User
+		if err := tx.Where("id = ?", userID).First(&user).Error; err != nil {
+			return fmt.Errorf("用户不存在")
+		}
+
+		var account models.OAuthAccount
+		if err := tx.Where("user_id = ? AND provider = ?", userID, provider).First(&account).Error; err != nil {
+			return ErrOAuthAccountNotFound
+		}
+
+		if user.Password == nil {
+			var otherAccounts, passkeys int64
+			tx.Model(&models.OAuthAccount{}).Where("user_id = ? AND id <> ?", userID, account.ID).Count(&otherAccounts)
+			tx.Model(&models.Passkey{}).Where("user_id = ?", userID).Count(&passkeys)
+			if otherAccounts == 0 && passkeys == 0 {
+				return ErrOAuthLastLoginMethod
+			}
+		}
+
+		// 硬删除，解绑后同一第三方账号可以重新绑定
+		return tx.Unscoped().Delete(&account).Error
+	})
+}
+
+// GetUserOAuthAccounts 获取用户已绑定的第三方账号
+func GetUserOAuthAccounts(userID uint) ([]models.OAuthAccount, error) {
+	accounts := []models.OAuthAccount{}
+	if err := database.DB.Where("user_id = ?", userID).Order("created_at ASC").Find(&accounts).Error; err != nil {
+		return nil, fmt.Errorf("获取绑定账号失败: %v", err)
+	}
+	return accounts, nil
+}
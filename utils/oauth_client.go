@@ -0,0 +1,437 @@
+package utils
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net"
+	"net/url"
+	"regexp"
+	"strings"
+	"time"
+
+	"claude/config"
+	"claude/database"
+	"claude/models"
+)
+
+// 未配置权限范围的客户端默认授予的权限
+const DefaultOAuthClientScopes = "profile email"
+
+// 客户端令牌有效期上限
+const (
+	maxOAuthClientAccessTTLMinutes = 7 * 24 * 60
+	maxOAuthClientRefreshTTLDays   = 365
+)
+
+var (
+	ErrOAuthClientInvalid      = errors.New("客户端不存在或凭据错误")
+	ErrOAuthClientDisabled     = errors.New("客户端已停用")
+	ErrOAuthRedirectNotAllowed = errors.New("回调地址未在客户端白名单中")
+	ErrOAuthScopeNotAllowed    = errors.New("请求的权限范围超出客户端允许范围")
+)
+
+var oauthScopePattern = regexp.MustCompile(`^[a-z][a-z0-9_:.-]{0,31}$`)
+
+// OAuthClientInput 创建或更新客户端的参数
+type OAuthClientInput struct {
+	Name                  string   `json:"name" binding:"required,max=100"`
+	Description           string   `json:"description" binding:"max=500"`
+	RedirectURIs          []string `json:"redirect_uris"`
+	Scopes                []string `json:"scopes"`
+	AccessTokenTTLMinutes int      `json:"access_token_ttl_minutes"` // 0表示使用全局配置
+	RefreshTokenTTLDays   int      `json:"refresh_token_ttl_days"`   // 0表示使用全局配置
+	Enabled               *bool    `json:"enabled"`
+}
+
+func hashClientSecret(secret string) string {
+	sum := sha256.Sum256([]byte(secret))
+	return hex.EncodeToString(sum[:])
+}
+
+func randomHex(size int) (string, error) {
+	buf := make([]byte, size)
+	if _, err := rand.Read(buf); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(buf), nil
+}
+
+// legacyOAuthClient 环境变量配置的客户端，管理后台注册同名客户端后不再使用
+func legacyOAuthClient() *models.OAuthClient {
+	redirectURIs, _ := json.Marshal(config.AppConfig.SSORedirectURIs)
+	return &models.OAuthClient{
+		ClientID:     config.AppConfig.ClientID,
+		Name:         config.AppConfig.AppName,
+		RedirectURIs: string(redirectURIs),
+		Scopes:       DefaultOAuthClientScopes,
+		Enabled:      true,
+	}
+}
+
+// GetOAuthClient 按 client_id 获取已启用的客户端，用于不携带密钥的授权请求
+func GetOAuthClient(clientID string) (*models.OAuthClient, error) {
+	if clientID == "" {
+		return nil, ErrOAuthClientInvalid
+	}
+
+	var client models.OAuthClient
+	if err := database.DB.Where("client_id = ?", clientID).First(&client).Error; err != nil {
+		if config.AppConfig.ClientID != "" && clientID == config.AppConfig.ClientID {
+			return legacyOAuthClient(), nil
+		}
+		return nil, ErrOAuthClientInvalid
+	}
+	if !client.Enabled {
+		return nil, ErrOAuthClientDisabled
+	}
+	return &client, nil
+}
+
+// AuthenticateOAuthClient 校验客户端凭据，轮换后的旧密钥在宽限期内仍然有效
+func AuthenticateOAuthClient(clientID, clientSecret string) (*models.OAuthClient, error) {
+	if clientID == "" || clientSecret == "" {
+		return nil, ErrOAuthClientInvalid
+	}
+
+	var client models.OAuthClient
+	if err := database.DB.Where("client_id = ?", clientID).First(&client).Error; err != nil {
+		if config.AppConfig.ClientID != "" && clientID == config.AppConfig.ClientID &&
+			subtle.ConstantTimeCompare([]byte(clientSecret), []byte(config.AppConfig.ClientSecret)) == 1 {
+			return legacyOAuthClient(), nil
+		}
+		return nil, ErrOAuthClientInvalid
+	}
+
+	secretHash := hashClientSecret(clientSecret)
+	matched := subtle.ConstantTimeCompare([]byte(secretHash), []byte(client.SecretHash)) == 1
+	if !matched && client.PreviousSecretHash != "" && client.PreviousSecretExpires != nil && time.Now().Before(*client.PreviousSecretExpires) {
+		matched = subtle.ConstantTimeCompare([]byte(secretHash), []byte(client.PreviousSecretHash)) == 1
+	}
+	if !matched {
+		return nil, ErrOAuthClientInvalid
+	}
+	if !client.Enabled {
+		return nil, ErrOAuthClientDisabled
+	}
+
+	now := time.Now()
+	database.DB.Model(&client).UpdateColumn("last_used_at", &now)
+	return &client, nil
+}
+
+// OAuthClientRedirectURIs 解析客户端的回调地址白名单
+func OAuthClientRedirectURIs(client *models.OAuthClient) []string {
+	uris := []string{}
+	if client.RedirectURIs != "" {
+		json.Unmarshal([]byte(client.RedirectURIs), &uris)
+	}
+	return uris
+}
+
+// OAuthClientScopes 客户端允许的权限范围
+func OAuthClientScopes(client *models.OAuthClient) []string {
+	scopes := strings.Fields(client.Scopes)
+	if len(scopes) == 0 {
+		scopes = strings.Fields(DefaultOAuthClientScopes)
+	}
+	return scopes
+}
+
+// isLoopbackHost 是否为本机地址
+func isLoopbackHost(host string) bool {
+	if host == "localhost" {
+		return true
+	}
+	ip := net.ParseIP(host)
+	return ip != nil && ip.IsLoopback()
+}
+
+// ValidateOAuthRedirectURI 校验回调地址是否在白名单中，要求精确匹配
+// 本机回调（http://localhost、127.0.0.1）按 RFC 8252 忽略端口，便于命令行工具使用随机端口
+func ValidateOAuthRedirectURI(client *models.OAuthClient, redirectURI string) error {
+	requested, err := url.Parse(redirectURI)
+	if err != nil || requested.Scheme == "" || requested.Fragment != "" {
+		return ErrOAuthRedirectNotAllowed
+	}
+
+	for _, allowed := range OAuthClientRedirectURIs(client) {
+		if allowed == redirectURI {
+			return nil
+		}
+		registered, err := url.Parse(allowed)
+		if err != nil || registered.Scheme != "http" || !isLoopbackHost(registered.Hostname()) {
+			continue
+		}
+		if requested.Scheme == registered.Scheme &&
+			requested.Hostname() == registered.Hostname() &&
+			requested.Path == registered.Path &&
+			requested.RawQuery == registered.RawQuery &&
+			requested.User == nil {
+			return nil
+		}
+	}
+	return ErrOAuthRedirectNotAllowed
+}
+
+// ResolveOAuthScopes 校验请求的权限范围，未指定时授予客户端允许的全部权限
+func ResolveOAuthScopes(client *models.OAuthClient, requested string) (string, error) {
+	allowed := OAuthClientScopes(client)
+	scopes := strings.Fields(requested)
+	if len(scopes) == 0 {
+		return strings.Join(allowed, " "), nil
+	}
+
+	allowedSet := make(map[string]bool, len(allowed))
+	for _, scope := range allowed {
+		allowedSet[scope] = true
+	}
+	granted := []string{}
+	seen := map[string]bool{}
+	for _, scope := range scopes {
+		if !allowedSet[scope] {
+			return "", ErrOAuthScopeNotAllowed
+		}
+		if !seen[scope] {
+			seen[scope] = true
+			granted = append(granted, scope)
+		}
+	}
+	return strings.Join(granted, " "), nil
+}
+
+// HasOAuthScope 授予的权限范围是否包含指定权限，升级前的设备没有记录权限时视为全部授予
+func HasOAuthScope(grantedScope, scope string) bool {
+	if grantedScope == "" {
+		return true
+	}
+	for _, granted := range strings.Fields(grantedScope) {
+		if granted == scope {
+			return true
+		}
+	}
+	return false
+}
+
+// OAuthClientTokenOptions 按客户端配置生成设备令牌参数
+func OAuthClientTokenOptions(client *models.OAuthClient, scope string) DeviceTokenOptions {
+	return DeviceTokenOptions{
+		ClientID:   client.ClientID,
+		Scope:      scope,
+		AccessTTL:  time.Duration(client.AccessTokenTTLMinutes) * time.Minute,
+		RefreshTTL: time.Duration(client.RefreshTokenTTLDays) * 24 * time.Hour,
+	}
+}
+
+// OAuthClientAccessTokenTTL 客户端的访问令牌有效期
+func OAuthClientAccessTokenTTL(client *models.OAuthClient) time.Duration {
+	if client.AccessTokenTTLMinutes > 0 {
+		return time.Duration(client.AccessTokenTTLMinutes) * time.Minute
+	}
+	return AccessTokenTTL()
+}
+
+// normalizeOAuthClientInput 校验并整理客户端参数
+func normalizeOAuthClientInput(input *OAuthClientInput) (string, string, error) {
+	input.Name = strings.TrimSpace(input.Name)
+	if input.Name == "" {
+		return "", "", fmt.Errorf("客户端名称不能为空")
+	}
+
+	redirectURIs := []string{}
+	for _, uri := range input.RedirectURIs {
+		uri = strings.TrimSpace(uri)
+		if uri == "" {
+			continue
+		}
+		parsed, err := url.Parse(uri)
+		if err != nil || parsed.Scheme == "" || parsed.Fragment != "" {
+			return "", "", fmt.Errorf("回调地址格式错误: %s", uri)
+		}
+		// 网页回调必须使用HTTPS，本机回调和自定义协议（原生应用）除外
+		if parsed.Scheme == "http" && !isLoopbackHost(parsed.Hostname()) {
+			return "", "", fmt.Errorf("回调地址必须使用HTTPS: %s", uri)
+		}
+		if (parsed.Scheme == "http" || parsed.Scheme == "https") && parsed.Host == "" {
+			return "", "", fmt.Errorf("回调地址格式错误: %s", uri)
+		}
+		redirectURIs = append(redirectURIs, uri)
+	}
+	if len(redirectURIs) == 0 {
+		return "", "", fmt.Errorf("至少需要一个回调地址")
+	}
+	redirectJSON, _ := json.Marshal(redirectURIs)
+
+	scopes := []string{}
+	seen := map[string]bool{}
+	for _, scope := range input.Scopes {
+		scope = strings.TrimSpace(scope)
+		if scope == "" || seen[scope] {
+			continue
+		}
+		if !oauthScopePattern.MatchString(scope) {
+			return "", "", fmt.Errorf("权限范围格式错误: %s", scope)
+		}
+		seen[scope] = true
+		scopes = append(scopes, scope)
+	}
+
+	if input.AccessTokenTTLMinutes < 0 || input.AccessTokenTTLMinutes > maxOAuthClientAccessTTLMinutes {
+		return "", "", fmt.Errorf("访问令牌有效期必须在0-%d分钟之间", maxOAuthClientAccessTTLMinutes)
+	}
+	if input.RefreshTokenTTLDays < 0 || input.RefreshTokenTTLDays > maxOAuthClientRefreshTTLDays {
+		return "", "", fmt.Errorf("刷新令牌有效期必须在0-%d天之间", maxOAuthClientRefreshTTLDays)
+	}
+
+	return string(redirectJSON), strings.Join(scopes, " "), nil
+}
+
+// CreateOAuthClient 创建客户端，返回仅展示一次的明文密钥
+func CreateOAuthClient(input *OAuthClientInput, adminID uint) (*models.OAuthClient, string, error) {
+	redirectURIs, scopes, err := normalizeOAuthClientInput(input)
+	if err != nil {
+		return nil, "", err
+	}
+
+	idPart, err := randomHex(12)
+	if err != nil {
+		return nil, "", err
+	}
+	secretPart, err := randomHex(32)
+	if err != nil {
+		return nil, "", err
+	}
+	secret := "cs_" + secretPart
+
+	client := models.OAuthClient{
+		ClientID:              "cli_" + idPart,
+		Name:                  input.Name,
+		Description:           input.Description,
+		SecretHash:            hashClientSecret(secret),
+		SecretPrefix:          secret[:10],
+		RedirectURIs:          redirectURIs,
+		Scopes:                scopes,
+		AccessTokenTTLMinutes: input.AccessTokenTTLMinutes,
+		RefreshTokenTTLDays:   input.RefreshTokenTTLDays,
+		Enabled:               input.Enabled == nil || *input.Enabled,
+		CreatedBy:             adminID,
+	}
+	if err := database.DB.Create(&client).Error; err != nil {
+		return nil, "", fmt.Errorf("创建客户端失败: %v", err)
+	}
+
+	log.Printf("创建SSO客户端: client_id=%s, name=%s, admin_id=%d", client.ClientID, client.Name, adminID)
+	return &client, secret, nil
+}
+
+// UpdateOAuthClient 更新客户端配置，停用时下线该客户端创建的所有设备
+func UpdateOAuthClient(id uint, input *OAuthClientInput) (*models.OAuthClient, error) {
+	var client models.OAuthClient
+	if err := database.DB.First(&client, id).Error; err != nil {
+		return nil, fmt.Errorf("客户端不存在")
+	}
+
+	redirectURIs, scopes, err := normalizeOAuthClientInput(input)
+	if err != nil {
+		return nil, err
+	}
+
+	wasEnabled := client.Enabled
+	updates := map[string]interface{}{
+		"name":                     input.Name,
+		"description":              input.Description,
+		"redirect_uris":            redirectURIs,
+		"scopes":                   scopes,
+		"access_token_ttl_minutes": input.AccessTokenTTLMinutes,
+		"refresh_token_ttl_days":   input.RefreshTokenTTLDays,
+	}
+	if input.Enabled != nil {
+		updates["enabled"] = *input.Enabled
+	}
+	if err := database.DB.Model(&client).Updates(updates).Error; err != nil {
+		return nil, fmt.Errorf("更新客户端失败: %v", err)
+	}
+
+	if wasEnabled && input.Enabled != nil && !*input.Enabled {
+		revokeOAuthClientDevices(client.ClientID)
+	}
+
+	database.DB.First(&client, id)
+	return &client, nil
+}
+
+// RotateOAuthClientSecret 轮换客户端密钥，旧密钥在宽限期内仍可使用，宽限期为0时立即失效
+func RotateOAuthClientSecret(id uint, graceHours int) (*models.OAuthClient, string, error) {
+	if graceHours < 0 || graceHours > 24*30 {
+		return nil, "", fmt.Errorf("宽限期必须在0-720小时之间")
+	}
+
+	var client models.OAuthClient
+	if err := database.DB.First(&client, id).Error; err != nil {
+		return nil, "", fmt.Errorf("客户端不存在")
+	}
+
+	secretPart, err := randomHex(32)
+	if err != nil {
+		return nil, "", err
+	}
+	secret := "cs_" + secretPart
+
+	now := time.Now()
+	updates := map[string]interface{}{
+		"secret_hash":             hashClientSecret(secret),
+		"secret_prefix":           secret[:10],
+		"previous_secret_hash":    "",
+		"previous_secret_expires": nil,
+		"secret_rotated_at":       &now,
+	}
+	if graceHours > 0 {
+		expires := now.Add(time.Duration(graceHours) * time.Hour)
+		updates["previous_secret_hash"] = client.SecretHash
+		updates["previous_secret_expires"] = &expires
+	}
+	if err := database.DB.Model(&client).Updates(updates).Error; err != nil {
+		return nil, "", fmt.Errorf("轮换密钥失败: %v", err)
+	}
+
+	log.Printf("轮换SSO客户端密钥: client_id=%s, grace_hours=%d", client.ClientID, graceHours)
+	return &client, secret, nil
+}
+
+// DeleteOAuthClient 删除客户端并下线其创建的所有设备
+func DeleteOAuthClient(id uint) error {
+	var client models.OAuthClient
+	if err := database.DB.First(&client, id).Error; err != nil {
+		return fmt.Errorf("客户端不存在")
+	}
+	if err := database.DB.Delete(&client).Error; err != nil {
+		return fmt.Errorf("删除客户端失败: %v", err)
+	}
+	revokeOAuthClientDevices(client.ClientID)
+	return nil
+}
+
+// revokeOAuthClientDevices 下线客户端创建的所有设备
+func revokeOAuthClientDevices(clientID string) {
+	deviceManager := NewDeviceManager(database.TokenRedisClient, database.UserRedisClient, database.DeviceRedisClient)
+	revoked, err := deviceManager.RevokeClientDevices(clientID)
+	if err != nil {
+		log.Printf("下线SSO客户端设备失败: client_id=%s, error=%v", clientID, err)
+		return
+	}
+	log.Printf("已下线SSO客户端设备: client_id=%s, count=%d", clientID, revoked)
+}
+
+// ListOAuthClients 获取所有客户端
+func ListOAuthClients() ([]models.OAuthClient, error) {
+	clients := []models.OAuthClient{}
+	if err := database.DB.Order("created_at DESC").Find(&clients).Error; err != nil {
+		return nil, fmt.Errorf("获取客户端列表失败: %v", err)
+	}
+	return clients, nil
+}
@@ -0,0 +1,196 @@
+package utils
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+
+	"claude/config"
+)
+
+// linuxDoProvider Linux Do Connect
+type linuxDoProvider struct{}
+
+// Linux Do用户信息结构
+type linuxDoUserInfo struct {
+	ID             uint   `json:"id"`
+	Username       string `json:"username"`
+	Name           string `json:"name"`
+	AvatarTemplate string `json:"avatar_template"`
+	Active         bool   `json:"active"`
+	TrustLevel     int    `json:"trust_level"`
+	Silenced       bool   `json:"silenced"`
+	ExternalIDs    any    `json:"external_ids"` // 可能是object或null
+	APIKey         string `json:"api_key"`
+}
+
+func (p *linuxDoProvider) Name() string         { return "linux_do" }
+func (p *linuxDoProvider) DisplayName() string  { return "Linux Do" }
+func (p *linuxDoProvider) CallbackPath() string { return "/oauth/linuxdo" }
+
+func (p *linuxDoProvider) Configured() bool {
+	return config.AppConfig.LinuxDoClientID != "" && config.AppConfig.LinuxDoClientSecret != ""
+}
+
+func (p *linuxDoProvider) AuthorizeURL(state, codeChallenge, redirectURI string) string {
+	return buildOAuthAuthorizeURL(config.AppConfig.LinuxDoBaseURL+"/oauth2/authorize",
+		config.AppConfig.LinuxDoClientID, redirectURI, "user", state, codeChallenge, nil)
+}
+
+func (p *linuxDoProvider) ExchangeCode(code, codeVerifier, redirectURI string) (*OAuthToken, error) {
+	return exchangeOAuthCode(config.AppConfig.LinuxDoBaseURL+"/oauth2/token",
+		oauthTokenForm(config.AppConfig.LinuxDoClientID, config.AppConfig.LinuxDoClientSecret, code, codeVerifier, redirectURI))
+}
+
+func (p *linuxDoProvider) FetchProfile(token *OAuthToken) (*OAuthProfile, error) {
+	var userInfo linuxDoUserInfo
+	if err := fetchOAuthJSON(config.AppConfig.LinuxDoBaseURL+"/api/user", token.AccessToken, &userInfo); err != nil {
+		return nil, err
+	}
+	if userInfo.ID == 0 {
+		return nil, fmt.Errorf("用户信息缺少ID")
+	}
+
+	// 将ExternalIDs转换为JSON字符串
+	externalIDsJSON := ""
+	if userInfo.ExternalIDs != nil {
+		if jsonBytes, err := json.Marshal(userInfo.ExternalIDs); err == nil {
+			externalIDsJSON = string(jsonBytes)
+		}
+	}
+
+	return &OAuthProfile{
+		ProviderUID:    fmt.Sprintf("%d", userInfo.ID),
+		Username:       userInfo.Username,
+		Name:           userInfo.Name,
+		AvatarTemplate: userInfo.AvatarTemplate,
+		Active:         userInfo.Active,
+		TrustLevel:     userInfo.TrustLevel,
+		Silenced:       userInfo.Silenced,
+		ExternalIDs:    externalIDsJSON,
+		APIKey:         userInfo.APIKey,
+	}, nil
+}
+
+// gitHubProvider GitHub OAuth App
+type gitHubProvider struct{}
+
+type gitHubUserInfo struct {
+	ID        int64  `json:"id"`
+	Login     string `json:"login"`
+	Name      string `json:"name"`
+	Email     string `json:"email"`
+	AvatarURL string `json:"avatar_url"`
+}
+
+type gitHubEmail struct {
+	Email    string `json:"email"`
+	Primary  bool   `json:"primary"`
+	Verified bool   `json:"verified"`
+}
+
+func (p *gitHubProvider) Name() string         { return "github" }
+func (p *gitHubProvider) DisplayName() string  { return "GitHub" }
+func (p *gitHubProvider) CallbackPath() string { return "/oauth/github" }
+
+func (p *gitHubProvider) Configured() bool {
+	return config.AppConfig.GitHubClientID != "" && config.AppConfig.GitHubClientSecret != ""
+}
+
+func (p *gitHubProvider) AuthorizeURL(state, codeChallenge, redirectURI string) string {
+	return buildOAuthAuthorizeURL("https://github.com/login/oauth/authorize",
+		config.AppConfig.GitHubClientID, redirectURI, "read:user user:email", state, codeChallenge, nil)
+}
+
+func (p *gitHubProvider) ExchangeCode(code, codeVerifier, redirectURI string) (*OAuthToken, error) {
+	return exchangeOAuthCode("https://github.com/login/oauth/access_token",
+		oauthTokenForm(config.AppConfig.GitHubClientID, config.AppConfig.GitHubClientSecret, code, codeVerifier, redirectURI))
+}
+
+func (p *gitHubProvider) FetchProfile(token *OAuthToken) (*OAuthProfile, error) {
+	var userInfo gitHubUserInfo
+	if err := fetchOAuthJSON("https://api.github.com/user", token.AccessToken, &userInfo); err != nil {
+		return nil, err
+	}
+	if userInfo.ID == 0 {
+		return nil, fmt.Errorf("用户信息缺少ID")
+	}
+
+	profile := &OAuthProfile{
+		ProviderUID:    fmt.Sprintf("%d", userInfo.ID),
+		Username:       userInfo.Login,
+		Name:           userInfo.Name,
+		Email:          userInfo.Email,
+		AvatarTemplate: userInfo.AvatarURL,
+		Active:         true,
+	}
+
+	// 公开资料中的邮箱可能为空或未验证，以邮箱接口返回的已验证主邮箱为准
+	var emails []gitHubEmail
+	if err := fetchOAuthJSON("https://api.github.com/user/emails", token.AccessToken, &emails); err == nil {
+		for _, email := range emails {
+			if email.Primary && email.Verified {
+				profile.Email = email.Email
+				profile.EmailVerified = true
+				break
+			}
+		}
+	}
+	return profile, nil
+}
+
+// googleProvider Google OpenID Connect
+type googleProvider struct{}
+
+type googleUserInfo struct {
+	Sub           string `json:"sub"`
+	Name          string `json:"name"`
+	Email         string `json:"email"`
+	EmailVerified bool   `json:"email_verified"`
+	Picture       string `json:"picture"`
+}
+
+func (p *googleProvider) Name() string         { return "google" }
+func (p *googleProvider) DisplayName() string  { return "Google" }
+func (p *googleProvider) CallbackPath() string { return "/oauth/google" }
+
+func (p *googleProvider) Configured() bool {
+	return config.AppConfig.GoogleClientID != "" && config.AppConfig.GoogleClientSecret != ""
+}
+
+func (p *googleProvider) AuthorizeURL(state, codeChallenge, redirectURI string) string {
+	return buildOAuthAuthorizeURL("https://accounts.google.com/o/oauth2/v2/auth",
+		config.AppConfig.GoogleClientID, redirectURI, "openid email profile", state, codeChallenge,
+		map[string][]string{"prompt": {"select_account"}})
+}
+
+func (p *googleProvider) ExchangeCode(code, codeVerifier, redirectURI string) (*OAuthToken, error) {
+	return exchangeOAuthCode("https://oauth2.googleapis.com/token",
+		oauthTokenForm(config.AppConfig.GoogleClientID, config.AppConfig.GoogleClientSecret, code, codeVerifier, redirectURI))
+}
+
+func (p *googleProvider) FetchProfile(token *OAuthToken) (*OAuthProfile, error) {
+	var userInfo googleUserInfo
+	if err := fetchOAuthJSON("https://openidconnect.googleapis.com/v1/userinfo", token.AccessToken, &userInfo); err != nil {
+		return nil, err
+	}
+	if userInfo.Sub == "" {
+		return nil, fmt.Errorf("用户信息缺少ID")
+	}
+
+	// Google 没有用户名，使用邮箱前缀作为默认用户名
+	username := userInfo.Email
+	if idx := strings.Index(username, "@"); idx > 0 {
+		username = username[:idx]
+	}
+
+	return &OAuthProfile{
+		ProviderUID:    userInfo.Sub,
+		Username:       username,
+		Name:           userInfo.Name,
+		Email:          userInfo.Email,
+		EmailVerified:  userInfo.EmailVerified,
+		AvatarTemplate: userInfo.Picture,
+		Active:         true,
+	}, nil
+}
@@ -0,0 +1,683 @@
+package utils
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"log"
+	"strconv"
+	"strings"
+	"time"
+
+	"claude/database"
+	"claude/models"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// OrganizationMemberUsage 组织成员用量统计
+type OrganizationMemberUsage struct {
+	UserID                   uint   `json:"user_id"`
+	Username                 string `json:"username"`
+	Email                    string `json:"email"`
+	Role                     string `json:"role"`
+	DailyMaxPoints           int64  `json:"daily_max_points"`
+	Requests                 int64  `json:"requests"`
+	FailedRequests           int64  `json:"failed_requests"`
+	InputTokens              int64  `json:"input_tokens"`
+	OutputTokens             int64  `json:"output_tokens"`
+	CacheCreationInputTokens int64  `json:"cache_creation_input_tokens"`
+	CacheReadInputTokens     int64  `json:"cache_read_input_tokens"`
+	PointsUsed               int64  `json:"points_used"`
+	TodayPointsUsed          int64  `json:"today_points_used"`
+}
+
+// IsValidOrganizationRole 检查组织角色是否合法
+func IsValidOrganizationRole(role string) bool {
+	return role == "owner" || role == "admin" || role == "member"
+}
+
+// getOrganizationIntConfig 读取组织相关的整数配置，配置不存在时使用默认值
+func getOrganizationIntConfig(key string, defaultValue int64) int64 {
+	var config models.SystemConfig
+	if err := database.DB.Where("config_key = ?", key).First(&config).Error; err != nil {
+		return defaultValue
+	}
+	value, err := strconv.ParseInt(config.ConfigValue, 10, 64)
+	if err != nil || value <= 0 {
+		return defaultValue
+	}
+	return value
+}
+
+// hashOrganizationInvitationToken 计算邀请令牌的SHA256摘要
+func hashOrganizationInvitationToken(token string) string {
+	hash := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(hash[:])
+}
+
+// CreateOrganization 创建组织，创建者成为所有者
+func CreateOrganization(ownerUserID uint, name string) (*models.Organization, error) {
+	var organization models.Organization
+
+	err := database.DB.Transaction(func(tx *gorm.DB) error {
+		// 一个用户同一时间只能属于一个组织
+		var count int64
+		if err := tx.Model(&models.OrganizationMember{}).Where("user_id = ?", ownerUserID).Count(&count).Error; err != nil {
+			return fmt.Errorf("查询组织成员失败: %w", err)
+		}
+		if count > 0 {
+			return fmt.Errorf("您已加入其他组织，请先退出后再创建")
+		}
+
+		organization = models.Organization{
+			Name:        name,
+			OwnerUserID: ownerUserID,
+			Status:      "active",
+		}
+		if err := tx.Create(&organization).Error; err != nil {
+			return fmt.Errorf("创建组织失败: %w", err)
+		}
+
+		wallet := models.OrganizationWallet{
+			OrganizationID:  organization.ID,
+			WalletExpiresAt: time.Now(),
+			Status:          "expired",
+		}
+		if err := tx.Create(&wallet).Error; err != nil {
+			return fmt.Errorf("创建组织钱包失败: %w", err)
+		}
+
+		member := models.OrganizationMember{
+			OrganizationID: organization.ID,
+			UserID:         ownerUserID,
+			Role:           "owner",
+		}
+		if err := tx.Create(&member).Error; err != nil {
+			return fmt.Errorf("创建组织成员失败: %w", err)
+		}
+
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return &organization, nil
+}
+
+// GetUserOrganizationMember 获取用户所属组织的成员信息，未加入组织时返回 gorm.ErrRecordNotFound
+func GetUserOrganizationMember(userID uint) (*models.OrganizationMember, error) {
+	var member models.OrganizationMember
+	err := database.DB.Preload("Organization").Where("user_id = ?", userID).First(&member).Error
+	if err != nil {
+		return nil, err
+	}
+	return &member, nil
+}
+
+// GetOrganizationMember 获取指定组织中的成员信息
+func GetOrganizationMember(organizationID, userID uint) (*models.OrganizationMember, error) {
+	var member models.OrganizationMember
+	err := database.DB.Preload("Organization").
+		Where("organization_id = ? AND user_id = ?", organizationID, userID).
+		First(&member).Error
+	if err != nil {
+		return nil, err
+	}
+	return &member, nil
+}
+
+// GetBillingOrganizationID 获取用户代理请求应计费的组织ID，未加入有效组织时返回nil
+func GetBillingOrganizationID(userID uint) *uint {
+	member, err := GetUserOrganizationMember(userID)
+	if err != nil || member.Organization.Status != "active" {
+		return nil
+	}
+	return &member.OrganizationID
+}
+
+// GetOrCreateOrganizationWallet 获取或创建组织钱包
+func GetOrCreateOrganizationWallet(organizationID uint) (*models.OrganizationWallet, error) {
+	var wallet models.OrganizationWallet
+	err := database.DB.Where("organization_id = ?", organizationID).First(&wallet).Error
+	if err == nil {
+		return &wallet, nil
+	}
+
+	if err != gorm.ErrRecordNotFound {
+		return nil, fmt.Errorf("查询组织钱包失败: %v", err)
+	}
+
+	wallet = models.OrganizationWallet{
+		OrganizationID:  organizationID,
+		WalletExpiresAt: time.Now(),
+		Status:          "expired",
+	}
+	if err := database.DB.Create(&wallet).Error; err != nil {
+		return nil, fmt.Errorf("创建组织钱包失败: %v", err)
+	}
+
+	return &wallet, nil
+}
+
+// IsOrganizationWalletActive 检查组织钱包是否有效
+func IsOrganizationWalletActive(organizationID uint) bool {
+	var wallet models.OrganizationWallet
+	if err := database.DB.Where("organization_id = ?", organizationID).First(&wallet).Error; err != nil {
+		return false
+	}
+
+	return wallet.Status == "active" &&
+		wallet.AvailablePoints > 0 &&
+		wallet.WalletExpiresAt.After(time.Now())
+}
+
+// GetOrganizationMemberTodayUsage 获取组织成员今日已使用积分
+func GetOrganizationMemberTodayUsage(organizationID, userID uint) int64 {
+	today := time.Now().Format("2006-01-02")
+	var usage models.OrganizationMemberDailyUsage
+	err := database.DB.Where("organization_id = ? AND user_id = ? AND usage_date = ?", organizationID, userID, today).
+		First(&usage).Error
+	if err != nil {
+		return 0
+	}
+	return usage.PointsUsed
+}
+
+// CheckOrganizationMemberDailyLimit 检查组织成员每日积分限制
+func CheckOrganizationMemberDailyLimit(member *models.OrganizationMember, pointsToUse int64) error {
+	// 没有设置每日限制
+	if member.DailyMaxPoints <= 0 {
+		return nil
+	}
+
+	usedToday := GetOrganizationMemberTodayUsage(member.OrganizationID, member.UserID)
+	remaining := member.DailyMaxPoints - usedToday
+	if remaining <= 0 || remaining < pointsToUse {
+		return fmt.Errorf("组织成员每日积分额度不足，今日剩余 %d 积分", max(remaining, 0))
+	}
+
+	return nil
+}
+
+// updateOrganizationMemberDailyUsage 更新组织成员每日使用记录（事务版本）
+func updateOrganizationMemberDailyUsage(tx *gorm.DB, organizationID, userID uint, pointsUsed int64) error {
+	if pointsUsed <= 0 {
+		return nil
+	}
+
+	today := time.Now().Format("2006-01-02")
+	var usage models.OrganizationMemberDailyUsage
+	err := tx.Where("organization_id = ? AND user_id = ? AND usage_date = ?", organizationID, userID, today).
+		First(&usage).Error
+
+	if err == gorm.ErrRecordNotFound {
+		usage = models.OrganizationMemberDailyUsage{
+			OrganizationID: organizationID,
+			UserID:         userID,
+			UsageDate:      today,
+			PointsUsed:     pointsUsed,
+		}
+		return tx.Create(&usage).Error
+	} else if err != nil {
+		return fmt.Errorf("查询组织成员每日使用记录失败: %v", err)
+	}
+
+	return tx.Model(&usage).Updates(map[string]interface{}{
+		"points_used": gorm.Expr("points_used + ?", pointsUsed),
+		"updated_at":  time.Now(),
+	}).Error
+}
+
+// AccumulateOrganizationTokensAndDeduct 累计组织tokens并在达到阈值时从组织钱包扣费，扣费计入成员每日用量，返回本次实际扣除的积分
+func AccumulateOrganizationTokensAndDeduct(organizationID, userID uint, weightedTokens int64) (int64, error) {
+	if weightedTokens <= 0 {
+		return 0, nil
+	}
+
+	threshold, pointsPerThreshold, err := GetTokenThresholdConfig()
+	if err != nil {
+		return 0, err
+	}
+
+	member, err := GetOrganizationMember(organizationID, userID)
+	if err != nil {
+		return 0, fmt.Errorf("获取组织成员信息失败: %v", err)
+	}
+
+	var deductedPoints int64
+	err = database.DB.Transaction(func(tx *gorm.DB) error {
+		// 组织钱包由多个成员并发使用，需要加行锁
+		var wallet models.OrganizationWallet
+		if err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).
+			Where("organization_id = ?", organizationID).First(&wallet).Error; err != nil {
+			return fmt.Errorf("获取组织钱包失败: %v", err)
+		}
+
+		newAccumulatedTokens := wallet.AccumulatedTokens + weightedTokens
+
+		// 未达到阈值，只累计tokens
+		if newAccumulatedTokens < threshold {
+			return tx.Model(&models.OrganizationWallet{}).
+				Where("organization_id = ?", organizationID).
+				Updates(map[string]interface{}{
+					"accumulated_tokens": newAccumulatedTokens,
+					"updated_at":         time.Now(),
+				}).Error
+		}
+
+		deductTimes := newAccumulatedTokens / threshold
+		totalPointsToDeduct := deductTimes * pointsPerThreshold
+
+		if wallet.AvailablePoints < totalPointsToDeduct {
+			return fmt.Errorf("组织积分余额不足，需要 %d 积分，可用 %d 积分", totalPointsToDeduct, wallet.AvailablePoints)
+		}
+
+		// 上游请求已经完成，跨过每日额度时照常扣费并记录超出部分，额度在下一次请求前检查
+		if member.DailyMaxPoints > 0 {
+			usedToday := GetOrganizationMemberTodayUsage(organizationID, userID)
+			if overage := usedToday + totalPointsToDeduct - member.DailyMaxPoints; overage > 0 {
+				log.Printf("组织成员超出每日额度: organization_id=%d, user_id=%d, daily_max=%d, overage=%d",
+					organizationID, userID, member.DailyMaxPoints, min(overage, totalPointsToDeduct))
+			}
+		}
+
+		err := tx.Model(&models.OrganizationWallet{}).
+			Where("organization_id = ?", organizationID).
+			Updates(map[string]interface{}{
+				"available_points":   gorm.Expr("available_points - ?", totalPointsToDeduct),
+				"used_points":        gorm.Expr("used_points + ?", totalPointsToDeduct),
+				"accumulated_tokens": newAccumulatedTokens % threshold,
+				"updated_at":         time.Now(),
+			}).Error
+		if err != nil {
+			return fmt.Errorf("扣除组织积分失败: %v", err)
+		}
+
+		deductedPoints = totalPointsToDeduct
+		return updateOrganizationMemberDailyUsage(tx, organizationID, userID, totalPointsToDeduct)
+	})
+	if err != nil {
+		return 0, err
+	}
+	return deductedPoints, nil
+}
+
+// CreateOrganizationInvitation 创建组织邀请，返回明文邀请令牌（仅用于发送邮件）
+func CreateOrganizationInvitation(organizationID, inviterID uint, email, role string) (*models.OrganizationInvitation, string, error) {
+	email = strings.ToLower(strings.TrimSpace(email))
+
+	if role != "admin" && role != "member" {
+		return nil, "", fmt.Errorf("邀请角色只能是 admin 或 member")
+	}
+
+	// 检查该邮箱是否已是组织成员
+	var existingUser models.User
+	if err := database.DB.Where("email = ?", email).First(&existingUser).Error; err == nil {
+		var count int64
+		database.DB.Model(&models.OrganizationMember{}).
+			Where("organization_id = ? AND user_id = ?", organizationID, existingUser.ID).
+			Count(&count)
+		if count > 0 {
+			return nil, "", fmt.Errorf("该用户已是组织成员")
+		}
+	}
+
+	// 检查成员数量上限
+	maxMembers := getOrganizationIntConfig("organization_max_members", 50)
+	var memberCount int64
+	database.DB.Model(&models.OrganizationMember{}).Where("organization_id = ?", organizationID).Count(&memberCount)
+	if memberCount >= maxMembers {
+		return nil, "", fmt.Errorf("组织成员数量已达上限 %d", maxMembers)
+	}
+
+	// 生成邀请令牌
+	tokenBytes := make([]byte, 32)
+	if _, err := rand.Read(tokenBytes); err != nil {
+		return nil, "", fmt.Errorf("生成邀请令牌失败: %v", err)
+	}
+	token := hex.EncodeToString(tokenBytes)
+
+	expireHours := getOrganizationIntConfig("organization_invitation_expire_hours", 72)
+	invitation := models.OrganizationInvitation{
+		OrganizationID: organizationID,
+		Email:          email,
+		Role:           role,
+		TokenHash:      hashOrganizationInvitationToken(token),
+		InvitedByID:    inviterID,
+		Status:         "pending",
+		ExpiresAt:      time.Now().Add(time.Duration(expireHours) * time.Hour),
+	}
+
+	err := database.DB.Transaction(func(tx *gorm.DB) error {
+		// 同一邮箱只保留最新的一条待处理邀请
+		if err := tx.Model(&models.OrganizationInvitation{}).
+			Where("organization_id = ? AND email = ? AND status = ?", organizationID, email, "pending").
+			Update("status", "revoked").Error; err != nil {
+			return fmt.Errorf("撤销旧邀请失败: %w", err)
+		}
+		if err := tx.Create(&invitation).Error; err != nil {
+			return fmt.Errorf("创建邀请失败: %w", err)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, "", err
+	}
+
+	return &invitation, token, nil
+}
+
+// AcceptOrganizationInvitation 接受组织邀请
+func AcceptOrganizationInvitation(userID uint, token string) (*models.OrganizationMember, error) {
+	var user models.User
+	if err := database.DB.Where("id = ?", userID).First(&user).Error; err != nil {
+		return nil, fmt.Errorf("获取用户信息失败")
+	}
+
+	var member models.OrganizationMember
+	err := database.DB.Transaction(func(tx *gorm.DB) error {
+		var invitation models.OrganizationInvitation
+		if err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).
+			Preload("Organization").
+			Where("token_hash = ?", hashOrganizationInvitationToken(token)).
+			First(&invitation).Error; err != nil {
+			return fmt.Errorf("邀请不存在或已失效")
+		}
+
+		if invitation.Status != "pending" || invitation.ExpiresAt.Before(time.Now()) {
+			return fmt.Errorf("邀请不存在或已失效")
+		}
+		if invitation.Organization.Status != "active" {
+			return fmt.Errorf("该组织已被停用")
+		}
+		if !strings.EqualFold(invitation.Email, user.Email) {
+			return fmt.Errorf("该邀请不是发送给当前账号的")
+		}
+
+		var count int64
+		if err := tx.Model(&models.OrganizationMember{}).Where("user_id = ?", userID).Count(&count).Error; err != nil {
+			return fmt.Errorf("查询组织成员失败: %w", err)
+		}
+		if count > 0 {
+			return fmt.Errorf("您已加入其他组织，请先退出后再接受邀请")
+		}
+
+		maxMembers := getOrganizationIntConfig("organization_max_members", 50)
+		if err := tx.Model(&models.OrganizationMember{}).
+			Where("organization_id = ?", invitation.OrganizationID).Count(&count).Error; err != nil {
+			return fmt.Errorf("查询组织成员失败: %w", err)
+		}
+		if count >= maxMembers {
+			return fmt.Errorf("组织成员数量已达上限 %d", maxMembers)
+		}
+
+		member = models.OrganizationMember{
+			OrganizationID: invitation.OrganizationID,
+			UserID:         userID,
+			Role:           invitation.Role,
+			InvitedByID:    &invitation.InvitedByID,
+		}
+		if err := tx.Create(&member).Error; err != nil {
+			return fmt.Errorf("加入组织失败: %w", err)
+		}
+
+		now := time.Now()
+		return tx.Model(&invitation).Updates(map[string]interface{}{
+			"status":              "accepted",
+			"accepted_at":         &now,
+			"accepted_by_user_id": userID,
+		}).Error
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return &member, nil
+}
+
+// UpdateOrganizationMember 更新组织成员角色或每日额度
+func UpdateOrganizationMember(organizationID, userID uint, role *string, dailyMaxPoints *int64) error {
+	member, err := GetOrganizationMember(organizationID, userID)
+	if err != nil {
+		return fmt.Errorf("组织成员不存在")
+	}
+
+	updates := map[string]interface{}{
+		"updated_at": time.Now(),
+	}
+
+	if role != nil {
+		if *role != "admin" && *role != "member" {
+			return fmt.Errorf("成员角色只能是 admin 或 member")
+		}
+		if member.Role == "owner" {
+			return fmt.Errorf("不能修改组织所有者的角色")
+		}
+		updates["role"] = *role
+	}
+
+	if dailyMaxPoints != nil {
+		if *dailyMaxPoints < 0 {
+			return fmt.Errorf("每日积分额度不能为负数")
+		}
+		updates["daily_max_points"] = *dailyMaxPoints
+	}
+
+	return database.DB.Model(&models.OrganizationMember{}).Where("id = ?", member.ID).Updates(updates).Error
+}
+
+// RemoveOrganizationMember 移除组织成员（所有者不可移除）
+func RemoveOrganizationMember(organizationID, userID uint) error {
+	member, err := GetOrganizationMember(organizationID, userID)
+	if err != nil {
+		return fmt.Errorf("组织成员不存在")
+	}
+	if member.Role == "owner" {
+		return fmt.Errorf("组织所有者不能被移除")
+	}
+
+	return database.DB.Delete(&models.OrganizationMember{}, member.ID).Error
+}
+
+// creditOrganizationWallet 为组织钱包充值并写入充值记录（事务版本）
+func creditOrganizationWallet(tx *gorm.DB, record *models.OrganizationCreditRecord) error {
+	var wallet models.OrganizationWallet
+	if err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).
+		Where("organization_id = ?", record.OrganizationID).First(&wallet).Error; err != nil {
+		return fmt.Errorf("获取组织钱包失败: %v", err)
+	}
+
+	expiresAt := time.Now().Add(time.Duration(record.ValidityDays) * 24 * time.Hour)
+	record.ExpiresAt = maxTime(wallet.WalletExpiresAt, expiresAt)
+
+	updates := map[string]interface{}{
+		"total_points":      gorm.Expr("total_points + ?", record.PointsAmount),
+		"available_points":  gorm.Expr("available_points + ?", record.PointsAmount),
+		"wallet_expires_at": record.ExpiresAt,
+		"status":            "active",
+		"updated_at":        time.Now(),
+	}
+	if err := tx.Model(&models.OrganizationWallet{}).
+		Where("organization_id = ?", record.OrganizationID).Updates(updates).Error; err != nil {
+		return fmt.Errorf("更新组织钱包失败: %v", err)
+	}
+
+	if err := tx.Create(record).Error; err != nil {
+		return fmt.Errorf("创建组织充值记录失败: %v", err)
+	}
+
+	return nil
+}
+
+// RedeemActivationCodeToOrganization 激活码兑换到组织钱包（积分累加，有效期取最大值）
+func RedeemActivationCodeToOrganization(organizationID, operatorUserID uint, activationCode *models.ActivationCode) error {
+	if _, err := GetOrCreateOrganizationWallet(organizationID); err != nil {
+		return err
+	}
+
+	return database.DB.Transaction(func(tx *gorm.DB) error {
+		var currentPlan models.SubscriptionPlan
+		if err := tx.Where("id = ?", activationCode.SubscriptionPlanID).First(&currentPlan).Error; err != nil {
+			return fmt.Errorf("获取订阅计划失败: %v", err)
+		}
+
+		// 锁定激活码并按操作人校验兑换限制，防止同一激活码被并发兑换
+		claimed, err := claimActivationCodeTx(tx, activationCode.ID, operatorUserID)
+		if err != nil {
+			return err
+		}
+
+		// 按激活码生成时的版本发放
+		plan, err := ResolvePlanVersion(tx, &currentPlan, claimed.PlanVersionID)
+		if err != nil {
+			return err
+		}
+		if err := CheckPlanAvailability(plan); err != nil {
+			return err
+		}
+		if err := consumePlanInventoryTx(tx, plan.ID, true); err != nil {
+			return err
+		}
+
+		record := models.OrganizationCreditRecord{
+			OrganizationID:     organizationID,
+			SourceType:         "activation_code",
+			SourceID:           activationCode.Code,
+			PointsAmount:       plan.PointAmount,
+			ValidityDays:       plan.ValidityDays,
+			SubscriptionPlanID: &plan.ID,
+			PlanVersionID:      plan.CurrentVersionID,
+			OperatorUserID:     operatorUserID,
+			Reason:             fmt.Sprintf("组织激活码兑换 - %s", plan.Title),
+		}
+		return creditOrganizationWallet(tx, &record)
+	})
+}
+
+// AdminGiftToOrganization 管理员赠送积分到组织钱包
+func AdminGiftToOrganization(adminUserID, organizationID uint, points int64, validityDays int, reason string) error {
+	if points <= 0 || validityDays <= 0 {
+		return fmt.Errorf("赠送积分和有效期必须大于0")
+	}
+
+	if _, err := GetOrCreateOrganizationWallet(organizationID); err != nil {
+		return err
+	}
+
+	return database.DB.Transaction(func(tx *gorm.DB) error {
+		record := models.OrganizationCreditRecord{
+			OrganizationID: organizationID,
+			SourceType:     "admin_gift",
+			SourceID:       fmt.Sprintf("admin_%d_%d", adminUserID, time.Now().Unix()),
+			PointsAmount:   points,
+			ValidityDays:   validityDays,
+			OperatorUserID: adminUserID,
+			Reason:         reason,
+		}
+		return creditOrganizationWallet(tx, &record)
+	})
+}
+
+// GetOrganizationUsageBreakdown 按成员统计组织用量，日期格式为 YYYY-MM-DD（包含首尾）
+func GetOrganizationUsageBreakdown(organizationID uint, dateFrom, dateTo string) ([]OrganizationMemberUsage, error) {
+	var members []models.OrganizationMember
+	if err := database.DB.Preload("User").Where("organization_id = ?", organizationID).
+		Order("created_at ASC").Find(&members).Error; err != nil {
+		return nil, fmt.Errorf("获取组织成员失败: %v", err)
+	}
+
+	// API请求统计（按成员分组）
+	type transactionStats struct {
+		UserID                   uint
+		Requests                 int64
+		FailedRequests           int64
+		InputTokens              int64
+		OutputTokens             int64
+		CacheCreationInputTokens int64
+		CacheReadInputTokens     int64
+	}
+	var txStats []transactionStats
+	err := database.DB.Model(&models.APITransaction{}).
+		Where("organization_id = ? AND created_at >= ? AND created_at <= ?", organizationID, dateFrom, dateTo+" 23:59:59").
+		Group("user_id").
+		Select(`user_id, COUNT(*) as requests,
+			SUM(CASE WHEN status = 'success' THEN 0 ELSE 1 END) as failed_requests,
+			SUM(input_tokens) as input_tokens, SUM(output_tokens) as output_tokens,
+			SUM(cache_creation_input_tokens) as cache_creation_input_tokens,
+			SUM(cache_read_input_tokens) as cache_read_input_tokens`).
+		Scan(&txStats).Error
+	if err != nil {
+		return nil, fmt.Errorf("统计组织请求失败: %v", err)
+	}
+
+	// 积分统计（按成员分组）
+	type pointsStats struct {
+		UserID     uint
+		PointsUsed int64
+	}
+	var ptStats []pointsStats
+	err = database.DB.Model(&models.OrganizationMemberDailyUsage{}).
+		Where("organization_id = ? AND usage_date >= ? AND usage_date <= ?", organizationID, dateFrom, dateTo).
+		Group("user_id").
+		Select("user_id, SUM(points_used) as points_used").
+		Scan(&ptStats).Error
+	if err != nil {
+		return nil, fmt.Errorf("统计组织积分失败: %v", err)
+	}
+
+	txMap := make(map[uint]transactionStats)
+	for _, s := range txStats {
+		txMap[s.UserID] = s
+	}
+	ptMap := make(map[uint]int64)
+	for _, s := range ptStats {
+		ptMap[s.UserID] = s.PointsUsed
+	}
+
+	result := make([]OrganizationMemberUsage, 0, len(members))
+	for _, member := range members {
+		s := txMap[member.UserID]
+		result = append(result, OrganizationMemberUsage{
+			UserID:                   member.UserID,
+			Username:                 member.User.Username,
+			Email:                    member.User.Email,
+			Role:                     member.Role,
+			DailyMaxPoints:           member.DailyMaxPoints,
+			Requests:                 s.Requests,
+			FailedRequests:           s.FailedRequests,
+			InputTokens:              s.InputTokens,
+			OutputTokens:             s.OutputTokens,
+			CacheCreationInputTokens: s.CacheCreationInputTokens,
+			CacheReadInputTokens:     s.CacheReadInputTokens,
+			PointsUsed:               ptMap[member.UserID],
+			TodayPointsUsed:          GetOrganizationMemberTodayUsage(organizationID, member.UserID),
+		})
+		delete(txMap, member.UserID)
+		delete(ptMap, member.UserID)
+	}
+
+	// 已退出组织的成员在统计区间内仍可能产生过用量
+	for userID, s := range txMap {
+		var user models.User
+		database.DB.Unscoped().Where("id = ?", userID).First(&user)
+		result = append(result, OrganizationMemberUsage{
+			UserID:                   userID,
+			Username:                 user.Username,
+			Email:                    user.Email,
+			Role:                     "removed",
+			Requests:                 s.Requests,
+			FailedRequests:           s.FailedRequests,
+			InputTokens:              s.InputTokens,
+			OutputTokens:             s.OutputTokens,
+			CacheCreationInputTokens: s.CacheCreationInputTokens,
+			CacheReadInputTokens:     s.CacheReadInputTokens,
+			PointsUsed:               ptMap[userID],
+		})
+	}
+
+	return result, nil
+}
@@ -0,0 +1,627 @@
+package utils
+
+import (
+	"bytes"
+	"context"
+	"crypto"
+	"crypto/ecdh"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/binary"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math/big"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"claude/config"
+	"claude/database"
+	"claude/models"
+)
+
+// 通行密钥相关限制
+const (
+	passkeyChallengeTTL    = 5 * time.Minute
+	passkeyTimeoutMs       = 300000
+	maxPasskeysPerUser     = 10
+	passkeyCredentialIDMax = 143 // Base64URL 编码后不超过 191 个字符
+)
+
+// COSE 算法和密钥类型
+const (
+	coseAlgES256 = -7
+	coseAlgEdDSA = -8
+	coseAlgRS256 = -257
+
+	coseKeyTypeOKP = 1
+	coseKeyTypeEC2 = 2
+	coseKeyTypeRSA = 3
+)
+
+// authenticatorData 标志位
+const (
+	authDataFlagUserPresent  = 0x01
+	authDataFlagUserVerified = 0x04
+	authDataFlagBackupElig   = 0x08
+	authDataFlagAttested     = 0x40
+)
+
+// ErrPasskeyVerification 通行密钥校验失败，不向客户端暴露具体原因
+var ErrPasskeyVerification = errors.New("通行密钥验证失败")
+
+// PasskeyCredentialResponse 浏览器 PublicKeyCredential.toJSON() 中的 response 字段
+type PasskeyCredentialResponse struct {
+	ClientDataJSON    string   `json:"clientDataJSON"`
+	AttestationObject string   `json:"attestationObject,omitempty"` // 注册时返回
+	Transports        []string `json:"transports,omitempty"`        // 注册时返回
+	AuthenticatorData string   `json:"authenticatorData,omitempty"` // 登录时返回
+	Signature         string   `json:"signature,omitempty"`         // 登录时返回
+	UserHandle        string   `json:"userHandle,omitempty"`        // 登录时返回
+}
+
+// PasskeyCredential 浏览器 PublicKeyCredential.toJSON() 的结果，二进制字段均为 Base64URL
+type PasskeyCredential struct {
+	ID       string                    `json:"id"`
+	RawID    string                    `json:"rawId"`
+	Type     string                    `json:"type"`
+	Response PasskeyCredentialResponse `json:"response"`
+}
+
+// PasskeyCredentialDescriptor 凭据描述
+type PasskeyCredentialDescriptor struct {
+	Type       string   `json:"type"`
+	ID         string   `json:"id"`
+	Transports []string `json:"transports,omitempty"`
+}
+
+// PasskeyCreationOptions 注册选项，对应 PublicKeyCredentialCreationOptionsJSON
+type PasskeyCreationOptions struct {
+	Challenge string `json:"challenge"`
+	RP        struct {
+		ID   string `json:"id"`
+		Name string `json:"name"`
+	} `json:"rp"`
+	User struct {
+		ID          string `json:"id"`
+		Name        string `json:"name"`
+		DisplayName string `json:"displayName"`
+	} `json:"user"`
+	PubKeyCredParams []struct {
+		Type string `json:"type"`
+		Alg  int    `json:"alg"`
+	} `json:"pubKeyCredParams"`
+	Timeout                int                           `json:"timeout"`
+	Attestation            string                        `json:"attestation"`
+	ExcludeCredentials     []PasskeyCredentialDescriptor `json:"excludeCredentials"`
+	AuthenticatorSelection struct {
+		ResidentKey      string `json:"residentKey"`
+		RequireResident  bool   `json:"requireResidentKey"`
+		UserVerification string `json:"userVerification"`
+	} `json:"authenticatorSelection"`
+}
+
+// PasskeyRequestOptions 登录选项，对应 PublicKeyCredentialRequestOptionsJSON
+// 使用可发现凭据登录，allowCredentials 为空，由认证器列出可用的通行密钥
+type PasskeyRequestOptions struct {
+	Challenge        string                        `json:"challenge"`
+	RPID             string                        `json:"rpId"`
+	Timeout          int                           `json:"timeout"`
+	UserVerification string                        `json:"userVerification"`
+	AllowCredentials []PasskeyCredentialDescriptor `json:"allowCredentials"`
+}
+
+// passkeyClientData clientDataJSON 中参与校验的字段
+type passkeyClientData struct {
+	Type      string `json:"type"`
+	Challenge string `json:"challenge"`
+	Origin    string `json:"origin"`
+}
+
+// passkeyAuthData 解析后的 authenticatorData
+type passkeyAuthData struct {
+	RPIDHash     []byte
+	Flags        byte
+	SignCount    uint32
+	AAGUID       []byte
+	CredentialID []byte
+	PublicKey    []byte // COSE格式公钥原始字节
+}
+
+// decodeBase64URL 解码 Base64URL，兼容带填充的输入
+func decodeBase64URL(value string) ([]byte, error) {
+	return base64.RawURLEncoding.DecodeString(strings.TrimRight(value, "="))
+}
+
+// passkeyRPID 依赖方ID，默认为前端域名
+func passkeyRPID() string {
+	if config.AppConfig.WebAuthnRPID != "" {
+		return config.AppConfig.WebAuthnRPID
+	}
+	if parsed, err := url.Parse(config.AppConfig.FrontendURL); err == nil {
+		return parsed.Hostname()
+	}
+	return ""
+}
+
+// passkeyOrigins 允许发起通行密钥操作的来源，默认为前端地址
+func passkeyOrigins() []string {
+	origins := []string{}
+	for _, origin := range config.AppConfig.WebAuthnOrigins {
+		if origin = strings.TrimRight(strings.TrimSpace(origin), "/"); origin != "" {
+			origins = append(origins, origin)
+		}
+	}
+	if len(origins) == 0 {
+		if parsed, err := url.Parse(config.AppConfig.FrontendURL); err == nil {
+			origins = append(origins, parsed.Scheme+"://"+parsed.Host)
+		}
+	}
+	return origins
+}
+
+// passkeyUserHandle 用户句柄，登录时认证器原样返回，用于核对凭据所属用户
+func passkeyUserHandle(userID uint) []byte {
+	return []byte(strconv.FormatUint(uint64(userID), 10))
+}
+
+// newPasskeyChallenge 生成随机挑战并保存到 Redis
+func newPasskeyChallenge(key string) (string, error) {
+	challenge := make([]byte, 32)
+	if _, err := rand.Read(challenge); err != nil {
+		return "", fmt.Errorf("生成挑战失败: %v", err)
+	}
+	encoded := base64.RawURLEncoding.EncodeToString(challenge)
+	if err := database.TokenRedisClient.Set(context.Background(), key, encoded, passkeyChallengeTTL).Err(); err != nil {
+		return "", fmt.Errorf("保存挑战失败: %v", err)
+	}
+	return encoded, nil
+}
+
+// consumePasskeyChallenge 取出并删除挑战，每个挑战只能使用一次
+func consumePasskeyChallenge(key string) (string, error) {
+	ctx := context.Background()
+	challenge, err := database.TokenRedisClient.Get(ctx, key).Result()
+	if err != nil {
+		return "", fmt.Errorf("通行密钥请求已过期，请重试")
+	}
+	if deleted, _ := database.TokenRedisClient.Del(ctx, key).Result(); deleted == 0 {
+		return "", fmt.Errorf("通行密钥请求已过期，请重试")
+	}
+	return challenge, nil
+}
+
+// verifyPasskeyClientData 校验 clientDataJSON 的类型、挑战和来源
+func verifyPasskeyClientData(raw []byte, expectedType, challenge string) error {
+	var clientData passkeyClientData
+	if err := json.Unmarshal(raw, &clientData); err != nil {
+		return ErrPasskeyVerification
+	}
+	if clientData.Type != expectedType {
+		return ErrPasskeyVerification
+	}
+	got, err := decodeBase64URL(clientData.Challenge)
+	if err != nil {
+		return ErrPasskeyVerification
+	}
+	expected, _ := decodeBase64URL(challenge)
+	if !bytes.Equal(got, expected) {
+		return ErrPasskeyVerification
+	}
+	for _, origin := range passkeyOrigins() {
+		if clientData.Origin == origin {
+			return nil
+		}
+	}
+	return fmt.Errorf("不允许的来源: %s", clientData.Origin)
+}
+
+// parsePasskeyAuthData 解析 authenticatorData，包含凭据数据时一并解析凭据ID和公钥
+func parsePasskeyAuthData(data []byte) (*passkeyAuthData, error) {
+	if len(data) < 37 {
+		return nil, ErrPasskeyVerification
+	}
+	authData := &passkeyAuthData{
+		RPIDHash:  data[:32],
+		Flags:     data[32],
+		SignCount: binary.BigEndian.Uint32(data[33:37]),
+	}
+	rpIDHash := sha256.Sum256([]byte(passkeyRPID()))
+	if !bytes.Equal(authData.RPIDHash, rpIDHash[:]) {
+		return nil, ErrPasskeyVerification
+	}
+	if authData.Flags&authDataFlagUserPresent == 0 {
+		return nil, ErrPasskeyVerification
+	}
+	if authData.Flags&authDataFlagAttested == 0 {
+		return authData, nil
+	}
+
+	rest := data[37:]
+	if len(rest) < 18 {
+		return nil, ErrPasskeyVerification
+	}
+	authData.AAGUID = rest[:16]
+	idLength := int(binary.BigEndian.Uint16(rest[16:18]))
+	rest = rest[18:]
+	if len(rest) < idLength {
+		return nil, ErrPasskeyVerification
+	}
+	authData.CredentialID = rest[:idLength]
+	rest = rest[idLength:]
+
+	// 公钥之后可能还有扩展数据，只截取公钥部分
+	_, remaining, err := decodeCBOR(rest)
+	if err != nil {
+		return nil, ErrPasskeyVerification
+	}
+	authData.PublicKey = rest[:len(rest)-len(remaining)]
+	return authData, nil
+}
+
+// coseInt 读取 COSE 映射中的整数字段
+func coseInt(key map[interface{}]interface{}, label int64) (int64, bool) {
+	value, ok := key[label].(int64)
+	return value, ok
+}
+
+// coseBytes 读取 COSE 映射中的字节串字段
+func coseBytes(key map[interface{}]interface{}, label int64) []byte {
+	value, _ := key[label].([]byte)
+	return value
+}
+
+// parseCOSEPublicKey 解析 COSE 公钥，返回算法和可用于验签的公钥
+func parseCOSEPublicKey(raw []byte) (int, crypto.PublicKey, error) {
+	decoded, _, err := decodeCBOR(raw)
+	if err != nil {
+		return 0, nil, ErrPasskeyVerification
+	}
+	key, ok := decoded.(map[interface{}]interface{})
+	if !ok {
+		return 0, nil, ErrPasskeyVerification
+	}
+	keyType, _ := coseInt(key, 1)
+	alg, _ := coseInt(key, 3)
+
+	switch {
+	case keyType == coseKeyTypeEC2 && alg == coseAlgES256:
+		curve, _ := coseInt(key, -1)
+		x, y := coseBytes(key, -2), coseBytes(key, -3)
+		if curve != 1 || len(x) != 32 || len(y) != 32 {
+			return 0, nil, ErrPasskeyVerification
+		}
+		// 通过 ecdh 校验坐标是否在曲线上
+		if _, err := ecdh.P256().NewPublicKey(append(append([]byte{4}, x...), y...)); err != nil {
+			return 0, nil, ErrPasskeyVerification
+		}
+		return coseAlgES256, &ecdsa.PublicKey{Curve: elliptic.P256(), X: new(big.Int).SetBytes(x), Y: new(big.Int).SetBytes(y)}, nil
+	case keyType == coseKeyTypeOKP && alg == coseAlgEdDSA:
+		curve, _ := coseInt(key, -1)
+		x := coseBytes(key, -2)
+		if curve != 6 || len(x) != ed25519.PublicKeySize {
+			return 0, nil, ErrPasskeyVerification
+		}
+		return coseAlgEdDSA, ed25519.PublicKey(x), nil
+	case keyType == coseKeyTypeRSA && alg == coseAlgRS256:
+		n, e := coseBytes(key, -1), coseBytes(key, -2)
+		if len(n) < 256 || len(e) == 0 || len(e) > 4 {
+			return 0, nil, ErrPasskeyVerification
+		}
+		exponent := 0
+		for _, b := range e {
+			exponent = exponent<<8 | int(b)
+		}
+		return coseAlgRS256, &rsa.PublicKey{N: new(big.Int).SetBytes(n), E: exponent}, nil
+	}
+	return 0, nil, fmt.Errorf("不支持的通行密钥算法")
+}
+
+// verifyPasskeySignature 使用凭据公钥校验登录签名
+func verifyPasskeySignature(rawPublicKey, signedData, signature []byte) error {
+	_, publicKey, err := parseCOSEPublicKey(rawPublicKey)
+	if err != nil {
+		return err
+	}
+	digest := sha256.Sum256(signedData)
+	switch key := publicKey.(type) {
+	case *ecdsa.PublicKey:
+		if ecdsa.VerifyASN1(key, digest[:], signature) {
+			return nil
+		}
+	case ed25519.PublicKey:
+		if ed25519.Verify(key, signedData, signature) {
+			return nil
+		}
+	case *rsa.PublicKey:
+		if rsa.VerifyPKCS1v15(key, crypto.SHA256, digest[:], signature) == nil {
+			return nil
+		}
+	}
+	return ErrPasskeyVerification
+}
+
+// verifyPasskeyAttestation 校验注册结果的客户端数据和认证器数据，返回凭据数据和公钥算法
+// 注册时请求 attestation=none，attStmt 不参与校验
+func verifyPasskeyAttestation(challenge string, credential *PasskeyCredential) (*passkeyAuthData, int, error) {
+	if credential.Type != "public-key" {
+		return nil, 0, ErrPasskeyVerification
+	}
+
+	clientDataJSON, err := decodeBase64URL(credential.Response.ClientDataJSON)
+	if err != nil {
+		return nil, 0, ErrPasskeyVerification
+	}
+	if err := verifyPasskeyClientData(clientDataJSON, "webauthn.create", challenge); err != nil {
+		return nil, 0, err
+	}
+
+	attestationObject, err := decodeBase64URL(credential.Response.AttestationObject)
+	if err != nil {
+		return nil, 0, ErrPasskeyVerification
+	}
+	decoded, _, err := decodeCBOR(attestationObject)
+	if err != nil {
+		return nil, 0, ErrPasskeyVerification
+	}
+	attestation, ok := decoded.(map[interface{}]interface{})
+	if !ok {
+		return nil, 0, ErrPasskeyVerification
+	}
+	rawAuthData, ok := attestation["authData"].([]byte)
+	if !ok {
+		return nil, 0, ErrPasskeyVerification
+	}
+	authData, err := parsePasskeyAuthData(rawAuthData)
+	if err != nil {
+		return nil, 0, err
+	}
+	if authData.CredentialID == nil {
+		return nil, 0, ErrPasskeyVerification
+	}
+
+	rawID, err := decodeBase64URL(credential.RawID)
+	if err != nil || !bytes.Equal(rawID, authData.CredentialID) {
+		return nil, 0, ErrPasskeyVerification
+	}
+	if len(rawID) > passkeyCredentialIDMax {
+		return nil, 0, fmt.Errorf("通行密钥凭据ID过长")
+	}
+	algorithm, _, err := parseCOSEPublicKey(authData.PublicKey)
+	if err != nil {
+		return nil, 0, err
+	}
+	return authData, algorithm, nil
+}
+
+// verifyPasskeyAssertion 校验登录结果的用户句柄、客户端数据、认证器数据、签名和签名计数
+func verifyPasskeyAssertion(passkey *models.Passkey, challenge string, credential *PasskeyCredential) (*passkeyAuthData, error) {
+	// 可发现凭据会返回用户句柄，必须与凭据所属用户一致
+	if credential.Response.UserHandle != "" {
+		userHandle, err := decodeBase64URL(credential.Response.UserHandle)
+		if err != nil || !bytes.Equal(userHandle, passkeyUserHandle(passkey.UserID)) {
+			return nil, ErrPasskeyVerification
+		}
+	}
+
+	clientDataJSON, err := decodeBase64URL(credential.Response.ClientDataJSON)
+	if err != nil {
+		return nil, ErrPasskeyVerification
+	}
+	if err := verifyPasskeyClientData(clientDataJSON, "webauthn.get", challenge); err != nil {
+		return nil, err
+	}
+
+	rawAuthData, err := decodeBase64URL(credential.Response.AuthenticatorData)
+	if err != nil {
+		return nil, ErrPasskeyVerification
+	}
+	authData, err := parsePasskeyAuthData(rawAuthData)
+	if err != nil {
+		return nil, err
+	}
+
+	signature, err := decodeBase64URL(credential.Response.Signature)
+	if err != nil {
+		return nil, ErrPasskeyVerification
+	}
+	clientDataHash := sha256.Sum256(clientDataJSON)
+	signedData := append(append([]byte{}, rawAuthData...), clientDataHash[:]...)
+	if err := verifyPasskeySignature(passkey.PublicKey, signedData, signature); err != nil {
+		return nil, err
+	}
+
+	// 计数器不递增说明认证器可能被克隆；可同步的通行密钥计数器始终为0，不做检查
+	if (authData.SignCount != 0 || passkey.SignCount != 0) && authData.SignCount <= passkey.SignCount {
+		return nil, fmt.Errorf("通行密钥签名计数异常，请联系管理员")
+	}
+	return authData, nil
+}
+
+// formatAAGUID 将 AAGUID 格式化为 UUID 字符串
+func formatAAGUID(aaguid []byte) string {
+	if len(aaguid) != 16 {
+		return ""
+	}
+	h := hex.EncodeToString(aaguid)
+	return h[:8] + "-" + h[8:12] + "-" + h[12:16] + "-" + h[16:20] + "-" + h[20:]
+}
+
+// BeginPasskeyRegistration 生成注册通行密钥的选项，已注册的凭据会被排除
+func BeginPasskeyRegistration(user *models.User) (*PasskeyCreationOptions, error) {
+	passkeys, err := GetUserPasskeys(user.ID)
+	if err != nil {
+		return nil, err
+	}
+	if len(passkeys) >= maxPasskeysPerUser {
+		return nil, fmt.Errorf("最多只能注册 %d 个通行密钥", maxPasskeysPerUser)
+	}
+
+	challenge, err := newPasskeyChallenge(fmt.Sprintf("passkey_challenge:register:%d", user.ID))
+	if err != nil {
+		return nil, err
+	}
+
+	options := &PasskeyCreationOptions{
+		Challenge:          challenge,
+		Timeout:            passkeyTimeoutMs,
+		Attestation:        "none",
+		ExcludeCredentials: []PasskeyCredentialDescriptor{},
+	}
+	options.RP.ID = passkeyRPID()
+	options.RP.Name = config.AppConfig.AppName
+	options.User.ID = base64.RawURLEncoding.EncodeToString(passkeyUserHandle(user.ID))
+	options.User.Name = user.Email
+	options.User.DisplayName = user.Username
+	for _, alg := range []int{coseAlgES256, coseAlgEdDSA, coseAlgRS256} {
+		options.PubKeyCredParams = append(options.PubKeyCredParams, struct {
+			Type string `json:"type"`
+			Alg  int    `json:"alg"`
+		}{Type: "public-key", Alg: alg})
+	}
+	options.AuthenticatorSelection.ResidentKey = "required"
+	options.AuthenticatorSelection.RequireResident = true
+	options.AuthenticatorSelection.UserVerification = "preferred"
+	for _, passkey := range passkeys {
+		descriptor := PasskeyCredentialDescriptor{Type: "public-key", ID: passkey.CredentialID}
+		if passkey.Transports != "" {
+			descriptor.Transports = strings.Split(passkey.Transports, ",")
+		}
+		options.ExcludeCredentials = append(options.ExcludeCredentials, descriptor)
+	}
+	return options, nil
+}
+
+// FinishPasskeyRegistration 校验浏览器返回的注册结果并保存通行密钥
+// 注册时请求 attestation=none，不校验认证器证明，只信任本次挑战签发的凭据
+func FinishPasskeyRegistration(user *models.User, name string, credential *PasskeyCredential) (*models.Passkey, error) {
+	challenge, err := consumePasskeyChallenge(fmt.Sprintf("passkey_challenge:register:%d", user.ID))
+	if err != nil {
+		return nil, err
+	}
+	authData, algorithm, err := verifyPasskeyAttestation(challenge, credential)
+	if err != nil {
+		return nil, err
+	}
+
+	credentialID := base64.RawURLEncoding.EncodeToString(authData.CredentialID)
+	var count int64
+	database.DB.Model(&models.Passkey{}).Where("credential_id = ?", credentialID).Count(&count)
+	if count > 0 {
+		return nil, fmt.Errorf("该通行密钥已注册")
+	}
+
+	name = strings.TrimSpace(name)
+	if name == "" {
+		name = "通行密钥"
+	}
+	if len([]rune(name)) > 100 {
+		name = string([]rune(name)[:100])
+	}
+
+	passkey := models.Passkey{
+		UserID:         user.ID,
+		Name:           name,
+		CredentialID:   credentialID,
+		PublicKey:      authData.PublicKey,
+		Algorithm:      algorithm,
+		SignCount:      authData.SignCount,
+		AAGUID:         formatAAGUID(authData.AAGUID),
+		Transports:     strings.Join(credential.Response.Transports, ","),
+		BackupEligible: authData.Flags&authDataFlagBackupElig != 0,
+	}
+	if err := database.DB.Create(&passkey).Error; err != nil {
+		return nil, fmt.Errorf("保存通行密钥失败: %v", err)
+	}
+	return &passkey, nil
+}
+
+// BeginPasskeyLogin 生成通行密钥登录选项，返回会话ID用于提交登录结果
+func BeginPasskeyLogin() (string, *PasskeyRequestOptions, error) {
+	session := make([]byte, 16)
+	if _, err := rand.Read(session); err != nil {
+		return "", nil, fmt.Errorf("生成会话失败: %v", err)
+	}
+	sessionID := hex.EncodeToString(session)
+
+	challenge, err := newPasskeyChallenge("passkey_challenge:login:" + sessionID)
+	if err != nil {
+		return "", nil, err
+	}
+
+	return sessionID, &PasskeyRequestOptions{
+		Challenge:        challenge,
+		RPID:             passkeyRPID(),
+		Timeout:          passkeyTimeoutMs,
+		UserVerification: "preferred",
+		AllowCredentials: []PasskeyCredentialDescriptor{},
+	}, nil
+}
+
+// FinishPasskeyLogin 校验通行密钥登录签名，返回登录用户以及认证器是否完成了用户验证（生物识别或PIN）
+func FinishPasskeyLogin(sessionID string, credential *PasskeyCredential) (*models.User, bool, error) {
+	challenge, err := consumePasskeyChallenge("passkey_challenge:login:" + sessionID)
+	if err != nil {
+		return nil, false, err
+	}
+	if credential.Type != "public-key" {
+		return nil, false, ErrPasskeyVerification
+	}
+
+	rawID, err := decodeBase64URL(credential.RawID)
+	if err != nil {
+		return nil, false, ErrPasskeyVerification
+	}
+	var passkey models.Passkey
+	if err := database.DB.Where("credential_id = ?", base64.RawURLEncoding.EncodeToString(rawID)).First(&passkey).Error; err != nil {
+		return nil, false, ErrPasskeyVerification
+	}
+
+	authData, err := verifyPasskeyAssertion(&passkey, challenge, credential)
+	if err != nil {
+		return nil, false, err
+	}
+
+	now := time.Now()
+	if err := database.DB.Model(&passkey).Updates(map[string]interface{}{
+		"sign_count":   authData.SignCount,
+		"last_used_at": now,
+	}).Error; err != nil {
+		return nil, false, fmt.Errorf("更新通行密钥失败: %v", err)
+	}
+
+	var user models.User
+	if err := database.DB.Where("id = ?", passkey.UserID).First(&user).Error; err != nil {
+		return nil, false, ErrPasskeyVerification
+	}
+	return &user, authData.Flags&authDataFlagUserVerified != 0, nil
+}
+
+// GetUserPasskeys 获取用户的通行密钥，最近注册的在前
+func GetUserPasskeys(userID uint) ([]models.Passkey, error) {
+	passkeys := []models.Passkey{}
+	if err := database.DB.Where("user_id = ?", userID).Order("created_at DESC").Find(&passkeys).Error; err != nil {
+		return nil, fmt.Errorf("获取通行密钥失败: %v", err)
+	}
+	return passkeys, nil
+}
+
+// DeletePasskey 删除用户的通行密钥
+func DeletePasskey(userID, passkeyID uint) error {
+	result := database.DB.Where("id = ? AND user_id = ?", passkeyID, userID).Delete(&models.Passkey{})
+	if result.Error != nil {
+		return fmt.Errorf("删除通行密钥失败: %v", result.Error)
+	}
+	if result.RowsAffected == 0 {
+		return fmt.Errorf("通行密钥不存在")
+	}
+	return nil
+}
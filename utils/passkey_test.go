@@ -0,0 +1,413 @@
+package utils
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/binary"
+	"encoding/json"
+	"testing"
+
+	"claude/config"
+	"claude/models"
+)
+
+const (
+	testPasskeyRPID   = "example.com"
+	testPasskeyOrigin = "https://example.com"
+)
+
+// setupPasskeyConfig 设置依赖方ID和允许的来源，测试结束后恢复
+func setupPasskeyConfig(t *testing.T) {
+	t.Helper()
+	previous := config.AppConfig
+	config.AppConfig = &config.Config{
+		WebAuthnRPID:    testPasskeyRPID,
+		WebAuthnOrigins: []string{testPasskeyOrigin},
+	}
+	t.Cleanup(func() { config.AppConfig = previous })
+}
+
+// testAuthenticator 模拟认证器，使用真实密钥生成注册和登录数据
+type testAuthenticator struct {
+	alg          int
+	credentialID []byte
+	coseKey      []byte
+	sign         func(data []byte) []byte
+}
+
+func newTestAuthenticator(t *testing.T, alg int) *testAuthenticator {
+	t.Helper()
+	auth := &testAuthenticator{alg: alg, credentialID: make([]byte, 32)}
+	rand.Read(auth.credentialID)
+
+	switch alg {
+	case coseAlgES256:
+		key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+		if err != nil {
+			t.Fatalf("生成ES256密钥失败: %v", err)
+		}
+		auth.coseKey = encodeCBOR([]cborPair{
+			{1, coseKeyTypeEC2},
+			{3, coseAlgES256},
+			{-1, 1},
+			{-2, key.X.FillBytes(make([]byte, 32))},
+			{-3, key.Y.FillBytes(make([]byte, 32))},
+		})
+		auth.sign = func(data []byte) []byte {
+			digest := sha256.Sum256(data)
+			signature, err := ecdsa.SignASN1(rand.Reader, key, digest[:])
+			if err != nil {
+				t.Fatalf("ES256签名失败: %v", err)
+			}
+			return signature
+		}
+	case coseAlgRS256:
+		key, err := rsa.GenerateKey(rand.Reader, 2048)
+		if err != nil {
+			t.Fatalf("生成RS256密钥失败: %v", err)
+		}
+		auth.coseKey = encodeCBOR([]cborPair{
+			{1, coseKeyTypeRSA},
+			{3, coseAlgRS256},
+			{-1, key.N.Bytes()},
+			{-2, []byte{0x01, 0x00, 0x01}},
+		})
+		auth.sign = func(data []byte) []byte {
+			digest := sha256.Sum256(data)
+			signature, err := rsa.SignPKCS1v15(rand.Reader, key, crypto.SHA256, digest[:])
+			if err != nil {
+				t.Fatalf("RS256签名失败: %v", err)
+			}
+			return signature
+		}
+	case coseAlgEdDSA:
+		public, private, err := ed25519.GenerateKey(rand.Reader)
+		if err != nil {
+			t.Fatalf("生成EdDSA密钥失败: %v", err)
+		}
+		auth.coseKey = encodeCBOR([]cborPair{
+			{1, coseKeyTypeOKP},
+			{3, coseAlgEdDSA},
+			{-1, 6},
+			{-2, []byte(public)},
+		})
+		auth.sign = func(data []byte) []byte {
+			return ed25519.Sign(private, data)
+		}
+	default:
+		t.Fatalf("不支持的算法: %d", alg)
+	}
+	return auth
+}
+
+// authenticatorData 构造 authenticatorData，attested 为 true 时附带凭据数据
+func (a *testAuthenticator) authenticatorData(rpID string, flags byte, signCount uint32, attested bool) []byte {
+	rpIDHash := sha256.Sum256([]byte(rpID))
+	data := append([]byte{}, rpIDHash[:]...)
+	if attested {
+		flags |= authDataFlagAttested
+	}
+	data = append(data, flags)
+	data = binary.BigEndian.AppendUint32(data, signCount)
+	if attested {
+		data = append(data, make([]byte, 16)...) // AAGUID
+		data = binary.BigEndian.AppendUint16(data, uint16(len(a.credentialID)))
+		data = append(data, a.credentialID...)
+		data = append(data, a.coseKey...)
+	}
+	return data
+}
+
+// passkeyCeremony 一次注册或登录的参数，零值字段使用正确的默认值
+type passkeyCeremony struct {
+	challenge string
+	origin    string
+	rpID      string
+	flags     byte
+	signCount uint32
+}
+
+func (p passkeyCeremony) withDefaults() passkeyCeremony {
+	if p.origin == "" {
+		p.origin = testPasskeyOrigin
+	}
+	if p.rpID == "" {
+		p.rpID = testPasskeyRPID
+	}
+	if p.flags == 0 {
+		p.flags = authDataFlagUserPresent | authDataFlagUserVerified
+	}
+	return p
+}
+
+func testClientDataJSON(ceremonyType, challenge, origin string) []byte {
+	data, _ := json.Marshal(map[string]interface{}{
+		"type":        ceremonyType,
+		"challenge":   challenge,
+		"origin":      origin,
+		"crossOrigin": false,
+	})
+	return data
+}
+
+// register 生成注册结果，format 为 none 或 packed（自证明）
+func (a *testAuthenticator) register(format string, p passkeyCeremony) *PasskeyCredential {
+	p = p.withDefaults()
+	clientDataJSON := testClientDataJSON("webauthn.create", p.challenge, p.origin)
+	authData := a.authenticatorData(p.rpID, p.flags, p.signCount, true)
+
+	attStmt := []cborPair{}
+	if format == "packed" {
+		clientDataHash := sha256.Sum256(clientDataJSON)
+		attStmt = []cborPair{
+			{"alg", a.alg},
+			{"sig", a.sign(append(append([]byte{}, authData...), clientDataHash[:]...))},
+		}
+	}
+	attestationObject := encodeCBOR([]cborPair{
+		{"fmt", format},
+		{"attStmt", attStmt},
+		{"authData", authData},
+	})
+
+	id := base64.RawURLEncoding.EncodeToString(a.credentialID)
+	return &PasskeyCredential{
+		ID:    id,
+		RawID: id,
+		Type:  "public-key",
+		Response: PasskeyCredentialResponse{
+			ClientDataJSON:    base64.RawURLEncoding.EncodeToString(clientDataJSON),
+			AttestationObject: base64.RawURLEncoding.EncodeToString(attestationObject),
+			Transports:        []string{"internal"},
+		},
+	}
+}
+
+// assert 生成登录结果
+func (a *testAuthenticator) assert(userID uint, p passkeyCeremony) *PasskeyCredential {
+	p = p.withDefaults()
+	clientDataJSON := testClientDataJSON("webauthn.get", p.challenge, p.origin)
+	authData := a.authenticatorData(p.rpID, p.flags, p.signCount, false)
+	clientDataHash := sha256.Sum256(clientDataJSON)
+	signature := a.sign(append(append([]byte{}, authData...), clientDataHash[:]...))
+
+	id := base64.RawURLEncoding.EncodeToString(a.credentialID)
+	return &PasskeyCredential{
+		ID:    id,
+		RawID: id,
+		Type:  "public-key",
+		Response: PasskeyCredentialResponse{
+			ClientDataJSON:    base64.RawURLEncoding.EncodeToString(clientDataJSON),
+			AuthenticatorData: base64.RawURLEncoding.EncodeToString(authData),
+			Signature:         base64.RawURLEncoding.EncodeToString(signature),
+			UserHandle:        base64.RawURLEncoding.EncodeToString(passkeyUserHandle(userID)),
+		},
+	}
+}
+
+func testPasskeyChallenge() string {
+	challenge := make([]byte, 32)
+	rand.Read(challenge)
+	return base64.RawURLEncoding.EncodeToString(challenge)
+}
+
+var testPasskeyAlgorithms = []struct {
+	name string
+	alg  int
+}{
+	{"ES256", coseAlgES256},
+	{"RS256", coseAlgRS256},
+	{"EdDSA", coseAlgEdDSA},
+}
+
+func TestVerifyPasskeyAttestation(t *testing.T) {
+	setupPasskeyConfig(t)
+
+	for _, algorithm := range testPasskeyAlgorithms {
+		auth := newTestAuthenticator(t, algorithm.alg)
+		for _, format := range []string{"none", "packed"} {
+			challenge := testPasskeyChallenge()
+			authData, alg, err := verifyPasskeyAttestation(challenge, auth.register(format, passkeyCeremony{challenge: challenge, signCount: 1}))
+			if err != nil {
+				t.Errorf("%s/%s: 注册校验失败: %v", algorithm.name, format, err)
+				continue
+			}
+			if alg != algorithm.alg {
+				t.Errorf("%s/%s: 期望算法 %d，实际 %d", algorithm.name, format, algorithm.alg, alg)
+			}
+			if string(authData.CredentialID) != string(auth.credentialID) || string(authData.PublicKey) != string(auth.coseKey) {
+				t.Errorf("%s/%s: 解析出的凭据ID或公钥不一致", algorithm.name, format)
+			}
+			if authData.SignCount != 1 {
+				t.Errorf("%s/%s: 期望签名计数 1，实际 %d", algorithm.name, format, authData.SignCount)
+			}
+		}
+	}
+}
+
+func TestVerifyPasskeyAttestationRejects(t *testing.T) {
+	setupPasskeyConfig(t)
+	auth := newTestAuthenticator(t, coseAlgES256)
+	challenge := testPasskeyChallenge()
+
+	tests := []struct {
+		name       string
+		credential func() *PasskeyCredential
+	}{
+		{"错误的rpIdHash", func() *PasskeyCredential {
+			return auth.register("none", passkeyCeremony{challenge: challenge, rpID: "evil.example"})
+		}},
+		{"错误的来源", func() *PasskeyCredential {
+			return auth.register("none", passkeyCeremony{challenge: challenge, origin: "https://evil.example"})
+		}},
+		{"其他请求的挑战", func() *PasskeyCredential {
+			return auth.register("none", passkeyCeremony{challenge: testPasskeyChallenge()})
+		}},
+		{"未检测到用户在场", func() *PasskeyCredential {
+			return auth.register("none", passkeyCeremony{challenge: challenge, flags: authDataFlagUserVerified})
+		}},
+		{"登录数据用于注册", func() *PasskeyCredential {
+			credential := auth.register("none", passkeyCeremony{challenge: challenge})
+			credential.Response.ClientDataJSON = base64.RawURLEncoding.EncodeToString(testClientDataJSON("webauthn.get", challenge, testPasskeyOrigin))
+			return credential
+		}},
+		{"rawId与凭据ID不一致", func() *PasskeyCredential {
+			credential := auth.register("none", passkeyCeremony{challenge: challenge})
+			credential.RawID = base64.RawURLEncoding.EncodeToString([]byte("other-credential"))
+			return credential
+		}},
+		{"凭据类型错误", func() *PasskeyCredential {
+			credential := auth.register("none", passkeyCeremony{challenge: challenge})
+			credential.Type = "password"
+			return credential
+		}},
+		{"attestationObject不是CBOR映射", func() *PasskeyCredential {
+			credential := auth.register("none", passkeyCeremony{challenge: challenge})
+			credential.Response.AttestationObject = base64.RawURLEncoding.EncodeToString(encodeCBOR([]interface{}{1}))
+			return credential
+		}},
+	}
+	for _, tt := range tests {
+		if _, _, err := verifyPasskeyAttestation(challenge, tt.credential()); err == nil {
+			t.Errorf("%s: 应拒绝注册", tt.name)
+		}
+	}
+}
+
+func TestVerifyPasskeyAssertion(t *testing.T) {
+	setupPasskeyConfig(t)
+	const userID = 42
+
+	for _, algorithm := range testPasskeyAlgorithms {
+		auth := newTestAuthenticator(t, algorithm.alg)
+		passkey := &models.Passkey{UserID: userID, PublicKey: auth.coseKey, Algorithm: algorithm.alg, SignCount: 1}
+
+		challenge := testPasskeyChallenge()
+		authData, err := verifyPasskeyAssertion(passkey, challenge, auth.assert(userID, passkeyCeremony{challenge: challenge, signCount: 2}))
+		if err != nil {
+			t.Errorf("%s: 登录校验失败: %v", algorithm.name, err)
+			continue
+		}
+		if authData.SignCount != 2 || authData.Flags&authDataFlagUserVerified == 0 {
+			t.Errorf("%s: 签名计数或用户验证标志解析错误", algorithm.name)
+		}
+	}
+}
+
+// TestVerifyPasskeySyncedCounter 可同步的通行密钥计数器始终为0，不做递增检查
+func TestVerifyPasskeySyncedCounter(t *testing.T) {
+	setupPasskeyConfig(t)
+	auth := newTestAuthenticator(t, coseAlgES256)
+	passkey := &models.Passkey{UserID: 1, PublicKey: auth.coseKey, Algorithm: coseAlgES256}
+
+	for i := 0; i < 2; i++ {
+		challenge := testPasskeyChallenge()
+		if _, err := verifyPasskeyAssertion(passkey, challenge, auth.assert(1, passkeyCeremony{challenge: challenge})); err != nil {
+			t.Fatalf("第 %d 次登录校验失败: %v", i+1, err)
+		}
+	}
+}
+
+func TestVerifyPasskeyAssertionRejects(t *testing.T) {
+	setupPasskeyConfig(t)
+	const userID = 42
+
+	for _, algorithm := range testPasskeyAlgorithms {
+		auth := newTestAuthenticator(t, algorithm.alg)
+		other := newTestAuthenticator(t, algorithm.alg)
+		passkey := &models.Passkey{UserID: userID, PublicKey: auth.coseKey, Algorithm: algorithm.alg, SignCount: 5}
+		challenge := testPasskeyChallenge()
+
+		// 先用旧挑战完成一次登录，之后原样重放
+		previousChallenge := testPasskeyChallenge()
+		replayed := auth.assert(userID, passkeyCeremony{challenge: previousChallenge, signCount: 6})
+		if _, err := verifyPasskeyAssertion(passkey, previousChallenge, replayed); err != nil {
+			t.Fatalf("%s: 首次登录校验失败: %v", algorithm.name, err)
+		}
+
+		tests := []struct {
+			name       string
+			credential *PasskeyCredential
+		}{
+			{"错误的rpIdHash", auth.assert(userID, passkeyCeremony{challenge: challenge, rpID: "evil.example", signCount: 6})},
+			{"错误的来源", auth.assert(userID, passkeyCeremony{challenge: challenge, origin: "https://evil.example", signCount: 6})},
+			{"重放旧挑战的登录结果", replayed},
+			{"签名计数未递增", auth.assert(userID, passkeyCeremony{challenge: challenge, signCount: 5})},
+			{"签名计数回退", auth.assert(userID, passkeyCeremony{challenge: challenge, signCount: 3})},
+			{"签名计数回退为0", auth.assert(userID, passkeyCeremony{challenge: challenge, signCount: 0})},
+			{"其他密钥的签名", other.assert(userID, passkeyCeremony{challenge: challenge, signCount: 6})},
+			{"用户句柄不一致", auth.assert(userID+1, passkeyCeremony{challenge: challenge, signCount: 6})},
+			{"未检测到用户在场", auth.assert(userID, passkeyCeremony{challenge: challenge, flags: authDataFlagUserVerified, signCount: 6})},
+		}
+
+		tampered := auth.assert(userID, passkeyCeremony{challenge: challenge, signCount: 6})
+		authData, _ := decodeBase64URL(tampered.Response.AuthenticatorData)
+		authData[32] |= authDataFlagBackupElig
+		tampered.Response.AuthenticatorData = base64.RawURLEncoding.EncodeToString(authData)
+		tests = append(tests, struct {
+			name       string
+			credential *PasskeyCredential
+		}{"篡改的authenticatorData", tampered})
+
+		registration := auth.register("none", passkeyCeremony{challenge: challenge, signCount: 6})
+		registration.Response.AuthenticatorData = tampered.Response.AuthenticatorData
+		registration.Response.Signature = tampered.Response.Signature
+		tests = append(tests, struct {
+			name       string
+			credential *PasskeyCredential
+		}{"注册数据用于登录", registration})
+
+		for _, tt := range tests {
+			if _, err := verifyPasskeyAssertion(passkey, challenge, tt.credential); err == nil {
+				t.Errorf("%s/%s: 应拒绝登录", algorithm.name, tt.name)
+			}
+		}
+	}
+}
+
+func TestParseCOSEPublicKeyRejects(t *testing.T) {
+	x := make([]byte, 32)
+	tests := []struct {
+		name string
+		key  []byte
+	}{
+		{"不在曲线上的点", encodeCBOR([]cborPair{{1, coseKeyTypeEC2}, {3, coseAlgES256}, {-1, 1}, {-2, x}, {-3, x}})},
+		{"错误的曲线", encodeCBOR([]cborPair{{1, coseKeyTypeEC2}, {3, coseAlgES256}, {-1, 2}, {-2, x}, {-3, x}})},
+		{"Ed25519公钥长度错误", encodeCBOR([]cborPair{{1, coseKeyTypeOKP}, {3, coseAlgEdDSA}, {-1, 6}, {-2, x[:31]}})},
+		{"RSA模数过短", encodeCBOR([]cborPair{{1, coseKeyTypeRSA}, {3, coseAlgRS256}, {-1, make([]byte, 128)}, {-2, []byte{1, 0, 1}}})},
+		{"密钥类型与算法不匹配", encodeCBOR([]cborPair{{1, coseKeyTypeOKP}, {3, coseAlgES256}, {-1, 6}, {-2, x}})},
+		{"不支持的算法", encodeCBOR([]cborPair{{1, coseKeyTypeEC2}, {3, -35}, {-1, 2}, {-2, x}, {-3, x}})},
+		{"不是映射", encodeCBOR([]interface{}{1, 2})},
+	}
+	for _, tt := range tests {
+		if _, _, err := parseCOSEPublicKey(tt.key); err == nil {
+			t.Errorf("%s: 应拒绝公钥", tt.name)
+		}
+	}
+}
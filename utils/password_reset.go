@@ -0,0 +1,158 @@
+package utils
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"log"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"claude/config"
+	"claude/database"
+	"claude/models"
+
+	"github.com/go-redis/redis/v8"
+)
+
+// ErrPasswordResetTokenInvalid 重置链接不存在、已过期或已被使用
+var ErrPasswordResetTokenInvalid = errors.New("重置链接无效或已过期")
+
+// 同一邮箱两次发送找回密码邮件的最小间隔
+const passwordResetResendInterval = time.Minute
+
+func passwordResetTokenKey(tokenHash string) string { return "password_reset:token:" + tokenHash }
+func passwordResetUserKey(userID uint) string       { return fmt.Sprintf("password_reset:user:%d", userID) }
+func passwordResetRateKey(email string) string      { return "password_reset:rate:" + email }
+
+// PasswordResetExpireMinutes 重置链接有效期（分钟）
+func PasswordResetExpireMinutes() int {
+	minutes := getTransferIntConfig("password_reset_token_expire_minutes", 30)
+	if minutes < 1 {
+		minutes = 30
+	}
+	return int(minutes)
+}
+
+func hashPasswordResetToken(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(sum[:])
+}
+
+// RequestPasswordReset 为邮箱对应的账户生成重置链接并发送邮件
+// 邮箱未注册、账户被禁用或发送过于频繁时静默返回，调用方无法据此判断邮箱是否已注册
+func RequestPasswordReset(email string) error {
+	email = strings.ToLower(strings.TrimSpace(email))
+	ctx := context.Background()
+
+	// 同一邮箱发送频率限制，无论邮箱是否注册都计入，响应时间保持一致
+	ok, err := database.TokenRedisClient.SetNX(ctx, passwordResetRateKey(email), "1", passwordResetResendInterval).Result()
+	if err != nil {
+		return err
+	}
+	if !ok {
+		return nil
+	}
+
+	var user models.User
+	if err := database.DB.Where("email = ?", email).First(&user).Error; err != nil {
+		return nil
+	}
+	if user.IsDisabled {
+		log.Printf("已禁用账户请求找回密码，忽略: user_id=%d", user.ID)
+		return nil
+	}
+
+	buf := make([]byte, 32)
+	if _, err := rand.Read(buf); err != nil {
+		return err
+	}
+	token := hex.EncodeToString(buf)
+	tokenHash := hashPasswordResetToken(token)
+	expireMinutes := PasswordResetExpireMinutes()
+	ttl := time.Duration(expireMinutes) * time.Minute
+
+	// 每个用户只保留最新一个重置链接，之前发送的链接立即失效
+	if oldHash, err := database.TokenRedisClient.Get(ctx, passwordResetUserKey(user.ID)).Result(); err == nil {
+		database.TokenRedisClient.Del(ctx, passwordResetTokenKey(oldHash))
+	}
+	pipe := database.TokenRedisClient.TxPipeline()
+	pipe.Set(ctx, passwordResetTokenKey(tokenHash), user.ID, ttl)
+	pipe.Set(ctx, passwordResetUserKey(user.ID), tokenHash, ttl)
+	if _, err := pipe.Exec(ctx); err != nil {
+		return err
+	}
+
+	resetURL := fmt.Sprintf("%s/reset-password?token=%s", strings.TrimRight(config.AppConfig.FrontendURL, "/"), url.QueryEscape(token))
+
+	// 异步发送，避免邮件发送耗时暴露邮箱是否注册
+	go func() {
+		if err := SendPasswordResetEmail(user.Email, resetURL, expireMinutes); err != nil {
+			log.Printf("发送找回密码邮件失败: user_id=%d, error=%v", user.ID, err)
+		}
+	}()
+
+	log.Printf("已发送找回密码邮件: user_id=%d", user.ID)
+	return nil
+}
+
+// CompletePasswordReset 使用重置链接设置新密码（hashedPassword 为 bcrypt 哈希），成功后下线所有设备并发送确认邮件
+func CompletePasswordReset(token, hashedPassword, ip string) (*models.User, error) {
+	ctx := context.Background()
+	tokenKey := passwordResetTokenKey(hashPasswordResetToken(strings.TrimSpace(token)))
+
+	value, err := database.TokenRedisClient.Get(ctx, tokenKey).Result()
+	if err == redis.Nil {
+		return nil, ErrPasswordResetTokenInvalid
+	} else if err != nil {
+		return nil, err
+	}
+
+	// 原子地占用重置链接，并发请求只有一个能成功
+	deleted, err := database.TokenRedisClient.Del(ctx, tokenKey).Result()
+	if err != nil {
+		return nil, err
+	}
+	if deleted == 0 {
+		return nil, ErrPasswordResetTokenInvalid
+	}
+
+	userID, err := strconv.ParseUint(value, 10, 64)
+	if err != nil {
+		return nil, ErrPasswordResetTokenInvalid
+	}
+	database.TokenRedisClient.Del(ctx, passwordResetUserKey(uint(userID)))
+
+	var user models.User
+	if err := database.DB.Where("id = ?", userID).First(&user).Error; err != nil {
+		return nil, ErrPasswordResetTokenInvalid
+	}
+	if user.IsDisabled {
+		return nil, ErrPasswordResetTokenInvalid
+	}
+
+	if err := database.DB.Model(&user).Update("password", &hashedPassword).Error; err != nil {
+		return nil, err
+	}
+
+	// 密码可能已泄露，下线所有设备（含刷新令牌）
+	deviceManager := NewDeviceManager(database.TokenRedisClient, database.UserRedisClient, database.DeviceRedisClient)
+	if err := deviceManager.RevokeAllUserDevices(user.ID); err != nil {
+		log.Printf("重置密码后下线设备失败: user_id=%d, error=%v", user.ID, err)
+	}
+
+	changedAt := time.Now()
+	go func() {
+		if err := SendPasswordChangedEmail(user.Email, ip, changedAt); err != nil {
+			log.Printf("发送密码重置确认邮件失败: user_id=%d, error=%v", user.ID, err)
+		}
+	}()
+
+	log.Printf("密码重置成功: user_id=%d, ip=%s", user.ID, ip)
+	return &user, nil
+}
@@ -0,0 +1,536 @@
+package utils
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"log"
+	"math"
+	"net/http"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"claude/config"
+	"claude/database"
+	"claude/models"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// 支付事件类型
+const (
+	PaymentEventPaid     = "paid"
+	PaymentEventRefunded = "refunded"
+	PaymentEventExpired  = "expired"
+	PaymentEventFailed   = "failed"
+)
+
+// ErrPaymentSignature 回调签名校验失败
+var ErrPaymentSignature = errors.New("支付回调签名校验失败")
+
+// errPaymentEventProcessed 回调事件已处理过
+var errPaymentEventProcessed = errors.New("支付回调事件已处理")
+
+// CheckoutResult 创建支付会话的结果
+type CheckoutResult struct {
+	ProviderOrderID string // 渠道侧订单/会话ID
+	CheckoutURL     string // 用户跳转支付的地址
+}
+
+// PaymentEvent 经过签名校验后的标准化支付事件
+type PaymentEvent struct {
+	EventID           string  `json:"event_id"`            // 渠道事件ID，用于幂等
+	Type              string  `json:"type"`                // paid, refunded, expired, failed；为空表示无需处理的事件
+	OrderNo           string  `json:"order_no"`            // 商户订单号
+	ProviderOrderID   string  `json:"provider_order_id"`   // 渠道侧订单/会话ID
+	ProviderPaymentID string  `json:"provider_payment_id"` // 渠道侧支付ID
+	Amount            float64 `json:"amount"`              // 支付或退款金额
+	Currency          string  `json:"currency"`
+	InvoiceURL        string  `json:"invoice_url"`
+}
+
+// PaymentProvider 支付渠道接口
+type PaymentProvider interface {
+	// Name 渠道标识，与订单的 Provider 字段和回调路由一致
+	Name() string
+	// CreateCheckout 为订单创建支付会话
+	CreateCheckout(order *models.PaymentOrder, plan *models.SubscriptionPlan) (*CheckoutResult, error)
+	// ParseWebhook 校验回调签名并解析为标准化事件
+	ParseWebhook(header http.Header, body []byte) (*PaymentEvent, error)
+	// Refund 向渠道发起全额退款
+	Refund(order *models.PaymentOrder) error
+}
+
+var (
+	paymentProviders   = make(map[string]PaymentProvider)
+	paymentProvidersMu sync.RWMutex
+)
+
+// RegisterPaymentProvider 注册支付渠道
+func RegisterPaymentProvider(provider PaymentProvider) {
+	paymentProvidersMu.Lock()
+	defer paymentProvidersMu.Unlock()
+	paymentProviders[provider.Name()] = provider
+}
+
+// GetPaymentProvider 获取已注册的支付渠道
+func GetPaymentProvider(name string) (PaymentProvider, bool) {
+	paymentProvidersMu.RLock()
+	defer paymentProvidersMu.RUnlock()
+	provider, ok := paymentProviders[name]
+	return provider, ok
+}
+
+// GetPaymentProviderNames 获取所有已启用的支付渠道名称
+func GetPaymentProviderNames() []string {
+	paymentProvidersMu.RLock()
+	defer paymentProvidersMu.RUnlock()
+	names := make([]string, 0, len(paymentProviders))
+	for name := range paymentProviders {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// InitPaymentProviders 根据配置注册可用的支付渠道
+func InitPaymentProviders() {
+	if config.AppConfig.StripeSecretKey != "" {
+		RegisterPaymentProvider(NewStripeProvider(config.AppConfig.StripeSecretKey, config.AppConfig.StripeWebhookSecret))
+		log.Println("已启用 Stripe 支付渠道")
+	}
+	if config.AppConfig.PaymentMockEnabled {
+		// 未配置签名密钥时任何人都能伪造回调，拒绝启用
+		if config.AppConfig.PaymentMockSecret == "" {
+			log.Println("未配置 PAYMENT_MOCK_SECRET，模拟支付渠道未启用")
+		} else {
+			RegisterPaymentProvider(NewMockPaymentProvider(config.AppConfig.PaymentMockSecret))
+			log.Println("已启用模拟支付渠道（仅用于测试）")
+		}
+	}
+}
+
+// RenewalCharger 支持使用已保存的支付方式自动扣款的渠道可实现此接口，
+// 扣款结果仍通过回调（或直接调用 ProcessPaymentEvent）通知
+type RenewalCharger interface {
+	ChargeRenewal(order *models.PaymentOrder) error
+}
+
+// generatePaymentOrderNo 生成商户订单号
+func generatePaymentOrderNo() (string, error) {
+	b := make([]byte, 6)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return fmt.Sprintf("PO%s%s", time.Now().Format("20060102150405"), strings.ToUpper(hex.EncodeToString(b))), nil
+}
+
+// CreatePaymentOrder 创建支付订单并向渠道创建支付会话
+func CreatePaymentOrder(userID, planID uint, providerName string) (*models.PaymentOrder, error) {
+	var plan models.SubscriptionPlan
+	if err := database.DB.Where("id = ?", planID).First(&plan).Error; err != nil {
+		return nil, fmt.Errorf("订阅计划不存在")
+	}
+	if err := CheckPlanAvailability(&plan); err != nil {
+		return nil, err
+	}
+
+	// 同一时间只能有一个进行中的周期订阅
+	if plan.IsRecurring {
+		if sub, _ := GetActiveRecurringSubscription(userID); sub != nil {
+			return nil, fmt.Errorf("您已有进行中的周期订阅，请先取消或等待当前订阅结束")
+		}
+	}
+
+	expireMinutes := getTransferIntConfig("payment_order_expire_minutes", 30)
+	if expireMinutes <= 0 {
+		expireMinutes = 30
+	}
+
+	return createPaymentOrder(userID, &plan, providerName, nil, time.Now().Add(time.Duration(expireMinutes)*time.Minute))
+}
+
+// createPaymentOrder 创建订单并向渠道创建支付会话，subscriptionID 不为空时为周期订阅续费订单
+func createPaymentOrder(userID uint, plan *models.SubscriptionPlan, providerName string, subscriptionID *uint, expiresAt time.Time) (*models.PaymentOrder, error) {
+	provider, ok := GetPaymentProvider(providerName)
+	if !ok {
+		return nil, fmt.Errorf("不支持的支付方式: %s", providerName)
+	}
+	if plan.Price <= 0 {
+		return nil, fmt.Errorf("该订阅计划不支持在线购买")
+	}
+
+	orderNo, err := generatePaymentOrderNo()
+	if err != nil {
+		return nil, fmt.Errorf("生成订单号失败: %v", err)
+	}
+
+	currency := strings.ToUpper(plan.Currency)
+	if currency == "" {
+		currency = "USD"
+	}
+
+	order := models.PaymentOrder{
+		OrderNo:            orderNo,
+		UserID:             userID,
+		SubscriptionPlanID: plan.ID,
+		SubscriptionID:     subscriptionID,
+		PlanVersionID:      plan.CurrentVersionID,
+		Provider:           provider.Name(),
+		Amount:             plan.Price,
+		Currency:           currency,
+		Status:             "pending",
+		ExpiresAt:          expiresAt,
+	}
+
+	// 已领取的折扣优惠码只用于用户主动下单，不用于自动续费
+	if subscriptionID == nil {
+		if redemption, amount := findPromoDiscount(userID, plan); redemption != nil {
+			order.Amount = amount
+			order.DiscountAmount = plan.Price - amount
+			order.PromoRedemptionID = &redemption.ID
+		}
+	}
+	if err := database.DB.Create(&order).Error; err != nil {
+		return nil, fmt.Errorf("创建支付订单失败: %v", err)
+	}
+
+	result, err := provider.CreateCheckout(&order, plan)
+	if err != nil {
+		database.DB.Model(&order).Update("status", "failed")
+		return nil, fmt.Errorf("创建支付会话失败: %v", err)
+	}
+
+	order.ProviderOrderID = result.ProviderOrderID
+	order.CheckoutURL = result.CheckoutURL
+	if err := database.DB.Model(&order).Updates(map[string]interface{}{
+		"provider_order_id": result.ProviderOrderID,
+		"checkout_url":      result.CheckoutURL,
+	}).Error; err != nil {
+		return nil, fmt.Errorf("保存支付会话失败: %v", err)
+	}
+
+	order.Plan = *plan
+	return &order, nil
+}
+
+// CancelPaymentOrder 用户取消未支付的订单
+func CancelPaymentOrder(userID uint, orderNo string) error {
+	result := database.DB.Model(&models.PaymentOrder{}).
+		Where("order_no = ? AND user_id = ? AND status = ?", orderNo, userID, "pending").
+		Updates(map[string]interface{}{
+			"status":     "cancelled",
+			"updated_at": time.Now(),
+		})
+	if result.Error != nil {
+		return result.Error
+	}
+	if result.RowsAffected == 0 {
+		return fmt.Errorf("订单不存在或无法取消")
+	}
+	return nil
+}
+
+// isDuplicateKeyError 判断是否为唯一索引冲突
+func isDuplicateKeyError(err error) bool {
+	if err == nil {
+		return false
+	}
+	if errors.Is(err, gorm.ErrDuplicatedKey) {
+		return true
+	}
+	msg := err.Error()
+	return strings.Contains(msg, "Duplicate entry") || strings.Contains(msg, "UNIQUE constraint failed")
+}
+
+// ProcessPaymentEvent 处理支付渠道事件，同一事件重复回调时直接返回成功
+func ProcessPaymentEvent(providerName string, event *PaymentEvent, payload []byte) error {
+	if event.EventID == "" {
+		return fmt.Errorf("缺少事件ID")
+	}
+
+	err := database.DB.Transaction(func(tx *gorm.DB) error {
+		// 事件记录与业务处理在同一事务中，处理失败时回滚，渠道重试时可以重新处理
+		webhookEvent := models.PaymentWebhookEvent{
+			Provider:  providerName,
+			EventID:   event.EventID,
+			EventType: event.Type,
+			OrderNo:   event.OrderNo,
+			Payload:   string(payload),
+			CreatedAt: time.Now(),
+		}
+		if err := tx.Create(&webhookEvent).Error; err != nil {
+			if isDuplicateKeyError(err) {
+				return errPaymentEventProcessed
+			}
+			return fmt.Errorf("记录支付回调事件失败: %v", err)
+		}
+
+		if event.Type == "" {
+			return nil
+		}
+
+		order, err := lockPaymentOrderTx(tx, providerName, event)
+		if err != nil {
+			return err
+		}
+
+		switch event.Type {
+		case PaymentEventPaid:
+			return markPaymentOrderPaidTx(tx, order, event)
+		case PaymentEventRefunded:
+			// 部分退款不自动处理，记录事件后由管理员人工处理，避免渠道反复重试
+			if isPartialRefund(order, event.Amount) {
+				log.Printf("⚠️ 部分退款需人工处理: order_no=%s, amount=%.2f, refund_amount=%.2f",
+					order.OrderNo, order.Amount, event.Amount)
+				return nil
+			}
+			return markPaymentOrderRefundedTx(tx, order, event.Amount, "支付渠道退款")
+		case PaymentEventExpired, PaymentEventFailed:
+			if order.Status != "pending" {
+				return nil
+			}
+			return tx.Model(order).Updates(map[string]interface{}{
+				"status":     event.Type,
+				"updated_at": time.Now(),
+			}).Error
+		default:
+			return fmt.Errorf("未知的支付事件类型: %s", event.Type)
+		}
+	})
+
+	if errors.Is(err, errPaymentEventProcessed) {
+		log.Printf("支付回调事件已处理，忽略重复事件: provider=%s, event_id=%s", providerName, event.EventID)
+		return nil
+	}
+	return err
+}
+
+// lockPaymentOrderTx 根据事件中的订单号、渠道订单ID或支付ID查找并锁定订单
+func lockPaymentOrderTx(tx *gorm.DB, providerName string, event *PaymentEvent) (*models.PaymentOrder, error) {
+	query := tx.Clauses(clause.Locking{Strength: "UPDATE"}).Where("provider = ?", providerName)
+	switch {
+	case event.OrderNo != "":
+		query = query.Where("order_no = ?", event.OrderNo)
+	case event.ProviderOrderID != "":
+		query = query.Where("provider_order_id = ?", event.ProviderOrderID)
+	case event.ProviderPaymentID != "":
+		query = query.Where("provider_payment_id = ?", event.ProviderPaymentID)
+	default:
+		return nil, fmt.Errorf("支付事件缺少订单标识")
+	}
+
+	var order models.PaymentOrder
+	if err := query.First(&order).Error; err != nil {
+		return nil, fmt.Errorf("支付订单不存在: %v", err)
+	}
+	return &order, nil
+}
+
+// markPaymentOrderPaidTx 标记订单已支付并发放套餐
+func markPaymentOrderPaidTx(tx *gorm.DB, order *models.PaymentOrder, event *PaymentEvent) error {
+	// 已支付或已退款的订单不重复发放
+	if order.Status == "paid" || order.Status == "refunded" {
+		return nil
+	}
+
+	// 金额校验，防止篡改订单金额
+	if event.Amount > 0 && math.Abs(event.Amount-order.Amount) > 0.01 {
+		return fmt.Errorf("支付金额不一致: 订单 %.2f, 实付 %.2f", order.Amount, event.Amount)
+	}
+	if event.Currency != "" && !strings.EqualFold(event.Currency, order.Currency) {
+		return fmt.Errorf("支付币种不一致: 订单 %s, 实付 %s", order.Currency, event.Currency)
+	}
+
+	var currentPlan models.SubscriptionPlan
+	if err := tx.Where("id = ?", order.SubscriptionPlanID).First(&currentPlan).Error; err != nil {
+		return fmt.Errorf("获取订阅计划失败: %v", err)
+	}
+
+	// 按下单时的版本发放，已付款的新购订单计入库存但不受库存上限限制
+	versionedPlan, err := ResolvePlanVersion(tx, &currentPlan, order.PlanVersionID)
+	if err != nil {
+		return err
+	}
+	plan := *versionedPlan
+	if order.SubscriptionID == nil {
+		if err := consumePlanInventoryTx(tx, plan.ID, false); err != nil {
+			return err
+		}
+	}
+
+	// 在同一事务中确保用户钱包存在，发放失败回滚时不会留下空钱包
+	if err := ensureUserWalletTx(tx, order.UserID); err != nil {
+		return fmt.Errorf("获取用户钱包失败: %v", err)
+	}
+
+	// 即使订单已过期或取消，渠道确认收款后仍然发放套餐
+	var record *models.RedemptionRecord
+	switch {
+	case order.SubscriptionID != nil:
+		record, err = renewSubscriptionTx(tx, *order.SubscriptionID, &plan, order.OrderNo, event.InvoiceURL)
+	case plan.IsRecurring:
+		record, err = startRecurringSubscriptionTx(tx, order, &plan, event.InvoiceURL)
+	default:
+		record, err = GrantPlanToWalletTx(tx, order.UserID, &plan, models.RedemptionRecord{
+			SourceType: "payment",
+			SourceID:   order.OrderNo,
+			Reason:     "在线支付购买",
+			InvoiceURL: event.InvoiceURL,
+		})
+	}
+	if err != nil {
+		return err
+	}
+
+	// 折扣记录只用于统计，更新失败不影响已付款订单的发放
+	if err := applyPromoDiscountTx(tx, order); err != nil {
+		log.Printf("⚠️ 更新优惠使用记录失败: order_no=%s, error=%v", order.OrderNo, err)
+	}
+	if _, err := applyPromoBonusTx(tx, order.UserID, &plan, "payment:"+order.OrderNo); err != nil {
+		return err
+	}
+
+	now := time.Now()
+	updates := map[string]interface{}{
+		"status":               "paid",
+		"paid_at":              now,
+		"redemption_record_id": record.ID,
+		"invoice_url":          event.InvoiceURL,
+		"updated_at":           now,
+	}
+	if event.ProviderPaymentID != "" {
+		updates["provider_payment_id"] = event.ProviderPaymentID
+	}
+	return tx.Model(order).Updates(updates).Error
+}
+
+// isPartialRefund 判断退款金额是否小于订单实付金额，金额为空时视为全额退款
+func isPartialRefund(order *models.PaymentOrder, refundAmount float64) bool {
+	return refundAmount > 0 && refundAmount < order.Amount-0.01
+}
+
+// markPaymentOrderRefundedTx 标记订单已全额退款，并在同一事务中撤销订单的全部影响：
+// 收回套餐积分和优惠码额外赠送积分（可用积分不足时收回剩余部分），作废订单使用的优惠，
+// 释放订阅计划库存，取消订单开通或续费的周期订阅
+func markPaymentOrderRefundedTx(tx *gorm.DB, order *models.PaymentOrder, refundAmount float64, reason string) error {
+	if order.Status == "refunded" {
+		return nil
+	}
+	if order.Status != "paid" {
+		return fmt.Errorf("订单状态为 %s，无法退款", order.Status)
+	}
+	if isPartialRefund(order, refundAmount) {
+		return fmt.Errorf("暂不支持部分退款: 订单 %.2f, 退款 %.2f", order.Amount, refundAmount)
+	}
+	refundAmount = order.Amount
+
+	var record models.RedemptionRecord
+	if order.RedemptionRecordID != nil {
+		tx.Where("id = ?", *order.RedemptionRecordID).First(&record)
+	}
+
+	bonus, err := revokePaymentPromoTx(tx, order)
+	if err != nil {
+		return err
+	}
+
+	now := time.Now()
+	if points := record.PointsAmount + bonus; points > 0 {
+		var wallet models.UserWallet
+		if err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).
+			Where("user_id = ?", order.UserID).First(&wallet).Error; err != nil {
+			return fmt.Errorf("获取用户钱包失败: %v", err)
+		}
+
+		revoke := min(points, wallet.AvailablePoints)
+		if revoke > 0 {
+			err := tx.Model(&models.UserWallet{}).Where("user_id = ?", order.UserID).
+				Updates(map[string]interface{}{
+					"total_points":     gorm.Expr("total_points - ?", revoke),
+					"available_points": gorm.Expr("available_points - ?", revoke),
+					"updated_at":       now,
+				}).Error
+			if err != nil {
+				return fmt.Errorf("收回积分失败: %v", err)
+			}
+
+			refundRecord := models.RedemptionRecord{
+				UserID:       order.UserID,
+				SourceType:   "payment_refund",
+				SourceID:     order.OrderNo,
+				PointsAmount: -revoke,
+				ActivatedAt:  now,
+				ExpiresAt:    wallet.WalletExpiresAt,
+				Reason:       fmt.Sprintf("%s，收回积分", reason),
+				CreatedAt:    now,
+				UpdatedAt:    now,
+			}
+			if err := tx.Create(&refundRecord).Error; err != nil {
+				return fmt.Errorf("创建退款记录失败: %v", err)
+			}
+		}
+	}
+
+	// 续费订单支付时未计入库存
+	if order.SubscriptionID == nil {
+		if err := releasePlanInventoryTx(tx, order.SubscriptionPlanID); err != nil {
+			return err
+		}
+	}
+	if err := cancelRefundedSubscriptionTx(tx, order); err != nil {
+		return err
+	}
+
+	return tx.Model(order).Updates(map[string]interface{}{
+		"status":        "refunded",
+		"refund_amount": refundAmount,
+		"refunded_at":   now,
+		"updated_at":    now,
+	}).Error
+}
+
+// RefundPaymentOrder 管理员发起订单退款：先调用渠道退款，成功后本地收回积分
+func RefundPaymentOrder(orderNo, reason string) error {
+	var order models.PaymentOrder
+	if err := database.DB.Where("order_no = ?", orderNo).First(&order).Error; err != nil {
+		return fmt.Errorf("订单不存在")
+	}
+	if order.Status != "paid" {
+		return fmt.Errorf("只有已支付的订单可以退款，当前状态: %s", order.Status)
+	}
+
+	provider, ok := GetPaymentProvider(order.Provider)
+	if !ok {
+		return fmt.Errorf("支付渠道 %s 未启用", order.Provider)
+	}
+	if err := provider.Refund(&order); err != nil {
+		return fmt.Errorf("渠道退款失败: %v", err)
+	}
+
+	if reason == "" {
+		reason = "管理员退款"
+	}
+	return database.DB.Transaction(func(tx *gorm.DB) error {
+		var locked models.PaymentOrder
+		if err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).Where("id = ?", order.ID).First(&locked).Error; err != nil {
+			return err
+		}
+		return markPaymentOrderRefundedTx(tx, &locked, locked.Amount, reason)
+	})
+}
+
+// ExpirePendingPaymentOrders 将超时未支付的订单标记为过期
+func ExpirePendingPaymentOrders() (int64, error) {
+	result := database.DB.Model(&models.PaymentOrder{}).
+		Where("status = ? AND expires_at < ?", "pending", time.Now()).
+		Updates(map[string]interface{}{
+			"status":     "expired",
+			"updated_at": time.Now(),
+		})
+	return result.RowsAffected, result.Error
+}
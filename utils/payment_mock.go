@@ -0,0 +1,91 @@
+package utils
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"net/http"
+
+	"claude/models"
+)
+
+// MockPaymentProvider 模拟支付渠道，用于开发和测试环境
+// 回调请求体为 JSON 格式的 PaymentEvent，签名为请求体的 HMAC-SHA256，放在 X-Mock-Signature 头中
+type MockPaymentProvider struct {
+	secret string
+}
+
+// NewMockPaymentProvider 创建模拟支付渠道
+func NewMockPaymentProvider(secret string) *MockPaymentProvider {
+	return &MockPaymentProvider{secret: secret}
+}
+
+// Name 渠道标识
+func (p *MockPaymentProvider) Name() string {
+	return "mock"
+}
+
+// CreateCheckout 创建模拟支付会话，支付地址为本服务的模拟支付接口（相对路径）
+func (p *MockPaymentProvider) CreateCheckout(order *models.PaymentOrder, plan *models.SubscriptionPlan) (*CheckoutResult, error) {
+	return &CheckoutResult{
+		ProviderOrderID: "mock_" + order.OrderNo,
+		CheckoutURL:     fmt.Sprintf("/api/payments/mock/%s/pay", order.OrderNo),
+	}, nil
+}
+
+// Sign 计算回调请求体签名
+func (p *MockPaymentProvider) Sign(body []byte) string {
+	mac := hmac.New(sha256.New, []byte(p.secret))
+	mac.Write(body)
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+// ParseWebhook 校验签名并解析模拟回调
+func (p *MockPaymentProvider) ParseWebhook(header http.Header, body []byte) (*PaymentEvent, error) {
+	signature := header.Get("X-Mock-Signature")
+	if signature == "" || !hmac.Equal([]byte(signature), []byte(p.Sign(body))) {
+		return nil, ErrPaymentSignature
+	}
+
+	var event PaymentEvent
+	if err := json.Unmarshal(body, &event); err != nil {
+		return nil, fmt.Errorf("解析回调数据失败: %v", err)
+	}
+	return &event, nil
+}
+
+// Refund 模拟退款，直接返回成功
+func (p *MockPaymentProvider) Refund(order *models.PaymentOrder) error {
+	return nil
+}
+
+// CompletePayment 构造带签名的支付成功回调，并走与真实渠道相同的回调处理流程
+func (p *MockPaymentProvider) CompletePayment(order *models.PaymentOrder) error {
+	body, err := json.Marshal(PaymentEvent{
+		EventID:           "mock_evt_" + order.OrderNo,
+		Type:              PaymentEventPaid,
+		OrderNo:           order.OrderNo,
+		ProviderOrderID:   order.ProviderOrderID,
+		ProviderPaymentID: "mock_pay_" + order.OrderNo,
+		Amount:            order.Amount,
+		Currency:          order.Currency,
+	})
+	if err != nil {
+		return err
+	}
+
+	header := http.Header{}
+	header.Set("X-Mock-Signature", p.Sign(body))
+	event, err := p.ParseWebhook(header, body)
+	if err != nil {
+		return err
+	}
+	return ProcessPaymentEvent(p.Name(), event, body)
+}
+
+// ChargeRenewal 模拟续费自动扣款，直接视为支付成功
+func (p *MockPaymentProvider) ChargeRenewal(order *models.PaymentOrder) error {
+	return p.CompletePayment(order)
+}
@@ -0,0 +1,277 @@
+package utils
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"math"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"claude/config"
+	"claude/models"
+)
+
+const (
+	stripeAPIBaseURL = "https://api.stripe.com/v1"
+	// stripeSignatureTolerance 回调签名时间戳允许的最大偏差
+	stripeSignatureTolerance = 5 * time.Minute
+)
+
+// StripeProvider Stripe 支付渠道，使用 Checkout Session 收款
+type StripeProvider struct {
+	secretKey     string
+	webhookSecret string
+	client        *http.Client
+}
+
+// NewStripeProvider 创建 Stripe 支付渠道
+func NewStripeProvider(secretKey, webhookSecret string) *StripeProvider {
+	return &StripeProvider{
+		secretKey:     secretKey,
+		webhookSecret: webhookSecret,
+		client:        &http.Client{Timeout: 30 * time.Second},
+	}
+}
+
+// Name 渠道标识
+func (p *StripeProvider) Name() string {
+	return "stripe"
+}
+
+// stripeAmount 将金额转换为 Stripe 使用的最小货币单位
+func stripeAmount(amount float64) int64 {
+	return int64(math.Round(amount * 100))
+}
+
+// post 调用 Stripe API
+func (p *StripeProvider) post(path string, form url.Values, result interface{}) error {
+	req, err := http.NewRequest("POST", stripeAPIBaseURL+path, strings.NewReader(form.Encode()))
+	if err != nil {
+		return err
+	}
+	req.SetBasicAuth(p.secretKey, "")
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+
+	resp, err := p.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return err
+	}
+	if resp.StatusCode != http.StatusOK {
+		var apiErr struct {
+			Error struct {
+				Message string `json:"message"`
+			} `json:"error"`
+		}
+		json.Unmarshal(body, &apiErr)
+		return fmt.Errorf("Stripe 返回错误 (%d): %s", resp.StatusCode, apiErr.Error.Message)
+	}
+
+	return json.Unmarshal(body, result)
+}
+
+// stripeSessionExpiresAt Checkout Session 的过期时间必须在创建后30分钟到24小时之间，
+// 周期订阅续费订单的有效期覆盖整个宽限期，会话过期后由用户重新发起支付
+func stripeSessionExpiresAt(expiresAt time.Time) time.Time {
+	earliest := time.Now().Add(31 * time.Minute)
+	latest := time.Now().Add(23 * time.Hour)
+	if expiresAt.Before(earliest) {
+		return earliest
+	}
+	if expiresAt.After(latest) {
+		return latest
+	}
+	return expiresAt
+}
+
+// CreateCheckout 创建 Stripe Checkout Session
+func (p *StripeProvider) CreateCheckout(order *models.PaymentOrder, plan *models.SubscriptionPlan) (*CheckoutResult, error) {
+	returnURL := fmt.Sprintf("%s/payment/result?order_no=%s", config.AppConfig.FrontendURL, order.OrderNo)
+
+	form := url.Values{}
+	form.Set("mode", "payment")
+	form.Set("client_reference_id", order.OrderNo)
+	form.Set("success_url", returnURL)
+	form.Set("cancel_url", returnURL)
+	form.Set("expires_at", strconv.FormatInt(stripeSessionExpiresAt(order.ExpiresAt).Unix(), 10))
+	form.Set("metadata[order_no]", order.OrderNo)
+	form.Set("payment_intent_data[metadata][order_no]", order.OrderNo)
+	form.Set("invoice_creation[enabled]", "true")
+	form.Set("line_items[0][quantity]", "1")
+	form.Set("line_items[0][price_data][currency]", strings.ToLower(order.Currency))
+	form.Set("line_items[0][price_data][unit_amount]", strconv.FormatInt(stripeAmount(order.Amount), 10))
+	form.Set("line_items[0][price_data][product_data][name]", plan.Title)
+
+	var session struct {
+		ID  string `json:"id"`
+		URL string `json:"url"`
+	}
+	if err := p.post("/checkout/sessions", form, &session); err != nil {
+		return nil, err
+	}
+
+	return &CheckoutResult{
+		ProviderOrderID: session.ID,
+		CheckoutURL:     session.URL,
+	}, nil
+}
+
+// verifySignature 校验 Stripe-Signature 头（t=时间戳,v1=签名）
+func (p *StripeProvider) verifySignature(header string, body []byte) error {
+	if p.webhookSecret == "" || header == "" {
+		return ErrPaymentSignature
+	}
+
+	var timestamp string
+	var signatures []string
+	for _, part := range strings.Split(header, ",") {
+		kv := strings.SplitN(strings.TrimSpace(part), "=", 2)
+		if len(kv) != 2 {
+			continue
+		}
+		switch kv[0] {
+		case "t":
+			timestamp = kv[1]
+		case "v1":
+			signatures = append(signatures, kv[1])
+		}
+	}
+
+	ts, err := strconv.ParseInt(timestamp, 10, 64)
+	if err != nil || len(signatures) == 0 {
+		return ErrPaymentSignature
+	}
+	if diff := time.Since(time.Unix(ts, 0)); diff > stripeSignatureTolerance || diff < -stripeSignatureTolerance {
+		return ErrPaymentSignature
+	}
+
+	mac := hmac.New(sha256.New, []byte(p.webhookSecret))
+	mac.Write([]byte(timestamp + "."))
+	mac.Write(body)
+	expected := hex.EncodeToString(mac.Sum(nil))
+	for _, signature := range signatures {
+		if hmac.Equal([]byte(signature), []byte(expected)) {
+			return nil
+		}
+	}
+	return ErrPaymentSignature
+}
+
+// ParseWebhook 校验签名并将 Stripe 事件转换为标准化事件
+func (p *StripeProvider) ParseWebhook(header http.Header, body []byte) (*PaymentEvent, error) {
+	if err := p.verifySignature(header.Get("Stripe-Signature"), body); err != nil {
+		return nil, err
+	}
+
+	var stripeEvent struct {
+		ID   string `json:"id"`
+		Type string `json:"type"`
+		Data struct {
+			Object json.RawMessage `json:"object"`
+		} `json:"data"`
+	}
+	if err := json.Unmarshal(body, &stripeEvent); err != nil {
+		return nil, fmt.Errorf("解析回调数据失败: %v", err)
+	}
+
+	event := &PaymentEvent{EventID: stripeEvent.ID}
+
+	switch stripeEvent.Type {
+	case "checkout.session.completed", "checkout.session.async_payment_succeeded",
+		"checkout.session.expired", "checkout.session.async_payment_failed":
+		var session struct {
+			ID                string `json:"id"`
+			ClientReferenceID string `json:"client_reference_id"`
+			PaymentIntent     string `json:"payment_intent"`
+			PaymentStatus     string `json:"payment_status"`
+			AmountTotal       int64  `json:"amount_total"`
+			Currency          string `json:"currency"`
+			Invoice           string `json:"invoice"`
+		}
+		if err := json.Unmarshal(stripeEvent.Data.Object, &session); err != nil {
+			return nil, fmt.Errorf("解析 Checkout Session 失败: %v", err)
+		}
+
+		event.OrderNo = session.ClientReferenceID
+		event.ProviderOrderID = session.ID
+		event.ProviderPaymentID = session.PaymentIntent
+		event.Amount = float64(session.AmountTotal) / 100
+		event.Currency = session.Currency
+		if session.Invoice != "" {
+			event.InvoiceURL = "https://dashboard.stripe.com/invoices/" + session.Invoice
+		}
+
+		switch stripeEvent.Type {
+		case "checkout.session.completed":
+			// 异步支付方式在 completed 时尚未到账，等待 async_payment_succeeded
+			if session.PaymentStatus == "paid" {
+				event.Type = PaymentEventPaid
+			}
+		case "checkout.session.async_payment_succeeded":
+			event.Type = PaymentEventPaid
+		case "checkout.session.expired":
+			event.Type = PaymentEventExpired
+		case "checkout.session.async_payment_failed":
+			event.Type = PaymentEventFailed
+		}
+	case "charge.refunded":
+		var charge struct {
+			PaymentIntent  string `json:"payment_intent"`
+			AmountRefunded int64  `json:"amount_refunded"`
+			Refunded       bool   `json:"refunded"`
+			Currency       string `json:"currency"`
+			Metadata       struct {
+				OrderNo string `json:"order_no"`
+			} `json:"metadata"`
+		}
+		if err := json.Unmarshal(stripeEvent.Data.Object, &charge); err != nil {
+			return nil, fmt.Errorf("解析 Charge 失败: %v", err)
+		}
+
+		// 只处理全额退款，部分退款由管理员人工处理
+		if charge.Refunded {
+			event.Type = PaymentEventRefunded
+			event.OrderNo = charge.Metadata.OrderNo
+			event.ProviderPaymentID = charge.PaymentIntent
+			event.Amount = float64(charge.AmountRefunded) / 100
+			event.Currency = charge.Currency
+		}
+	}
+
+	return event, nil
+}
+
+// Refund 通过 PaymentIntent 发起全额退款
+func (p *StripeProvider) Refund(order *models.PaymentOrder) error {
+	if order.ProviderPaymentID == "" {
+		return fmt.Errorf("订单缺少支付ID，无法退款")
+	}
+
+	form := url.Values{}
+	form.Set("payment_intent", order.ProviderPaymentID)
+	form.Set("metadata[order_no]", order.OrderNo)
+
+	var refund struct {
+		ID     string `json:"id"`
+		Status string `json:"status"`
+	}
+	if err := p.post("/refunds", form, &refund); err != nil {
+		return err
+	}
+	if refund.Status == "failed" || refund.Status == "canceled" {
+		return fmt.Errorf("Stripe 退款失败，状态: %s", refund.Status)
+	}
+	return nil
+}
@@ -0,0 +1,252 @@
+package utils
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"reflect"
+	"sort"
+	"time"
+
+	"claude/database"
+	"claude/models"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// ErrPlanSoldOut 订阅计划库存已发完
+var ErrPlanSoldOut = errors.New("该订阅计划已售罄。")
+
+// PlanVersionFieldDiff 两个版本之间的字段差异
+type PlanVersionFieldDiff struct {
+	Field string      `json:"field"`
+	From  interface{} `json:"from"`
+	To    interface{} `json:"to"`
+}
+
+// PlanVersionDiff 版本对比结果
+type PlanVersionDiff struct {
+	SubscriptionPlanID uint                           `json:"subscription_plan_id"`
+	From               models.SubscriptionPlanVersion `json:"from"`
+	To                 models.SubscriptionPlanVersion `json:"to"`
+	Changes            []PlanVersionFieldDiff         `json:"changes"`
+}
+
+// planVersionSnapshot 根据订阅计划当前的权益配置生成版本快照（不含版本号）
+func planVersionSnapshot(plan *models.SubscriptionPlan) models.SubscriptionPlanVersion {
+	return models.SubscriptionPlanVersion{
+		SubscriptionPlanID:    plan.ID,
+		Title:                 plan.Title,
+		Description:           plan.Description,
+		PointAmount:           plan.PointAmount,
+		Price:                 plan.Price,
+		Currency:              plan.Currency,
+		ValidityDays:          plan.ValidityDays,
+		DegradationGuaranteed: plan.DegradationGuaranteed,
+		DailyCheckinPoints:    plan.DailyCheckinPoints,
+		DailyCheckinPointsMax: plan.DailyCheckinPointsMax,
+		DailyMaxPoints:        plan.DailyMaxPoints,
+		AutoRefillEnabled:     plan.AutoRefillEnabled,
+		AutoRefillThreshold:   plan.AutoRefillThreshold,
+		AutoRefillAmount:      plan.AutoRefillAmount,
+		IsRecurring:           plan.IsRecurring,
+		RolloverCap:           plan.RolloverCap,
+		Features:              plan.Features,
+	}
+}
+
+// planVersionFields 获取版本中参与对比的权益字段，以 json 字段名为键
+func planVersionFields(version *models.SubscriptionPlanVersion) map[string]interface{} {
+	fields := map[string]interface{}{}
+	data, _ := json.Marshal(version)
+	json.Unmarshal(data, &fields)
+	for _, key := range []string{"id", "subscription_plan_id", "version", "change_note", "created_by", "created_at"} {
+		delete(fields, key)
+	}
+	return fields
+}
+
+// diffPlanVersionFields 对比两个版本的权益字段，按字段名排序
+func diffPlanVersionFields(from, to *models.SubscriptionPlanVersion) []PlanVersionFieldDiff {
+	fromFields := planVersionFields(from)
+	toFields := planVersionFields(to)
+
+	changes := []PlanVersionFieldDiff{}
+	for field, toValue := range toFields {
+		if fromValue := fromFields[field]; !reflect.DeepEqual(fromValue, toValue) {
+			changes = append(changes, PlanVersionFieldDiff{Field: field, From: fromValue, To: toValue})
+		}
+	}
+	sort.Slice(changes, func(i, j int) bool {
+		return changes[i].Field < changes[j].Field
+	})
+	return changes
+}
+
+// ApplyPlanVersion 用版本快照覆盖订阅计划的权益字段，返回按该版本发放的订阅计划
+// 启用状态、上下架时间和库存仍以订阅计划当前配置为准
+func ApplyPlanVersion(plan models.SubscriptionPlan, version *models.SubscriptionPlanVersion) *models.SubscriptionPlan {
+	plan.Title = version.Title
+	plan.Description = version.Description
+	plan.PointAmount = version.PointAmount
+	plan.Price = version.Price
+	plan.Currency = version.Currency
+	plan.ValidityDays = version.ValidityDays
+	plan.DegradationGuaranteed = version.DegradationGuaranteed
+	plan.DailyCheckinPoints = version.DailyCheckinPoints
+	plan.DailyCheckinPointsMax = version.DailyCheckinPointsMax
+	plan.DailyMaxPoints = version.DailyMaxPoints
+	plan.AutoRefillEnabled = version.AutoRefillEnabled
+	plan.AutoRefillThreshold = version.AutoRefillThreshold
+	plan.AutoRefillAmount = version.AutoRefillAmount
+	plan.IsRecurring = version.IsRecurring
+	plan.RolloverCap = version.RolloverCap
+	plan.Features = version.Features
+	plan.CurrentVersion = version.Version
+	plan.CurrentVersionID = &version.ID
+	return &plan
+}
+
+// ResolvePlanVersion 获取指定版本的订阅计划，versionID 为空时（历史数据）使用订阅计划当前配置
+func ResolvePlanVersion(db *gorm.DB, plan *models.SubscriptionPlan, versionID *uint) (*models.SubscriptionPlan, error) {
+	if versionID == nil {
+		return plan, nil
+	}
+	var version models.SubscriptionPlanVersion
+	if err := db.Where("id = ? AND subscription_plan_id = ?", *versionID, plan.ID).First(&version).Error; err != nil {
+		return nil, fmt.Errorf("获取订阅计划版本失败: %v", err)
+	}
+	return ApplyPlanVersion(*plan, &version), nil
+}
+
+// CreatePlanVersionTx 在事务中为订阅计划生成新版本，权益字段与当前版本相同时不生成，返回当前版本和是否新建
+func CreatePlanVersionTx(tx *gorm.DB, planID uint, note string, adminUserID *uint) (*models.SubscriptionPlanVersion, bool, error) {
+	var plan models.SubscriptionPlan
+	if err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).Where("id = ?", planID).First(&plan).Error; err != nil {
+		return nil, false, fmt.Errorf("获取订阅计划失败: %v", err)
+	}
+
+	version := planVersionSnapshot(&plan)
+	if plan.CurrentVersionID != nil {
+		var current models.SubscriptionPlanVersion
+		if err := tx.Where("id = ?", *plan.CurrentVersionID).First(&current).Error; err == nil &&
+			len(diffPlanVersionFields(&current, &version)) == 0 {
+			return &current, false, nil
+		}
+	}
+
+	version.Version = plan.CurrentVersion + 1
+	version.ChangeNote = note
+	version.CreatedBy = adminUserID
+	if err := tx.Create(&version).Error; err != nil {
+		return nil, false, fmt.Errorf("创建订阅计划版本失败: %v", err)
+	}
+
+	if err := tx.Model(&models.SubscriptionPlan{}).Where("id = ?", planID).Updates(map[string]interface{}{
+		"current_version":    version.Version,
+		"current_version_id": version.ID,
+	}).Error; err != nil {
+		return nil, false, fmt.Errorf("更新订阅计划版本失败: %v", err)
+	}
+	return &version, true, nil
+}
+
+// GetPlanVersions 获取订阅计划的全部版本，最新版本在前
+func GetPlanVersions(planID uint) ([]models.SubscriptionPlanVersion, error) {
+	versions := []models.SubscriptionPlanVersion{}
+	if err := database.DB.Where("subscription_plan_id = ?", planID).Order("version DESC").Find(&versions).Error; err != nil {
+		return nil, fmt.Errorf("获取订阅计划版本失败: %v", err)
+	}
+	return versions, nil
+}
+
+// DiffPlanVersions 对比订阅计划的两个版本
+func DiffPlanVersions(planID uint, fromVersion, toVersion int) (*PlanVersionDiff, error) {
+	var from, to models.SubscriptionPlanVersion
+	if err := database.DB.Where("subscription_plan_id = ? AND version = ?", planID, fromVersion).First(&from).Error; err != nil {
+		return nil, fmt.Errorf("版本 %d 不存在", fromVersion)
+	}
+	if err := database.DB.Where("subscription_plan_id = ? AND version = ?", planID, toVersion).First(&to).Error; err != nil {
+		return nil, fmt.Errorf("版本 %d 不存在", toVersion)
+	}
+
+	return &PlanVersionDiff{
+		SubscriptionPlanID: planID,
+		From:               from,
+		To:                 to,
+		Changes:            diffPlanVersionFields(&from, &to),
+	}, nil
+}
+
+// CheckPlanAvailability 检查订阅计划当前是否可兑换或购买：启用状态、上下架时间和库存
+func CheckPlanAvailability(plan *models.SubscriptionPlan) error {
+	now := time.Now()
+	if !plan.Active {
+		return fmt.Errorf("该订阅计划已停用。")
+	}
+	if plan.AvailableFrom != nil && plan.AvailableFrom.After(now) {
+		return fmt.Errorf("该订阅计划将于 %s 开放。", plan.AvailableFrom.Format("2006-01-02 15:04"))
+	}
+	if plan.AvailableUntil != nil && !plan.AvailableUntil.After(now) {
+		return fmt.Errorf("该订阅计划已下架。")
+	}
+	if plan.InventoryCap > 0 && plan.InventoryUsed >= plan.InventoryCap {
+		return ErrPlanSoldOut
+	}
+	return nil
+}
+
+// consumePlanInventoryTx 在事务中扣减订阅计划库存
+// enforce 为 true 时库存不足返回 ErrPlanSoldOut；已付款的订单不受库存限制，只累计数量
+func consumePlanInventoryTx(tx *gorm.DB, planID uint, enforce bool) error {
+	query := tx.Model(&models.SubscriptionPlan{}).Where("id = ?", planID)
+	if enforce {
+		query = query.Where("inventory_cap = 0 OR inventory_used < inventory_cap")
+	}
+	result := query.Update("inventory_used", gorm.Expr("inventory_used + 1"))
+	if result.Error != nil {
+		return fmt.Errorf("更新订阅计划库存失败: %v", result.Error)
+	}
+	if enforce && result.RowsAffected == 0 {
+		return ErrPlanSoldOut
+	}
+	return nil
+}
+
+// releasePlanInventoryTx 订单退款后释放已计入的订阅计划库存
+func releasePlanInventoryTx(tx *gorm.DB, planID uint) error {
+	err := tx.Model(&models.SubscriptionPlan{}).Where("id = ? AND inventory_used > 0", planID).
+		Update("inventory_used", gorm.Expr("inventory_used - 1")).Error
+	if err != nil {
+		return fmt.Errorf("释放订阅计划库存失败: %v", err)
+	}
+	return nil
+}
+
+// UpdatePlanSchedule 设置订阅计划的上下架时间和库存上限，时间为空表示不限制
+func UpdatePlanSchedule(planID uint, availableFrom, availableUntil *time.Time, inventoryCap int64) (*models.SubscriptionPlan, error) {
+	if availableFrom != nil && availableUntil != nil && !availableUntil.After(*availableFrom) {
+		return nil, fmt.Errorf("下架时间必须晚于上架时间")
+	}
+	if inventoryCap < 0 {
+		return nil, fmt.Errorf("库存上限不能为负数")
+	}
+
+	var plan models.SubscriptionPlan
+	if err := database.DB.Where("id = ?", planID).First(&plan).Error; err != nil {
+		return nil, fmt.Errorf("订阅计划不存在")
+	}
+
+	if err := database.DB.Model(&plan).Updates(map[string]interface{}{
+		"available_from":  availableFrom,
+		"available_until": availableUntil,
+		"inventory_cap":   inventoryCap,
+	}).Error; err != nil {
+		return nil, fmt.Errorf("更新订阅计划失败: %v", err)
+	}
+	plan.AvailableFrom = availableFrom
+	plan.AvailableUntil = availableUntil
+	plan.InventoryCap = inventoryCap
+	return &plan, nil
+}
@@ -0,0 +1,430 @@
+package utils
+
+import (
+	"fmt"
+	"log"
+	"math"
+	"strings"
+	"time"
+
+	"claude/database"
+	"claude/models"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// 优惠码奖励类型
+const (
+	PromoRewardPoints          = "points"           // 立即发放积分
+	PromoRewardBonusPercent    = "bonus_percent"    // 下次兑换/购买套餐时额外赠送积分
+	PromoRewardDiscountPercent = "discount_percent" // 下次在线购买套餐时打折
+)
+
+// PromoPreview 优惠码预览信息
+type PromoPreview struct {
+	Code               string     `json:"code"`
+	Name               string     `json:"name"`
+	Description        string     `json:"description"`
+	RewardType         string     `json:"reward_type"`
+	PointsAmount       int64      `json:"points_amount,omitempty"`
+	ValidityDays       int        `json:"validity_days,omitempty"`
+	Percent            int        `json:"percent,omitempty"`
+	SubscriptionPlanID *uint      `json:"subscription_plan_id,omitempty"`
+	EndsAt             *time.Time `json:"ends_at,omitempty"`
+	Summary            string     `json:"summary"`
+}
+
+// NormalizePromoCode 优惠码统一使用大写，不区分大小写
+func NormalizePromoCode(code string) string {
+	return strings.ToUpper(strings.TrimSpace(code))
+}
+
+// ValidatePromoCode 校验优惠码配置
+func ValidatePromoCode(promo *models.PromoCode) error {
+	if promo.Code == "" || promo.Name == "" {
+		return fmt.Errorf("优惠码和名称不能为空")
+	}
+	switch promo.RewardType {
+	case PromoRewardPoints:
+		if promo.PointsAmount <= 0 || promo.ValidityDays <= 0 {
+			return fmt.Errorf("积分类优惠码必须设置积分数量和有效期")
+		}
+	case PromoRewardBonusPercent:
+		if promo.Percent <= 0 || promo.Percent > 100 {
+			return fmt.Errorf("额外赠送比例必须在1-100之间")
+		}
+	case PromoRewardDiscountPercent:
+		// 不支持免单，支付渠道无法创建0元订单
+		if promo.Percent <= 0 || promo.Percent >= 100 {
+			return fmt.Errorf("折扣比例必须在1-99之间")
+		}
+	default:
+		return fmt.Errorf("不支持的奖励类型: %s", promo.RewardType)
+	}
+	if promo.MaxUses < 0 || promo.PerUserLimit < 0 {
+		return fmt.Errorf("使用次数限制不能为负数")
+	}
+	if promo.StartsAt != nil && promo.EndsAt != nil && !promo.EndsAt.After(*promo.StartsAt) {
+		return fmt.Errorf("失效时间必须晚于生效时间")
+	}
+	return nil
+}
+
+// FindPromoCode 根据优惠码查找
+func FindPromoCode(code string) (*models.PromoCode, error) {
+	var promo models.PromoCode
+	if err := database.DB.Where("code = ?", NormalizePromoCode(code)).First(&promo).Error; err != nil {
+		return nil, err
+	}
+	return &promo, nil
+}
+
+// checkPromoEligibilityTx 检查用户是否满足优惠码的使用条件
+func checkPromoEligibilityTx(tx *gorm.DB, promo *models.PromoCode, userID uint) error {
+	now := time.Now()
+	if !promo.Active {
+		return fmt.Errorf("该优惠码已停用")
+	}
+	if promo.StartsAt != nil && now.Before(*promo.StartsAt) {
+		return fmt.Errorf("该优惠码活动尚未开始")
+	}
+	if promo.EndsAt != nil && now.After(*promo.EndsAt) {
+		return fmt.Errorf("该优惠码已过期")
+	}
+	if promo.MaxUses > 0 && promo.UsedCount >= promo.MaxUses {
+		return fmt.Errorf("该优惠码已被领完")
+	}
+
+	var userUses int64
+	tx.Model(&models.PromoRedemption{}).Where("promo_code_id = ? AND user_id = ?", promo.ID, userID).Count(&userUses)
+	if promo.PerUserLimit > 0 && userUses >= int64(promo.PerUserLimit) {
+		return fmt.Errorf("您已使用过该优惠码")
+	}
+
+	if promo.NewUsersOnly {
+		var purchases int64
+		tx.Model(&models.RedemptionRecord{}).
+			Where("user_id = ? AND source_type IN ?", userID, []string{"activation_code", "payment", "subscription_renewal"}).
+			Count(&purchases)
+		if purchases > 0 {
+			return fmt.Errorf("该优惠码仅限新用户使用")
+		}
+	}
+
+	if promo.OAuthProvider != "" {
+		var bound int64
+		tx.Model(&models.OAuthAccount{}).Where("user_id = ? AND provider = ?", userID, promo.OAuthProvider).Count(&bound)
+		if bound == 0 {
+			return fmt.Errorf("该优惠码仅限绑定 %s 账号的用户使用", promo.OAuthProvider)
+		}
+	}
+
+	// 同类型的待使用优惠只能持有一个，避免下次兑换时叠加
+	if promo.RewardType != PromoRewardPoints {
+		var pending int64
+		tx.Model(&models.PromoRedemption{}).
+			Where("user_id = ? AND reward_type = ? AND status = ?", userID, promo.RewardType, "claimed").
+			Count(&pending)
+		if pending > 0 {
+			return fmt.Errorf("您已有一个未使用的同类优惠，请先使用后再领取")
+		}
+	}
+
+	return nil
+}
+
+// PromoSummary 优惠内容描述
+func PromoSummary(promo *models.PromoCode) string {
+	scope := "下次兑换或购买套餐时"
+	if promo.SubscriptionPlanID != nil {
+		scope = "下次兑换或购买指定套餐时"
+	}
+	switch promo.RewardType {
+	case PromoRewardPoints:
+		return fmt.Sprintf("立即获得 %d 积分，有效期 %d 天", promo.PointsAmount, promo.ValidityDays)
+	case PromoRewardBonusPercent:
+		return fmt.Sprintf("%s额外赠送 %d%% 积分", scope, promo.Percent)
+	case PromoRewardDiscountPercent:
+		if promo.SubscriptionPlanID != nil {
+			return fmt.Sprintf("下次在线购买指定套餐时享 %d%% 折扣", promo.Percent)
+		}
+		return fmt.Sprintf("下次在线购买套餐时享 %d%% 折扣", promo.Percent)
+	}
+	return ""
+}
+
+// PreviewPromoCode 预览优惠码内容并检查使用条件，不执行领取
+func PreviewPromoCode(userID uint, code string) (*PromoPreview, error) {
+	promo, err := FindPromoCode(code)
+	if err != nil {
+		return nil, fmt.Errorf("无效的优惠码")
+	}
+	if err := checkPromoEligibilityTx(database.DB, promo, userID); err != nil {
+		return nil, err
+	}
+
+	return &PromoPreview{
+		Code:               promo.Code,
+		Name:               promo.Name,
+		Description:        promo.Description,
+		RewardType:         promo.RewardType,
+		PointsAmount:       promo.PointsAmount,
+		ValidityDays:       promo.ValidityDays,
+		Percent:            promo.Percent,
+		SubscriptionPlanID: promo.SubscriptionPlanID,
+		EndsAt:             promo.EndsAt,
+		Summary:            PromoSummary(promo),
+	}, nil
+}
+
+// RedeemPromoCode 使用优惠码：积分类立即发放，额外赠送和折扣类领取后在下次兑换/购买时自动生效
+func RedeemPromoCode(userID uint, code string) (*models.PromoRedemption, *models.PromoCode, error) {
+	if _, err := GetOrCreateUserWallet(userID); err != nil {
+		return nil, nil, fmt.Errorf("获取用户钱包失败: %v", err)
+	}
+
+	var promo models.PromoCode
+	var redemption models.PromoRedemption
+	err := database.DB.Transaction(func(tx *gorm.DB) error {
+		// 锁定优惠码，保证使用次数统计准确
+		if err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).
+			Where("code = ?", NormalizePromoCode(code)).First(&promo).Error; err != nil {
+			return fmt.Errorf("无效的优惠码")
+		}
+		if err := checkPromoEligibilityTx(tx, &promo, userID); err != nil {
+			return err
+		}
+
+		if err := tx.Model(&models.PromoCode{}).Where("id = ?", promo.ID).
+			Update("used_count", gorm.Expr("used_count + 1")).Error; err != nil {
+			return fmt.Errorf("更新优惠码使用次数失败: %v", err)
+		}
+
+		now := time.Now()
+		redemption = models.PromoRedemption{
+			PromoCodeID: promo.ID,
+			UserID:      userID,
+			Status:      "claimed",
+			RewardType:  promo.RewardType,
+			CreatedAt:   now,
+			UpdatedAt:   now,
+		}
+
+		if promo.RewardType == PromoRewardPoints {
+			if err := grantPromoPointsTx(tx, userID, &promo); err != nil {
+				return err
+			}
+			redemption.Status = "applied"
+			redemption.PointsAmount = promo.PointsAmount
+			redemption.AppliedSource = "promo_code:" + promo.Code
+			redemption.AppliedAt = &now
+		}
+
+		if err := tx.Create(&redemption).Error; err != nil {
+			return fmt.Errorf("创建优惠码使用记录失败: %v", err)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, nil, err
+	}
+
+	return &redemption, &promo, nil
+}
+
+// grantPromoPointsTx 发放积分类优惠码的积分
+func grantPromoPointsTx(tx *gorm.DB, userID uint, promo *models.PromoCode) error {
+	var wallet models.UserWallet
+	if err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).Where("user_id = ?", userID).First(&wallet).Error; err != nil {
+		return fmt.Errorf("获取用户钱包失败: %v", err)
+	}
+
+	now := time.Now()
+	expiresAt := maxTime(wallet.WalletExpiresAt, now.AddDate(0, 0, promo.ValidityDays))
+	err := tx.Model(&models.UserWallet{}).Where("user_id = ?", userID).Updates(map[string]interface{}{
+		"total_points":      gorm.Expr("total_points + ?", promo.PointsAmount),
+		"available_points":  gorm.Expr("available_points + ?", promo.PointsAmount),
+		"wallet_expires_at": expiresAt,
+		"status":            "active",
+		"updated_at":        now,
+	}).Error
+	if err != nil {
+		return fmt.Errorf("更新用户钱包失败: %v", err)
+	}
+
+	record := models.RedemptionRecord{
+		UserID:       userID,
+		SourceType:   "promo_code",
+		SourceID:     promo.Code,
+		PointsAmount: promo.PointsAmount,
+		ValidityDays: promo.ValidityDays,
+		ActivatedAt:  now,
+		ExpiresAt:    expiresAt,
+		Reason:       fmt.Sprintf("优惠码奖励 - %s", promo.Name),
+		CreatedAt:    now,
+		UpdatedAt:    now,
+	}
+	if err := tx.Create(&record).Error; err != nil {
+		return fmt.Errorf("创建兑换记录失败: %v", err)
+	}
+	return nil
+}
+
+// findClaimedPromoTx 查找用户已领取且适用于指定套餐的待使用优惠
+func findClaimedPromoTx(tx *gorm.DB, userID, planID uint, rewardType string, lock bool) (*models.PromoRedemption, error) {
+	// 优惠码删除后，已领取的优惠仍然有效
+	query := tx.Preload("PromoCode", func(db *gorm.DB) *gorm.DB { return db.Unscoped() })
+	if lock {
+		query = query.Clauses(clause.Locking{Strength: "UPDATE"})
+	}
+
+	var redemptions []models.PromoRedemption
+	if err := query.Where("user_id = ? AND reward_type = ? AND status = ?", userID, rewardType, "claimed").
+		Order("created_at ASC").Find(&redemptions).Error; err != nil {
+		return nil, err
+	}
+	for i := range redemptions {
+		planLimit := redemptions[i].PromoCode.SubscriptionPlanID
+		if planLimit == nil || *planLimit == planID {
+			return &redemptions[i], nil
+		}
+	}
+	return nil, gorm.ErrRecordNotFound
+}
+
+// GetPendingPromoBonus 计算下次兑换/购买指定套餐时可额外获得的积分
+func GetPendingPromoBonus(userID uint, plan *models.SubscriptionPlan) int64 {
+	redemption, err := findClaimedPromoTx(database.DB, userID, plan.ID, PromoRewardBonusPercent, false)
+	if err != nil {
+		return 0
+	}
+	return plan.PointAmount * int64(redemption.PromoCode.Percent) / 100
+}
+
+// applyPromoBonusTx 兑换/购买套餐后发放已领取的额外赠送积分，返回赠送数量
+func applyPromoBonusTx(tx *gorm.DB, userID uint, plan *models.SubscriptionPlan, source string) (int64, error) {
+	redemption, err := findClaimedPromoTx(tx, userID, plan.ID, PromoRewardBonusPercent, true)
+	if err == gorm.ErrRecordNotFound {
+		return 0, nil
+	} else if err != nil {
+		return 0, fmt.Errorf("查询优惠失败: %v", err)
+	}
+
+	bonus := plan.PointAmount * int64(redemption.PromoCode.Percent) / 100
+	if bonus <= 0 {
+		return 0, nil
+	}
+
+	var wallet models.UserWallet
+	if err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).Where("user_id = ?", userID).First(&wallet).Error; err != nil {
+		return 0, fmt.Errorf("获取用户钱包失败: %v", err)
+	}
+
+	now := time.Now()
+	err = tx.Model(&models.UserWallet{}).Where("user_id = ?", userID).Updates(map[string]interface{}{
+		"total_points":     gorm.Expr("total_points + ?", bonus),
+		"available_points": gorm.Expr("available_points + ?", bonus),
+		"updated_at":       now,
+	}).Error
+	if err != nil {
+		return 0, fmt.Errorf("发放额外赠送积分失败: %v", err)
+	}
+
+	record := models.RedemptionRecord{
+		UserID:       userID,
+		SourceType:   "promo_bonus",
+		SourceID:     redemption.PromoCode.Code,
+		PointsAmount: bonus,
+		ValidityDays: max(validityDaysUntil(wallet.WalletExpiresAt), 0),
+		ActivatedAt:  now,
+		ExpiresAt:    wallet.WalletExpiresAt,
+		Reason:       fmt.Sprintf("优惠码额外赠送 %d%% 积分 - %s", redemption.PromoCode.Percent, redemption.PromoCode.Name),
+		CreatedAt:    now,
+		UpdatedAt:    now,
+	}
+	if err := tx.Create(&record).Error; err != nil {
+		return 0, fmt.Errorf("创建兑换记录失败: %v", err)
+	}
+
+	err = tx.Model(&models.PromoRedemption{}).Where("id = ?", redemption.ID).Updates(map[string]interface{}{
+		"status":         "applied",
+		"points_amount":  bonus,
+		"applied_source": source,
+		"applied_at":     now,
+		"updated_at":     now,
+	}).Error
+	if err != nil {
+		return 0, fmt.Errorf("更新优惠使用记录失败: %v", err)
+	}
+
+	return bonus, nil
+}
+
+// findPromoDiscount 查找适用于在线购买指定套餐的折扣，返回折后金额
+func findPromoDiscount(userID uint, plan *models.SubscriptionPlan) (*models.PromoRedemption, float64) {
+	redemption, err := findClaimedPromoTx(database.DB, userID, plan.ID, PromoRewardDiscountPercent, false)
+	if err != nil {
+		return nil, plan.Price
+	}
+	amount := math.Round(plan.Price*float64(100-redemption.PromoCode.Percent)) / 100
+	return redemption, amount
+}
+
+// applyPromoDiscountTx 订单支付成功后将折扣标记为已使用
+// 同一折扣可能被多个待支付订单引用，只有第一个支付的订单能标记使用；
+// 其余订单用户已按折后金额付款，仍正常发放套餐，只记录日志供人工核对
+func applyPromoDiscountTx(tx *gorm.DB, order *models.PaymentOrder) error {
+	if order.PromoRedemptionID == nil {
+		return nil
+	}
+	now := time.Now()
+	result := tx.Model(&models.PromoRedemption{}).
+		Where("id = ? AND status = ?", *order.PromoRedemptionID, "claimed").
+		Updates(map[string]interface{}{
+			"status":         "applied",
+			"discount_value": order.DiscountAmount,
+			"applied_source": "payment:" + order.OrderNo,
+			"applied_at":     now,
+			"updated_at":     now,
+		})
+	if result.Error != nil {
+		return result.Error
+	}
+	if result.RowsAffected != 1 {
+		log.Printf("⚠️ 折扣已被其他订单使用，订单按折后金额照常发放: order_no=%s, user_id=%d, promo_redemption_id=%d, discount=%.2f",
+			order.OrderNo, order.UserID, *order.PromoRedemptionID, order.DiscountAmount)
+	}
+	return nil
+}
+
+// revokePaymentPromoTx 订单退款后作废该订单使用的折扣和额外赠送优惠，返回需要收回的额外赠送积分
+func revokePaymentPromoTx(tx *gorm.DB, order *models.PaymentOrder) (int64, error) {
+	var redemptions []models.PromoRedemption
+	if err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).
+		Where("user_id = ? AND status = ? AND applied_source = ?", order.UserID, "applied", "payment:"+order.OrderNo).
+		Find(&redemptions).Error; err != nil {
+		return 0, fmt.Errorf("查询优惠使用记录失败: %v", err)
+	}
+	if len(redemptions) == 0 {
+		return 0, nil
+	}
+
+	var bonus int64
+	ids := make([]uint, 0, len(redemptions))
+	for _, redemption := range redemptions {
+		if redemption.RewardType == PromoRewardBonusPercent {
+			bonus += redemption.PointsAmount
+		}
+		ids = append(ids, redemption.ID)
+	}
+
+	err := tx.Model(&models.PromoRedemption{}).Where("id IN ?", ids).Updates(map[string]interface{}{
+		"status":     "revoked",
+		"updated_at": time.Now(),
+	}).Error
+	if err != nil {
+		return 0, fmt.Errorf("作废优惠使用记录失败: %v", err)
+	}
+	return bonus, nil
+}
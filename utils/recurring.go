@@ -0,0 +1,459 @@
+package utils
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"time"
+
+	"claude/database"
+	"claude/models"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// 周期订阅自动扣款的最小重试间隔
+const subscriptionRenewalRetryInterval = 24 * time.Hour
+
+// GetActiveRecurringSubscription 获取用户进行中（active 或 past_due）的周期订阅
+func GetActiveRecurringSubscription(userID uint) (*models.Subscription, error) {
+	var sub models.Subscription
+	err := database.DB.Preload("Plan").
+		Where("user_id = ? AND is_recurring = ? AND status IN ?", userID, true, []string{"active", "past_due"}).
+		Order("created_at DESC").First(&sub).Error
+	if err != nil {
+		return nil, err
+	}
+	return &sub, nil
+}
+
+// GetUserRecurringSubscriptions 获取用户所有周期订阅
+func GetUserRecurringSubscriptions(userID uint) ([]models.Subscription, error) {
+	var subs []models.Subscription
+	err := database.DB.Preload("Plan").
+		Where("user_id = ? AND is_recurring = ?", userID, true).
+		Order("created_at DESC").Find(&subs).Error
+	return subs, err
+}
+
+// startRecurringSubscriptionTx 首次购买周期订阅：发放首期套餐并创建订阅
+func startRecurringSubscriptionTx(tx *gorm.DB, order *models.PaymentOrder, plan *models.SubscriptionPlan, invoiceURL string) (*models.RedemptionRecord, error) {
+	record, err := GrantPlanToWalletTx(tx, order.UserID, plan, models.RedemptionRecord{
+		SourceType: "payment",
+		SourceID:   order.OrderNo,
+		Reason:     "周期订阅首期",
+		InvoiceURL: invoiceURL,
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	now := time.Now()
+	sub := models.Subscription{
+		UserID:             order.UserID,
+		SubscriptionPlanID: plan.ID,
+		Status:             "active",
+		ActivatedAt:        now,
+		ExpiresAt:          now.AddDate(0, 0, plan.ValidityDays),
+		TotalPoints:        plan.PointAmount,
+		AvailablePoints:    plan.PointAmount,
+		DailyMaxPoints:     plan.DailyMaxPoints,
+		SourceType:         "payment",
+		SourceID:           order.OrderNo,
+		InvoiceURL:         invoiceURL,
+		IsRecurring:        true,
+		PaymentProvider:    order.Provider,
+		CurrentPeriodStart: &now,
+		PeriodPoints:       plan.PointAmount,
+	}
+	if err := tx.Create(&sub).Error; err != nil {
+		return nil, fmt.Errorf("创建周期订阅失败: %v", err)
+	}
+
+	return record, nil
+}
+
+// renewSubscriptionTx 续费订单支付成功：按结转规则处理上一周期未用积分，发放新周期积分并推进订阅周期
+func renewSubscriptionTx(tx *gorm.DB, subscriptionID uint, plan *models.SubscriptionPlan, orderNo, invoiceURL string) (*models.RedemptionRecord, error) {
+	var sub models.Subscription
+	if err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).Where("id = ?", subscriptionID).First(&sub).Error; err != nil {
+		return nil, fmt.Errorf("周期订阅不存在: %v", err)
+	}
+
+	var wallet models.UserWallet
+	if err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).Where("user_id = ?", sub.UserID).First(&wallet).Error; err != nil {
+		return nil, fmt.Errorf("获取用户钱包失败: %v", err)
+	}
+
+	now := time.Now()
+
+	// 新周期从上一周期结束时开始；订阅已结束后才支付的，从支付时开始
+	periodStart := sub.ExpiresAt
+	if sub.Status == "expired" || sub.Status == "canceled" {
+		periodStart = now
+	}
+	periodEnd := periodStart.AddDate(0, 0, plan.ValidityDays)
+
+	// 只对上一周期发放的积分做结转限制，其他来源（激活码、转账等）的积分不受影响
+	var forfeit int64
+	if sub.Status == "active" || sub.Status == "past_due" {
+		unused := min(wallet.AvailablePoints, sub.PeriodPoints)
+		switch {
+		case plan.RolloverCap < 0:
+			forfeit = unused
+		case plan.RolloverCap > 0:
+			forfeit = max(unused-plan.RolloverCap, 0)
+		}
+	}
+
+	if forfeit > 0 {
+		forfeitRecord := models.RedemptionRecord{
+			UserID:       sub.UserID,
+			SourceType:   "subscription_rollover",
+			SourceID:     orderNo,
+			PointsAmount: -forfeit,
+			ActivatedAt:  now,
+			ExpiresAt:    wallet.WalletExpiresAt,
+			Reason:       fmt.Sprintf("周期续费结转上限 %d 积分，上一周期未用积分作废", max(plan.RolloverCap, 0)),
+			CreatedAt:    now,
+			UpdatedAt:    now,
+		}
+		if err := tx.Create(&forfeitRecord).Error; err != nil {
+			return nil, fmt.Errorf("创建积分结转记录失败: %v", err)
+		}
+	}
+
+	walletExpiresAt := maxTime(wallet.WalletExpiresAt, periodEnd)
+	err := tx.Model(&models.UserWallet{}).Where("user_id = ?", sub.UserID).Updates(map[string]interface{}{
+		"wallet_expires_at":        walletExpiresAt,
+		"daily_max_points":         plan.DailyMaxPoints,
+		"degradation_guaranteed":   plan.DegradationGuaranteed,
+		"daily_checkin_points":     plan.DailyCheckinPoints,
+		"daily_checkin_points_max": plan.DailyCheckinPointsMax,
+		"auto_refill_enabled":      plan.AutoRefillEnabled,
+		"auto_refill_threshold":    plan.AutoRefillThreshold,
+		"auto_refill_amount":       plan.AutoRefillAmount,
+		"status":                   "active",
+		"total_points":             gorm.Expr("total_points + ?", plan.PointAmount-forfeit),
+		"available_points":         gorm.Expr("available_points + ?", plan.PointAmount-forfeit),
+		"updated_at":               now,
+	}).Error
+	if err != nil {
+		return nil, fmt.Errorf("更新用户钱包失败: %v", err)
+	}
+
+	record := models.RedemptionRecord{
+		UserID:                sub.UserID,
+		SourceType:            "subscription_renewal",
+		SourceID:              orderNo,
+		PointsAmount:          plan.PointAmount,
+		ValidityDays:          plan.ValidityDays,
+		SubscriptionPlanID:    &plan.ID,
+		DailyMaxPoints:        plan.DailyMaxPoints,
+		DegradationGuaranteed: plan.DegradationGuaranteed,
+		DailyCheckinPoints:    plan.DailyCheckinPoints,
+		DailyCheckinPointsMax: plan.DailyCheckinPointsMax,
+		AutoRefillEnabled:     plan.AutoRefillEnabled,
+		AutoRefillThreshold:   plan.AutoRefillThreshold,
+		AutoRefillAmount:      plan.AutoRefillAmount,
+		ActivatedAt:           now,
+		ExpiresAt:             walletExpiresAt,
+		Reason:                fmt.Sprintf("周期订阅续费（%s 至 %s）", periodStart.Format("2006-01-02"), periodEnd.Format("2006-01-02")),
+		InvoiceURL:            invoiceURL,
+		CreatedAt:             now,
+		UpdatedAt:             now,
+	}
+	if err := tx.Create(&record).Error; err != nil {
+		return nil, fmt.Errorf("创建续费记录失败: %v", err)
+	}
+
+	err = tx.Model(&models.Subscription{}).Where("id = ?", sub.ID).Updates(map[string]interface{}{
+		"status":               "active",
+		"current_period_start": periodStart,
+		"expires_at":           periodEnd,
+		"period_points":        plan.PointAmount,
+		"total_points":         gorm.Expr("total_points + ?", plan.PointAmount),
+		"renewal_attempts":     0,
+		"last_renewal_attempt": nil,
+		"grace_period_ends_at": nil,
+		"invoice_url":          invoiceURL,
+		"updated_at":           now,
+	}).Error
+	if err != nil {
+		return nil, fmt.Errorf("更新周期订阅失败: %v", err)
+	}
+
+	return &record, nil
+}
+
+// cancelRefundedSubscriptionTx 订单退款后立即取消订单开通或续费的周期订阅，不再自动续费
+func cancelRefundedSubscriptionTx(tx *gorm.DB, order *models.PaymentOrder) error {
+	query := tx.Clauses(clause.Locking{Strength: "UPDATE"}).Where("is_recurring = ?", true)
+	if order.SubscriptionID != nil {
+		query = query.Where("id = ?", *order.SubscriptionID)
+	} else {
+		query = query.Where("source_type = ? AND source_id = ?", "payment", order.OrderNo)
+	}
+
+	var sub models.Subscription
+	err := query.First(&sub).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil
+	}
+	if err != nil {
+		return fmt.Errorf("查询周期订阅失败: %v", err)
+	}
+	if sub.Status != "active" && sub.Status != "past_due" {
+		return nil
+	}
+
+	if err := cancelPendingRenewalOrdersTx(tx, sub.ID); err != nil {
+		return err
+	}
+	now := time.Now()
+	err = tx.Model(&sub).Updates(map[string]interface{}{
+		"status":               "canceled",
+		"cancel_at_period_end": true,
+		"canceled_at":          now,
+		"grace_period_ends_at": nil,
+		"updated_at":           now,
+	}).Error
+	if err != nil {
+		return fmt.Errorf("取消周期订阅失败: %v", err)
+	}
+	return nil
+}
+
+// CancelRecurringSubscription 取消周期订阅：进行中的订阅在当前周期结束时取消，宽限期内的订阅立即取消
+func CancelRecurringSubscription(userID, subscriptionID uint) error {
+	return database.DB.Transaction(func(tx *gorm.DB) error {
+		var sub models.Subscription
+		if err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).
+			Where("id = ? AND user_id = ? AND is_recurring = ?", subscriptionID, userID, true).
+			First(&sub).Error; err != nil {
+			return fmt.Errorf("订阅不存在")
+		}
+
+		now := time.Now()
+		switch sub.Status {
+		case "active":
+			return tx.Model(&sub).Updates(map[string]interface{}{
+				"cancel_at_period_end": true,
+				"updated_at":           now,
+			}).Error
+		case "past_due":
+			if err := cancelPendingRenewalOrdersTx(tx, sub.ID); err != nil {
+				return err
+			}
+			return tx.Model(&sub).Updates(map[string]interface{}{
+				"status":               "canceled",
+				"cancel_at_period_end": true,
+				"canceled_at":          now,
+				"grace_period_ends_at": nil,
+				"updated_at":           now,
+			}).Error
+		default:
+			return fmt.Errorf("订阅已结束，无需取消")
+		}
+	})
+}
+
+// ResumeRecurringSubscription 恢复已设置为周期结束时取消的订阅
+func ResumeRecurringSubscription(userID, subscriptionID uint) error {
+	result := database.DB.Model(&models.Subscription{}).
+		Where("id = ? AND user_id = ? AND is_recurring = ? AND status = ? AND cancel_at_period_end = ?",
+			subscriptionID, userID, true, "active", true).
+		Updates(map[string]interface{}{
+			"cancel_at_period_end": false,
+			"updated_at":           time.Now(),
+		})
+	if result.Error != nil {
+		return result.Error
+	}
+	if result.RowsAffected == 0 {
+		return fmt.Errorf("订阅不存在或无需恢复")
+	}
+	return nil
+}
+
+// RetrySubscriptionRenewal 宽限期内由用户重新发起续费支付，替换原有未支付的续费订单
+func RetrySubscriptionRenewal(userID, subscriptionID uint, providerName string) (*models.PaymentOrder, error) {
+	var sub models.Subscription
+	if err := database.DB.Preload("Plan").
+		Where("id = ? AND user_id = ? AND is_recurring = ?", subscriptionID, userID, true).
+		First(&sub).Error; err != nil {
+		return nil, fmt.Errorf("订阅不存在")
+	}
+	if sub.Status != "past_due" || sub.GracePeriodEndsAt == nil {
+		return nil, fmt.Errorf("订阅当前无需续费")
+	}
+	if providerName == "" {
+		providerName = sub.PaymentProvider
+	}
+
+	if err := cancelPendingRenewalOrdersTx(database.DB, sub.ID); err != nil {
+		return nil, err
+	}
+	return createPaymentOrder(userID, &sub.Plan, providerName, &sub.ID, *sub.GracePeriodEndsAt)
+}
+
+// cancelPendingRenewalOrdersTx 取消订阅所有未支付的续费订单
+func cancelPendingRenewalOrdersTx(tx *gorm.DB, subscriptionID uint) error {
+	return tx.Model(&models.PaymentOrder{}).
+		Where("subscription_id = ? AND status = ?", subscriptionID, "pending").
+		Updates(map[string]interface{}{
+			"status":     "cancelled",
+			"updated_at": time.Now(),
+		}).Error
+}
+
+// ProcessSubscriptionRenewals 处理到期的周期订阅：
+// 到期且设置了周期结束取消的订阅直接取消；其余创建续费订单并进入宽限期，
+// 渠道支持自动扣款时尝试扣款；宽限期结束仍未支付的订阅标记为过期
+func ProcessSubscriptionRenewals() {
+	now := time.Now()
+
+	var dueSubs []models.Subscription
+	database.DB.Preload("Plan").
+		Where("is_recurring = ? AND status = ? AND expires_at <= ?", true, "active", now).
+		Find(&dueSubs)
+	for i := range dueSubs {
+		if err := startSubscriptionRenewal(&dueSubs[i]); err != nil {
+			log.Printf("❌ 周期订阅续费失败: subscription_id=%d, user_id=%d, error=%v", dueSubs[i].ID, dueSubs[i].UserID, err)
+		}
+	}
+
+	var pastDueSubs []models.Subscription
+	database.DB.Where("is_recurring = ? AND status = ?", true, "past_due").Find(&pastDueSubs)
+	for i := range pastDueSubs {
+		sub := &pastDueSubs[i]
+		if sub.GracePeriodEndsAt == nil || now.After(*sub.GracePeriodEndsAt) {
+			expirePastDueSubscription(sub)
+			continue
+		}
+		attemptRenewalCharge(sub)
+	}
+}
+
+// startSubscriptionRenewal 订阅周期结束：取消或进入宽限期并创建续费订单
+func startSubscriptionRenewal(sub *models.Subscription) error {
+	now := time.Now()
+
+	if sub.CancelAtPeriodEnd || !sub.Plan.Active || sub.Plan.Price <= 0 {
+		status := "canceled"
+		if !sub.CancelAtPeriodEnd {
+			// 计划已下架，无法继续续费
+			status = "expired"
+		}
+		return database.DB.Model(&models.Subscription{}).
+			Where("id = ? AND status = ?", sub.ID, "active").
+			Updates(map[string]interface{}{
+				"status":      status,
+				"canceled_at": now,
+				"updated_at":  now,
+			}).Error
+	}
+
+	graceDays := getTransferIntConfig("subscription_grace_period_days", 3)
+	graceEndsAt := sub.ExpiresAt.AddDate(0, 0, int(graceDays))
+	if graceEndsAt.Before(now) {
+		graceEndsAt = now.AddDate(0, 0, int(graceDays))
+	}
+
+	// 条件更新，避免多个实例重复创建续费订单
+	result := database.DB.Model(&models.Subscription{}).
+		Where("id = ? AND status = ?", sub.ID, "active").
+		Updates(map[string]interface{}{
+			"status":               "past_due",
+			"grace_period_ends_at": graceEndsAt,
+			"renewal_attempts":     0,
+			"last_renewal_attempt": nil,
+			"updated_at":           now,
+		})
+	if result.Error != nil {
+		return result.Error
+	}
+	if result.RowsAffected == 0 {
+		return nil
+	}
+	sub.Status = "past_due"
+	sub.GracePeriodEndsAt = &graceEndsAt
+
+	// 宽限期内保留钱包权益
+	database.DB.Model(&models.UserWallet{}).
+		Where("user_id = ? AND wallet_expires_at < ?", sub.UserID, graceEndsAt).
+		Updates(map[string]interface{}{
+			"wallet_expires_at": graceEndsAt,
+			"updated_at":        now,
+		})
+
+	order, err := createPaymentOrder(sub.UserID, &sub.Plan, sub.PaymentProvider, &sub.ID, graceEndsAt)
+	if err != nil {
+		return fmt.Errorf("创建续费订单失败: %v", err)
+	}
+	log.Printf("周期订阅进入续费: subscription_id=%d, user_id=%d, order_no=%s, grace_until=%s",
+		sub.ID, sub.UserID, order.OrderNo, graceEndsAt.Format("2006-01-02 15:04"))
+
+	attemptRenewalCharge(sub)
+	return nil
+}
+
+// attemptRenewalCharge 渠道支持自动扣款时，对宽限期内的订阅尝试扣款（每24小时最多一次）
+func attemptRenewalCharge(sub *models.Subscription) {
+	provider, ok := GetPaymentProvider(sub.PaymentProvider)
+	if !ok {
+		return
+	}
+	charger, ok := provider.(RenewalCharger)
+	if !ok {
+		return
+	}
+
+	maxAttempts := int(getTransferIntConfig("subscription_renewal_max_attempts", 3))
+	if sub.RenewalAttempts >= maxAttempts {
+		return
+	}
+	if sub.LastRenewalAttempt != nil && time.Since(*sub.LastRenewalAttempt) < subscriptionRenewalRetryInterval {
+		return
+	}
+
+	var order models.PaymentOrder
+	if err := database.DB.Where("subscription_id = ? AND status = ?", sub.ID, "pending").
+		Order("created_at DESC").First(&order).Error; err != nil {
+		return
+	}
+
+	now := time.Now()
+	database.DB.Model(&models.Subscription{}).Where("id = ?", sub.ID).Updates(map[string]interface{}{
+		"renewal_attempts":     gorm.Expr("renewal_attempts + 1"),
+		"last_renewal_attempt": now,
+		"updated_at":           now,
+	})
+
+	if err := charger.ChargeRenewal(&order); err != nil {
+		log.Printf("周期订阅自动扣款失败: subscription_id=%d, order_no=%s, attempt=%d, error=%v",
+			sub.ID, order.OrderNo, sub.RenewalAttempts+1, err)
+	}
+}
+
+// expirePastDueSubscription 宽限期结束仍未续费，订阅过期
+func expirePastDueSubscription(sub *models.Subscription) {
+	err := database.DB.Transaction(func(tx *gorm.DB) error {
+		result := tx.Model(&models.Subscription{}).
+			Where("id = ? AND status = ?", sub.ID, "past_due").
+			Updates(map[string]interface{}{
+				"status":     "expired",
+				"updated_at": time.Now(),
+			})
+		if result.Error != nil || result.RowsAffected == 0 {
+			return result.Error
+		}
+		return cancelPendingRenewalOrdersTx(tx, sub.ID)
+	})
+	if err != nil {
+		log.Printf("❌ 周期订阅过期处理失败: subscription_id=%d, error=%v", sub.ID, err)
+		return
+	}
+	log.Printf("周期订阅宽限期结束未续费，已过期: subscription_id=%d, user_id=%d", sub.ID, sub.UserID)
+}
@@ -0,0 +1,403 @@
+package utils
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"log"
+	"math/big"
+	"strings"
+	"time"
+
+	"claude/config"
+	"claude/database"
+	"claude/models"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// 邀请码字符集（去掉易混淆的 0/O/1/I）
+const referralCodeCharset = "ABCDEFGHJKLMNPQRSTUVWXYZ23456789"
+
+// ReferralSettings 邀请奖励配置
+type ReferralSettings struct {
+	Enabled        bool  `json:"enabled"`
+	ReferrerPoints int64 `json:"referrer_points"`
+	RefereePoints  int64 `json:"referee_points"`
+	ValidityDays   int   `json:"validity_days"`
+}
+
+// ReferralStats 邀请统计
+type ReferralStats struct {
+	Total          int64 `json:"total"`
+	Pending        int64 `json:"pending"`
+	Rewarded       int64 `json:"rewarded"`
+	Rejected       int64 `json:"rejected"`
+	ReferrerPoints int64 `json:"referrer_points"` // 邀请人累计获得积分
+	RefereePoints  int64 `json:"referee_points"`  // 被邀请人累计获得积分
+}
+
+// ReferrerRanking 邀请人排行
+type ReferrerRanking struct {
+	ReferrerID     uint   `json:"referrer_id"`
+	Username       string `json:"username"`
+	Email          string `json:"email"`
+	Total          int64  `json:"total"`
+	Rewarded       int64  `json:"rewarded"`
+	Rejected       int64  `json:"rejected"`
+	ReferrerPoints int64  `json:"referrer_points"`
+}
+
+// GetReferralSettings 获取邀请奖励配置
+func GetReferralSettings() *ReferralSettings {
+	settings := &ReferralSettings{
+		Enabled:        true,
+		ReferrerPoints: getTransferIntConfig("referral_referrer_points", 1000),
+		RefereePoints:  getTransferIntConfig("referral_referee_points", 500),
+		ValidityDays:   int(getTransferIntConfig("referral_reward_validity_days", 30)),
+	}
+
+	var cfg models.SystemConfig
+	if err := database.DB.Where("config_key = ?", "referral_enabled").First(&cfg).Error; err == nil {
+		settings.Enabled = cfg.ConfigValue == "true"
+	}
+	if settings.ValidityDays < 1 {
+		settings.ValidityDays = 1
+	}
+
+	return settings
+}
+
+// NormalizeReferralCode 邀请码统一使用大写，不区分大小写
+func NormalizeReferralCode(code string) string {
+	return strings.ToUpper(strings.TrimSpace(code))
+}
+
+// ReferralDeviceHash 根据UA和前端上报的设备指纹计算设备摘要
+// 没有设备指纹时退化为IP+UA摘要，避免不上报指纹即可绕过设备检查
+func ReferralDeviceHash(ip, userAgent, fingerprint string) string {
+	fingerprint = strings.TrimSpace(fingerprint)
+	source := userAgent + "|" + fingerprint
+	if fingerprint == "" {
+		source = "ip|" + ip + "|" + userAgent
+	}
+	hash := sha256.Sum256([]byte(source))
+	return hex.EncodeToString(hash[:])
+}
+
+// ReferralLink 生成邀请注册链接
+func ReferralLink(code string) string {
+	return fmt.Sprintf("%s/register?ref=%s", strings.TrimRight(config.AppConfig.FrontendURL, "/"), code)
+}
+
+// generateReferralCode 生成8位邀请码
+func generateReferralCode() (string, error) {
+	b := make([]byte, 8)
+	for i := range b {
+		n, err := rand.Int(rand.Reader, big.NewInt(int64(len(referralCodeCharset))))
+		if err != nil {
+			return "", err
+		}
+		b[i] = referralCodeCharset[n.Int64()]
+	}
+	return string(b), nil
+}
+
+// GetOrCreateReferralCode 获取用户的邀请码，不存在时生成
+func GetOrCreateReferralCode(userID uint) (*models.ReferralCode, error) {
+	var referralCode models.ReferralCode
+	if err := database.DB.Where("user_id = ?", userID).First(&referralCode).Error; err == nil {
+		return &referralCode, nil
+	} else if !errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, fmt.Errorf("查询邀请码失败: %v", err)
+	}
+
+	// 邀请码冲突或并发创建时重试
+	for i := 0; i < 5; i++ {
+		code, err := generateReferralCode()
+		if err != nil {
+			return nil, fmt.Errorf("生成邀请码失败: %v", err)
+		}
+		referralCode = models.ReferralCode{UserID: userID, Code: code}
+		err = database.DB.Create(&referralCode).Error
+		if err == nil {
+			return &referralCode, nil
+		}
+		if !isDuplicateKeyError(err) {
+			return nil, fmt.Errorf("创建邀请码失败: %v", err)
+		}
+		if database.DB.Where("user_id = ?", userID).First(&referralCode).Error == nil {
+			return &referralCode, nil
+		}
+	}
+	return nil, errors.New("生成邀请码失败，请稍后重试")
+}
+
+// isDisposableEmail 判断邮箱是否属于一次性邮箱域名
+func isDisposableEmail(email string) bool {
+	parts := strings.Split(strings.ToLower(email), "@")
+	if len(parts) != 2 {
+		return false
+	}
+
+	var cfg models.SystemConfig
+	if err := database.DB.Where("config_key = ?", "referral_disposable_email_domains").First(&cfg).Error; err != nil {
+		return false
+	}
+	for _, domain := range strings.Split(cfg.ConfigValue, ",") {
+		domain = strings.ToLower(strings.TrimSpace(domain))
+		if domain != "" && (parts[1] == domain || strings.HasSuffix(parts[1], "."+domain)) {
+			return true
+		}
+	}
+	return false
+}
+
+// checkReferralAbuse 检查邀请是否触发风控规则，返回拒绝原因，为空表示通过
+func checkReferralAbuse(referrer, referee *models.User, ip, deviceHash string) string {
+	if referrer.IsDisabled {
+		return "邀请人账号已禁用"
+	}
+	if isDisposableEmail(referee.Email) {
+		return "使用一次性邮箱注册"
+	}
+
+	// 与邀请人当前登录设备的IP相同
+	if ip != "" {
+		deviceManager := NewDeviceManager(database.TokenRedisClient, database.UserRedisClient, database.DeviceRedisClient)
+		if devices, err := deviceManager.GetUserDevices(referrer.ID); err == nil {
+			for _, device := range devices {
+				if device.IP == ip {
+					return "与邀请人IP相同"
+				}
+			}
+		}
+
+		var count int64
+		database.DB.Model(&models.Referral{}).
+			Where("referrer_id = ? AND register_ip = ?", referrer.ID, ip).Count(&count)
+		if count > 0 {
+			return "同一IP重复注册"
+		}
+	}
+
+	// 同一设备注册的多个账号只认第一个
+	if deviceHash != "" {
+		var count int64
+		database.DB.Model(&models.Referral{}).Where("device_hash = ?", deviceHash).Count(&count)
+		if count > 0 {
+			return "同一设备重复注册"
+		}
+	}
+
+	return ""
+}
+
+// RecordReferral 注册成功后记录邀请关系，邀请码无效时返回错误但不影响注册
+func RecordReferral(refereeID uint, code, source, ip, deviceHash string) error {
+	code = NormalizeReferralCode(code)
+	if code == "" || !GetReferralSettings().Enabled {
+		return nil
+	}
+
+	var referralCode models.ReferralCode
+	if err := database.DB.Where("code = ?", code).First(&referralCode).Error; err != nil {
+		return fmt.Errorf("邀请码不存在: %s", code)
+	}
+	if referralCode.UserID == refereeID {
+		return nil
+	}
+
+	var referrer, referee models.User
+	if err := database.DB.Where("id = ?", referralCode.UserID).First(&referrer).Error; err != nil {
+		return fmt.Errorf("邀请人不存在: %v", err)
+	}
+	if err := database.DB.Where("id = ?", refereeID).First(&referee).Error; err != nil {
+		return fmt.Errorf("被邀请人不存在: %v", err)
+	}
+
+	referral := models.Referral{
+		ReferrerID: referrer.ID,
+		RefereeID:  refereeID,
+		Code:       code,
+		Source:     source,
+		RegisterIP: ip,
+		DeviceHash: deviceHash,
+		Status:     "pending",
+	}
+	if reason := checkReferralAbuse(&referrer, &referee, ip, deviceHash); reason != "" {
+		referral.Status = "rejected"
+		referral.RejectReason = reason
+	}
+
+	if err := database.DB.Create(&referral).Error; err != nil {
+		return fmt.Errorf("记录邀请关系失败: %v", err)
+	}
+
+	log.Printf("记录邀请关系: referrer_id=%d, referee_id=%d, source=%s, status=%s, reason=%s",
+		referrer.ID, refereeID, source, referral.Status, referral.RejectReason)
+	return nil
+}
+
+// grantReferralPointsTx 发放邀请奖励积分并创建兑换记录
+func grantReferralPointsTx(tx *gorm.DB, userID uint, points int64, validityDays int, sourceID, reason string) error {
+	if _, err := createOrGetUserWallet(tx, userID); err != nil {
+		return err
+	}
+
+	var wallet models.UserWallet
+	if err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).Where("user_id = ?", userID).First(&wallet).Error; err != nil {
+		return fmt.Errorf("获取用户钱包失败: %v", err)
+	}
+
+	now := time.Now()
+	expiresAt := maxTime(wallet.WalletExpiresAt, now.AddDate(0, 0, validityDays))
+	err := tx.Model(&models.UserWallet{}).Where("user_id = ?", userID).Updates(map[string]interface{}{
+		"total_points":      gorm.Expr("total_points + ?", points),
+		"available_points":  gorm.Expr("available_points + ?", points),
+		"wallet_expires_at": expiresAt,
+		"status":            "active",
+		"updated_at":        now,
+	}).Error
+	if err != nil {
+		return fmt.Errorf("更新用户钱包失败: %v", err)
+	}
+
+	record := models.RedemptionRecord{
+		UserID:       userID,
+		SourceType:   "referral",
+		SourceID:     sourceID,
+		PointsAmount: points,
+		ValidityDays: validityDays,
+		ActivatedAt:  now,
+		ExpiresAt:    expiresAt,
+		Reason:       reason,
+		CreatedAt:    now,
+		UpdatedAt:    now,
+	}
+	if err := tx.Create(&record).Error; err != nil {
+		return fmt.Errorf("创建兑换记录失败: %v", err)
+	}
+	return nil
+}
+
+// convertReferralTx 被邀请人首次兑换付费套餐时为双方发放奖励，免费套餐不计入转化
+func convertReferralTx(tx *gorm.DB, refereeID uint, plan *models.SubscriptionPlan, source string) error {
+	if plan.Price <= 0 {
+		return nil
+	}
+
+	var referral models.Referral
+	err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).
+		Where("referee_id = ? AND status = ?", refereeID, "pending").First(&referral).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil
+	}
+	if err != nil {
+		return fmt.Errorf("查询邀请关系失败: %v", err)
+	}
+
+	settings := GetReferralSettings()
+	if !settings.Enabled {
+		return nil
+	}
+
+	now := time.Now()
+	var referrer models.User
+	if err := tx.Where("id = ?", referral.ReferrerID).First(&referrer).Error; err != nil || referrer.IsDisabled {
+		return tx.Model(&referral).Updates(map[string]interface{}{
+			"status":        "rejected",
+			"reject_reason": "邀请人账号已禁用",
+			"updated_at":    now,
+		}).Error
+	}
+
+	sourceID := fmt.Sprintf("referral:%d", referral.ID)
+	if settings.ReferrerPoints > 0 {
+		if err := grantReferralPointsTx(tx, referral.ReferrerID, settings.ReferrerPoints, settings.ValidityDays,
+			sourceID, fmt.Sprintf("邀请奖励 - 邀请用户 #%d 完成首次兑换", refereeID)); err != nil {
+			return err
+		}
+	}
+	if settings.RefereePoints > 0 {
+		if err := grantReferralPointsTx(tx, refereeID, settings.RefereePoints, settings.ValidityDays,
+			sourceID, "受邀奖励 - 首次兑换付费套餐"); err != nil {
+			return err
+		}
+	}
+
+	if err := tx.Model(&referral).Updates(map[string]interface{}{
+		"status":          "rewarded",
+		"referrer_points": settings.ReferrerPoints,
+		"referee_points":  settings.RefereePoints,
+		"convert_source":  source,
+		"converted_at":    now,
+		"updated_at":      now,
+	}).Error; err != nil {
+		return fmt.Errorf("更新邀请关系失败: %v", err)
+	}
+
+	log.Printf("邀请转化奖励已发放: referral_id=%d, referrer_id=%d, referee_id=%d, source=%s",
+		referral.ID, referral.ReferrerID, refereeID, source)
+	return nil
+}
+
+// GetReferralStats 统计邀请数据，referrerID 为0时统计全部
+func GetReferralStats(referrerID uint) (*ReferralStats, error) {
+	var rows []struct {
+		Status         string
+		Count          int64
+		ReferrerPoints int64
+		RefereePoints  int64
+	}
+
+	query := database.DB.Model(&models.Referral{}).
+		Select("status, COUNT(*) AS count, COALESCE(SUM(referrer_points), 0) AS referrer_points, COALESCE(SUM(referee_points), 0) AS referee_points")
+	if referrerID > 0 {
+		query = query.Where("referrer_id = ?", referrerID)
+	}
+	if err := query.Group("status").Scan(&rows).Error; err != nil {
+		return nil, err
+	}
+
+	stats := &ReferralStats{}
+	for _, row := range rows {
+		stats.Total += row.Count
+		stats.ReferrerPoints += row.ReferrerPoints
+		stats.RefereePoints += row.RefereePoints
+		switch row.Status {
+		case "pending":
+			stats.Pending = row.Count
+		case "rewarded":
+			stats.Rewarded = row.Count
+		case "rejected":
+			stats.Rejected = row.Count
+		}
+	}
+	return stats, nil
+}
+
+// GetTopReferrers 获取邀请人排行（按成功转化数）
+func GetTopReferrers(start, end *time.Time, limit int) ([]ReferrerRanking, error) {
+	var rankings []ReferrerRanking
+
+	query := database.DB.Table("referrals").
+		Select(`referrals.referrer_id, users.username, users.email, COUNT(*) AS total,
+			SUM(CASE WHEN referrals.status = 'rewarded' THEN 1 ELSE 0 END) AS rewarded,
+			SUM(CASE WHEN referrals.status = 'rejected' THEN 1 ELSE 0 END) AS rejected,
+			COALESCE(SUM(referrals.referrer_points), 0) AS referrer_points`).
+		Joins("LEFT JOIN users ON users.id = referrals.referrer_id")
+	if start != nil {
+		query = query.Where("referrals.created_at >= ?", *start)
+	}
+	if end != nil {
+		query = query.Where("referrals.created_at < ?", *end)
+	}
+
+	err := query.Group("referrals.referrer_id, users.username, users.email").
+		Order("rewarded DESC, total DESC").Limit(limit).Scan(&rankings).Error
+	return rankings, err
+}
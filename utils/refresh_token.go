@@ -0,0 +1,199 @@
+package utils
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"time"
+
+	"claude/database"
+	"claude/models"
+
+	"github.com/go-redis/redis/v8"
+)
+
+var (
+	// ErrRefreshTokenInvalid 刷新令牌不存在、已过期或不属于当前客户端
+	ErrRefreshTokenInvalid = errors.New("刷新令牌无效或已过期")
+	// ErrRefreshTokenReused 已轮换的刷新令牌被再次使用，整条令牌链已被吊销
+	ErrRefreshTokenReused = errors.New("刷新令牌已被使用，设备已下线，请重新登录")
+	// ErrRefreshUserDisabled 用户已被禁用，不再续期
+	ErrRefreshUserDisabled = errors.New("账户已被禁用")
+)
+
+// refreshTokenRecord 刷新令牌在Redis中的记录
+type refreshTokenRecord struct {
+	DeviceID   string `json:"device_id"`
+	UserID     uint   `json:"user_id"`
+	Family     string `json:"family"`
+	Generation int    `json:"generation"`
+}
+
+// AccessTokenExpiresIn 访问令牌有效期（秒），随令牌一起返回给客户端
+func AccessTokenExpiresIn() int {
+	return int(AccessTokenTTL() / time.Second)
+}
+
+// generateRefreshToken 生成随机刷新令牌
+func generateRefreshToken() (string, error) {
+	buf := make([]byte, 32)
+	if _, err := rand.Read(buf); err != nil {
+		return "", err
+	}
+	return "rt_" + hex.EncodeToString(buf), nil
+}
+
+// issueRefreshToken 为设备签发刷新令牌并写入Redis，调用方负责保存设备信息
+func (dm *DeviceManager) issueRefreshToken(device *DeviceInfo, family string, generation int) (string, error) {
+	ctx := context.Background()
+
+	refreshToken, err := generateRefreshToken()
+	if err != nil {
+		return "", err
+	}
+	refreshHash := dm.HashToken(refreshToken)
+
+	record, err := json.Marshal(refreshTokenRecord{
+		DeviceID:   device.ID,
+		UserID:     device.UserID,
+		Family:     family,
+		Generation: generation,
+	})
+	if err != nil {
+		return "", err
+	}
+
+	ttl := device.RefreshTokenTTL()
+	if err := dm.tokenRedis.Set(ctx, fmt.Sprintf("refresh_token:%s", refreshHash), record, ttl).Err(); err != nil {
+		return "", err
+	}
+
+	device.RefreshFamily = family
+	device.RefreshTokenHash = refreshHash
+	device.RefreshGeneration = generation
+	device.ExpiresAt = time.Now().Add(ttl)
+	return refreshToken, nil
+}
+
+// revokeRefreshChain 检测到刷新令牌重用时下线整台设备，同族的所有令牌随之失效
+func (dm *DeviceManager) revokeRefreshChain(record refreshTokenRecord) {
+	log.Printf("检测到刷新令牌重用，下线设备: user_id=%d, device_id=%s, family=%s, generation=%d",
+		record.UserID, record.DeviceID, record.Family, record.Generation)
+	if err := dm.RevokeDevice(record.UserID, record.DeviceID); err != nil {
+		log.Printf("下线设备失败: device_id=%s, error=%v", record.DeviceID, err)
+	}
+}
+
+// RefreshTokens 使用刷新令牌换取新的访问令牌和刷新令牌
+// 每次刷新都会轮换刷新令牌，旧令牌再次出现时视为泄露并吊销整台设备
+// source 不为空时只允许对应来源的设备刷新（如 SSO 客户端只能刷新 sso 设备）
+// clientID 为发起刷新的SSO客户端，只能刷新该客户端创建的设备
+func (dm *DeviceManager) RefreshTokens(refreshToken string, ip string, source string, clientID string) (*models.User, string, *DeviceInfo, error) {
+	ctx := context.Background()
+	refreshHash := dm.HashToken(refreshToken)
+	refreshKey := fmt.Sprintf("refresh_token:%s", refreshHash)
+	usedKey := fmt.Sprintf("refresh_token_used:%s", refreshHash)
+
+	recordData, err := dm.tokenRedis.Get(ctx, refreshKey).Result()
+	if err == redis.Nil {
+		// 已轮换过的令牌再次出现，说明令牌可能已泄露
+		usedData, usedErr := dm.tokenRedis.Get(ctx, usedKey).Result()
+		if usedErr == nil {
+			var used refreshTokenRecord
+			if json.Unmarshal([]byte(usedData), &used) == nil {
+				dm.revokeRefreshChain(used)
+				return nil, "", nil, ErrRefreshTokenReused
+			}
+		}
+		return nil, "", nil, ErrRefreshTokenInvalid
+	} else if err != nil {
+		return nil, "", nil, err
+	}
+
+	var record refreshTokenRecord
+	if err := json.Unmarshal([]byte(recordData), &record); err != nil {
+		return nil, "", nil, err
+	}
+
+	// 从DB 2获取设备信息
+	deviceData, err := dm.deviceRedis.Get(ctx, fmt.Sprintf("device:%s", record.DeviceID)).Result()
+	if err == redis.Nil {
+		dm.tokenRedis.Del(ctx, refreshKey)
+		return nil, "", nil, ErrRefreshTokenInvalid
+	} else if err != nil {
+		return nil, "", nil, err
+	}
+
+	var device DeviceInfo
+	if err := json.Unmarshal([]byte(deviceData), &device); err != nil {
+		return nil, "", nil, err
+	}
+
+	// 设备当前持有的不是这枚令牌，说明令牌链已被其他请求推进
+	if device.UserID != record.UserID || device.RefreshFamily != record.Family || device.RefreshTokenHash != refreshHash {
+		dm.revokeRefreshChain(record)
+		return nil, "", nil, ErrRefreshTokenReused
+	}
+
+	if (source != "" && device.Source != source) || device.ClientID != clientID {
+		return nil, "", nil, ErrRefreshTokenInvalid
+	}
+
+	// 原子地占用这枚令牌，并发刷新时只有一个请求能成功
+	deleted, err := dm.tokenRedis.Del(ctx, refreshKey).Result()
+	if err != nil {
+		return nil, "", nil, err
+	}
+	if deleted == 0 {
+		dm.revokeRefreshChain(record)
+		return nil, "", nil, ErrRefreshTokenReused
+	}
+	dm.tokenRedis.Set(ctx, usedKey, recordData, device.RefreshTokenTTL())
+
+	var user models.User
+	if err := database.DB.Where("id = ?", device.UserID).First(&user).Error; err != nil {
+		dm.RevokeDevice(device.UserID, device.ID)
+		return nil, "", nil, ErrRefreshTokenInvalid
+	}
+	if user.IsDisabled {
+		dm.RevokeDevice(device.UserID, device.ID)
+		return nil, "", nil, ErrRefreshUserDisabled
+	}
+
+	// 签发新的访问令牌和刷新令牌
+	accessToken, err := GenerateAccessTokenWithTTL(user.ID, user.Email, device.AccessTokenTTL())
+	if err != nil {
+		return nil, "", nil, err
+	}
+	newRefreshToken, err := dm.issueRefreshToken(&device, record.Family, record.Generation+1)
+	if err != nil {
+		return nil, "", nil, err
+	}
+
+	// 替换DB 0中的访问令牌映射，旧访问令牌立即失效
+	dm.tokenRedis.Del(ctx, fmt.Sprintf("token:%s", device.TokenHash))
+	device.TokenHash = dm.HashToken(accessToken)
+	if err := dm.tokenRedis.Set(ctx, fmt.Sprintf("token:%s", device.TokenHash), device.ID, device.AccessTokenTTL()).Err(); err != nil {
+		return nil, "", nil, err
+	}
+
+	// 更新DB 2中的设备信息
+	if ip != "" {
+		device.IP = ip
+	}
+	device.LastActive = time.Now()
+	updatedData, err := json.Marshal(device)
+	if err != nil {
+		return nil, "", nil, err
+	}
+	if err := dm.deviceRedis.Set(ctx, fmt.Sprintf("device:%s", device.ID), updatedData, 0).Err(); err != nil {
+		return nil, "", nil, err
+	}
+
+	device.RefreshToken = newRefreshToken
+	return &user, accessToken, &device, nil
+}
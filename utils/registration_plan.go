@@ -144,6 +144,7 @@ func ProcessRegistrationPlanGift(userID uint, registrationType string) error {
 		FromAdminID:        nil, // 系统赠送使用 NULL
 		ToUserID:           userID,
 		SubscriptionPlanID: uint(planID),
+		PlanVersionID:      plan.CurrentVersionID,
 		PointsAmount:       plan.PointAmount,
 		ValidityDays:       plan.ValidityDays,
 		DailyMaxPoints:     plan.DailyCheckinPointsMax,
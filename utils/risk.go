@@ -0,0 +1,624 @@
+package utils
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"sort"
+	"time"
+
+	"claude/database"
+	"claude/models"
+
+	"gorm.io/gorm"
+)
+
+// 风控信号
+const (
+	RiskSignalDistinctIPs        = "distinct_ips"         // 统计窗口内使用的不同IP过多
+	RiskSignalDistinctLocations  = "distinct_locations"   // 统计窗口内登录地区过多
+	RiskSignalDevicesPerDay      = "devices_per_day"      // 一天内新增登录设备过多
+	RiskSignalConcurrentIPs      = "concurrent_ips"       // 多个IP同时发起请求
+	RiskSignalBatchFreshAccounts = "batch_fresh_accounts" // 同一批次激活码集中被新注册账户兑换
+)
+
+// 风控事件状态
+const (
+	RiskEventPending   = "pending"
+	RiskEventConfirmed = "confirmed"
+	RiskEventDismissed = "dismissed"
+)
+
+// 风控处置动作
+const (
+	RiskActionNone         = "none"
+	RiskActionDeviceLogout = "device_logout"
+	RiskActionDisable      = "disable"
+)
+
+// riskSignalWeights 各信号刚超过阈值时的风险分，超出越多分数越高，最多为该值的两倍
+var riskSignalWeights = map[string]int{
+	RiskSignalDistinctIPs:        20,
+	RiskSignalDistinctLocations:  30,
+	RiskSignalDevicesPerDay:      20,
+	RiskSignalConcurrentIPs:      40,
+	RiskSignalBatchFreshAccounts: 30,
+}
+
+// 信号详情中最多列出的IP、地区数量
+const riskDetailsMaxItems = 20
+
+// RiskSettings 风控配置
+type RiskSettings struct {
+	Enabled                    bool  `json:"enabled"`
+	WindowHours                int64 `json:"window_hours"`
+	MaxDistinctIPs             int64 `json:"max_distinct_ips"`
+	MaxDistinctLocations       int64 `json:"max_distinct_locations"`
+	MaxDevicesPerDay           int64 `json:"max_devices_per_day"`
+	MaxConcurrentIPs           int64 `json:"max_concurrent_ips"`
+	FreshAccountHours          int64 `json:"fresh_account_hours"`
+	BatchFreshAccountThreshold int64 `json:"batch_fresh_account_threshold"`
+	AutoLogoutScore            int64 `json:"auto_logout_score"`
+	AutoDisableScore           int64 `json:"auto_disable_score"`
+	AutoDisableHours           int64 `json:"auto_disable_hours"`
+}
+
+// RiskSignal 单个风控信号的计算结果
+type RiskSignal struct {
+	Signal    string                 `json:"signal"`
+	Value     int64                  `json:"value"`
+	Threshold int64                  `json:"threshold"`
+	Triggered bool                   `json:"triggered"`
+	Score     int                    `json:"score"`
+	Details   map[string]interface{} `json:"details"`
+}
+
+// RiskScanResult 风控扫描结果
+type RiskScanResult struct {
+	ScannedUsers  int `json:"scanned_users"`
+	CreatedEvents int `json:"created_events"`
+	UpdatedEvents int `json:"updated_events"`
+	AutoLogouts   int `json:"auto_logouts"`
+	AutoDisables  int `json:"auto_disables"`
+	Released      int `json:"released"`
+}
+
+// UserRiskProfile 用户风险概况（管理后台展示）
+type UserRiskProfile struct {
+	UserID        uint               `json:"user_id"`
+	Score         int                `json:"score"`
+	IsDisabled    bool               `json:"is_disabled"`
+	DisabledUntil *time.Time         `json:"disabled_until"`
+	Signals       []RiskSignal       `json:"signals"`
+	Events        []models.RiskEvent `json:"events"`
+}
+
+// GetRiskSettings 获取风控配置
+func GetRiskSettings() *RiskSettings {
+	settings := &RiskSettings{
+		Enabled:                    true,
+		WindowHours:                getTransferIntConfig("risk_scan_window_hours", 24),
+		MaxDistinctIPs:             getTransferIntConfig("risk_max_distinct_ips", 10),
+		MaxDistinctLocations:       getTransferIntConfig("risk_max_distinct_locations", 3),
+		MaxDevicesPerDay:           getTransferIntConfig("risk_max_devices_per_day", 5),
+		MaxConcurrentIPs:           getTransferIntConfig("risk_max_concurrent_ips", 3),
+		FreshAccountHours:          getTransferIntConfig("risk_fresh_account_hours", 48),
+		BatchFreshAccountThreshold: getTransferIntConfig("risk_batch_fresh_account_threshold", 10),
+		AutoLogoutScore:            getTransferIntConfig("risk_auto_logout_score", 0),
+		AutoDisableScore:           getTransferIntConfig("risk_auto_disable_score", 0),
+		AutoDisableHours:           getTransferIntConfig("risk_auto_disable_hours", 24),
+	}
+
+	var config models.SystemConfig
+	if err := database.DB.Where("config_key = ?", "risk_engine_enabled").First(&config).Error; err == nil {
+		settings.Enabled = config.ConfigValue == "true"
+	}
+
+	if settings.WindowHours < 1 {
+		settings.WindowHours = 24
+	}
+	if settings.AutoDisableHours < 1 {
+		settings.AutoDisableHours = 24
+	}
+
+	return settings
+}
+
+// newRiskSignal 生成风控信号，阈值为0表示不检测该信号
+// 超过阈值（orEqual 为 true 时达到阈值即可）时按超出比例计算风险分
+func newRiskSignal(signal string, value, threshold int64, orEqual bool, details map[string]interface{}) RiskSignal {
+	result := RiskSignal{Signal: signal, Value: value, Threshold: threshold, Details: details}
+	if threshold <= 0 {
+		return result
+	}
+	result.Triggered = value > threshold || (orEqual && value == threshold)
+	if result.Triggered {
+		weight := riskSignalWeights[signal]
+		result.Score = int(int64(weight) * value / threshold)
+		if result.Score > weight*2 {
+			result.Score = weight * 2
+		}
+	}
+	return result
+}
+
+// riskTransaction 参与风控计算的API请求
+type riskTransaction struct {
+	IP        string
+	Duration  int
+	CreatedAt time.Time
+}
+
+// maxConcurrentIPs 计算同一时刻发起请求的最多不同IP数量
+// 请求记录在请求结束时写入，开始时间为 CreatedAt 减去请求耗时
+func maxConcurrentIPs(transactions []riskTransaction) (int64, time.Time, []string) {
+	type edge struct {
+		at    time.Time
+		ip    string
+		delta int
+	}
+	edges := make([]edge, 0, len(transactions)*2)
+	for _, tx := range transactions {
+		start := tx.CreatedAt.Add(-time.Duration(tx.Duration) * time.Millisecond)
+		edges = append(edges, edge{at: start, ip: tx.IP, delta: 1}, edge{at: tx.CreatedAt, ip: tx.IP, delta: -1})
+	}
+	// 同一时刻先处理结束再处理开始，首尾相接的请求不算并发
+	sort.Slice(edges, func(i, j int) bool {
+		if edges[i].at.Equal(edges[j].at) {
+			return edges[i].delta < edges[j].delta
+		}
+		return edges[i].at.Before(edges[j].at)
+	})
+
+	active := map[string]int{}
+	var peak int64
+	var peakAt time.Time
+	var peakIPs []string
+	for _, e := range edges {
+		active[e.ip] += e.delta
+		if active[e.ip] <= 0 {
+			delete(active, e.ip)
+		}
+		if int64(len(active)) > peak {
+			peak = int64(len(active))
+			peakAt = e.at
+			peakIPs = peakIPs[:0]
+			for ip := range active {
+				peakIPs = append(peakIPs, ip)
+			}
+		}
+	}
+	sort.Strings(peakIPs)
+	return peak, peakAt, peakIPs
+}
+
+// sortedKeys 返回集合中排序后的前 riskDetailsMaxItems 个元素
+func sortedKeys(set map[string]bool) []string {
+	keys := make([]string, 0, len(set))
+	for key := range set {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	if len(keys) > riskDetailsMaxItems {
+		keys = keys[:riskDetailsMaxItems]
+	}
+	return keys
+}
+
+// EvaluateUserRisk 根据登录设备和API请求记录计算用户的账户共享信号
+// 批次兑换信号按批次统计，只在风控扫描中产生
+func EvaluateUserRisk(userID uint, settings *RiskSettings) ([]RiskSignal, error) {
+	now := time.Now()
+	since := now.Add(-time.Duration(settings.WindowHours) * time.Hour)
+	daySince := now.Add(-24 * time.Hour)
+
+	var transactions []riskTransaction
+	if err := database.DB.Model(&models.APITransaction{}).
+		Select("ip, duration, created_at").
+		Where("user_id = ? AND created_at >= ? AND ip <> ''", userID, since).
+		Order("created_at ASC").
+		Scan(&transactions).Error; err != nil {
+		return nil, fmt.Errorf("获取API请求记录失败: %v", err)
+	}
+
+	// Redis 不可用时只根据API请求记录计算
+	deviceManager := NewDeviceManager(database.TokenRedisClient, database.UserRedisClient, database.DeviceRedisClient)
+	devices, err := deviceManager.GetUserDevices(userID)
+	if err != nil {
+		log.Printf("❌ 风控获取用户设备失败: user_id=%d, error=%v", userID, err)
+	}
+
+	ips := map[string]bool{}
+	for _, tx := range transactions {
+		ips[tx.IP] = true
+	}
+	locations := map[string]bool{}
+	var newDevices int64
+	for _, device := range devices {
+		if device.LastActive.After(since) {
+			if device.IP != "" {
+				ips[device.IP] = true
+			}
+			// 本地、内网和无法识别的地区不计入
+			if device.Location != "" && device.Location != "本地" && device.Location != "内网" && device.Location != "未知地区" {
+				locations[device.Location] = true
+			}
+		}
+		if device.CreatedAt.After(daySince) {
+			newDevices++
+		}
+	}
+
+	peak, peakAt, peakIPs := maxConcurrentIPs(transactions)
+	concurrentDetails := map[string]interface{}{"ips": peakIPs}
+	if peak > 0 {
+		concurrentDetails["at"] = peakAt
+	}
+
+	return []RiskSignal{
+		newRiskSignal(RiskSignalDistinctIPs, int64(len(ips)), settings.MaxDistinctIPs, false, map[string]interface{}{
+			"ips":          sortedKeys(ips),
+			"window_hours": settings.WindowHours,
+		}),
+		newRiskSignal(RiskSignalDistinctLocations, int64(len(locations)), settings.MaxDistinctLocations, false, map[string]interface{}{
+			"locations":    sortedKeys(locations),
+			"window_hours": settings.WindowHours,
+		}),
+		newRiskSignal(RiskSignalDevicesPerDay, newDevices, settings.MaxDevicesPerDay, false, map[string]interface{}{
+			"total_devices": len(devices),
+		}),
+		newRiskSignal(RiskSignalConcurrentIPs, peak, settings.MaxConcurrentIPs, false, concurrentDetails),
+	}, nil
+}
+
+// detectBatchFreshAccounts 统计窗口内同一批次被新注册账户兑换的次数，返回每个兑换账户的信号
+func detectBatchFreshAccounts(settings *RiskSettings) (map[uint][]RiskSignal, error) {
+	signals := map[uint][]RiskSignal{}
+	if settings.BatchFreshAccountThreshold <= 0 {
+		return signals, nil
+	}
+
+	since := time.Now().Add(-time.Duration(settings.WindowHours) * time.Hour)
+	var rows []struct {
+		BatchNumber string
+		UserID      uint
+	}
+	if err := database.DB.Table("redemption_records").
+		Select("redemption_records.batch_number, redemption_records.user_id").
+		Joins("JOIN users ON users.id = redemption_records.user_id").
+		Where("redemption_records.source_type = ? AND redemption_records.batch_number <> '' AND redemption_records.created_at >= ?", "activation_code", since).
+		Where("redemption_records.created_at <= DATE_ADD(users.created_at, INTERVAL ? HOUR)", settings.FreshAccountHours).
+		Scan(&rows).Error; err != nil {
+		return nil, fmt.Errorf("获取激活码兑换记录失败: %v", err)
+	}
+
+	batchUsers := map[string]map[uint]int64{}
+	batchTotals := map[string]int64{}
+	for _, row := range rows {
+		if batchUsers[row.BatchNumber] == nil {
+			batchUsers[row.BatchNumber] = map[uint]int64{}
+		}
+		batchUsers[row.BatchNumber][row.UserID]++
+		batchTotals[row.BatchNumber]++
+	}
+
+	for batchNumber, users := range batchUsers {
+		total := batchTotals[batchNumber]
+		if total < settings.BatchFreshAccountThreshold {
+			continue
+		}
+		for userID, count := range users {
+			signals[userID] = append(signals[userID], newRiskSignal(RiskSignalBatchFreshAccounts, total, settings.BatchFreshAccountThreshold, true, map[string]interface{}{
+				"batch_number":        batchNumber,
+				"fresh_accounts":      len(users),
+				"user_redemptions":    count,
+				"fresh_account_hours": settings.FreshAccountHours,
+				"window_hours":        settings.WindowHours,
+			}))
+		}
+	}
+	return signals, nil
+}
+
+// recordRiskSignal 记录触发的信号：统计窗口内已有待审核事件时更新，否则新建
+// 管理员在窗口内已审核过的同类事件，观测值没有继续升高时不再重复产生
+// 返回是否新建、是否更新以及是否计入账户风险分
+func recordRiskSignal(userID uint, signal RiskSignal, since time.Time) (bool, bool, bool, error) {
+	details, _ := json.Marshal(signal.Details)
+
+	var reviewed models.RiskEvent
+	err := database.DB.Where("user_id = ? AND signal_type = ? AND status <> ? AND reviewed_at >= ?", userID, signal.Signal, RiskEventPending, since).
+		Order("reviewed_at DESC").First(&reviewed).Error
+	if err == nil && signal.Value <= reviewed.Value {
+		return false, false, reviewed.Status == RiskEventConfirmed, nil
+	}
+
+	var existing models.RiskEvent
+	err = database.DB.Where("user_id = ? AND signal_type = ? AND status = ? AND created_at >= ?", userID, signal.Signal, RiskEventPending, since).
+		Order("created_at DESC").First(&existing).Error
+	if err == nil {
+		if err := database.DB.Model(&existing).Updates(map[string]interface{}{
+			"score":     signal.Score,
+			"value":     signal.Value,
+			"threshold": signal.Threshold,
+			"details":   string(details),
+		}).Error; err != nil {
+			return false, false, false, fmt.Errorf("更新风控事件失败: %v", err)
+		}
+		return false, true, true, nil
+	}
+	if err != gorm.ErrRecordNotFound {
+		return false, false, false, fmt.Errorf("获取风控事件失败: %v", err)
+	}
+
+	event := models.RiskEvent{
+		UserID:     userID,
+		SignalType: signal.Signal,
+		Score:      signal.Score,
+		Value:      signal.Value,
+		Threshold:  signal.Threshold,
+		Details:    string(details),
+		Status:     RiskEventPending,
+		AutoAction: RiskActionNone,
+	}
+	if err := database.DB.Create(&event).Error; err != nil {
+		return false, false, false, fmt.Errorf("创建风控事件失败: %v", err)
+	}
+	return true, false, true, nil
+}
+
+// applyRiskAutoAction 账户风险分达到配置值时自动下线设备或临时禁用账户，统计窗口内同一处置只执行一次
+func applyRiskAutoAction(userID uint, score int, settings *RiskSettings, since time.Time) (string, error) {
+	action := RiskActionNone
+	if settings.AutoDisableScore > 0 && int64(score) >= settings.AutoDisableScore {
+		action = RiskActionDisable
+	} else if settings.AutoLogoutScore > 0 && int64(score) >= settings.AutoLogoutScore {
+		action = RiskActionDeviceLogout
+	}
+	if action == RiskActionNone {
+		return RiskActionNone, nil
+	}
+
+	var count int64
+	database.DB.Model(&models.RiskEvent{}).
+		Where("user_id = ? AND auto_action = ? AND updated_at >= ?", userID, action, since).
+		Count(&count)
+	if count > 0 {
+		return RiskActionNone, nil
+	}
+
+	if action == RiskActionDisable {
+		until := time.Now().Add(time.Duration(settings.AutoDisableHours) * time.Hour)
+		if _, err := DisableUserTemporarily(userID, until); err != nil {
+			return RiskActionNone, err
+		}
+	} else if err := revokeUserDevicesForRisk(userID); err != nil {
+		return RiskActionNone, err
+	}
+
+	// 标记本次扫描涉及的待审核事件，便于管理员在审核队列中看到自动处置
+	if err := database.DB.Model(&models.RiskEvent{}).
+		Where("user_id = ? AND status = ? AND updated_at >= ?", userID, RiskEventPending, since).
+		Update("auto_action", action).Error; err != nil {
+		return action, fmt.Errorf("更新风控事件处置失败: %v", err)
+	}
+	log.Printf("🚨 风控自动处置: user_id=%d, score=%d, action=%s", userID, score, action)
+	return action, nil
+}
+
+// revokeUserDevicesForRisk 下线用户全部登录设备
+func revokeUserDevicesForRisk(userID uint) error {
+	deviceManager := NewDeviceManager(database.TokenRedisClient, database.UserRedisClient, database.DeviceRedisClient)
+	if err := deviceManager.RevokeAllUserDevices(userID); err != nil {
+		return fmt.Errorf("下线用户设备失败: %v", err)
+	}
+	return nil
+}
+
+// DisableUserTemporarily 临时禁用账户并下线全部登录设备，到期后由风控扫描自动恢复
+// 已被管理员永久禁用的账户不会改为临时禁用，返回是否执行了禁用
+func DisableUserTemporarily(userID uint, until time.Time) (bool, error) {
+	result := database.DB.Model(&models.User{}).
+		Where("id = ? AND (is_disabled = ? OR disabled_until IS NOT NULL)", userID, false).
+		Updates(map[string]interface{}{
+			"is_disabled":    true,
+			"disabled_until": until,
+		})
+	if result.Error != nil {
+		return false, fmt.Errorf("禁用账户失败: %v", result.Error)
+	}
+	if err := revokeUserDevicesForRisk(userID); err != nil {
+		return result.RowsAffected > 0, err
+	}
+	return result.RowsAffected > 0, nil
+}
+
+// ReleaseExpiredUserDisables 恢复临时禁用已到期的账户
+func ReleaseExpiredUserDisables() (int64, error) {
+	result := database.DB.Model(&models.User{}).
+		Where("is_disabled = ? AND disabled_until IS NOT NULL AND disabled_until <= ?", true, time.Now()).
+		Updates(map[string]interface{}{
+			"is_disabled":    false,
+			"disabled_until": nil,
+		})
+	if result.Error != nil {
+		return 0, fmt.Errorf("恢复临时禁用账户失败: %v", result.Error)
+	}
+	return result.RowsAffected, nil
+}
+
+// RunRiskScan 扫描统计窗口内有API请求或激活码兑换的用户，产生风控事件并执行自动处置
+func RunRiskScan() (*RiskScanResult, error) {
+	result := &RiskScanResult{}
+
+	released, err := ReleaseExpiredUserDisables()
+	if err != nil {
+		return result, err
+	}
+	result.Released = int(released)
+
+	settings := GetRiskSettings()
+	if !settings.Enabled {
+		return result, nil
+	}
+	since := time.Now().Add(-time.Duration(settings.WindowHours) * time.Hour)
+
+	var userIDs []uint
+	if err := database.DB.Model(&models.APITransaction{}).
+		Where("created_at >= ?", since).
+		Distinct("user_id").
+		Pluck("user_id", &userIDs).Error; err != nil {
+		return result, fmt.Errorf("获取活跃用户失败: %v", err)
+	}
+
+	batchSignals, err := detectBatchFreshAccounts(settings)
+	if err != nil {
+		return result, err
+	}
+	seen := map[uint]bool{}
+	for _, userID := range userIDs {
+		seen[userID] = true
+	}
+	for userID := range batchSignals {
+		if !seen[userID] {
+			userIDs = append(userIDs, userID)
+		}
+	}
+
+	for _, userID := range userIDs {
+		signals, err := EvaluateUserRisk(userID, settings)
+		if err != nil {
+			log.Printf("❌ 风控计算失败: user_id=%d, error=%v", userID, err)
+			continue
+		}
+		signals = append(signals, batchSignals[userID]...)
+		result.ScannedUsers++
+
+		score := 0
+		for _, signal := range signals {
+			if !signal.Triggered {
+				continue
+			}
+			created, updated, counted, err := recordRiskSignal(userID, signal, since)
+			if err != nil {
+				log.Printf("❌ 记录风控事件失败: user_id=%d, signal=%s, error=%v", userID, signal.Signal, err)
+				continue
+			}
+			if created {
+				result.CreatedEvents++
+			}
+			if updated {
+				result.UpdatedEvents++
+			}
+			if counted {
+				score += signal.Score
+			}
+		}
+		if score == 0 {
+			continue
+		}
+
+		action, err := applyRiskAutoAction(userID, score, settings, since)
+		if err != nil {
+			log.Printf("❌ 风控自动处置失败: user_id=%d, error=%v", userID, err)
+		}
+		switch action {
+		case RiskActionDisable:
+			result.AutoDisables++
+		case RiskActionDeviceLogout:
+			result.AutoLogouts++
+		}
+	}
+
+	return result, nil
+}
+
+// GetUserRiskProfile 获取用户当前的风控信号、风险分和最近的风控事件
+func GetUserRiskProfile(userID uint) (*UserRiskProfile, error) {
+	var user models.User
+	if err := database.DB.Where("id = ?", userID).First(&user).Error; err != nil {
+		return nil, fmt.Errorf("用户不存在")
+	}
+
+	signals, err := EvaluateUserRisk(userID, GetRiskSettings())
+	if err != nil {
+		return nil, err
+	}
+	profile := &UserRiskProfile{
+		UserID:        userID,
+		IsDisabled:    user.IsDisabled,
+		DisabledUntil: user.DisabledUntil,
+		Signals:       signals,
+		Events:        []models.RiskEvent{},
+	}
+	for _, signal := range signals {
+		profile.Score += signal.Score
+	}
+
+	if err := database.DB.Where("user_id = ?", userID).Order("created_at DESC").Limit(50).Find(&profile.Events).Error; err != nil {
+		return nil, fmt.Errorf("获取风控事件失败: %v", err)
+	}
+	return profile, nil
+}
+
+// ReviewRiskEvent 管理员审核风控事件：确认或忽略，确认时可下线设备或临时禁用账户
+func ReviewRiskEvent(eventID, adminUserID uint, status, action string, disableHours int64, note string) (*models.RiskEvent, error) {
+	if status != RiskEventConfirmed && status != RiskEventDismissed {
+		return nil, fmt.Errorf("无效的审核状态")
+	}
+	if action == "" {
+		action = RiskActionNone
+	}
+	if action != RiskActionNone && action != RiskActionDeviceLogout && action != RiskActionDisable {
+		return nil, fmt.Errorf("无效的处置动作")
+	}
+	if status == RiskEventDismissed && action != RiskActionNone {
+		return nil, fmt.Errorf("忽略的事件不能执行处置")
+	}
+
+	var event models.RiskEvent
+	if err := database.DB.Where("id = ?", eventID).First(&event).Error; err != nil {
+		return nil, fmt.Errorf("风控事件不存在")
+	}
+	if event.Status != RiskEventPending {
+		return nil, fmt.Errorf("该风控事件已审核")
+	}
+
+	switch action {
+	case RiskActionDisable:
+		if disableHours <= 0 {
+			disableHours = GetRiskSettings().AutoDisableHours
+		}
+		if _, err := DisableUserTemporarily(event.UserID, time.Now().Add(time.Duration(disableHours)*time.Hour)); err != nil {
+			return nil, err
+		}
+	case RiskActionDeviceLogout:
+		if err := revokeUserDevicesForRisk(event.UserID); err != nil {
+			return nil, err
+		}
+	}
+
+	now := time.Now()
+	result := database.DB.Model(&models.RiskEvent{}).
+		Where("id = ? AND status = ?", eventID, RiskEventPending).
+		Updates(map[string]interface{}{
+			"status":        status,
+			"review_action": action,
+			"review_note":   note,
+			"reviewed_by":   adminUserID,
+			"reviewed_at":   now,
+		})
+	if result.Error != nil {
+		return nil, fmt.Errorf("更新风控事件失败: %v", result.Error)
+	}
+	if result.RowsAffected == 0 {
+		return nil, fmt.Errorf("该风控事件已审核")
+	}
+
+	event.Status = status
+	event.ReviewAction = action
+	event.ReviewNote = note
+	event.ReviewedBy = &adminUserID
+	event.ReviewedAt = &now
+	return &event, nil
+}
@@ -0,0 +1,453 @@
+package utils
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"runtime/debug"
+	"sort"
+	"strings"
+	"time"
+
+	"claude/database"
+	"claude/models"
+
+	"github.com/go-redis/redis/v8"
+	"github.com/google/uuid"
+)
+
+// 定时任务触发方式
+const (
+	JobTriggerSchedule = "schedule"
+	JobTriggerManual   = "manual"
+)
+
+// ErrJobRunning 任务正在其他实例或本实例中执行
+var ErrJobRunning = errors.New("任务正在执行中，请稍后再试")
+
+// 默认任务锁过期时间，任务执行超过该时间后锁自动释放
+const defaultJobTimeout = 30 * time.Minute
+
+// 释放任务锁，仅当锁仍由当前持有者持有时删除
+var releaseJobLockScript = redis.NewScript(`
+if redis.call("get", KEYS[1]) == ARGV[1] then
+	return redis.call("del", KEYS[1])
+end
+return 0`)
+
+// ScheduledJob 定时任务定义
+type ScheduledJob struct {
+	Name            string
+	Description     string
+	DefaultSchedule string        // 默认cron表达式，可通过 job_schedule_<name> 配置覆盖
+	Timeout         time.Duration // 任务锁过期时间，为0时使用默认值
+	Run             func() error
+}
+
+// ScheduledJobStatus 定时任务状态（管理后台展示）
+type ScheduledJobStatus struct {
+	Name        string         `json:"name"`
+	Description string         `json:"description"`
+	Schedule    string         `json:"schedule"`
+	Enabled     bool           `json:"enabled"`
+	NextRunAt   *time.Time     `json:"next_run_at"`
+	Running     bool           `json:"running"`
+	LastRun     *models.JobRun `json:"last_run"`
+}
+
+var (
+	scheduledJobs = make(map[string]*ScheduledJob)
+	// 当前实例标识，用于区分多副本部署时由哪个实例执行了任务
+	schedulerInstanceID = buildSchedulerInstanceID()
+)
+
+// buildSchedulerInstanceID 生成实例标识：主机名-进程号-随机后缀
+func buildSchedulerInstanceID() string {
+	hostname, _ := os.Hostname()
+	return fmt.Sprintf("%s-%d-%s", hostname, os.Getpid(), uuid.New().String()[:8])
+}
+
+// RegisterScheduledJob 注册定时任务
+func RegisterScheduledJob(job *ScheduledJob) {
+	if job.Timeout == 0 {
+		job.Timeout = defaultJobTimeout
+	}
+	scheduledJobs[job.Name] = job
+}
+
+// GetScheduledJob 按名称获取定时任务
+func GetScheduledJob(name string) (*ScheduledJob, bool) {
+	job, ok := scheduledJobs[name]
+	return job, ok
+}
+
+// jobScheduleConfigKey 定时任务cron表达式的配置键
+func jobScheduleConfigKey(name string) string {
+	return "job_schedule_" + name
+}
+
+// GetJobSchedule 获取任务当前的cron表达式，配置为 off 时返回 nil 表示停用
+func GetJobSchedule(job *ScheduledJob) (string, *CronSchedule, error) {
+	expr := job.DefaultSchedule
+	var cfg models.SystemConfig
+	if err := database.DB.Where("config_key = ?", jobScheduleConfigKey(job.Name)).First(&cfg).Error; err == nil {
+		expr = strings.TrimSpace(cfg.ConfigValue)
+	}
+	if expr == "" || strings.EqualFold(expr, "off") {
+		return "off", nil, nil
+	}
+
+	schedule, err := ParseCronSchedule(expr)
+	if err != nil {
+		return expr, nil, err
+	}
+	return schedule.String(), schedule, nil
+}
+
+// UpdateJobSchedule 更新任务的cron表达式，off 表示停用
+func UpdateJobSchedule(name, expr string) error {
+	job, ok := GetScheduledJob(name)
+	if !ok {
+		return errors.New("定时任务不存在")
+	}
+
+	expr = strings.TrimSpace(expr)
+	if !strings.EqualFold(expr, "off") {
+		schedule, err := ParseCronSchedule(expr)
+		if err != nil {
+			return err
+		}
+		expr = schedule.String()
+	} else {
+		expr = "off"
+	}
+
+	key := jobScheduleConfigKey(name)
+	var cfg models.SystemConfig
+	if err := database.DB.Where("config_key = ?", key).First(&cfg).Error; err != nil {
+		cfg = models.SystemConfig{
+			ConfigKey:   key,
+			ConfigValue: expr,
+			Description: fmt.Sprintf("定时任务【%s】的cron表达式（分 时 日 月 周），填 off 表示停用", job.Description),
+		}
+		return database.DB.Create(&cfg).Error
+	}
+	return database.DB.Model(&cfg).Update("config_value", expr).Error
+}
+
+// GetScheduledJobStatuses 获取所有定时任务的状态
+func GetScheduledJobStatuses() []ScheduledJobStatus {
+	names := make([]string, 0, len(scheduledJobs))
+	for name := range scheduledJobs {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	ctx := context.Background()
+	now := time.Now()
+	statuses := make([]ScheduledJobStatus, 0, len(names))
+	for _, name := range names {
+		job := scheduledJobs[name]
+		expr, schedule, err := GetJobSchedule(job)
+		status := ScheduledJobStatus{
+			Name:        job.Name,
+			Description: job.Description,
+			Schedule:    expr,
+			Enabled:     schedule != nil && err == nil,
+		}
+		if schedule != nil {
+			if next := schedule.Next(now); !next.IsZero() {
+				status.NextRunAt = &next
+			}
+		}
+		if exists, err := database.TokenRedisClient.Exists(ctx, jobLockKey(name)).Result(); err == nil {
+			status.Running = exists > 0
+		}
+
+		var lastRun models.JobRun
+		if err := database.DB.Where("job_name = ?", name).Order("started_at DESC").First(&lastRun).Error; err == nil {
+			status.LastRun = &lastRun
+		}
+		statuses = append(statuses, status)
+	}
+	return statuses
+}
+
+// jobLockKey 任务执行锁的Redis键
+func jobLockKey(name string) string {
+	return "job_lock:" + name
+}
+
+// acquireJobLock 获取任务执行锁，成功时返回锁令牌
+func acquireJobLock(job *ScheduledJob) (string, error) {
+	token := uuid.New().String()
+	ok, err := database.TokenRedisClient.SetNX(context.Background(), jobLockKey(job.Name), token, job.Timeout).Result()
+	if err != nil {
+		return "", fmt.Errorf("获取任务锁失败: %v", err)
+	}
+	if !ok {
+		return "", ErrJobRunning
+	}
+	return token, nil
+}
+
+// releaseJobLock 释放任务执行锁
+func releaseJobLock(job *ScheduledJob, token string) {
+	if err := releaseJobLockScript.Run(context.Background(), database.TokenRedisClient,
+		[]string{jobLockKey(job.Name)}, token).Err(); err != nil && err != redis.Nil {
+		log.Printf("❌ 释放任务锁失败: job=%s, error=%v", job.Name, err)
+	}
+}
+
+// claimJobSlot 同一调度时间点只允许一个实例执行，多副本部署时避免重复执行
+func claimJobSlot(job *ScheduledJob, slot time.Time) (bool, error) {
+	key := fmt.Sprintf("job_slot:%s:%d", job.Name, slot.Unix())
+	return database.TokenRedisClient.SetNX(context.Background(), key, schedulerInstanceID, time.Hour).Result()
+}
+
+// startJobRun 持有任务锁后创建执行记录
+func startJobRun(job *ScheduledJob, trigger string, triggeredBy *uint) (*models.JobRun, error) {
+	now := time.Now()
+
+	// 持有锁说明没有其他实例在执行，之前遗留的执行中记录是实例异常退出导致的
+	database.DB.Model(&models.JobRun{}).
+		Where("job_name = ? AND status = ?", job.Name, "running").
+		Updates(map[string]interface{}{
+			"status":      "failed",
+			"error":       "任务执行中断（实例退出或超时）",
+			"finished_at": now,
+		})
+
+	run := &models.JobRun{
+		JobName:     job.Name,
+		TriggerType: trigger,
+		TriggeredBy: triggeredBy,
+		InstanceID:  schedulerInstanceID,
+		Status:      "running",
+		StartedAt:   now,
+	}
+	if err := database.DB.Create(run).Error; err != nil {
+		return nil, fmt.Errorf("创建任务执行记录失败: %v", err)
+	}
+	return run, nil
+}
+
+// executeJobRun 执行任务并更新执行记录，执行结束后释放任务锁
+func executeJobRun(job *ScheduledJob, run *models.JobRun, lockToken string) {
+	defer releaseJobLock(job, lockToken)
+
+	var runErr error
+	func() {
+		defer func() {
+			if r := recover(); r != nil {
+				runErr = fmt.Errorf("panic: %v\n%s", r, debug.Stack())
+			}
+		}()
+		runErr = job.Run()
+	}()
+
+	finishedAt := time.Now()
+	updates := map[string]interface{}{
+		"status":      "success",
+		"finished_at": finishedAt,
+		"duration_ms": finishedAt.Sub(run.StartedAt).Milliseconds(),
+	}
+	if runErr != nil {
+		updates["status"] = "failed"
+		updates["error"] = runErr.Error()
+		log.Printf("❌ 定时任务执行失败: job=%s, run_id=%d, error=%v", job.Name, run.ID, runErr)
+	}
+	if err := database.DB.Model(run).Updates(updates).Error; err != nil {
+		log.Printf("❌ 更新任务执行记录失败: job=%s, run_id=%d, error=%v", job.Name, run.ID, err)
+	}
+}
+
+// runScheduledJob 按计划执行任务
+func runScheduledJob(job *ScheduledJob, slot time.Time) {
+	claimed, err := claimJobSlot(job, slot)
+	if err != nil {
+		log.Printf("❌ 定时任务调度失败: job=%s, error=%v", job.Name, err)
+		return
+	}
+	if !claimed {
+		return
+	}
+
+	token, err := acquireJobLock(job)
+	if err != nil {
+		// 上一次执行尚未结束，记录跳过
+		now := time.Now()
+		database.DB.Create(&models.JobRun{
+			JobName:     job.Name,
+			TriggerType: JobTriggerSchedule,
+			InstanceID:  schedulerInstanceID,
+			Status:      "skipped",
+			Error:       err.Error(),
+			StartedAt:   now,
+			FinishedAt:  &now,
+		})
+		return
+	}
+
+	run, err := startJobRun(job, JobTriggerSchedule, nil)
+	if err != nil {
+		releaseJobLock(job, token)
+		log.Printf("❌ %v: job=%s", err, job.Name)
+		return
+	}
+	executeJobRun(job, run, token)
+}
+
+// TriggerScheduledJob 管理员手动触发任务，任务在后台执行，返回执行记录
+func TriggerScheduledJob(name string, adminUserID uint) (*models.JobRun, error) {
+	job, ok := GetScheduledJob(name)
+	if !ok {
+		return nil, errors.New("定时任务不存在")
+	}
+
+	token, err := acquireJobLock(job)
+	if err != nil {
+		return nil, err
+	}
+
+	run, err := startJobRun(job, JobTriggerManual, &adminUserID)
+	if err != nil {
+		releaseJobLock(job, token)
+		return nil, err
+	}
+
+	go executeJobRun(job, run, token)
+	return run, nil
+}
+
+// StartJobScheduler 启动定时任务调度器，每分钟检查一次各任务的cron表达式
+func StartJobScheduler() {
+	registerBuiltinJobs()
+
+	go func() {
+		for {
+			// 对齐到下一个整分钟
+			now := time.Now()
+			next := now.Truncate(time.Minute).Add(time.Minute)
+			time.Sleep(next.Sub(now))
+
+			slot := time.Now().Truncate(time.Minute)
+			for _, job := range scheduledJobs {
+				_, schedule, err := GetJobSchedule(job)
+				if err != nil {
+					log.Printf("❌ 定时任务cron表达式错误: job=%s, error=%v", job.Name, err)
+					continue
+				}
+				if schedule != nil && schedule.Matches(slot) {
+					go runScheduledJob(job, slot)
+				}
+			}
+		}
+	}()
+
+	log.Printf("✅ 定时任务调度器已启动: instance=%s, jobs=%d", schedulerInstanceID, len(scheduledJobs))
+}
+
+// CleanupJobRuns 清理30天前的任务执行记录
+func CleanupJobRuns() error {
+	result := database.DB.Where("started_at < ?", time.Now().AddDate(0, 0, -30)).Delete(&models.JobRun{})
+	if result.Error != nil {
+		return fmt.Errorf("清理任务执行记录失败: %v", result.Error)
+	}
+	if result.RowsAffected > 0 {
+		log.Printf("已清理 %d 条任务执行记录", result.RowsAffected)
+	}
+	return nil
+}
+
+// registerBuiltinJobs 注册内置定时任务
+func registerBuiltinJobs() {
+	RegisterScheduledJob(&ScheduledJob{
+		Name:            "auto_refill",
+		Description:     "自动补给",
+		DefaultSchedule: "0 */4 * * *",
+		Run:             ExecuteAutoRefillCheck,
+	})
+	RegisterScheduledJob(&ScheduledJob{
+		Name:            "payment_order_expiry",
+		Description:     "支付订单过期检查",
+		DefaultSchedule: "*/5 * * * *",
+		Run: func() error {
+			count, err := ExpirePendingPaymentOrders()
+			if err == nil && count > 0 {
+				log.Printf("⏰ 已将 %d 个超时未支付订单标记为过期", count)
+			}
+			return err
+		},
+	})
+	RegisterScheduledJob(&ScheduledJob{
+		Name:            "subscription_renewal",
+		Description:     "周期订阅续费",
+		DefaultSchedule: "*/10 * * * *",
+		Run: func() error {
+			ProcessSubscriptionRenewals()
+			return nil
+		},
+	})
+	RegisterScheduledJob(&ScheduledJob{
+		Name:            "wallet_expiry",
+		Description:     "钱包过期扫描",
+		DefaultSchedule: "*/15 * * * *",
+		Run: func() error {
+			result, err := SweepExpiredWallets()
+			if result != nil && (result.EnteredGrace > 0 || result.Expired > 0 || result.Reactivated > 0) {
+				log.Printf("⏰ 钱包过期扫描完成: 进入宽限期=%d, 过期=%d, 恢复有效=%d",
+					result.EnteredGrace, result.Expired, result.Reactivated)
+			}
+			return err
+		},
+	})
+	RegisterScheduledJob(&ScheduledJob{
+		Name:            "activation_code_expiry",
+		Description:     "激活码过期检查",
+		DefaultSchedule: "5 * * * *",
+		Run: func() error {
+			count, err := ExpireActivationCodes()
+			if err == nil && count > 0 {
+				log.Printf("⏰ 已将 %d 个到期未使用的激活码标记为过期", count)
+			}
+			return err
+		},
+	})
+	RegisterScheduledJob(&ScheduledJob{
+		Name:            "device_code_cleanup",
+		Description:     "过期设备码清理",
+		DefaultSchedule: "*/30 * * * *",
+		Run:             CleanExpiredDeviceCodes,
+	})
+	RegisterScheduledJob(&ScheduledJob{
+		Name:            "device_cleanup",
+		Description:     "过期登录设备清理",
+		DefaultSchedule: "0 3 * * *",
+		Run: func() error {
+			deviceManager := NewDeviceManager(database.TokenRedisClient, database.UserRedisClient, database.DeviceRedisClient)
+			return deviceManager.CleanupExpiredDevices()
+		},
+	})
+	RegisterScheduledJob(&ScheduledJob{
+		Name:            "job_run_cleanup",
+		Description:     "定时任务执行记录清理",
+		DefaultSchedule: "30 3 * * *",
+		Run:             CleanupJobRuns,
+	})
+	RegisterScheduledJob(&ScheduledJob{
+		Name:            "risk_scan",
+		Description:     "账户风控扫描",
+		DefaultSchedule: "*/30 * * * *",
+		Run: func() error {
+			result, err := RunRiskScan()
+			if result != nil && (result.CreatedEvents > 0 || result.AutoLogouts > 0 || result.AutoDisables > 0 || result.Released > 0) {
+				log.Printf("🚨 风控扫描完成: 扫描用户=%d, 新增事件=%d, 自动下线=%d, 自动禁用=%d, 解除禁用=%d",
+					result.ScannedUsers, result.CreatedEvents, result.AutoLogouts, result.AutoDisables, result.Released)
+			}
+			return err
+		},
+	})
+}
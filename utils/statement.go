@@ -0,0 +1,456 @@
+package utils
+
+import (
+	"bytes"
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"html/template"
+	"io"
+	"math"
+	"sort"
+	"strconv"
+	"time"
+
+	"claude/config"
+	"claude/database"
+	"claude/models"
+)
+
+// weightedTokensSQL 单条API事务的加权token计算表达式（与recordUsage中的计费公式一致）
+const weightedTokensSQL = "(input_tokens * input_multiplier + output_tokens * output_multiplier + (cache_creation_input_tokens + cache_read_input_tokens) * cache_multiplier) * model_multiplier"
+
+// StatementCredit 对账单中的积分变动明细，包括兑换记录以及冻结、解禁和过期作废
+type StatementCredit struct {
+	Date       time.Time `json:"date"`
+	SourceType string    `json:"source_type"`
+	SourceID   string    `json:"source_id"`
+	Points     int64     `json:"points"`
+	Reason     string    `json:"reason"`
+}
+
+// StatementModelDebit 对账单中按模型汇总的积分消耗
+type StatementModelDebit struct {
+	Model        string `json:"model"`
+	Requests     int64  `json:"requests"`
+	InputTokens  int64  `json:"input_tokens"`
+	OutputTokens int64  `json:"output_tokens"`
+	CacheTokens  int64  `json:"cache_tokens"`
+	Points       int64  `json:"points"`
+}
+
+// UserStatement 用户积分对账单
+type UserStatement struct {
+	UserID         uint                  `json:"user_id"`
+	Username       string                `json:"username"`
+	Email          string                `json:"email"`
+	PeriodStart    time.Time             `json:"period_start"`
+	PeriodEnd      time.Time             `json:"period_end"` // 不包含
+	OpeningBalance int64                 `json:"opening_balance"`
+	Credits        []StatementCredit     `json:"credits"`
+	TotalCredits   int64                 `json:"total_credits"`
+	ModelDebits    []StatementModelDebit `json:"model_debits"`
+	OtherDebits    []StatementCredit     `json:"other_debits"` // 转出、手动扣减、冻结、过期作废等负数记录
+	TotalDebits    int64                 `json:"total_debits"`
+	ClosingBalance int64                 `json:"closing_balance"`
+	GeneratedAt    time.Time             `json:"generated_at"`
+}
+
+// StatementLine 对账单明细行，用于CSV和JSONL导出
+type StatementLine struct {
+	RecordType   string `json:"record_type"` // opening_balance, credit, model_debit, other_debit, closing_balance
+	Date         string `json:"date"`
+	Category     string `json:"category"`
+	Reference    string `json:"reference"`
+	Requests     int64  `json:"requests"`
+	InputTokens  int64  `json:"input_tokens"`
+	OutputTokens int64  `json:"output_tokens"`
+	CacheTokens  int64  `json:"cache_tokens"`
+	Points       int64  `json:"points"`
+	Description  string `json:"description"`
+}
+
+// roundPoints 积分保留两位小数
+func roundPoints(points float64) float64 {
+	return math.Round(points*100) / 100
+}
+
+// getStatementBalanceBefore 按账本计算指定时间之前的个人钱包余额：
+// 兑换记录合计 - API实际扣费 - 卡密冻结 + 解禁恢复 - 过期作废
+func getStatementBalanceBefore(userID uint, at time.Time) int64 {
+	var records, usage, frozen, restored, expired int64
+	database.DB.Model(&models.RedemptionRecord{}).
+		Select("COALESCE(SUM(points_amount), 0)").
+		Where("user_id = ? AND created_at < ?", userID, at).
+		Scan(&records)
+	database.DB.Model(&models.APITransaction{}).
+		Select("COALESCE(SUM(points_used), 0)").
+		Where("user_id = ? AND organization_id IS NULL AND status = ? AND created_at < ?", userID, "success", at).
+		Scan(&usage)
+	database.DB.Model(&models.FrozenPointsRecord{}).
+		Select("COALESCE(SUM(frozen_points), 0)").
+		Where("user_id = ? AND created_at < ?", userID, at).
+		Scan(&frozen)
+	database.DB.Model(&models.FrozenPointsRecord{}).
+		Select("COALESCE(SUM(frozen_points), 0)").
+		Where("user_id = ? AND status = ? AND updated_at < ?", userID, "restored", at).
+		Scan(&restored)
+	database.DB.Model(&models.WalletExpiryRecord{}).
+		Select("COALESCE(SUM(available_points), 0)").
+		Where("user_id = ? AND event = ? AND created_at < ?", userID, "expired", at).
+		Scan(&expired)
+	return records - usage - frozen + restored - expired
+}
+
+// getStatementWalletEvents 获取时间段内不写兑换记录的余额变动：卡密冻结、解禁恢复和钱包过期作废
+func getStatementWalletEvents(userID uint, start, end time.Time) []StatementCredit {
+	events := []StatementCredit{}
+
+	var frozen []models.FrozenPointsRecord
+	database.DB.Where("user_id = ? AND frozen_points > 0 AND created_at >= ? AND created_at < ?", userID, start, end).
+		Find(&frozen)
+	for _, record := range frozen {
+		events = append(events, StatementCredit{
+			Date:       record.CreatedAt,
+			SourceType: "freeze",
+			SourceID:   fmt.Sprintf("frozen_%d", record.ID),
+			Points:     -record.FrozenPoints,
+			Reason:     record.BanReason,
+		})
+	}
+
+	var restored []models.FrozenPointsRecord
+	database.DB.Where("user_id = ? AND status = ? AND frozen_points > 0 AND updated_at >= ? AND updated_at < ?", userID, "restored", start, end).
+		Find(&restored)
+	for _, record := range restored {
+		events = append(events, StatementCredit{
+			Date:       record.UpdatedAt,
+			SourceType: "unfreeze",
+			SourceID:   fmt.Sprintf("frozen_%d", record.ID),
+			Points:     record.FrozenPoints,
+			Reason:     "卡密解禁，恢复冻结积分",
+		})
+	}
+
+	var expired []models.WalletExpiryRecord
+	database.DB.Where("user_id = ? AND event = ? AND available_points > 0 AND created_at >= ? AND created_at < ?", userID, "expired", start, end).
+		Find(&expired)
+	for _, record := range expired {
+		events = append(events, StatementCredit{
+			Date:       record.CreatedAt,
+			SourceType: "expiry",
+			SourceID:   fmt.Sprintf("wallet_expiry_%d", record.ID),
+			Points:     -record.AvailablePoints,
+			Reason:     "钱包过期，剩余积分作废",
+		})
+	}
+
+	return events
+}
+
+// GenerateUserStatement 生成用户在指定时间段内的积分对账单
+// 余额和消耗均按账本计算：兑换记录、API请求实际扣除的积分、卡密冻结/解禁和钱包过期作废，期初余额加本期变动等于期末余额
+func GenerateUserStatement(userID uint, start, end time.Time) (*UserStatement, error) {
+	var user models.User
+	if err := database.DB.Where("id = ?", userID).First(&user).Error; err != nil {
+		return nil, fmt.Errorf("用户不存在")
+	}
+
+	statement := &UserStatement{
+		UserID:         user.ID,
+		Username:       user.Username,
+		Email:          user.Email,
+		PeriodStart:    start,
+		PeriodEnd:      end,
+		OpeningBalance: getStatementBalanceBefore(userID, start),
+		Credits:        []StatementCredit{},
+		ModelDebits:    []StatementModelDebit{},
+		OtherDebits:    []StatementCredit{},
+		GeneratedAt:    time.Now(),
+	}
+
+	// 入账和其他扣减明细
+	var records []models.RedemptionRecord
+	database.DB.Where("user_id = ? AND created_at >= ? AND created_at < ?", userID, start, end).
+		Order("created_at ASC").Find(&records)
+
+	items := make([]StatementCredit, 0, len(records))
+	for _, record := range records {
+		items = append(items, StatementCredit{
+			Date:       record.CreatedAt,
+			SourceType: record.SourceType,
+			SourceID:   record.SourceID,
+			Points:     record.PointsAmount,
+			Reason:     record.Reason,
+		})
+	}
+	items = append(items, getStatementWalletEvents(userID, start, end)...)
+	sort.SliceStable(items, func(i, j int) bool { return items[i].Date.Before(items[j].Date) })
+
+	var otherDebitTotal int64
+	for _, item := range items {
+		if item.Points >= 0 {
+			statement.Credits = append(statement.Credits, item)
+			statement.TotalCredits += item.Points
+		} else {
+			statement.OtherDebits = append(statement.OtherDebits, item)
+			otherDebitTotal += -item.Points
+		}
+	}
+
+	// 按模型汇总API请求实际扣除的积分（组织钱包计费的请求不计入个人账单）
+	var modelRows []struct {
+		Model        string
+		Requests     int64
+		InputTokens  int64
+		OutputTokens int64
+		CacheTokens  int64
+		Points       int64
+	}
+	database.DB.Model(&models.APITransaction{}).
+		Select("model, COUNT(*) AS requests, COALESCE(SUM(input_tokens), 0) AS input_tokens, "+
+			"COALESCE(SUM(output_tokens), 0) AS output_tokens, "+
+			"COALESCE(SUM(cache_creation_input_tokens + cache_read_input_tokens), 0) AS cache_tokens, "+
+			"COALESCE(SUM(points_used), 0) AS points").
+		Where("user_id = ? AND organization_id IS NULL AND status = ? AND created_at >= ? AND created_at < ?", userID, "success", start, end).
+		Group("model").Order("points DESC").
+		Scan(&modelRows)
+
+	var usagePoints int64
+	for _, row := range modelRows {
+		usagePoints += row.Points
+		statement.ModelDebits = append(statement.ModelDebits, StatementModelDebit{
+			Model:        row.Model,
+			Requests:     row.Requests,
+			InputTokens:  row.InputTokens,
+			OutputTokens: row.OutputTokens,
+			CacheTokens:  row.CacheTokens,
+			Points:       row.Points,
+		})
+	}
+	statement.TotalDebits = usagePoints + otherDebitTotal
+	statement.ClosingBalance = statement.OpeningBalance + statement.TotalCredits - statement.TotalDebits
+
+	return statement, nil
+}
+
+// Lines 将对账单展开为明细行
+func (s *UserStatement) Lines() []StatementLine {
+	lines := []StatementLine{{
+		RecordType:  "opening_balance",
+		Date:        s.PeriodStart.Format("2006-01-02"),
+		Points:      s.OpeningBalance,
+		Description: "期初余额",
+	}}
+
+	for _, credit := range s.Credits {
+		lines = append(lines, StatementLine{
+			RecordType:  "credit",
+			Date:        credit.Date.Format("2006-01-02 15:04:05"),
+			Category:    credit.SourceType,
+			Reference:   credit.SourceID,
+			Points:      credit.Points,
+			Description: credit.Reason,
+		})
+	}
+
+	for _, debit := range s.ModelDebits {
+		lines = append(lines, StatementLine{
+			RecordType:   "model_debit",
+			Category:     debit.Model,
+			Requests:     debit.Requests,
+			InputTokens:  debit.InputTokens,
+			OutputTokens: debit.OutputTokens,
+			CacheTokens:  debit.CacheTokens,
+			Points:       -debit.Points,
+			Description:  "API调用消耗",
+		})
+	}
+
+	for _, debit := range s.OtherDebits {
+		lines = append(lines, StatementLine{
+			RecordType:  "other_debit",
+			Date:        debit.Date.Format("2006-01-02 15:04:05"),
+			Category:    debit.SourceType,
+			Reference:   debit.SourceID,
+			Points:      debit.Points,
+			Description: debit.Reason,
+		})
+	}
+
+	lines = append(lines, StatementLine{
+		RecordType:  "closing_balance",
+		Date:        s.PeriodEnd.Add(-time.Second).Format("2006-01-02"),
+		Points:      s.ClosingBalance,
+		Description: "期末余额",
+	})
+
+	return lines
+}
+
+// WriteCSV 以CSV格式输出对账单明细
+func (s *UserStatement) WriteCSV(w io.Writer) error {
+	writer := csv.NewWriter(w)
+	header := []string{"record_type", "date", "category", "reference", "requests", "input_tokens", "output_tokens", "cache_tokens", "points", "description"}
+	if err := writer.Write(header); err != nil {
+		return err
+	}
+
+	for _, line := range s.Lines() {
+		row := []string{
+			line.RecordType,
+			line.Date,
+			line.Category,
+			line.Reference,
+			strconv.FormatInt(line.Requests, 10),
+			strconv.FormatInt(line.InputTokens, 10),
+			strconv.FormatInt(line.OutputTokens, 10),
+			strconv.FormatInt(line.CacheTokens, 10),
+			strconv.FormatInt(line.Points, 10),
+			line.Description,
+		}
+		if err := writer.Write(row); err != nil {
+			return err
+		}
+	}
+
+	writer.Flush()
+	return writer.Error()
+}
+
+// WriteJSONL 以JSON Lines格式输出对账单明细
+func (s *UserStatement) WriteJSONL(w io.Writer) error {
+	encoder := json.NewEncoder(w)
+	for _, line := range s.Lines() {
+		if err := encoder.Encode(line); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// statementHTMLTemplate 可打印的HTML对账单模板（浏览器打印即可另存为PDF）
+var statementHTMLTemplate = template.Must(template.New("statement").Funcs(template.FuncMap{
+	"date":    func(t time.Time) string { return t.Format("2006-01-02 15:04") },
+	"lastDay": func(t time.Time) string { return t.Add(-time.Second).Format("2006-01-02") },
+}).Parse(`<!DOCTYPE html>
+<html>
+<head>
+    <meta charset="UTF-8">
+    <title>{{.AppName}} 积分对账单</title>
+    <style>
+        body { font-family: Arial, sans-serif; color: #333; max-width: 900px; margin: 0 auto; padding: 20px; }
+        h1 { color: #007bff; margin-bottom: 0; }
+        table { width: 100%; border-collapse: collapse; margin: 15px 0; font-size: 13px; }
+        th, td { border: 1px solid #ddd; padding: 6px 8px; text-align: left; }
+        th { background-color: #f8f9fa; }
+        td.num { text-align: right; }
+        .summary td { font-weight: bold; }
+        @media print { body { padding: 0; } }
+    </style>
+</head>
+<body>
+    <h1>{{.AppName}}</h1>
+    <h2 style="color: #666;">积分对账单</h2>
+    <p>用户：{{.S.Username}}（{{.S.Email}}）<br>
+    账单周期：{{.S.PeriodStart.Format "2006-01-02"}} 至 {{lastDay .S.PeriodEnd}}<br>
+    生成时间：{{date .S.GeneratedAt}}</p>
+
+    <table class="summary">
+        <tr><td>期初余额</td><td class="num">{{.S.OpeningBalance}}</td></tr>
+        <tr><td>本期入账</td><td class="num">{{.S.TotalCredits}}</td></tr>
+        <tr><td>本期消耗</td><td class="num">{{.S.TotalDebits}}</td></tr>
+        <tr><td>期末余额</td><td class="num">{{.S.ClosingBalance}}</td></tr>
+    </table>
+
+    <h3>入账明细</h3>
+    <table>
+        <tr><th>时间</th><th>来源</th><th>说明</th><th>积分</th></tr>
+        {{range .S.Credits}}<tr><td>{{date .Date}}</td><td>{{.SourceType}}</td><td>{{.Reason}}</td><td class="num">{{.Points}}</td></tr>
+        {{else}}<tr><td colspan="4">无</td></tr>{{end}}
+    </table>
+
+    <h3>按模型消耗</h3>
+    <table>
+        <tr><th>模型</th><th>请求数</th><th>输入tokens</th><th>输出tokens</th><th>缓存tokens</th><th>积分</th></tr>
+        {{range .S.ModelDebits}}<tr><td>{{.Model}}</td><td class="num">{{.Requests}}</td><td class="num">{{.InputTokens}}</td><td class="num">{{.OutputTokens}}</td><td class="num">{{.CacheTokens}}</td><td class="num">{{.Points}}</td></tr>
+        {{else}}<tr><td colspan="6">无</td></tr>{{end}}
+    </table>
+
+    {{if .S.OtherDebits}}<h3>其他扣减</h3>
+    <table>
+        <tr><th>时间</th><th>类型</th><th>说明</th><th>积分</th></tr>
+        {{range .S.OtherDebits}}<tr><td>{{date .Date}}</td><td>{{.SourceType}}</td><td>{{.Reason}}</td><td class="num">{{.Points}}</td></tr>
+        {{end}}
+    </table>{{end}}
+
+    <p style="color: #999; font-size: 12px;">API消耗为累计token达到计费阈值时实际扣除的积分，未达到阈值的用量计入下一次扣费。</p>
+</body>
+</html>`))
+
+// WriteHTML 以可打印的HTML格式输出对账单
+func (s *UserStatement) WriteHTML(w io.Writer) error {
+	var buf bytes.Buffer
+	data := struct {
+		AppName string
+		S       *UserStatement
+	}{
+		AppName: config.AppConfig.AppName,
+		S:       s,
+	}
+	if err := statementHTMLTemplate.Execute(&buf, data); err != nil {
+		return err
+	}
+	_, err := w.Write(buf.Bytes())
+	return err
+}
+
+// GetStatementUserIDs 获取时间段内有积分变动或API调用的用户ID
+func GetStatementUserIDs(start, end time.Time) ([]uint, error) {
+	var transactionUserIDs []uint
+	if err := database.DB.Model(&models.APITransaction{}).
+		Where("organization_id IS NULL AND created_at >= ? AND created_at < ?", start, end).
+		Distinct().Pluck("user_id", &transactionUserIDs).Error; err != nil {
+		return nil, err
+	}
+
+	var recordUserIDs []uint
+	if err := database.DB.Model(&models.RedemptionRecord{}).
+		Where("created_at >= ? AND created_at < ?", start, end).
+		Distinct().Pluck("user_id", &recordUserIDs).Error; err != nil {
+		return nil, err
+	}
+
+	// 冻结、解禁和过期作废不写兑换记录，需要单独查询
+	var eventUserIDs, restoredUserIDs, expiredUserIDs []uint
+	if err := database.DB.Model(&models.FrozenPointsRecord{}).
+		Where("created_at >= ? AND created_at < ?", start, end).
+		Distinct().Pluck("user_id", &eventUserIDs).Error; err != nil {
+		return nil, err
+	}
+	if err := database.DB.Model(&models.FrozenPointsRecord{}).
+		Where("status = ? AND updated_at >= ? AND updated_at < ?", "restored", start, end).
+		Distinct().Pluck("user_id", &restoredUserIDs).Error; err != nil {
+		return nil, err
+	}
+	if err := database.DB.Model(&models.WalletExpiryRecord{}).
+		Where("event = ? AND created_at >= ? AND created_at < ?", "expired", start, end).
+		Distinct().Pluck("user_id", &expiredUserIDs).Error; err != nil {
+		return nil, err
+	}
+
+	candidates := append(transactionUserIDs, recordUserIDs...)
+	candidates = append(candidates, eventUserIDs...)
+	candidates = append(candidates, restoredUserIDs...)
+	candidates = append(candidates, expiredUserIDs...)
+
+	seen := make(map[uint]bool)
+	userIDs := make([]uint, 0, len(candidates))
+	for _, id := range candidates {
+		if !seen[id] {
+			seen[id] = true
+			userIDs = append(userIDs, id)
+		}
+	}
+	return userIDs, nil
+}
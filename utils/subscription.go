@@ -8,6 +8,7 @@ import (
 	"claude/models"
 
 	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
 )
 
 // DetermineServiceLevel 判断服务等级（升级/降级/同级）
@@ -58,22 +59,78 @@ func RedeemActivationCodeToWallet(userID uint, activationCode *models.Activation
 		}
 	}()
 
-	// 获取或创建用户钱包
-	wallet, err := GetOrCreateUserWallet(userID)
+	// 锁定激活码并校验兑换限制（过期时间、兑换次数、每人一次、新用户、邮箱域名）
+	claimed, err := claimActivationCodeTx(tx, activationCode.ID, userID)
 	if err != nil {
 		tx.Rollback()
-		return fmt.Errorf("获取用户钱包失败: %v", err)
+		return err
 	}
 
-	// 获取订阅计划
-	var plan models.SubscriptionPlan
-	if err := tx.Where("id = ?", activationCode.SubscriptionPlanID).First(&plan).Error; err != nil {
+	// 确保用户钱包存在，与兑换在同一事务中，兑换失败时不会留下空钱包
+	if err := ensureUserWalletTx(tx, userID); err != nil {
+		tx.Rollback()
+		return err
+	}
+
+	// 获取订阅计划，按激活码生成时的版本发放权益
+	var currentPlan models.SubscriptionPlan
+	if err := tx.Where("id = ?", activationCode.SubscriptionPlanID).First(&currentPlan).Error; err != nil {
 		tx.Rollback()
 		return fmt.Errorf("获取订阅计划失败: %v", err)
 	}
+	plan, err := ResolvePlanVersion(tx, &currentPlan, claimed.PlanVersionID)
+	if err != nil {
+		tx.Rollback()
+		return err
+	}
+	if err := CheckPlanAvailability(plan); err != nil {
+		tx.Rollback()
+		return err
+	}
+	if err := consumePlanInventoryTx(tx, plan.ID, true); err != nil {
+		tx.Rollback()
+		return err
+	}
+
+	// 发放套餐权益并创建兑换记录
+	_, err = GrantPlanToWalletTx(tx, userID, plan, models.RedemptionRecord{
+		SourceType:  "activation_code",
+		SourceID:    activationCode.Code,
+		Reason:      "激活码兑换",
+		BatchNumber: activationCode.BatchNumber,
+	})
+	if err != nil {
+		tx.Rollback()
+		return err
+	}
+
+	// 发放已领取的优惠码额外赠送积分
+	if _, err := applyPromoBonusTx(tx, userID, plan, "activation_code:"+activationCode.Code); err != nil {
+		tx.Rollback()
+		return err
+	}
+
+	// 被邀请人首次兑换付费激活码时发放邀请奖励
+	if err := convertReferralTx(tx, userID, plan, "activation_code:"+activationCode.Code); err != nil {
+		tx.Rollback()
+		return err
+	}
+
+	// 提交事务
+	return tx.Commit().Error
+}
+
+// GrantPlanToWalletTx 在事务中按服务等级规则将套餐权益发放到用户钱包，并创建兑换记录
+// record 只需填写来源相关字段（SourceType/SourceID/Reason等），套餐属性和时间由本函数补全
+func GrantPlanToWalletTx(tx *gorm.DB, userID uint, plan *models.SubscriptionPlan, record models.RedemptionRecord) (*models.RedemptionRecord, error) {
+	// 锁定用户钱包，避免并发发放时读取到旧数据
+	var wallet models.UserWallet
+	if err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).Where("user_id = ?", userID).First(&wallet).Error; err != nil {
+		return nil, fmt.Errorf("获取用户钱包失败: %v", err)
+	}
 
 	// 判断服务等级
-	serviceLevel := DetermineServiceLevel(wallet, &plan)
+	serviceLevel := DetermineServiceLevel(&wallet, plan)
 
 	// 计算新的过期时间
 	newValidityDuration := time.Duration(plan.ValidityDays) * 24 * time.Hour
@@ -141,50 +198,35 @@ func RedeemActivationCodeToWallet(userID uint, activationCode *models.Activation
 
 	// 更新钱包
 	if err := tx.Model(&models.UserWallet{}).Where("user_id = ?", userID).Updates(updates).Error; err != nil {
-		tx.Rollback()
-		return fmt.Errorf("更新用户钱包失败: %v", err)
+		return nil, fmt.Errorf("更新用户钱包失败: %v", err)
 	}
 
 	// 创建兑换记录
-	redemptionRecord := models.RedemptionRecord{
-		UserID:                userID,
-		SourceType:            "activation_code",
-		SourceID:              activationCode.Code,
-		PointsAmount:          plan.PointAmount,
-		ValidityDays:          plan.ValidityDays,
-		SubscriptionPlanID:    &plan.ID,
-		DailyMaxPoints:        plan.DailyMaxPoints,
-		DegradationGuaranteed: plan.DegradationGuaranteed,
-		DailyCheckinPoints:    plan.DailyCheckinPoints,
-		DailyCheckinPointsMax: plan.DailyCheckinPointsMax,
-		AutoRefillEnabled:     plan.AutoRefillEnabled,
-		AutoRefillThreshold:   plan.AutoRefillThreshold,
-		AutoRefillAmount:      plan.AutoRefillAmount,
-		ActivatedAt:           time.Now(),
-		ExpiresAt:             newExpiresAt,
-		Reason:                fmt.Sprintf("激活码兑换 - %s服务", serviceLevel),
-		BatchNumber:           activationCode.BatchNumber,
-		CreatedAt:             time.Now(),
-		UpdatedAt:             time.Now(),
-	}
-
-	if err := tx.Create(&redemptionRecord).Error; err != nil {
-		tx.Rollback()
-		return fmt.Errorf("创建兑换记录失败: %v", err)
-	}
-
-	// 更新激活码状态
-	if err := tx.Model(activationCode).Updates(map[string]interface{}{
-		"status":         "used",
-		"used_by_user_id": userID,
-		"used_at":        time.Now(),
-	}).Error; err != nil {
-		tx.Rollback()
-		return fmt.Errorf("更新激活码状态失败: %v", err)
-	}
-
-	// 提交事务
-	return tx.Commit().Error
+	record.UserID = userID
+	if record.PlanVersionID == nil {
+		record.PlanVersionID = plan.CurrentVersionID
+	}
+	record.PointsAmount = plan.PointAmount
+	record.ValidityDays = plan.ValidityDays
+	record.SubscriptionPlanID = &plan.ID
+	record.DailyMaxPoints = plan.DailyMaxPoints
+	record.DegradationGuaranteed = plan.DegradationGuaranteed
+	record.DailyCheckinPoints = plan.DailyCheckinPoints
+	record.DailyCheckinPointsMax = plan.DailyCheckinPointsMax
+	record.AutoRefillEnabled = plan.AutoRefillEnabled
+	record.AutoRefillThreshold = plan.AutoRefillThreshold
+	record.AutoRefillAmount = plan.AutoRefillAmount
+	record.ActivatedAt = time.Now()
+	record.ExpiresAt = newExpiresAt
+	record.Reason = fmt.Sprintf("%s - %s服务", record.Reason, serviceLevel)
+	record.CreatedAt = time.Now()
+	record.UpdatedAt = time.Now()
+
+	if err := tx.Create(&record).Error; err != nil {
+		return nil, fmt.Errorf("创建兑换记录失败: %v", err)
+	}
+
+	return &record, nil
 }
 
 // AdminGiftToWallet 管理员赠送积分到钱包
@@ -271,6 +313,7 @@ func AdminGiftToWallet(adminUserID, targetUserID uint, plan *models.Subscription
 		PointsAmount:          pointsAmount,
 		ValidityDays:          validityDays,
 		SubscriptionPlanID:    &plan.ID,
+		PlanVersionID:         plan.CurrentVersionID,
 		DailyMaxPoints:        dailyMaxPoints,
 		DegradationGuaranteed: plan.DegradationGuaranteed,
 		DailyCheckinPoints:    plan.DailyCheckinPoints,
@@ -0,0 +1,54 @@
+package utils
+
+import (
+	"os"
+	"testing"
+
+	"claude/database"
+	"claude/models"
+
+	"gorm.io/driver/mysql"
+	"gorm.io/gorm"
+	"gorm.io/gorm/logger"
+)
+
+// openTestDB 连接 TEST_MYSQL_DSN 指定的测试库并迁移兑换流程用到的表，未设置时跳过测试
+// 示例: TEST_MYSQL_DSN="root:root@tcp(127.0.0.1:3306)/claude_test?charset=utf8mb4&parseTime=True&loc=Local"
+// 行锁和条件更新的行为依赖 MySQL，不能用 SQLite 代替
+func openTestDB(t *testing.T) *gorm.DB {
+	t.Helper()
+
+	dsn := os.Getenv("TEST_MYSQL_DSN")
+	if dsn == "" {
+		t.Skip("未设置 TEST_MYSQL_DSN，跳过依赖 MySQL 的测试")
+	}
+
+	db, err := gorm.Open(mysql.Open(dsn), &gorm.Config{
+		Logger: logger.Default.LogMode(logger.Silent),
+	})
+	if err != nil {
+		t.Fatalf("连接测试数据库失败: %v", err)
+	}
+
+	err = db.AutoMigrate(
+		&models.User{},
+		&models.SubscriptionPlan{},
+		&models.SubscriptionPlanVersion{},
+		&models.ActivationCode{},
+		&models.SystemConfig{},
+		&models.UserWallet{},
+		&models.RedemptionRecord{},
+		&models.OrganizationCreditRecord{},
+		&models.PromoCode{},
+		&models.PromoRedemption{},
+		&models.Referral{},
+	)
+	if err != nil {
+		t.Fatalf("迁移测试数据库失败: %v", err)
+	}
+
+	previous := database.DB
+	database.DB = db
+	t.Cleanup(func() { database.DB = previous })
+	return db
+}
@@ -0,0 +1,270 @@
+package utils
+
+import (
+	"fmt"
+	"math"
+	"strconv"
+	"time"
+
+	"claude/database"
+	"claude/models"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// PointTransferSettings 积分转账配置
+type PointTransferSettings struct {
+	Enabled         bool  `json:"enabled"`
+	MinPoints       int64 `json:"min_points"`
+	MaxPoints       int64 `json:"max_points"`       // 0表示不限制
+	DailyLimit      int64 `json:"daily_limit"`      // 0表示不限制
+	VerifyThreshold int64 `json:"verify_threshold"` // 0表示不需要验证
+}
+
+// RequiresVerification 判断指定积分数量的转账是否需要邮箱验证码确认
+func (s *PointTransferSettings) RequiresVerification(points int64) bool {
+	return s.VerifyThreshold > 0 && points >= s.VerifyThreshold
+}
+
+// getTransferIntConfig 读取转账相关的整数配置，允许0值，配置不存在或非法时使用默认值
+func getTransferIntConfig(key string, defaultValue int64) int64 {
+	var config models.SystemConfig
+	if err := database.DB.Where("config_key = ?", key).First(&config).Error; err != nil {
+		return defaultValue
+	}
+	value, err := strconv.ParseInt(config.ConfigValue, 10, 64)
+	if err != nil || value < 0 {
+		return defaultValue
+	}
+	return value
+}
+
+// GetPointTransferSettings 获取积分转账配置
+func GetPointTransferSettings() *PointTransferSettings {
+	settings := &PointTransferSettings{
+		Enabled:         true,
+		MinPoints:       getTransferIntConfig("point_transfer_min_points", 100),
+		MaxPoints:       getTransferIntConfig("point_transfer_max_points", 100000),
+		DailyLimit:      getTransferIntConfig("point_transfer_daily_limit", 200000),
+		VerifyThreshold: getTransferIntConfig("point_transfer_verify_threshold", 10000),
+	}
+
+	var config models.SystemConfig
+	if err := database.DB.Where("config_key = ?", "point_transfer_enabled").First(&config).Error; err == nil {
+		settings.Enabled = config.ConfigValue == "true"
+	}
+
+	if settings.MinPoints < 1 {
+		settings.MinPoints = 1
+	}
+
+	return settings
+}
+
+// GetTodayTransferredPoints 获取用户今日已转出的积分总数
+func GetTodayTransferredPoints(userID uint) int64 {
+	return getTodayTransferredPoints(database.DB, userID)
+}
+
+// getTodayTransferredPoints 获取用户今日已转出的积分总数（可在事务中使用）
+func getTodayTransferredPoints(db *gorm.DB, userID uint) int64 {
+	now := time.Now()
+	startOfDay := time.Date(now.Year(), now.Month(), now.Day(), 0, 0, 0, 0, now.Location())
+
+	var total int64
+	db.Model(&models.PointTransfer{}).
+		Where("from_user_id = ? AND status = ? AND created_at >= ?", userID, "completed", startOfDay).
+		Select("COALESCE(SUM(points_amount), 0)").
+		Scan(&total)
+	return total
+}
+
+// validityDaysUntil 计算距离过期时间的剩余天数（向上取整）
+func validityDaysUntil(expiresAt time.Time) int {
+	return int(math.Ceil(time.Until(expiresAt).Hours() / 24))
+}
+
+// TransferPoints 用户之间转账积分，转入的积分沿用收款方钱包的过期时间，不延长收款方已有积分的有效期
+func TransferPoints(fromUserID, toUserID uint, points int64, note string, verified bool, ip string) (*models.PointTransfer, error) {
+	if fromUserID == toUserID {
+		return nil, fmt.Errorf("不能向自己转账")
+	}
+
+	settings := GetPointTransferSettings()
+	if !settings.Enabled {
+		return nil, fmt.Errorf("积分转账功能已关闭")
+	}
+	if points < settings.MinPoints {
+		return nil, fmt.Errorf("单笔转账最少 %d 积分", settings.MinPoints)
+	}
+	if settings.MaxPoints > 0 && points > settings.MaxPoints {
+		return nil, fmt.Errorf("单笔转账最多 %d 积分", settings.MaxPoints)
+	}
+	if settings.RequiresVerification(points) && !verified {
+		return nil, fmt.Errorf("转账金额较大，需要邮箱验证码确认")
+	}
+
+	// 确保收款方钱包存在
+	if _, err := GetOrCreateUserWallet(toUserID); err != nil {
+		return nil, fmt.Errorf("获取收款方钱包失败: %v", err)
+	}
+
+	var transfer models.PointTransfer
+	err := database.DB.Transaction(func(tx *gorm.DB) error {
+		// 按用户ID顺序加锁，避免双向转账时死锁
+		lockIDs := []uint{fromUserID, toUserID}
+		if toUserID < fromUserID {
+			lockIDs = []uint{toUserID, fromUserID}
+		}
+		wallets := make(map[uint]*models.UserWallet, 2)
+		for _, id := range lockIDs {
+			var wallet models.UserWallet
+			if err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).
+				Where("user_id = ?", id).First(&wallet).Error; err != nil {
+				if id == fromUserID {
+					return fmt.Errorf("您还没有可用的积分钱包")
+				}
+				return fmt.Errorf("获取收款方钱包失败: %v", err)
+			}
+			wallets[id] = &wallet
+		}
+
+		fromWallet := wallets[fromUserID]
+		toWallet := wallets[toUserID]
+		now := time.Now()
+
+		if fromWallet.Status != "active" || !fromWallet.WalletExpiresAt.After(now) {
+			return fmt.Errorf("您的钱包已过期，无法转账")
+		}
+		if fromWallet.AvailablePoints < points {
+			return fmt.Errorf("可用积分不足，当前可用 %d 积分", fromWallet.AvailablePoints)
+		}
+
+		// 转出方钱包已加锁，今日转出统计不会被并发请求绕过
+		if settings.DailyLimit > 0 {
+			transferredToday := getTodayTransferredPoints(tx, fromUserID)
+			if transferredToday+points > settings.DailyLimit {
+				return fmt.Errorf("超出每日转账限额，今日剩余可转 %d 积分", max(settings.DailyLimit-transferredToday, 0))
+			}
+		}
+
+		// 收款方钱包有效时保持原过期时间；已过期且没有剩余积分时沿用转出方的过期时间，
+		// 已过期但仍有积分时拒绝，避免通过转账让过期的余额重新生效
+		expiresAt := toWallet.WalletExpiresAt
+		if toWallet.Status != "active" || !toWallet.WalletExpiresAt.After(now) {
+			if toWallet.AvailablePoints > 0 {
+				return fmt.Errorf("收款方钱包已过期，无法接收转账")
+			}
+			expiresAt = fromWallet.WalletExpiresAt
+		}
+		validityDays := validityDaysUntil(expiresAt)
+		fromValidityDays := validityDaysUntil(fromWallet.WalletExpiresAt)
+
+		outReason := fmt.Sprintf("转账给用户 #%d", toUserID)
+		inReason := fmt.Sprintf("来自用户 #%d 的转账", fromUserID)
+		if note != "" {
+			outReason += "：" + note
+			inReason += "：" + note
+		}
+
+		// 扣减转出方积分（条件更新保证余额不会为负）
+		result := tx.Model(&models.UserWallet{}).
+			Where("user_id = ? AND available_points >= ?", fromUserID, points).
+			Updates(map[string]interface{}{
+				"total_points":     gorm.Expr("total_points - ?", points),
+				"available_points": gorm.Expr("available_points - ?", points),
+				"updated_at":       now,
+			})
+		if result.Error != nil {
+			return fmt.Errorf("扣减转出方积分失败: %v", result.Error)
+		}
+		if result.RowsAffected == 0 {
+			return fmt.Errorf("可用积分不足")
+		}
+
+		// 增加收款方积分
+		err := tx.Model(&models.UserWallet{}).
+			Where("user_id = ?", toUserID).
+			Updates(map[string]interface{}{
+				"total_points":      gorm.Expr("total_points + ?", points),
+				"available_points":  gorm.Expr("available_points + ?", points),
+				"wallet_expires_at": expiresAt,
+				"status":            "active",
+				"updated_at":        now,
+			}).Error
+		if err != nil {
+			return fmt.Errorf("增加收款方积分失败: %v", err)
+		}
+
+		transfer = models.PointTransfer{
+			FromUserID:   fromUserID,
+			ToUserID:     toUserID,
+			PointsAmount: points,
+			ExpiresAt:    expiresAt,
+			Note:         note,
+			Verified:     verified,
+			IP:           ip,
+			Status:       "completed",
+			CreatedAt:    now,
+		}
+		if err := tx.Create(&transfer).Error; err != nil {
+			return fmt.Errorf("创建转账记录失败: %v", err)
+		}
+
+		// 双方各写一条兑换记录，保证积分历史一致
+		sourceID := fmt.Sprintf("transfer_%d", transfer.ID)
+		records := []models.RedemptionRecord{
+			{
+				UserID:       fromUserID,
+				SourceType:   "transfer_out",
+				SourceID:     sourceID,
+				PointsAmount: -points,
+				ValidityDays: fromValidityDays,
+				ActivatedAt:  now,
+				ExpiresAt:    fromWallet.WalletExpiresAt,
+				Reason:       outReason,
+				CreatedAt:    now,
+				UpdatedAt:    now,
+			},
+			{
+				UserID:       toUserID,
+				SourceType:   "transfer_in",
+				SourceID:     sourceID,
+				PointsAmount: points,
+				ValidityDays: validityDays,
+				ActivatedAt:  now,
+				ExpiresAt:    expiresAt,
+				Reason:       inReason,
+				CreatedAt:    now,
+				UpdatedAt:    now,
+			},
+		}
+		if err := tx.Create(&records).Error; err != nil {
+			return fmt.Errorf("创建兑换记录失败: %v", err)
+		}
+
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return &transfer, nil
+}
+
+// GetUserPointTransfers 获取用户的转账记录（包含转入和转出）
+func GetUserPointTransfers(userID uint, limit, offset int) ([]models.PointTransfer, int64, error) {
+	var transfers []models.PointTransfer
+	var total int64
+
+	query := database.DB.Model(&models.PointTransfer{}).Where("from_user_id = ? OR to_user_id = ?", userID, userID)
+	query.Count(&total)
+
+	err := query.Preload("FromUser").Preload("ToUser").
+		Order("created_at DESC").
+		Limit(limit).Offset(offset).
+		Find(&transfers).Error
+
+	return transfers, total, err
+}
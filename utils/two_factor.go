@@ -0,0 +1,424 @@
+package utils
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha1"
+	"crypto/sha256"
+	"encoding/base32"
+	"encoding/binary"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math/big"
+	"net/url"
+	"strings"
+	"time"
+
+	"claude/config"
+	"claude/database"
+	"claude/models"
+
+	"gorm.io/gorm"
+)
+
+// TOTP参数（RFC 6238），与主流验证器应用的默认值一致
+const (
+	totpPeriod = 30
+	totpDigits = 6
+	totpSkew   = 1 // 允许前后各一个时间步的时钟偏差
+)
+
+// 恢复码数量和字符集（去掉了容易混淆的字符）
+const (
+	recoveryCodeCount    = 10
+	recoveryCodeAlphabet = "abcdefghjkmnpqrstuvwxyz23456789"
+)
+
+// 两步验证登录挑战有效期和最多尝试次数
+const (
+	twoFactorChallengeTTL         = 5 * time.Minute
+	twoFactorChallengeMaxAttempts = 5
+)
+
+var (
+	// ErrTwoFactorInvalidCode 两步验证码错误
+	ErrTwoFactorInvalidCode = errors.New("两步验证码错误")
+	// ErrTwoFactorChallengeExpired 登录挑战不存在或已过期
+	ErrTwoFactorChallengeExpired = errors.New("两步验证已过期，请重新登录")
+)
+
+// TwoFactorStatus 用户两步验证状态
+type TwoFactorStatus struct {
+	Enabled                bool       `json:"enabled"`
+	EnabledAt              *time.Time `json:"enabled_at"`
+	RecoveryCodesRemaining int64      `json:"recovery_codes_remaining"`
+	Required               bool       `json:"required"` // 管理员账户被要求启用两步验证
+}
+
+// TwoFactorSetup 开始绑定时返回给用户的密钥和 otpauth 链接（前端据此生成二维码）
+type TwoFactorSetup struct {
+	Secret     string `json:"secret"`
+	OtpauthURI string `json:"otpauth_uri"`
+}
+
+// twoFactorChallenge 密码或验证码校验通过后等待两步验证的登录
+type twoFactorChallenge struct {
+	UserID uint   `json:"user_id"`
+	Source string `json:"source"` // password, password_code（密码+邮箱验证码）, email_code, passkey, linux_do
+}
+
+// generateTOTPSecret 生成160位随机TOTP密钥
+func generateTOTPSecret() (string, error) {
+	secret := make([]byte, 20)
+	if _, err := rand.Read(secret); err != nil {
+		return "", err
+	}
+	return base32.StdEncoding.WithPadding(base32.NoPadding).EncodeToString(secret), nil
+}
+
+// totpCode 计算指定时间步的TOTP验证码
+func totpCode(secret string, step int64) (string, error) {
+	key, err := base32.StdEncoding.WithPadding(base32.NoPadding).DecodeString(strings.ToUpper(secret))
+	if err != nil {
+		return "", err
+	}
+
+	var counter [8]byte
+	binary.BigEndian.PutUint64(counter[:], uint64(step))
+	mac := hmac.New(sha1.New, key)
+	mac.Write(counter[:])
+	sum := mac.Sum(nil)
+
+	offset := sum[len(sum)-1] & 0x0f
+	value := binary.BigEndian.Uint32(sum[offset:offset+4]) & 0x7fffffff
+	return fmt.Sprintf("%0*d", totpDigits, value%1000000), nil
+}
+
+// matchTOTPCode 校验TOTP验证码，返回匹配的时间步，只接受大于 lastStep 的时间步以防重放
+func matchTOTPCode(secret, code string, lastStep int64) (int64, bool) {
+	code = strings.TrimSpace(code)
+	if len(code) != totpDigits {
+		return 0, false
+	}
+	current := time.Now().Unix() / totpPeriod
+	for step := current - totpSkew; step <= current+totpSkew; step++ {
+		if step <= lastStep {
+			continue
+		}
+		expected, err := totpCode(secret, step)
+		if err == nil && hmac.Equal([]byte(expected), []byte(code)) {
+			return step, true
+		}
+	}
+	return 0, false
+}
+
+// buildOtpauthURI 生成验证器应用可识别的 otpauth 链接
+func buildOtpauthURI(account, secret string) string {
+	issuer := config.AppConfig.AppName
+	values := url.Values{}
+	values.Set("secret", secret)
+	values.Set("issuer", issuer)
+	values.Set("algorithm", "SHA1")
+	values.Set("digits", fmt.Sprintf("%d", totpDigits))
+	values.Set("period", fmt.Sprintf("%d", totpPeriod))
+	label := url.PathEscape(issuer + ":" + account)
+	return "otpauth://totp/" + label + "?" + values.Encode()
+}
+
+// normalizeRecoveryCode 统一恢复码格式：忽略大小写、空格和连字符
+func normalizeRecoveryCode(code string) string {
+	code = strings.ToLower(strings.TrimSpace(code))
+	code = strings.ReplaceAll(code, "-", "")
+	return strings.ReplaceAll(code, " ", "")
+}
+
+// hashRecoveryCode 计算恢复码哈希
+func hashRecoveryCode(code string) string {
+	sum := sha256.Sum256([]byte(normalizeRecoveryCode(code)))
+	return hex.EncodeToString(sum[:])
+}
+
+// generateRecoveryCode 生成 xxxxx-xxxxx 格式的恢复码
+func generateRecoveryCode() (string, error) {
+	var builder strings.Builder
+	alphabetSize := big.NewInt(int64(len(recoveryCodeAlphabet)))
+	for i := 0; i < 10; i++ {
+		if i == 5 {
+			builder.WriteByte('-')
+		}
+		n, err := rand.Int(rand.Reader, alphabetSize)
+		if err != nil {
+			return "", err
+		}
+		builder.WriteByte(recoveryCodeAlphabet[n.Int64()])
+	}
+	return builder.String(), nil
+}
+
+// replaceRecoveryCodesTx 在事务中作废旧恢复码并生成新的一组，明文只在此时返回一次
+func replaceRecoveryCodesTx(tx *gorm.DB, userID uint) ([]string, error) {
+	if err := tx.Where("user_id = ?", userID).Delete(&models.TwoFactorRecoveryCode{}).Error; err != nil {
+		return nil, fmt.Errorf("删除旧恢复码失败: %v", err)
+	}
+
+	codes := make([]string, 0, recoveryCodeCount)
+	records := make([]models.TwoFactorRecoveryCode, 0, recoveryCodeCount)
+	for i := 0; i < recoveryCodeCount; i++ {
+		code, err := generateRecoveryCode()
+		if err != nil {
+			return nil, fmt.Errorf("生成恢复码失败: %v", err)
+		}
+		codes = append(codes, code)
+		records = append(records, models.TwoFactorRecoveryCode{UserID: userID, CodeHash: hashRecoveryCode(code)})
+	}
+	if err := tx.Create(&records).Error; err != nil {
+		return nil, fmt.Errorf("保存恢复码失败: %v", err)
+	}
+	return codes, nil
+}
+
+// getEnabledTwoFactor 获取已启用的两步验证配置，未启用时返回 nil
+func getEnabledTwoFactor(userID uint) *models.UserTwoFactor {
+	var twoFactor models.UserTwoFactor
+	if err := database.DB.Where("user_id = ? AND enabled = ?", userID, true).First(&twoFactor).Error; err != nil {
+		return nil
+	}
+	return &twoFactor
+}
+
+// IsTwoFactorEnabled 用户是否已启用两步验证
+func IsTwoFactorEnabled(userID uint) bool {
+	return getEnabledTwoFactor(userID) != nil
+}
+
+// IsTwoFactorRequiredForAdmins 是否要求管理员账户启用两步验证
+func IsTwoFactorRequiredForAdmins() bool {
+	var setting models.SystemConfig
+	if err := database.DB.Where("config_key = ?", "two_factor_required_for_admins").First(&setting).Error; err != nil {
+		return false
+	}
+	return setting.ConfigValue == "true"
+}
+
+// GetTwoFactorStatus 获取用户两步验证状态
+func GetTwoFactorStatus(user *models.User) *TwoFactorStatus {
+	status := &TwoFactorStatus{Required: user.IsAdmin && IsTwoFactorRequiredForAdmins()}
+	if twoFactor := getEnabledTwoFactor(user.ID); twoFactor != nil {
+		status.Enabled = true
+		status.EnabledAt = twoFactor.EnabledAt
+		database.DB.Model(&models.TwoFactorRecoveryCode{}).
+			Where("user_id = ? AND used_at IS NULL", user.ID).
+			Count(&status.RecoveryCodesRemaining)
+	}
+	return status
+}
+
+// BeginTwoFactorSetup 开始绑定两步验证：生成新密钥，用户使用验证器扫码后需调用 EnableTwoFactor 确认
+func BeginTwoFactorSetup(user *models.User) (*TwoFactorSetup, error) {
+	if IsTwoFactorEnabled(user.ID) {
+		return nil, fmt.Errorf("已启用两步验证，如需更换请先关闭")
+	}
+
+	secret, err := generateTOTPSecret()
+	if err != nil {
+		return nil, fmt.Errorf("生成密钥失败: %v", err)
+	}
+
+	var twoFactor models.UserTwoFactor
+	err = database.DB.Where("user_id = ?", user.ID).First(&twoFactor).Error
+	if err == gorm.ErrRecordNotFound {
+		twoFactor = models.UserTwoFactor{UserID: user.ID, Secret: secret}
+		err = database.DB.Create(&twoFactor).Error
+	} else if err == nil {
+		err = database.DB.Model(&twoFactor).Updates(map[string]interface{}{
+			"secret":         secret,
+			"last_used_step": 0,
+		}).Error
+	}
+	if err != nil {
+		return nil, fmt.Errorf("保存两步验证配置失败: %v", err)
+	}
+
+	return &TwoFactorSetup{
+		Secret:     secret,
+		OtpauthURI: buildOtpauthURI(user.Email, secret),
+	}, nil
+}
+
+// EnableTwoFactor 使用验证器生成的验证码确认绑定，启用两步验证并返回恢复码
+func EnableTwoFactor(userID uint, code string) ([]string, error) {
+	var codes []string
+	err := database.DB.Transaction(func(tx *gorm.DB) error {
+		var twoFactor models.UserTwoFactor
+		if err := tx.Where("user_id = ?", userID).First(&twoFactor).Error; err != nil {
+			return fmt.Errorf("请先获取两步验证密钥")
+		}
+		if twoFactor.Enabled {
+			return fmt.Errorf("已启用两步验证")
+		}
+
+		step, ok := matchTOTPCode(twoFactor.Secret, code, twoFactor.LastUsedStep)
+		if !ok {
+			return ErrTwoFactorInvalidCode
+		}
+
+		now := time.Now()
+		if err := tx.Model(&twoFactor).Updates(map[string]interface{}{
+			"enabled":        true,
+			"enabled_at":     now,
+			"last_used_step": step,
+		}).Error; err != nil {
+			return fmt.Errorf("启用两步验证失败: %v", err)
+		}
+
+		var err error
+		codes, err = replaceRecoveryCodesTx(tx, userID)
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+	return codes, nil
+}
+
+// VerifyTwoFactorCode 校验两步验证码，支持验证器验证码和恢复码，恢复码使用后作废
+func VerifyTwoFactorCode(userID uint, code string) error {
+	twoFactor := getEnabledTwoFactor(userID)
+	if twoFactor == nil {
+		return fmt.Errorf("未启用两步验证")
+	}
+
+	if step, ok := matchTOTPCode(twoFactor.Secret, code, twoFactor.LastUsedStep); ok {
+		// 条件更新保证同一个验证码并发提交时只有一次通过
+		result := database.DB.Model(&models.UserTwoFactor{}).
+			Where("id = ? AND last_used_step < ?", twoFactor.ID, step).
+			Update("last_used_step", step)
+		if result.Error == nil && result.RowsAffected == 1 {
+			return nil
+		}
+		return ErrTwoFactorInvalidCode
+	}
+
+	result := database.DB.Model(&models.TwoFactorRecoveryCode{}).
+		Where("user_id = ? AND code_hash = ? AND used_at IS NULL", userID, hashRecoveryCode(code)).
+		Update("used_at", time.Now())
+	if result.Error == nil && result.RowsAffected == 1 {
+		return nil
+	}
+	return ErrTwoFactorInvalidCode
+}
+
+// DisableTwoFactor 验证后关闭两步验证并删除恢复码
+func DisableTwoFactor(userID uint, code string) error {
+	if err := VerifyTwoFactorCode(userID, code); err != nil {
+		return err
+	}
+	return ResetTwoFactor(userID)
+}
+
+// RegenerateRecoveryCodes 验证后重新生成恢复码，旧恢复码全部作废
+func RegenerateRecoveryCodes(userID uint, code string) ([]string, error) {
+	if err := VerifyTwoFactorCode(userID, code); err != nil {
+		return nil, err
+	}
+	var codes []string
+	err := database.DB.Transaction(func(tx *gorm.DB) error {
+		var err error
+		codes, err = replaceRecoveryCodesTx(tx, userID)
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+	return codes, nil
+}
+
+// ResetTwoFactor 删除用户的两步验证配置和恢复码（关闭两步验证或管理员重置）
+func ResetTwoFactor(userID uint) error {
+	return database.DB.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Where("user_id = ?", userID).Delete(&models.UserTwoFactor{}).Error; err != nil {
+			return fmt.Errorf("删除两步验证配置失败: %v", err)
+		}
+		if err := tx.Where("user_id = ?", userID).Delete(&models.TwoFactorRecoveryCode{}).Error; err != nil {
+			return fmt.Errorf("删除恢复码失败: %v", err)
+		}
+		return nil
+	})
+}
+
+// CreateTwoFactorChallenge 第一步登录校验通过后创建短期登录挑战，返回挑战令牌
+func CreateTwoFactorChallenge(userID uint, source string) (string, error) {
+	token := make([]byte, 32)
+	if _, err := rand.Read(token); err != nil {
+		return "", fmt.Errorf("生成挑战令牌失败: %v", err)
+	}
+	challengeToken := hex.EncodeToString(token)
+
+	data, _ := json.Marshal(twoFactorChallenge{UserID: userID, Source: source})
+	ctx := context.Background()
+	if err := database.TokenRedisClient.Set(ctx, "two_factor_challenge:"+challengeToken, data, twoFactorChallengeTTL).Err(); err != nil {
+		return "", fmt.Errorf("保存登录挑战失败: %v", err)
+	}
+	return challengeToken, nil
+}
+
+// getTwoFactorChallenge 读取登录挑战，不存在或已过期时返回 ErrTwoFactorChallengeExpired
+func getTwoFactorChallenge(ctx context.Context, challengeToken string) (*twoFactorChallenge, error) {
+	data, err := database.TokenRedisClient.Get(ctx, "two_factor_challenge:"+challengeToken).Result()
+	if err != nil {
+		return nil, ErrTwoFactorChallengeExpired
+	}
+	var challenge twoFactorChallenge
+	if err := json.Unmarshal([]byte(data), &challenge); err != nil {
+		return nil, ErrTwoFactorChallengeExpired
+	}
+	return &challenge, nil
+}
+
+// GetTwoFactorChallengeUserID 获取登录挑战所属的用户ID
+func GetTwoFactorChallengeUserID(challengeToken string) (uint, error) {
+	challenge, err := getTwoFactorChallenge(context.Background(), challengeToken)
+	if err != nil {
+		return 0, err
+	}
+	return challenge.UserID, nil
+}
+
+// CompleteTwoFactorChallenge 校验登录挑战的两步验证码，通过后挑战作废并返回登录用户和第一步登录方式
+// 错误次数达到上限后挑战作废，需要重新登录
+func CompleteTwoFactorChallenge(challengeToken, code string) (*models.User, string, error) {
+	ctx := context.Background()
+	key := "two_factor_challenge:" + challengeToken
+	attemptsKey := "two_factor_challenge_attempts:" + challengeToken
+
+	challenge, err := getTwoFactorChallenge(ctx, challengeToken)
+	if err != nil {
+		return nil, "", err
+	}
+
+	if err := VerifyTwoFactorCode(challenge.UserID, code); err != nil {
+		attempts, _ := database.TokenRedisClient.Incr(ctx, attemptsKey).Result()
+		database.TokenRedisClient.Expire(ctx, attemptsKey, twoFactorChallengeTTL)
+		if attempts >= twoFactorChallengeMaxAttempts {
+			database.TokenRedisClient.Del(ctx, key, attemptsKey)
+			return nil, "", ErrTwoFactorChallengeExpired
+		}
+		return nil, "", err
+	}
+
+	// 挑战只能使用一次
+	if deleted, _ := database.TokenRedisClient.Del(ctx, key).Result(); deleted == 0 {
+		return nil, "", ErrTwoFactorChallengeExpired
+	}
+	database.TokenRedisClient.Del(ctx, attemptsKey)
+
+	var user models.User
+	if err := database.DB.Where("id = ?", challenge.UserID).First(&user).Error; err != nil {
+		return nil, "", fmt.Errorf("用户不存在")
+	}
+	return &user, challenge.Source, nil
+}
@@ -9,6 +9,7 @@ import (
 	"claude/models"
 
 	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
 )
 
 // GetUserWallet 获取用户钱包信息
@@ -52,6 +53,22 @@ func GetOrCreateUserWallet(userID uint) (*models.UserWallet, error) {
 	return &wallet, nil
 }
 
+// ensureUserWalletTx 在事务中确保用户钱包存在，钱包以用户ID为主键，并发创建时忽略冲突
+func ensureUserWalletTx(tx *gorm.DB, userID uint) error {
+	now := time.Now()
+	wallet := models.UserWallet{
+		UserID:          userID,
+		WalletExpiresAt: now,
+		Status:          "expired",
+		CreatedAt:       now,
+		UpdatedAt:       now,
+	}
+	if err := tx.Clauses(clause.OnConflict{DoNothing: true}).Create(&wallet).Error; err != nil {
+		return fmt.Errorf("创建用户钱包失败: %v", err)
+	}
+	return nil
+}
+
 // UpdateWalletPoints 更新钱包积分（增加）
 func UpdateWalletPoints(userID uint, points int64) error {
 	if points <= 0 {
@@ -251,11 +268,17 @@ func UpdateWalletStatus(userID uint) error {
 		return err
 	}
 
-	var newStatus string
-	if wallet.WalletExpiresAt.After(time.Now()) {
-		newStatus = "active"
-	} else {
-		newStatus = "expired"
+	now := time.Now()
+	graceDays := GetWalletGracePeriodDays()
+	newStatus := walletStatusAt(wallet.WalletExpiresAt, now, graceDays)
+
+	// 到期后的状态切换与定时扫描一致，记录过期快照；已过期的钱包不会回到宽限期
+	if newStatus != "active" {
+		if wallet.Status == newStatus || wallet.Status == "expired" {
+			return nil
+		}
+		_, err := transitionWalletStatus(wallet, newStatus, now, graceDays)
+		return err
 	}
 
 	if wallet.Status != newStatus {
@@ -296,16 +319,16 @@ func GetTokenThresholdConfig() (int64, int64, error) {
 	return threshold, pointsPerThreshold, nil
 }
 
-// AccumulateTokensAndDeduct 累计tokens并在达到阈值时扣费
-func AccumulateTokensAndDeduct(userID uint, weightedTokens int64) error {
+// AccumulateTokensAndDeduct 累计tokens并在达到阈值时扣费，返回本次实际扣除的积分
+func AccumulateTokensAndDeduct(userID uint, weightedTokens int64) (int64, error) {
 	if weightedTokens <= 0 {
-		return nil
+		return 0, nil
 	}
 
 	// 获取阈值配置
 	threshold, pointsPerThreshold, err := GetTokenThresholdConfig()
 	if err != nil {
-		return err
+		return 0, err
 	}
 
 	// 开始事务
@@ -334,14 +357,15 @@ func AccumulateTokensAndDeduct(userID uint, weightedTokens int64) error {
 		}
 		if err := tx.Create(&wallet).Error; err != nil {
 			tx.Rollback()
-			return fmt.Errorf("创建用户钱包失败: %v", err)
+			return 0, fmt.Errorf("创建用户钱包失败: %v", err)
 		}
 	} else if err != nil {
 		tx.Rollback()
-		return fmt.Errorf("获取用户钱包失败: %v", err)
+		return 0, fmt.Errorf("获取用户钱包失败: %v", err)
 	}
 
 	// 累计tokens
+	var deductedPoints int64
 	newAccumulatedTokens := wallet.AccumulatedTokens + weightedTokens
 
 	// 检查是否达到扣费阈值
@@ -353,13 +377,13 @@ func AccumulateTokensAndDeduct(userID uint, weightedTokens int64) error {
 		// 检查余额是否足够
 		if wallet.AvailablePoints < totalPointsToDeduct {
 			tx.Rollback()
-			return fmt.Errorf("积分余额不足，需要 %d 积分，可用 %d 积分", totalPointsToDeduct, wallet.AvailablePoints)
+			return 0, fmt.Errorf("积分余额不足，需要 %d 积分，可用 %d 积分", totalPointsToDeduct, wallet.AvailablePoints)
 		}
 
 		// 检查每日限制
 		if err := CheckDailyLimit(userID, totalPointsToDeduct); err != nil {
 			tx.Rollback()
-			return err
+			return 0, err
 		}
 
 		// 扣除积分
@@ -373,14 +397,15 @@ func AccumulateTokensAndDeduct(userID uint, weightedTokens int64) error {
 			}).Error
 		if err != nil {
 			tx.Rollback()
-			return fmt.Errorf("扣除积分失败: %v", err)
+			return 0, fmt.Errorf("扣除积分失败: %v", err)
 		}
 
 		// 更新每日使用记录
 		if err := UpdateDailyUsage(userID, totalPointsToDeduct); err != nil {
 			tx.Rollback()
-			return err
+			return 0, err
 		}
+		deductedPoints = totalPointsToDeduct
 
 	} else {
 		// 未达到阈值，只累计tokens
@@ -392,10 +417,13 @@ func AccumulateTokensAndDeduct(userID uint, weightedTokens int64) error {
 			}).Error
 		if err != nil {
 			tx.Rollback()
-			return fmt.Errorf("累计tokens失败: %v", err)
+			return 0, fmt.Errorf("累计tokens失败: %v", err)
 		}
 	}
 
 	// 提交事务
-	return tx.Commit().Error
+	if err := tx.Commit().Error; err != nil {
+		return 0, err
+	}
+	return deductedPoints, nil
 }
@@ -0,0 +1,162 @@
+package utils
+
+import (
+	"fmt"
+	"log"
+	"time"
+
+	"claude/database"
+	"claude/models"
+
+	"gorm.io/gorm"
+)
+
+// 每批处理的钱包数量
+const walletSweepBatchSize = 200
+
+// WalletSweepResult 钱包过期扫描结果
+type WalletSweepResult struct {
+	Reactivated  int64 `json:"reactivated"`   // 状态滞后、实际仍在有效期内而恢复为 active 的钱包
+	EnteredGrace int64 `json:"entered_grace"` // 进入宽限期的钱包
+	Expired      int64 `json:"expired"`       // 过期的钱包
+}
+
+// GetWalletGracePeriodDays 获取钱包到期后的宽限期天数
+func GetWalletGracePeriodDays() int {
+	return int(getTransferIntConfig("wallet_grace_period_days", 0))
+}
+
+// isWalletExpiryNotifyEnabled 是否在钱包进入宽限期或过期时通知用户
+func isWalletExpiryNotifyEnabled() bool {
+	var cfg models.SystemConfig
+	if err := database.DB.Where("config_key = ?", "wallet_expiry_notify_enabled").First(&cfg).Error; err != nil {
+		return true
+	}
+	return cfg.ConfigValue == "true"
+}
+
+// walletStatusAt 根据过期时间和宽限期计算钱包在指定时间应处的状态
+func walletStatusAt(expiresAt, now time.Time, graceDays int) string {
+	if expiresAt.After(now) {
+		return "active"
+	}
+	if graceDays > 0 && expiresAt.AddDate(0, 0, graceDays).After(now) {
+		return "grace"
+	}
+	return "expired"
+}
+
+// transitionWalletStatus 将钱包切换到到期后的状态并记录快照，返回是否发生了切换
+// 使用条件更新，多实例同时扫描或与兑换并发时只有一方生效
+func transitionWalletStatus(wallet *models.UserWallet, newStatus string, now time.Time, graceDays int) (*models.WalletExpiryRecord, error) {
+	var record *models.WalletExpiryRecord
+	err := database.DB.Transaction(func(tx *gorm.DB) error {
+		result := tx.Model(&models.UserWallet{}).
+			Where("user_id = ? AND status = ? AND wallet_expires_at <= ?", wallet.UserID, wallet.Status, now).
+			Updates(map[string]interface{}{
+				"status":     newStatus,
+				"updated_at": now,
+			})
+		if result.Error != nil {
+			return result.Error
+		}
+		if result.RowsAffected == 0 {
+			return nil
+		}
+
+		record = &models.WalletExpiryRecord{
+			UserID:          wallet.UserID,
+			Event:           newStatus,
+			PreviousStatus:  wallet.Status,
+			AvailablePoints: wallet.AvailablePoints,
+			TotalPoints:     wallet.TotalPoints,
+			UsedPoints:      wallet.UsedPoints,
+			WalletExpiresAt: wallet.WalletExpiresAt,
+		}
+		if graceDays > 0 {
+			graceEndsAt := wallet.WalletExpiresAt.AddDate(0, 0, graceDays)
+			record.GraceEndsAt = &graceEndsAt
+		}
+		return tx.Create(record).Error
+	})
+	if err != nil {
+		return nil, fmt.Errorf("更新钱包状态失败: user_id=%d, %v", wallet.UserID, err)
+	}
+	return record, nil
+}
+
+// notifyWalletExpiry 邮件通知用户钱包进入宽限期或已过期
+func notifyWalletExpiry(record *models.WalletExpiryRecord) {
+	var user models.User
+	if err := database.DB.Where("id = ?", record.UserID).First(&user).Error; err != nil || user.Email == "" {
+		return
+	}
+	if err := SendWalletExpiryEmail(user.Email, record); err != nil {
+		log.Printf("❌ 钱包过期通知发送失败: user_id=%d, error=%v", record.UserID, err)
+		return
+	}
+	database.DB.Model(record).Update("notified", true)
+}
+
+// SweepExpiredWallets 扫描到期钱包：进入宽限期、宽限期结束后过期，并修正状态滞后的钱包
+func SweepExpiredWallets() (*WalletSweepResult, error) {
+	now := time.Now()
+	graceDays := GetWalletGracePeriodDays()
+	notify := isWalletExpiryNotifyEnabled()
+	result := &WalletSweepResult{}
+
+	// 有效期已被延长但状态未恢复的钱包
+	reactivated := database.DB.Model(&models.UserWallet{}).
+		Where("status = ? AND wallet_expires_at > ?", "grace", now).
+		Updates(map[string]interface{}{
+			"status":     "active",
+			"updated_at": now,
+		})
+	if reactivated.Error != nil {
+		return nil, fmt.Errorf("恢复钱包状态失败: %v", reactivated.Error)
+	}
+	result.Reactivated = reactivated.RowsAffected
+
+	// 宽限期关闭后，仍处于宽限期的钱包也直接过期
+	for _, status := range []string{"active", "grace"} {
+		lastUserID := uint(0)
+		for {
+			var wallets []models.UserWallet
+			if err := database.DB.Where("status = ? AND wallet_expires_at <= ? AND user_id > ?", status, now, lastUserID).
+				Order("user_id").Limit(walletSweepBatchSize).Find(&wallets).Error; err != nil {
+				return result, fmt.Errorf("查询到期钱包失败: %v", err)
+			}
+			if len(wallets) == 0 {
+				break
+			}
+			lastUserID = wallets[len(wallets)-1].UserID
+
+			for i := range wallets {
+				newStatus := walletStatusAt(wallets[i].WalletExpiresAt, now, graceDays)
+				if newStatus == wallets[i].Status {
+					continue
+				}
+
+				record, err := transitionWalletStatus(&wallets[i], newStatus, now, graceDays)
+				if err != nil {
+					log.Printf("❌ %v", err)
+					continue
+				}
+				if record == nil {
+					continue
+				}
+
+				if newStatus == "grace" {
+					result.EnteredGrace++
+				} else {
+					result.Expired++
+				}
+				if notify {
+					notifyWalletExpiry(record)
+				}
+			}
+		}
+	}
+
+	return result, nil
+}